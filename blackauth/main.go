@@ -67,11 +67,16 @@ func loginPlayerHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func loginOrganizerHandler(w http.ResponseWriter, r *http.Request) {
+	// idを指定すると、そのテナントの主催者アカウントとしてログインする
+	id, err := getNameParam(r)
+	if err != nil {
+		id = "organizer"
+	}
 	tenant := getTenantName(r.Host)
 
 	token := jwt.New()
 	token.Set(jwt.IssuerKey, "isuports")
-	token.Set(jwt.SubjectKey, "organizer")
+	token.Set(jwt.SubjectKey, id)
 	token.Set(jwt.AudienceKey, tenant)
 	token.Set("role", "organizer")
 	token.Set(jwt.ExpirationKey, time.Now().Add(24*time.Hour).Unix())
@@ -0,0 +1,207 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// 管理用DBをMySQLの代わりにSQLiteのファイルで動かすモード
+// admin_db.driver (環境変数 ISUCON_DB_DRIVER) に sqlite3 を設定すると使う
+// MySQLを用意できない結合テストやローカルでの動作確認向けで、本番では使わない
+// アプリケーションのクエリはMySQLの方言のまま書き、SQLiteで動かない構文だけをドライバで書き換える
+
+const (
+	AdminDBDriverMySQL  = "mysql"
+	AdminDBDriverSQLite = "sqlite3"
+
+	adminDBSchemaFilePath = "../sql/admin/10_schema.sql"
+
+	adminSQLiteBaseDriverName = "sqlite3-admin"
+)
+
+func init() {
+	sql.Register(adminSQLiteBaseDriverName, &mysqlDialectDriver{base: &sqlite3.SQLiteDriver{}})
+}
+
+// setupAppで登録する(クエリログやトレースのフックを付けたドライバの名前になる)
+var adminSQLiteDriverName = adminSQLiteBaseDriverName
+
+// MySQLの方言をSQLiteで実行できるように書き換える
+var mysqlDialectReplacer = strings.NewReplacer(
+	"INSERT IGNORE", "INSERT OR IGNORE",
+	" DIV ", " / ",
+)
+
+type mysqlDialectDriver struct {
+	base driver.Driver
+}
+
+func (d *mysqlDialectDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &mysqlDialectConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type mysqlDialectConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *mysqlDialectConn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(mysqlDialectReplacer.Replace(query))
+}
+
+func (c *mysqlDialectConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, mysqlDialectReplacer.Replace(query))
+}
+
+func (c *mysqlDialectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, mysqlDialectReplacer.Replace(query), args)
+}
+
+func (c *mysqlDialectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.SQLiteConn.QueryContext(ctx, mysqlDialectReplacer.Replace(query), args)
+}
+
+var (
+	autoIncrementColumnRegexp = regexp.MustCompile("(?i)^(`\\w+`)\\s+BIGINT\\s+NOT\\s+NULL\\s+AUTO_INCREMENT$")
+	primaryKeyRegexp          = regexp.MustCompile("(?i)^PRIMARY\\s+KEY\\s*\\(")
+	uniqueKeyRegexp           = regexp.MustCompile("(?i)^UNIQUE\\s+KEY\\s+`\\w+`\\s*(\\(.*\\))$")
+	indexRegexp               = regexp.MustCompile("(?i)^INDEX\\s+`(\\w+)`\\s*(\\(.*\\))$")
+	createTableRegexp         = regexp.MustCompile("(?is)CREATE\\s+TABLE\\s+`(\\w+)`\\s*\\((.*)\\)[^)]*$")
+)
+
+// MySQL向けのCREATE TABLEをSQLiteで実行できる形に変換する
+// AUTO_INCREMENTの主キーはINTEGER PRIMARY KEY AUTOINCREMENTにし、テーブル内のINDEXはCREATE INDEXに分ける
+func translateAdminSchemaToSQLite(schema string) ([]string, error) {
+	stmts := []string{}
+	for _, stmt := range strings.Split(schema, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" || strings.HasPrefix(strings.ToUpper(stmt), "USE ") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(stmt), "DROP ") {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		m := createTableRegexp.FindStringSubmatch(stmt)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported statement: %s", stmt)
+		}
+		table := m[1]
+		defs := []string{}
+		indexes := []string{}
+		hasAutoIncrement := false
+		for _, line := range strings.Split(m[2], "\n") {
+			line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+			if line == "" {
+				continue
+			}
+			if am := autoIncrementColumnRegexp.FindStringSubmatch(line); am != nil {
+				defs = append(defs, am[1]+" INTEGER PRIMARY KEY AUTOINCREMENT")
+				hasAutoIncrement = true
+				continue
+			}
+			if um := uniqueKeyRegexp.FindStringSubmatch(line); um != nil {
+				defs = append(defs, "UNIQUE "+um[1])
+				continue
+			}
+			if im := indexRegexp.FindStringSubmatch(line); im != nil {
+				indexes = append(indexes, fmt.Sprintf("CREATE INDEX `%s_%s` ON `%s` %s", table, im[1], table, im[2]))
+				continue
+			}
+			if hasAutoIncrement && primaryKeyRegexp.MatchString(line) {
+				continue
+			}
+			defs = append(defs, line)
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE `%s` (\n  %s\n)", table, strings.Join(defs, ",\n  ")))
+		stmts = append(stmts, indexes...)
+	}
+	return stmts, nil
+}
+
+// SQLiteの管理用DBに接続する
+// まだテーブルがなければスキーマを作る
+func connectAdminSQLiteDB() (*sqlx.DB, error) {
+	// 複数のリクエストから同時に書き込むので、ロックを待つようにする
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate", appConfig.AdminDB.File)
+	db, err := sqlx.Open(adminSQLiteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error sqlx.Open: %s, %w", dsn, err)
+	}
+	var n int
+	if err := db.Get(&n, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'tenant'"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error Select sqlite_master: %w", err)
+	}
+	if n == 0 {
+		if err := initializeAdminSQLiteSchema(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// /initialize でSQLiteの管理用DBとテナントDBを空にする
+func resetAdminSQLiteDB() error {
+	if err := initializeAdminSQLiteSchema(adminDB); err != nil {
+		return err
+	}
+	dbs, err := filepath.Glob(filepath.Join(appConfig.TenantDB.Dir, "*.db"))
+	if err != nil {
+		return fmt.Errorf("error filepath.Glob: %w", err)
+	}
+	for _, p := range dbs {
+		if err := os.Remove(p); err != nil {
+			return fmt.Errorf("error os.Remove: %s, %w", p, err)
+		}
+	}
+	return nil
+}
+
+// SQLiteの管理用DBにスキーマを作る
+// 既存のテーブルは作り直す
+func initializeAdminSQLiteSchema(db *sqlx.DB) error {
+	b, err := os.ReadFile(adminDBSchemaFilePath)
+	if err != nil {
+		return fmt.Errorf("error os.ReadFile: %s, %w", adminDBSchemaFilePath, err)
+	}
+	stmts, err := translateAdminSchemaToSQLite(string(b))
+	if err != nil {
+		return fmt.Errorf("error translateAdminSchemaToSQLite: %w", err)
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("error Exec: %s, %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// 一意制約に違反したエラーか
+// MySQLのduplicate entryと、SQLiteの管理用DBでのUNIQUE制約違反の両方を扱う
+func isDuplicateEntryError(err error) bool {
+	var merr *mysql.MySQLError
+	if errors.As(err, &merr) {
+		return merr.Number == 1062
+	}
+	var serr sqlite3.Error
+	if errors.As(err, &serr) {
+		return serr.ExtendedCode == sqlite3.ErrConstraintUnique || serr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
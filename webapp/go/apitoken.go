@@ -0,0 +1,313 @@
+package isuports
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 主催者向けAPIトークンのスコープ
+const (
+	ScopePlayersRead       = "players:read"
+	ScopePlayersWrite      = "players:write"
+	ScopeCompetitionsRead  = "competitions:read"
+	ScopeCompetitionsWrite = "competitions:write"
+	ScopeScoresWrite       = "scores:write"
+	ScopeBillingRead       = "billing:read"
+	ScopeWebhooksWrite     = "webhooks:write"
+
+	apiTokenPrefix = "isuports_"
+)
+
+var allAPITokenScopes = []string{
+	ScopePlayersRead,
+	ScopePlayersWrite,
+	ScopeCompetitionsRead,
+	ScopeCompetitionsWrite,
+	ScopeScoresWrite,
+	ScopeBillingRead,
+	ScopeWebhooksWrite,
+}
+
+type OrganizerAPITokenRow struct {
+	ID        int64         `db:"id"`
+	TenantID  int64         `db:"tenant_id"`
+	Name      string        `db:"name"`
+	TokenHash string        `db:"token_hash"`
+	Scopes    string        `db:"scopes"` // スペース区切り
+	CreatedAt int64         `db:"created_at"`
+	RevokedAt sql.NullInt64 `db:"revoked_at"`
+}
+
+// APIトークンは平文では保存せずハッシュ値で照合する
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIトークンを生成する
+func generateAPIToken() (string, error) {
+	return generateRandomToken(apiTokenPrefix)
+}
+
+// prefixに続けて32バイトの乱数を16進数で並べたトークンを生成する
+func generateRandomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error rand.Read: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Authorization: Bearer ヘッダのAPIトークンからViewerを作る
+func parseAPITokenViewer(c echo.Context, token string) (*Viewer, error) {
+	ctx := requestContext(c)
+	var t OrganizerAPITokenRow
+	if err := adminDB.GetContext(
+		ctx,
+		&t,
+		"SELECT * FROM organizer_api_token WHERE token_hash = ? AND revoked_at IS NULL",
+		hashAPIToken(token),
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid api token")
+		}
+		return nil, fmt.Errorf("error Select organizer_api_token: %w", err)
+	}
+
+	tenant, err := retrieveTenantRowFromHeader(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "tenant not found")
+		}
+		return nil, fmt.Errorf("error retrieveTenantRowFromHeader at parseAPITokenViewer: %w", err)
+	}
+	// JWTのaudと同様に、トークンを発行したテナント以外では使えない
+	if tenant.ID != t.TenantID {
+		return nil, echo.NewHTTPError(
+			http.StatusUnauthorized,
+			fmt.Sprintf("invalid api token: tenant is not match with %s", c.Request().Host),
+		)
+	}
+
+	return &Viewer{
+		role:       RoleOrganizer,
+		playerID:   fmt.Sprintf("api_token:%d", t.ID),
+		tenantName: tenant.Name,
+		tenantID:   tenant.ID,
+		apiTokenID: t.ID,
+		scopes:     strings.Fields(t.Scopes),
+	}, nil
+}
+
+// APIトークンのスコープを持っているか
+// APIトークン以外(JWT)でのアクセスは全てのスコープを持っているとみなす
+func (v *Viewer) hasScope(scope string) bool {
+	if v.apiTokenID == 0 {
+		return true
+	}
+	for _, s := range v.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// 主催者向けAPIの認可
+// permissionは主催者アカウントに必要な権限 空文字列なら閲覧のみのAPIで、どのアカウントでも行える organizer.go を参照
+func authorizeOrganizer(v *Viewer, scope, permission string) error {
+	if v.role != RoleOrganizer {
+		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if !v.hasScope(scope) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("scope %s required", scope))
+	}
+	if permission != "" && !v.hasPermission(permission) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("permission %s required", permission))
+	}
+	return nil
+}
+
+type APITokenDetail struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"created_at"`
+	RevokedAt *int64   `json:"revoked_at"`
+}
+
+func apiTokenDetail(t OrganizerAPITokenRow) APITokenDetail {
+	d := APITokenDetail{
+		ID:        strconv.FormatInt(t.ID, 10),
+		Name:      t.Name,
+		Scopes:    strings.Fields(t.Scopes),
+		CreatedAt: t.CreatedAt,
+	}
+	if t.RevokedAt.Valid {
+		d.RevokedAt = &t.RevokedAt.Int64
+	}
+	return d
+}
+
+type APITokensAddHandlerResult struct {
+	APIToken APITokenDetail `json:"api_token"`
+	Token    string         `json:"token"` // 作成時にのみ返す
+}
+
+type APITokensHandlerResult struct {
+	APITokens []APITokenDetail `json:"api_tokens"`
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/api_tokens/add
+// APIトークンを発行する
+func apiTokensAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	name := c.FormValue("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name required")
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	scopeSet := map[string]struct{}{}
+	for _, s := range params["scopes[]"] {
+		valid := false
+		for _, as := range allAPITokenScopes {
+			if s == as {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid scope: %s", s))
+		}
+		scopeSet[s] = struct{}{}
+	}
+	if len(scopeSet) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "scopes[] required")
+	}
+	scopes := make([]string, 0, len(scopeSet))
+	for s := range scopeSet {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+
+	token, err := generateAPIToken()
+	if err != nil {
+		return fmt.Errorf("error generateAPIToken: %w", err)
+	}
+	now := time.Now().Unix()
+	t := OrganizerAPITokenRow{
+		TenantID:  v.tenantID,
+		Name:      name,
+		TokenHash: hashAPIToken(token),
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: now,
+	}
+	res, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO organizer_api_token (tenant_id, name, token_hash, scopes, created_at, revoked_at) VALUES (:tenant_id, :name, :token_hash, :scopes, :created_at, :revoked_at)",
+		t,
+	)
+	if err != nil {
+		return fmt.Errorf("error Insert organizer_api_token: tenantID=%d, name=%s, %w", v.tenantID, name, err)
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("error get LastInsertId: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: APITokensAddHandlerResult{
+			APIToken: apiTokenDetail(t),
+			Token:    token,
+		},
+	})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/api_tokens
+// APIトークンの一覧を返す
+func apiTokensHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	ts := []OrganizerAPITokenRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&ts,
+		"SELECT * FROM organizer_api_token WHERE tenant_id = ? ORDER BY id DESC",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select organizer_api_token: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]APITokenDetail, 0, len(ts))
+	for _, t := range ts {
+		ds = append(ds, apiTokenDetail(t))
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   APITokensHandlerResult{APITokens: ds},
+	})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/api_token/:token_id/revoke
+// APIトークンを無効にする
+func apiTokenRevokeHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	tokenID, err := strconv.ParseInt(c.Param("token_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid token_id")
+	}
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE organizer_api_token SET revoked_at = ? WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL",
+		now, tokenID, v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Update organizer_api_token: id=%d, revokedAt=%d, %w", tokenID, now, err)
+	}
+	var t OrganizerAPITokenRow
+	if err := adminDB.GetContext(
+		ctx,
+		&t,
+		"SELECT * FROM organizer_api_token WHERE id = ? AND tenant_id = ?",
+		tokenID, v.tenantID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "api token not found")
+		}
+		return fmt.Errorf("error Select organizer_api_token: id=%d, %w", tokenID, err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   APITokensHandlerResult{APITokens: []APITokenDetail{apiTokenDetail(t)}},
+	})
+}
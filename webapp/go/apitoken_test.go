@@ -0,0 +1,104 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestAPITokens(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+
+	added, err := org.APITokensAdd(ctx, &client.APITokensAddParams{Name: "ci", Scopes: []string{ScopePlayersRead}})
+	if err != nil {
+		t.Fatalf("error APITokensAdd: %s", err)
+	}
+	tokens, err := org.APITokens(ctx)
+	if err != nil {
+		t.Fatalf("error APITokens: %s", err)
+	}
+	if len(tokens.APITokens) != 1 || tokens.APITokens[0].ID != added.APIToken.ID {
+		t.Fatalf("unexpected tokens: %+v", tokens.APITokens)
+	}
+
+	bearer := newTestClient(tenantHost(tenantName), "")
+	bearer.Header.Set("Authorization", "Bearer "+added.Token)
+	if _, err := bearer.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList with api token: %s", err)
+	}
+	// スコープにない操作はできない
+	_, err = bearer.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"alice"}})
+	assertStatus(t, err, http.StatusForbidden)
+	// APIトークンでAPIトークンを管理することはできない
+	_, err = bearer.APITokens(ctx)
+	assertStatus(t, err, http.StatusForbidden)
+
+	tokenID, err := strconv.ParseInt(added.APIToken.ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	revoked, err := org.APITokenRevoke(ctx, &client.APITokenRevokeParams{TokenID: tokenID})
+	if err != nil {
+		t.Fatalf("error APITokenRevoke: %s", err)
+	}
+	if len(revoked.APITokens) != 1 || revoked.APITokens[0].RevokedAt == nil {
+		t.Fatalf("unexpected tokens: %+v", revoked.APITokens)
+	}
+	_, err = bearer.PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+}
+
+func TestGenerateAPIToken(t *testing.T) {
+	a, err := generateAPIToken()
+	if err != nil {
+		t.Fatalf("error generateAPIToken: %s", err)
+	}
+	b, err := generateAPIToken()
+	if err != nil {
+		t.Fatalf("error generateAPIToken: %s", err)
+	}
+	if !strings.HasPrefix(a, apiTokenPrefix) || len(a) != len(apiTokenPrefix)+64 || a == b {
+		t.Fatalf("unexpected tokens: %s, %s", a, b)
+	}
+	// 保存するのはハッシュ値のみ
+	if h := hashAPIToken(a); len(h) != 64 || h != hashAPIToken(a) || h == hashAPIToken(b) || strings.Contains(h, a) {
+		t.Fatalf("unexpected hash: %s", h)
+	}
+}
+
+func TestViewerHasScope(t *testing.T) {
+	// JWTでのアクセスは全てのスコープを持っている
+	jwt := &Viewer{role: RoleOrganizer}
+	for _, s := range allAPITokenScopes {
+		if !jwt.hasScope(s) {
+			t.Errorf("jwt viewer must have scope %s", s)
+		}
+	}
+	token := &Viewer{role: RoleOrganizer, apiTokenID: 1, scopes: []string{ScopePlayersRead, ScopeScoresWrite}}
+	for s, want := range map[string]bool{
+		ScopePlayersRead:       true,
+		ScopeScoresWrite:       true,
+		ScopePlayersWrite:      false,
+		ScopeCompetitionsWrite: false,
+		ScopeBillingRead:       false,
+	} {
+		if got := token.hasScope(s); got != want {
+			t.Errorf("hasScope(%s) = %t, want %t", s, got, want)
+		}
+	}
+
+	d := apiTokenDetail(OrganizerAPITokenRow{
+		ID: 3, Name: "ci", Scopes: "players:read scores:write", CreatedAt: 100,
+		RevokedAt: sql.NullInt64{Int64: 200, Valid: true},
+	})
+	if d.ID != "3" || len(d.Scopes) != 2 || d.RevokedAt == nil || *d.RevokedAt != 200 {
+		t.Fatalf("unexpected apiTokenDetail: %+v", d)
+	}
+}
@@ -0,0 +1,76 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// テナントごとの課金計算を並列に行う
+// 同時に開くテナントDBの数と、1テナントあたりの計算時間の上限を設定できる
+type tenantBillingPool struct {
+	concurrency   int
+	tenantTimeout time.Duration
+}
+
+// Runで設定を読み込んで差し替える
+var billingPool = &tenantBillingPool{concurrency: 4, tenantTimeout: 10 * time.Second}
+
+// テナントごとにfnを並列に実行し、テナントと同じ順でエラーを返す
+// fnにはtsのインデックスを渡す
+// 1テナントの失敗で他のテナントの処理は止めない
+func (p *tenantBillingPool) run(ctx context.Context, ts []TenantRow, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, len(ts))
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+	for i := range ts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// リクエストが中断されたら残りのテナントは処理しない
+			for j := i; j < len(ts); j++ {
+				errs[j] = ctx.Err()
+			}
+			wg.Wait()
+			return errs
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			tctx, cancel := context.WithTimeout(ctx, p.tenantTimeout)
+			defer cancel()
+			errs[i] = fn(tctx, i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// テナントの全ての大会の課金額の合計を計算する
+func tenantBillingYen(ctx context.Context, t *TenantRow) (int64, error) {
+	tenantDB, err := connectToTenantDB(t.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connectToTenantDB: %w", err)
+	}
+	defer tenantDB.Close()
+	cs := []CompetitionRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&cs,
+		"SELECT * FROM competition WHERE tenant_id=?",
+		t.ID,
+	); err != nil {
+		return 0, fmt.Errorf("failed to Select competition: %w", err)
+	}
+	var billingYen int64
+	for _, comp := range cs {
+		report, err := billingReportByCompetition(ctx, tenantDB, t.ID, comp.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to billingReportByCompetition: %w", err)
+		}
+		billingYen += report.BillingYen
+	}
+	return billingYen, nil
+}
@@ -0,0 +1,82 @@
+package isuports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBillingPoolCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := &tenantBillingPool{concurrency: 1, tenantTimeout: time.Second}
+	// 処理中のテナントが枠を使っている間に、残りのテナントは中断される
+	errs := pool.run(ctx, make([]TenantRow, 3), func(ctx context.Context, i int) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	for i, err := range errs {
+		if i > 0 && !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled: i=%d, err=%v", i, err)
+		}
+	}
+}
+
+func TestFlockRespectsContext(t *testing.T) {
+	// lock_timeoutが0でも、キャンセルされうるctxならキャンセルされるまでしか待たない
+	const tenantID = 999999
+	fl, err := flockByTenantID(context.Background(), tenantID)
+	if err != nil {
+		t.Fatalf("error flockByTenantID: %s", err)
+	}
+	defer fl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := flockByTenantID(ctx, tenantID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("waited too long: %s", d)
+	}
+}
+
+func TestBillingPoolRun(t *testing.T) {
+	pool := &tenantBillingPool{concurrency: 2, tenantTimeout: time.Second}
+	var running, maxRunning int32
+	errs := pool.run(context.Background(), make([]TenantRow, 6), func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		// テナントごとに時間の上限がある
+		if _, ok := ctx.Deadline(); !ok {
+			return fmt.Errorf("no deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if i%2 == 1 {
+			return fmt.Errorf("tenant %d", i)
+		}
+		return nil
+	})
+	if maxRunning > 2 {
+		t.Fatalf("concurrency must be bounded: %d", maxRunning)
+	}
+	// 1テナントの失敗で他のテナントは止めず、テナントと同じ順でエラーを返す
+	for i, err := range errs {
+		if i%2 == 1 && (err == nil || err.Error() != fmt.Sprintf("tenant %d", i)) {
+			t.Errorf("unexpected error %d: %v", i, err)
+		}
+		if i%2 == 0 && err != nil {
+			t.Errorf("unexpected error %d: %v", i, err)
+		}
+	}
+}
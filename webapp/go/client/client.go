@@ -0,0 +1,157 @@
+// Package client はisuports APIのクライアント
+// APIごとのメソッドと型は openapi/openapi.yaml から生成している(client_gen.go)
+// 定義を変更したらこのディレクトリで go generate を実行する
+package client
+
+//go:generate go run ../cmd/openapi-gen -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	// https://tenant.t.isucon.dev など 末尾の/は付けない
+	BaseURL string
+	// nilならhttp.DefaultClientを使う
+	HTTPClient *http.Client
+	// 空でなければHostヘッダを上書きする 接続先とテナントのホスト名が異なる場合に使う
+	Host string
+	// 全てのリクエストに付けるヘッダ CookieやAuthorizationを設定する
+	Header http.Header
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Header:  http.Header{},
+	}
+}
+
+// multipart/form-dataで送るファイル
+type File struct {
+	Name string
+	Body io.Reader
+}
+
+// APIが200以外を返した場合のエラー
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: status %d: %s", e.Method, e.Path, e.StatusCode, bytes.TrimSpace(e.Body))
+}
+
+// リクエストを送り、レスポンスをそのまま返す
+// 請求書のCSVのようにJSON以外を返すAPIに使う レスポンスボディは呼び出し側で閉じること
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("error http.NewRequest: %w", err)
+	}
+	for k, vs := range c.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if c.Host != "" {
+		req.Host = c.Host
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+type envelope struct {
+	Status bool            `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// リクエストを送り、{"status": true, "data": ...} のdataをoutに読み込む
+// filesがあればmultipart/form-data、formがあればapplication/x-www-form-urlencodedで送る
+func (c *Client) call(ctx context.Context, method, path string, query, form url.Values, files map[string]*File, out any) error {
+	var body io.Reader
+	var contentType string
+	switch {
+	case len(files) > 0:
+		b, ct, err := multipartBody(form, files)
+		if err != nil {
+			return err
+		}
+		body, contentType = b, ct
+	case form != nil:
+		body, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	}
+
+	res, err := c.Do(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("error io.ReadAll: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return &APIError{Method: method, Path: path, StatusCode: res.StatusCode, Body: b}
+	}
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return fmt.Errorf("error json.Unmarshal: %s %s, %w", method, path, err)
+	}
+	if !env.Status {
+		return &APIError{Method: method, Path: path, StatusCode: res.StatusCode, Body: b}
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("error json.Unmarshal data: %s %s, %w", method, path, err)
+	}
+	return nil
+}
+
+func multipartBody(form url.Values, files map[string]*File) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, vs := range form {
+		for _, v := range vs {
+			if err := mw.WriteField(name, v); err != nil {
+				return nil, "", fmt.Errorf("error mw.WriteField: %w", err)
+			}
+		}
+	}
+	for name, f := range files {
+		fw, err := mw.CreateFormFile(name, f.Name)
+		if err != nil {
+			return nil, "", fmt.Errorf("error mw.CreateFormFile: %w", err)
+		}
+		if _, err := io.Copy(fw, f.Body); err != nil {
+			return nil, "", fmt.Errorf("error io.Copy: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", fmt.Errorf("error mw.Close: %w", err)
+	}
+	return &buf, mw.FormDataContentType(), nil
+}
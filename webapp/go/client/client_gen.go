@@ -0,0 +1,1707 @@
+// Code generated by openapi-gen from openapi/openapi.yaml. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// ImpersonationAuditLogs の引数
+type ImpersonationAuditLogsParams struct {
+	ImpersonationID string
+}
+
+// ImpersonationAuditLogs は GET /api/admin/impersonation/{impersonation_id}/audit_logs を呼ぶ
+// なりすましセッションで行われたリクエストを古い順に返す
+func (c *Client) ImpersonationAuditLogs(ctx context.Context, params *ImpersonationAuditLogsParams) (*ImpersonationAuditLogsHandlerResult, error) {
+	path := "/api/admin/impersonation/" + url.PathEscape(params.ImpersonationID) + "/audit_logs"
+	var out ImpersonationAuditLogsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImpersonationRevoke の引数
+type ImpersonationRevokeParams struct {
+	ImpersonationID string
+}
+
+// ImpersonationRevoke は POST /api/admin/impersonation/{impersonation_id}/revoke を呼ぶ
+// なりすましセッションを期限前に無効にする
+func (c *Client) ImpersonationRevoke(ctx context.Context, params *ImpersonationRevokeParams) (*ImpersonationsHandlerResult, error) {
+	path := "/api/admin/impersonation/" + url.PathEscape(params.ImpersonationID) + "/revoke"
+	var out ImpersonationsHandlerResult
+	if err := c.call(ctx, "POST", path, nil, url.Values{}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Impersonations の引数
+type ImpersonationsParams struct {
+	// 指定するとそのテナントのセッションのみ返す
+	TenantName string
+}
+
+// Impersonations は GET /api/admin/impersonations を呼ぶ
+// なりすましセッションの一覧を新しい順に最大100件返す
+func (c *Client) Impersonations(ctx context.Context, params *ImpersonationsParams) (*ImpersonationsHandlerResult, error) {
+	path := "/api/admin/impersonations"
+	query := url.Values{}
+	if params.TenantName != "" {
+		query.Set("tenant_name", params.TenantName)
+	}
+	var out ImpersonationsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImpersonationsAdd の引数
+type ImpersonationsAddParams struct {
+	TenantName string
+	Role       string
+	// roleがplayerの場合に必須
+	PlayerID *string
+	// なりすます理由 監査のため必須
+	Reason string
+	// trueでGET以外のリクエストも許可する 省略時は読み取り専用
+	Writable *bool
+	// 有効期間(秒) 省略時は900
+	ExpiresIn *int64
+}
+
+// ImpersonationsAdd は POST /api/admin/impersonations/add を呼ぶ
+// テナントの主催者か参加者になりすます短時間のセッションを発行する
+func (c *Client) ImpersonationsAdd(ctx context.Context, params *ImpersonationsAddParams) (*ImpersonationsAddHandlerResult, error) {
+	path := "/api/admin/impersonations/add"
+	form := url.Values{}
+	form.Set("tenant_name", params.TenantName)
+	form.Set("role", params.Role)
+	if params.PlayerID != nil {
+		form.Set("player_id", *params.PlayerID)
+	}
+	form.Set("reason", params.Reason)
+	if params.Writable != nil {
+		form.Set("writable", strconv.FormatBool(*params.Writable))
+	}
+	if params.ExpiresIn != nil {
+		form.Set("expires_in", strconv.FormatInt(*params.ExpiresIn, 10))
+	}
+	var out ImpersonationsAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// InvoicesClose の引数
+type InvoicesCloseParams struct {
+	// YYYY-MM形式
+	Month string
+}
+
+// InvoicesClose は POST /api/admin/invoices/close を呼ぶ
+// 締まった月の全テナントの請求書を確定する
+func (c *Client) InvoicesClose(ctx context.Context, params *InvoicesCloseParams) (*InvoicesCloseHandlerResult, error) {
+	path := "/api/admin/invoices/close"
+	form := url.Values{}
+	form.Set("month", params.Month)
+	var out InvoicesCloseHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Revenue は GET /api/admin/invoices/revenue を呼ぶ
+// 直近12か月の確定した売上を返す
+func (c *Client) Revenue(ctx context.Context) (*RevenueHandlerResult, error) {
+	path := "/api/admin/invoices/revenue"
+	var out RevenueHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchCompetitions の引数
+type SearchCompetitionsParams struct {
+	Q string
+	// 指定するとそのテナントの大会のみ返す
+	TenantName string
+	// 返す件数 省略時は100
+	Limit *int64
+}
+
+// SearchCompetitions は GET /api/admin/search/competitions を呼ぶ
+// 大会IDの完全一致かタイトルの部分一致で全テナントの大会を検索する
+func (c *Client) SearchCompetitions(ctx context.Context, params *SearchCompetitionsParams) (*SearchCompetitionsHandlerResult, error) {
+	path := "/api/admin/search/competitions"
+	query := url.Values{}
+	if params.Q != "" {
+		query.Set("q", params.Q)
+	}
+	if params.TenantName != "" {
+		query.Set("tenant_name", params.TenantName)
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.FormatInt(*params.Limit, 10))
+	}
+	var out SearchCompetitionsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchPlayers の引数
+type SearchPlayersParams struct {
+	Q string
+	// 指定するとそのテナントの参加者のみ返す
+	TenantName string
+	// 返す件数 省略時は100
+	Limit *int64
+}
+
+// SearchPlayers は GET /api/admin/search/players を呼ぶ
+// 参加者IDの完全一致か表示名の部分一致で全テナントの参加者を検索する
+func (c *Client) SearchPlayers(ctx context.Context, params *SearchPlayersParams) (*SearchPlayersHandlerResult, error) {
+	path := "/api/admin/search/players"
+	query := url.Values{}
+	if params.Q != "" {
+		query.Set("q", params.Q)
+	}
+	if params.TenantName != "" {
+		query.Set("tenant_name", params.TenantName)
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.FormatInt(*params.Limit, 10))
+	}
+	var out SearchPlayersHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchTenants の引数
+type SearchTenantsParams struct {
+	Q string
+	// 返す件数 省略時は100
+	Limit *int64
+}
+
+// SearchTenants は GET /api/admin/search/tenants を呼ぶ
+// テナント名・表示名の部分一致でテナントを検索する
+func (c *Client) SearchTenants(ctx context.Context, params *SearchTenantsParams) (*SearchTenantsHandlerResult, error) {
+	path := "/api/admin/search/tenants"
+	query := url.Values{}
+	if params.Q != "" {
+		query.Set("q", params.Q)
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.FormatInt(*params.Limit, 10))
+	}
+	var out SearchTenantsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TenantsAdd の引数
+type TenantsAddParams struct {
+	// テナント名 英小文字・数字・ハイフン
+	Name        string
+	DisplayName string
+}
+
+// TenantsAdd は POST /api/admin/tenants/add を呼ぶ
+// テナントを追加する
+func (c *Client) TenantsAdd(ctx context.Context, params *TenantsAddParams) (*TenantsAddHandlerResult, error) {
+	path := "/api/admin/tenants/add"
+	form := url.Values{}
+	form.Set("name", params.Name)
+	form.Set("display_name", params.DisplayName)
+	var out TenantsAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TenantsBilling の引数
+type TenantsBillingParams struct {
+	// このテナントIDより前のテナントを返す
+	Before *int64
+	// 返すテナント数 省略時は10
+	Limit *int64
+}
+
+// TenantsBilling は GET /api/admin/tenants/billing を呼ぶ
+// テナントごとの課金額を返す
+func (c *Client) TenantsBilling(ctx context.Context, params *TenantsBillingParams) (*TenantsBillingHandlerResult, error) {
+	path := "/api/admin/tenants/billing"
+	query := url.Values{}
+	if params.Before != nil {
+		query.Set("before", strconv.FormatInt(*params.Before, 10))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.FormatInt(*params.Limit, 10))
+	}
+	var out TenantsBillingHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TenantDomains の引数
+type TenantDomainsParams struct {
+	// 指定するとそのテナントのドメインのみ返す
+	TenantName string
+}
+
+// TenantDomains は GET /api/admin/tenants/domains を呼ぶ
+// 独自ドメインの一覧を返す
+func (c *Client) TenantDomains(ctx context.Context, params *TenantDomainsParams) (*TenantDomainsHandlerResult, error) {
+	path := "/api/admin/tenants/domains"
+	query := url.Values{}
+	if params.TenantName != "" {
+		query.Set("tenant_name", params.TenantName)
+	}
+	var out TenantDomainsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TenantDomainsAdd の引数
+type TenantDomainsAddParams struct {
+	Domain     string
+	TenantName string
+}
+
+// TenantDomainsAdd は POST /api/admin/tenants/domains/add を呼ぶ
+// テナントに独自ドメインを割り当てる
+func (c *Client) TenantDomainsAdd(ctx context.Context, params *TenantDomainsAddParams) (*TenantDomainsHandlerResult, error) {
+	path := "/api/admin/tenants/domains/add"
+	form := url.Values{}
+	form.Set("domain", params.Domain)
+	form.Set("tenant_name", params.TenantName)
+	var out TenantDomainsHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TenantDomainsDelete の引数
+type TenantDomainsDeleteParams struct {
+	Domain string
+}
+
+// TenantDomainsDelete は POST /api/admin/tenants/domains/delete を呼ぶ
+// 独自ドメインの割り当てを削除する
+func (c *Client) TenantDomainsDelete(ctx context.Context, params *TenantDomainsDeleteParams) error {
+	path := "/api/admin/tenants/domains/delete"
+	form := url.Values{}
+	form.Set("domain", params.Domain)
+	return c.call(ctx, "POST", path, nil, form, nil, nil)
+}
+
+// TenantQuota の引数
+type TenantQuotaParams struct {
+	TenantName string
+	// 0なら無制限
+	MaxPlayers *int64
+	// 0なら無制限
+	MaxCompetitions *int64
+	// 0なら無制限
+	MaxCSVRows *int64
+}
+
+// TenantQuota は POST /api/admin/tenants/quota を呼ぶ
+// テナントの参加者数・大会数・CSVの行数の上限を設定する
+func (c *Client) TenantQuota(ctx context.Context, params *TenantQuotaParams) error {
+	path := "/api/admin/tenants/quota"
+	form := url.Values{}
+	form.Set("tenant_name", params.TenantName)
+	if params.MaxPlayers != nil {
+		form.Set("max_players", strconv.FormatInt(*params.MaxPlayers, 10))
+	}
+	if params.MaxCompetitions != nil {
+		form.Set("max_competitions", strconv.FormatInt(*params.MaxCompetitions, 10))
+	}
+	if params.MaxCSVRows != nil {
+		form.Set("max_csv_rows", strconv.FormatInt(*params.MaxCSVRows, 10))
+	}
+	return c.call(ctx, "POST", path, nil, form, nil, nil)
+}
+
+// TenantRateLimit の引数
+type TenantRateLimitParams struct {
+	// 省略すると全テナントのデフォルト
+	TenantName *string
+	Role       string
+	// 1秒あたりのリクエスト数 省略すると設定を削除する
+	Rate  *float64
+	Burst *int64
+}
+
+// TenantRateLimit は POST /api/admin/tenants/rate_limit を呼ぶ
+// テナントとロールごとのレートリミットを設定する
+func (c *Client) TenantRateLimit(ctx context.Context, params *TenantRateLimitParams) error {
+	path := "/api/admin/tenants/rate_limit"
+	form := url.Values{}
+	if params.TenantName != nil {
+		form.Set("tenant_name", *params.TenantName)
+	}
+	form.Set("role", params.Role)
+	if params.Rate != nil {
+		form.Set("rate", strconv.FormatFloat(*params.Rate, 'f', -1, 64))
+	}
+	if params.Burst != nil {
+		form.Set("burst", strconv.FormatInt(*params.Burst, 10))
+	}
+	return c.call(ctx, "POST", path, nil, form, nil, nil)
+}
+
+// Me は GET /api/me を呼ぶ
+// アクセスしている人とテナントの情報を返す 未ログインでも使える
+func (c *Client) Me(ctx context.Context) (*MeHandlerResult, error) {
+	path := "/api/me"
+	var out MeHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OrganizerActionLogs の引数
+type OrganizerActionLogsParams struct {
+	// 指定するとその主催者の更新のみ返す
+	Subject string
+}
+
+// OrganizerActionLogs は GET /api/organizer/action_logs を呼ぶ
+// 主催者向けAPIで行われた更新を新しい順に最大100件返す
+func (c *Client) OrganizerActionLogs(ctx context.Context, params *OrganizerActionLogsParams) (*OrganizerActionLogsHandlerResult, error) {
+	path := "/api/organizer/action_logs"
+	query := url.Values{}
+	if params.Subject != "" {
+		query.Set("subject", params.Subject)
+	}
+	var out OrganizerActionLogsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// APITokenRevoke の引数
+type APITokenRevokeParams struct {
+	TokenID int64
+}
+
+// APITokenRevoke は POST /api/organizer/api_token/{token_id}/revoke を呼ぶ
+// APIトークンを失効させる
+func (c *Client) APITokenRevoke(ctx context.Context, params *APITokenRevokeParams) (*APITokensHandlerResult, error) {
+	path := "/api/organizer/api_token/" + strconv.FormatInt(params.TokenID, 10) + "/revoke"
+	var out APITokensHandlerResult
+	if err := c.call(ctx, "POST", path, nil, url.Values{}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// APITokens は GET /api/organizer/api_tokens を呼ぶ
+// APIトークンの一覧を返す
+func (c *Client) APITokens(ctx context.Context) (*APITokensHandlerResult, error) {
+	path := "/api/organizer/api_tokens"
+	var out APITokensHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// APITokensAdd の引数
+type APITokensAddParams struct {
+	Name   string
+	Scopes []string
+}
+
+// APITokensAdd は POST /api/organizer/api_tokens/add を呼ぶ
+// APIトークンを発行する
+func (c *Client) APITokensAdd(ctx context.Context, params *APITokensAddParams) (*APITokensAddHandlerResult, error) {
+	path := "/api/organizer/api_tokens/add"
+	form := url.Values{}
+	form.Set("name", params.Name)
+	for _, v := range params.Scopes {
+		form.Add("scopes[]", v)
+	}
+	var out APITokensAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Billing は GET /api/organizer/billing を呼ぶ
+// 大会ごとの課金レポートを返す
+func (c *Client) Billing(ctx context.Context) (*BillingHandlerResult, error) {
+	path := "/api/organizer/billing"
+	var out BillingHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompetitionFinish の引数
+type CompetitionFinishParams struct {
+	CompetitionID string
+}
+
+// CompetitionFinish は POST /api/organizer/competition/{competition_id}/finish を呼ぶ
+// 大会を終了する
+func (c *Client) CompetitionFinish(ctx context.Context, params *CompetitionFinishParams) error {
+	path := "/api/organizer/competition/" + url.PathEscape(params.CompetitionID) + "/finish"
+	return c.call(ctx, "POST", path, nil, url.Values{}, nil, nil)
+}
+
+// CompetitionScore の引数
+type CompetitionScoreParams struct {
+	CompetitionID string
+	// player_id,score または team_id,score のCSV
+	Scores *File
+}
+
+// CompetitionScore は POST /api/organizer/competition/{competition_id}/score を呼ぶ
+// 大会のスコアをCSVでアップロードする
+func (c *Client) CompetitionScore(ctx context.Context, params *CompetitionScoreParams) (*ScoreHandlerResult, error) {
+	path := "/api/organizer/competition/" + url.PathEscape(params.CompetitionID) + "/score"
+	form := url.Values{}
+	files := map[string]*File{}
+	if params.Scores != nil {
+		files["scores"] = params.Scores
+	}
+	var out ScoreHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, files, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompetitionScoreRule の引数
+type CompetitionScoreRuleParams struct {
+	CompetitionID string
+	ScoreOrder    *string
+	// スコアが登録された大会や終了した大会では変更できない
+	ScoreType *string
+	// 空文字列で制限を解除する
+	MinScore *string
+	// 空文字列で制限を解除する
+	MaxScore *string
+	TieBreak *string
+}
+
+// CompetitionScoreRule は POST /api/organizer/competition/{competition_id}/score_rule を呼ぶ
+// 大会のスコアのルールを変更する
+func (c *Client) CompetitionScoreRule(ctx context.Context, params *CompetitionScoreRuleParams) (*ScoreRuleHandlerResult, error) {
+	path := "/api/organizer/competition/" + url.PathEscape(params.CompetitionID) + "/score_rule"
+	form := url.Values{}
+	if params.ScoreOrder != nil {
+		form.Set("score_order", *params.ScoreOrder)
+	}
+	if params.ScoreType != nil {
+		form.Set("score_type", *params.ScoreType)
+	}
+	if params.MinScore != nil {
+		form.Set("min_score", *params.MinScore)
+	}
+	if params.MaxScore != nil {
+		form.Set("max_score", *params.MaxScore)
+	}
+	if params.TieBreak != nil {
+		form.Set("tie_break", *params.TieBreak)
+	}
+	var out ScoreRuleHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompetitionTeam の引数
+type CompetitionTeamParams struct {
+	CompetitionID string
+	ScoreMode     string
+	// score_modeがbestの場合に必須
+	BestN *int64
+}
+
+// CompetitionTeam は POST /api/organizer/competition/{competition_id}/team を呼ぶ
+// 大会をチーム戦にする
+func (c *Client) CompetitionTeam(ctx context.Context, params *CompetitionTeamParams) (*TeamCompetitionHandlerResult, error) {
+	path := "/api/organizer/competition/" + url.PathEscape(params.CompetitionID) + "/team"
+	form := url.Values{}
+	form.Set("score_mode", params.ScoreMode)
+	if params.BestN != nil {
+		form.Set("best_n", strconv.FormatInt(*params.BestN, 10))
+	}
+	var out TeamCompetitionHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OrganizerCompetitions は GET /api/organizer/competitions を呼ぶ
+// 大会の一覧を返す
+func (c *Client) OrganizerCompetitions(ctx context.Context) (*CompetitionsHandlerResult, error) {
+	path := "/api/organizer/competitions"
+	var out CompetitionsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompetitionsAdd の引数
+type CompetitionsAddParams struct {
+	Title      string
+	ScoreOrder *string
+	ScoreType  *string
+	// score_typeに応じた表記
+	MinScore *string
+	// score_typeに応じた表記
+	MaxScore *string
+	TieBreak *string
+}
+
+// CompetitionsAdd は POST /api/organizer/competitions/add を呼ぶ
+// 大会を追加する
+func (c *Client) CompetitionsAdd(ctx context.Context, params *CompetitionsAddParams) (*CompetitionsAddHandlerResult, error) {
+	path := "/api/organizer/competitions/add"
+	form := url.Values{}
+	form.Set("title", params.Title)
+	if params.ScoreOrder != nil {
+		form.Set("score_order", *params.ScoreOrder)
+	}
+	if params.ScoreType != nil {
+		form.Set("score_type", *params.ScoreType)
+	}
+	if params.MinScore != nil {
+		form.Set("min_score", *params.MinScore)
+	}
+	if params.MaxScore != nil {
+		form.Set("max_score", *params.MaxScore)
+	}
+	if params.TieBreak != nil {
+		form.Set("tie_break", *params.TieBreak)
+	}
+	var out CompetitionsAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// InviteRevoke の引数
+type InviteRevokeParams struct {
+	InviteID int64
+}
+
+// InviteRevoke は POST /api/organizer/invite/{invite_id}/revoke を呼ぶ
+// 招待コードを無効にする
+func (c *Client) InviteRevoke(ctx context.Context, params *InviteRevokeParams) (*InvitesHandlerResult, error) {
+	path := "/api/organizer/invite/" + strconv.FormatInt(params.InviteID, 10) + "/revoke"
+	var out InvitesHandlerResult
+	if err := c.call(ctx, "POST", path, nil, url.Values{}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Invites は GET /api/organizer/invites を呼ぶ
+// 招待コードの一覧を返す
+func (c *Client) Invites(ctx context.Context) (*InvitesHandlerResult, error) {
+	path := "/api/organizer/invites"
+	var out InvitesHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// InvitesAdd の引数
+type InvitesAddParams struct {
+	// 登録に使える回数 省略するか0なら無制限
+	MaxUses *int64
+	// 有効期間(秒) 省略すると無期限
+	ExpiresIn *int64
+}
+
+// InvitesAdd は POST /api/organizer/invites/add を呼ぶ
+// 参加者の招待コードを発行する
+func (c *Client) InvitesAdd(ctx context.Context, params *InvitesAddParams) (*InvitesAddHandlerResult, error) {
+	path := "/api/organizer/invites/add"
+	form := url.Values{}
+	if params.MaxUses != nil {
+		form.Set("max_uses", strconv.FormatInt(*params.MaxUses, 10))
+	}
+	if params.ExpiresIn != nil {
+		form.Set("expires_in", strconv.FormatInt(*params.ExpiresIn, 10))
+	}
+	var out InvitesAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Invoice の引数
+type InvoiceParams struct {
+	// YYYY-MM形式
+	Month string
+	// csvを指定するとCSVファイルを返す
+	Format string
+}
+
+// Invoice は GET /api/organizer/invoice/{month} を呼ぶ
+// 月の請求書を返す
+func (c *Client) Invoice(ctx context.Context, params *InvoiceParams) (*InvoiceHandlerResult, error) {
+	path := "/api/organizer/invoice/" + url.PathEscape(params.Month)
+	query := url.Values{}
+	if params.Format != "" {
+		query.Set("format", params.Format)
+	}
+	var out InvoiceHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Invoices は GET /api/organizer/invoices を呼ぶ
+// 月ごとの請求書の一覧を返す
+func (c *Client) Invoices(ctx context.Context) (*InvoicesHandlerResult, error) {
+	path := "/api/organizer/invoices"
+	var out InvoicesHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OrganizerDelete の引数
+type OrganizerDeleteParams struct {
+	OrganizerID int64
+}
+
+// OrganizerDelete は POST /api/organizer/organizer/{organizer_id}/delete を呼ぶ
+// 主催者アカウントを削除する
+func (c *Client) OrganizerDelete(ctx context.Context, params *OrganizerDeleteParams) error {
+	path := "/api/organizer/organizer/" + strconv.FormatInt(params.OrganizerID, 10) + "/delete"
+	return c.call(ctx, "POST", path, nil, url.Values{}, nil, nil)
+}
+
+// OrganizerPermissions の引数
+type OrganizerPermissionsParams struct {
+	OrganizerID int64
+	// 省略時はmember
+	Role        *string
+	Permissions []string
+}
+
+// OrganizerPermissions は POST /api/organizer/organizer/{organizer_id}/permissions を呼ぶ
+// 主催者アカウントのロールと権限を置き換える
+func (c *Client) OrganizerPermissions(ctx context.Context, params *OrganizerPermissionsParams) (*OrganizersHandlerResult, error) {
+	path := "/api/organizer/organizer/" + strconv.FormatInt(params.OrganizerID, 10) + "/permissions"
+	form := url.Values{}
+	if params.Role != nil {
+		form.Set("role", *params.Role)
+	}
+	for _, v := range params.Permissions {
+		form.Add("permissions[]", v)
+	}
+	var out OrganizersHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Organizers は GET /api/organizer/organizers を呼ぶ
+// 主催者アカウントの一覧を返す
+func (c *Client) Organizers(ctx context.Context) (*OrganizersHandlerResult, error) {
+	path := "/api/organizer/organizers"
+	var out OrganizersHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OrganizersAdd の引数
+type OrganizersAddParams struct {
+	// ログインに使うJWTのsub
+	Name string
+	// 省略時はmember
+	Role        *string
+	Permissions []string
+}
+
+// OrganizersAdd は POST /api/organizer/organizers/add を呼ぶ
+// 主催者アカウントを追加する
+func (c *Client) OrganizersAdd(ctx context.Context, params *OrganizersAddParams) (*OrganizersHandlerResult, error) {
+	path := "/api/organizer/organizers/add"
+	form := url.Values{}
+	form.Set("name", params.Name)
+	if params.Role != nil {
+		form.Set("role", *params.Role)
+	}
+	for _, v := range params.Permissions {
+		form.Add("permissions[]", v)
+	}
+	var out OrganizersHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerAttributes の引数
+type PlayerAttributesParams struct {
+	PlayerID string
+	// 空文字列で未設定にする 省略すると変更しない
+	Division *string
+	// 空文字列で未設定にする 省略すると変更しない
+	Category *string
+}
+
+// PlayerAttributes は POST /api/organizer/player/{player_id}/attributes を呼ぶ
+// 参加者の部門・カテゴリを変更する
+func (c *Client) PlayerAttributes(ctx context.Context, params *PlayerAttributesParams) (*PlayerAttributesHandlerResult, error) {
+	path := "/api/organizer/player/" + url.PathEscape(params.PlayerID) + "/attributes"
+	form := url.Values{}
+	if params.Division != nil {
+		form.Set("division", *params.Division)
+	}
+	if params.Category != nil {
+		form.Set("category", *params.Category)
+	}
+	var out PlayerAttributesHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerDisqualified の引数
+type PlayerDisqualifiedParams struct {
+	PlayerID string
+}
+
+// PlayerDisqualified は POST /api/organizer/player/{player_id}/disqualified を呼ぶ
+// 参加者を失格にする
+func (c *Client) PlayerDisqualified(ctx context.Context, params *PlayerDisqualifiedParams) (*PlayerDisqualifiedHandlerResult, error) {
+	path := "/api/organizer/player/" + url.PathEscape(params.PlayerID) + "/disqualified"
+	var out PlayerDisqualifiedHandlerResult
+	if err := c.call(ctx, "POST", path, nil, url.Values{}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerAttributeOptions は GET /api/organizer/player_attributes を呼ぶ
+// 部門・カテゴリの選択肢を返す
+func (c *Client) PlayerAttributeOptions(ctx context.Context) (*PlayerAttributeOptionsHandlerResult, error) {
+	path := "/api/organizer/player_attributes"
+	var out PlayerAttributeOptionsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerAttributeOptionsAdd の引数
+type PlayerAttributeOptionsAddParams struct {
+	Name  string
+	Value string
+}
+
+// PlayerAttributeOptionsAdd は POST /api/organizer/player_attributes/add を呼ぶ
+// 部門・カテゴリの選択肢を追加する
+func (c *Client) PlayerAttributeOptionsAdd(ctx context.Context, params *PlayerAttributeOptionsAddParams) (*PlayerAttributeOptionsHandlerResult, error) {
+	path := "/api/organizer/player_attributes/add"
+	form := url.Values{}
+	form.Set("name", params.Name)
+	form.Set("value", params.Value)
+	var out PlayerAttributeOptionsHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayersList は GET /api/organizer/players を呼ぶ
+// 参加者の一覧を返す
+func (c *Client) PlayersList(ctx context.Context) (*PlayersListHandlerResult, error) {
+	path := "/api/organizer/players"
+	var out PlayersListHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayersAdd の引数
+type PlayersAddParams struct {
+	DisplayName []string
+	// display_name[]と同じ順で指定する
+	Division []string
+	// display_name[]と同じ順で指定する
+	Category []string
+}
+
+// PlayersAdd は POST /api/organizer/players/add を呼ぶ
+// 参加者を追加する
+func (c *Client) PlayersAdd(ctx context.Context, params *PlayersAddParams) (*PlayersAddHandlerResult, error) {
+	path := "/api/organizer/players/add"
+	form := url.Values{}
+	for _, v := range params.DisplayName {
+		form.Add("display_name[]", v)
+	}
+	for _, v := range params.Division {
+		form.Add("division[]", v)
+	}
+	for _, v := range params.Category {
+		form.Add("category[]", v)
+	}
+	var out PlayersAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SeasonCompetitionsAdd の引数
+type SeasonCompetitionsAddParams struct {
+	SeasonID      string
+	CompetitionID string
+}
+
+// SeasonCompetitionsAdd は POST /api/organizer/season/{season_id}/competitions/add を呼ぶ
+// シーズンに大会を追加する
+func (c *Client) SeasonCompetitionsAdd(ctx context.Context, params *SeasonCompetitionsAddParams) (*SeasonHandlerResult, error) {
+	path := "/api/organizer/season/" + url.PathEscape(params.SeasonID) + "/competitions/add"
+	form := url.Values{}
+	form.Set("competition_id", params.CompetitionID)
+	var out SeasonHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Seasons は GET /api/organizer/seasons を呼ぶ
+// シーズンの一覧を返す
+func (c *Client) Seasons(ctx context.Context) (*SeasonsHandlerResult, error) {
+	path := "/api/organizer/seasons"
+	var out SeasonsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SeasonsAdd の引数
+type SeasonsAddParams struct {
+	Title string
+	Mode  *string
+	// 1位から順の獲得ポイントのカンマ区切り
+	PointsTable    *string
+	CompetitionIDs []string
+}
+
+// SeasonsAdd は POST /api/organizer/seasons/add を呼ぶ
+// シーズンを追加する
+func (c *Client) SeasonsAdd(ctx context.Context, params *SeasonsAddParams) (*SeasonHandlerResult, error) {
+	path := "/api/organizer/seasons/add"
+	form := url.Values{}
+	form.Set("title", params.Title)
+	if params.Mode != nil {
+		form.Set("mode", *params.Mode)
+	}
+	if params.PointsTable != nil {
+		form.Set("points_table", *params.PointsTable)
+	}
+	for _, v := range params.CompetitionIDs {
+		form.Add("competition_ids[]", v)
+	}
+	var out SeasonHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Stats の引数
+type StatsParams struct {
+	// 時系列の集計期間 省略時は30
+	Days *int64
+}
+
+// Stats は GET /api/organizer/stats を呼ぶ
+// テナントの参加者・大会・ランキング閲覧の統計を返す
+func (c *Client) Stats(ctx context.Context, params *StatsParams) (*StatsHandlerResult, error) {
+	path := "/api/organizer/stats"
+	query := url.Values{}
+	if params.Days != nil {
+		query.Set("days", strconv.FormatInt(*params.Days, 10))
+	}
+	var out StatsHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TeamMembers の引数
+type TeamMembersParams struct {
+	TeamID   string
+	PlayerID []string
+}
+
+// TeamMembers は POST /api/organizer/team/{team_id}/members を呼ぶ
+// チームのメンバーを置き換える
+func (c *Client) TeamMembers(ctx context.Context, params *TeamMembersParams) (*TeamHandlerResult, error) {
+	path := "/api/organizer/team/" + url.PathEscape(params.TeamID) + "/members"
+	form := url.Values{}
+	for _, v := range params.PlayerID {
+		form.Add("player_id[]", v)
+	}
+	var out TeamHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Teams は GET /api/organizer/teams を呼ぶ
+// チームの一覧を返す
+func (c *Client) Teams(ctx context.Context) (*TeamsHandlerResult, error) {
+	path := "/api/organizer/teams"
+	var out TeamsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TeamsAdd の引数
+type TeamsAddParams struct {
+	Name     string
+	PlayerID []string
+}
+
+// TeamsAdd は POST /api/organizer/teams/add を呼ぶ
+// チームを追加する
+func (c *Client) TeamsAdd(ctx context.Context, params *TeamsAddParams) (*TeamHandlerResult, error) {
+	path := "/api/organizer/teams/add"
+	form := url.Values{}
+	form.Set("name", params.Name)
+	for _, v := range params.PlayerID {
+		form.Add("player_id[]", v)
+	}
+	var out TeamHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WebhookDelete の引数
+type WebhookDeleteParams struct {
+	WebhookID int64
+}
+
+// WebhookDelete は POST /api/organizer/webhook/{webhook_id}/delete を呼ぶ
+// Webhookの購読を削除する
+func (c *Client) WebhookDelete(ctx context.Context, params *WebhookDeleteParams) error {
+	path := "/api/organizer/webhook/" + strconv.FormatInt(params.WebhookID, 10) + "/delete"
+	return c.call(ctx, "POST", path, nil, url.Values{}, nil, nil)
+}
+
+// WebhookDeliveries の引数
+type WebhookDeliveriesParams struct {
+	WebhookID int64
+}
+
+// WebhookDeliveries は GET /api/organizer/webhook/{webhook_id}/deliveries を呼ぶ
+// Webhookの直近100件の配送状況を返す
+func (c *Client) WebhookDeliveries(ctx context.Context, params *WebhookDeliveriesParams) (*WebhookDeliveriesHandlerResult, error) {
+	path := "/api/organizer/webhook/" + strconv.FormatInt(params.WebhookID, 10) + "/deliveries"
+	var out WebhookDeliveriesHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Webhooks は GET /api/organizer/webhooks を呼ぶ
+// Webhookの購読の一覧を返す
+func (c *Client) Webhooks(ctx context.Context) (*WebhooksHandlerResult, error) {
+	path := "/api/organizer/webhooks"
+	var out WebhooksHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WebhooksAdd の引数
+type WebhooksAddParams struct {
+	// http または https のURL
+	URL    string
+	Events []string
+}
+
+// WebhooksAdd は POST /api/organizer/webhooks/add を呼ぶ
+// Webhookの購読を追加する
+func (c *Client) WebhooksAdd(ctx context.Context, params *WebhooksAddParams) (*WebhooksAddHandlerResult, error) {
+	path := "/api/organizer/webhooks/add"
+	form := url.Values{}
+	form.Set("url", params.URL)
+	for _, v := range params.Events {
+		form.Add("events[]", v)
+	}
+	var out WebhooksAddHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompetitionRanking の引数
+type CompetitionRankingParams struct {
+	CompetitionID string
+	// この順位より後の100件を返す
+	RankAfter *int64
+	// 指定するとその部門の参加者のみで順位をつける
+	Division string
+}
+
+// CompetitionRanking は GET /api/player/competition/{competition_id}/ranking を呼ぶ
+// 大会のランキングを返す
+func (c *Client) CompetitionRanking(ctx context.Context, params *CompetitionRankingParams) (*CompetitionRankingHandlerResult, error) {
+	path := "/api/player/competition/" + url.PathEscape(params.CompetitionID) + "/ranking"
+	query := url.Values{}
+	if params.RankAfter != nil {
+		query.Set("rank_after", strconv.FormatInt(*params.RankAfter, 10))
+	}
+	if params.Division != "" {
+		query.Set("division", params.Division)
+	}
+	var out CompetitionRankingHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerCompetitions は GET /api/player/competitions を呼ぶ
+// 大会の一覧を返す
+func (c *Client) PlayerCompetitions(ctx context.Context) (*CompetitionsHandlerResult, error) {
+	path := "/api/player/competitions"
+	var out CompetitionsHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Player の引数
+type PlayerParams struct {
+	PlayerID string
+}
+
+// Player は GET /api/player/player/{player_id} を呼ぶ
+// 参加者の詳細と大会ごとのスコアを返す
+func (c *Client) Player(ctx context.Context, params *PlayerParams) (*PlayerHandlerResult, error) {
+	path := "/api/player/player/" + url.PathEscape(params.PlayerID)
+	var out PlayerHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlayerRegister の引数
+type PlayerRegisterParams struct {
+	Code        string
+	DisplayName string
+}
+
+// PlayerRegister は POST /api/player/register を呼ぶ
+// 招待コードを使って参加者を登録する
+func (c *Client) PlayerRegister(ctx context.Context, params *PlayerRegisterParams) (*PlayerRegisterHandlerResult, error) {
+	path := "/api/player/register"
+	form := url.Values{}
+	form.Set("code", params.Code)
+	form.Set("display_name", params.DisplayName)
+	var out PlayerRegisterHandlerResult
+	if err := c.call(ctx, "POST", path, nil, form, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SeasonRanking の引数
+type SeasonRankingParams struct {
+	SeasonID string
+	// この順位より後の100件を返す
+	RankAfter *int64
+}
+
+// SeasonRanking は GET /api/player/season/{season_id}/ranking を呼ぶ
+// シーズンの通算ランキングを返す
+func (c *Client) SeasonRanking(ctx context.Context, params *SeasonRankingParams) (*SeasonRankingHandlerResult, error) {
+	path := "/api/player/season/" + url.PathEscape(params.SeasonID) + "/ranking"
+	query := url.Values{}
+	if params.RankAfter != nil {
+		query.Set("rank_after", strconv.FormatInt(*params.RankAfter, 10))
+	}
+	var out SeasonRankingHandlerResult
+	if err := c.call(ctx, "GET", path, query, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Healthz は GET /healthz を呼ぶ
+// プロセスが応答できるかだけを返す
+func (c *Client) Healthz(ctx context.Context) error {
+	path := "/healthz"
+	return c.call(ctx, "GET", path, nil, nil, nil, nil)
+}
+
+// Initialize は POST /initialize を呼ぶ
+// ベンチマーカー向け データを初期化する
+func (c *Client) Initialize(ctx context.Context) (*InitializeHandlerResult, error) {
+	path := "/initialize"
+	var out InitializeHandlerResult
+	if err := c.call(ctx, "POST", path, nil, url.Values{}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Readyz は GET /readyz を呼ぶ
+// 管理用DBとテナントDBのディレクトリが使えるかを返す
+func (c *Client) Readyz(ctx context.Context) (*ReadyzHandlerResult, error) {
+	path := "/readyz"
+	var out ReadyzHandlerResult
+	if err := c.call(ctx, "GET", path, nil, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type APITokenDetail struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"created_at"`
+	RevokedAt *int64   `json:"revoked_at"`
+}
+
+type APITokensAddHandlerResult struct {
+	APIToken APITokenDetail `json:"api_token"`
+	Token    string         `json:"token"`
+}
+
+type APITokensHandlerResult struct {
+	APITokens []APITokenDetail `json:"api_tokens"`
+}
+
+type BillingHandlerResult struct {
+	Reports []BillingReport `json:"reports"`
+}
+
+type BillingReport struct {
+	CompetitionID    string `json:"competition_id"`
+	CompetitionTitle string `json:"competition_title"`
+	// スコアを登録した参加者数
+	PlayerCount int64 `json:"player_count"`
+	// ランキングを閲覧だけした参加者数
+	VisitorCount      int64 `json:"visitor_count"`
+	BillingPlayerYen  int64 `json:"billing_player_yen"`
+	BillingVisitorYen int64 `json:"billing_visitor_yen"`
+	BillingYen        int64 `json:"billing_yen"`
+}
+
+type CompetitionDetail struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	IsFinished bool   `json:"is_finished"`
+}
+
+type CompetitionRank struct {
+	Rank  int64 `json:"rank"`
+	Score int64 `json:"score"`
+	// 大会のスコアの種類に応じて整形したスコア
+	ScoreText         string `json:"score_text"`
+	PlayerID          string `json:"player_id"`
+	PlayerDisplayName string `json:"player_display_name"`
+}
+
+type CompetitionRankingHandlerResult struct {
+	Competition CompetitionDetail `json:"competition"`
+	Ranks       []CompetitionRank `json:"ranks"`
+	// チーム戦でなければ空
+	TeamRanks []TeamRank `json:"team_ranks"`
+}
+
+type CompetitionSearchResult struct {
+	ID                string `json:"id"`
+	Title             string `json:"title"`
+	TenantName        string `json:"tenant_name"`
+	TenantDisplayName string `json:"tenant_display_name"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
+type CompetitionStats struct {
+	CompetitionID     string            `json:"competition_id"`
+	Title             string            `json:"title"`
+	IsFinished        bool              `json:"is_finished"`
+	Participants      int64             `json:"participants"`
+	RankingViewers    int64             `json:"ranking_viewers"`
+	ScoreDistribution ScoreDistribution `json:"score_distribution"`
+}
+
+type CompetitionsAddHandlerResult struct {
+	Competition CompetitionDetail `json:"competition"`
+}
+
+type CompetitionsHandlerResult struct {
+	Competitions []CompetitionDetail `json:"competitions"`
+}
+
+type DailyCount struct {
+	Day   int64 `json:"day"`
+	Count int64 `json:"count"`
+}
+
+type FailureResult struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type HistogramBin struct {
+	Lower int64 `json:"lower"`
+	Upper int64 `json:"upper"`
+	Count int64 `json:"count"`
+}
+
+type ImpersonationAuditLogDetail struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Allowed   bool   `json:"allowed"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ImpersonationAuditLogsHandlerResult struct {
+	Impersonation ImpersonationDetail           `json:"impersonation"`
+	AuditLogs     []ImpersonationAuditLogDetail `json:"audit_logs"`
+}
+
+type ImpersonationDetail struct {
+	ID         string `json:"id"`
+	TenantName string `json:"tenant_name"`
+	Role       string `json:"role"`
+	// roleがplayerの場合のみ
+	PlayerID string `json:"player_id"`
+	Writable bool   `json:"writable"`
+	Reason   string `json:"reason"`
+	// 発行したSaaS管理者
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	RevokedAt *int64 `json:"revoked_at"`
+}
+
+type ImpersonationsAddHandlerResult struct {
+	Impersonation ImpersonationDetail `json:"impersonation"`
+	Token         string              `json:"token"`
+}
+
+type ImpersonationsHandlerResult struct {
+	Impersonations []ImpersonationDetail `json:"impersonations"`
+}
+
+type InitializeHandlerResult struct {
+	Lang string `json:"lang"`
+}
+
+type InviteDetail struct {
+	ID string `json:"id"`
+	// 0なら無制限
+	MaxUses   int64 `json:"max_uses"`
+	UsedCount int64 `json:"used_count"`
+	// 0なら無期限
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	RevokedAt *int64 `json:"revoked_at"`
+}
+
+type InvitesAddHandlerResult struct {
+	Invite InviteDetail `json:"invite"`
+	Code   string       `json:"code"`
+}
+
+type InvitesHandlerResult struct {
+	Invites []InviteDetail `json:"invites"`
+}
+
+type InvoiceDetail struct {
+	TenantID          string          `json:"tenant_id"`
+	TenantName        string          `json:"tenant_name"`
+	Month             string          `json:"month"`
+	IsClosed          bool            `json:"is_closed"`
+	ClosedAt          *int64          `json:"closed_at"`
+	BillingPlayerYen  int64           `json:"billing_player_yen"`
+	BillingVisitorYen int64           `json:"billing_visitor_yen"`
+	BillingYen        int64           `json:"billing_yen"`
+	Reports           []BillingReport `json:"reports"`
+}
+
+type InvoiceHandlerResult struct {
+	Invoice InvoiceDetail `json:"invoice"`
+}
+
+type InvoiceSummary struct {
+	Month      string `json:"month"`
+	IsClosed   bool   `json:"is_closed"`
+	BillingYen int64  `json:"billing_yen"`
+}
+
+type InvoicesCloseHandlerResult struct {
+	Month   string `json:"month"`
+	Tenants int64  `json:"tenants"`
+}
+
+type InvoicesHandlerResult struct {
+	Invoices []InvoiceSummary `json:"invoices"`
+}
+
+type MeHandlerResult struct {
+	Tenant   *TenantDetail `json:"tenant"`
+	Me       *PlayerDetail `json:"me"`
+	Role     string        `json:"role"`
+	LoggedIn bool          `json:"logged_in"`
+	// SaaS管理者のなりすましセッションでアクセスしている
+	Impersonated bool `json:"impersonated"`
+}
+
+type OrganizerAccountDetail struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// ownerは全ての権限を持つので空
+	Permissions []string `json:"permissions"`
+	CreatedBy   string   `json:"created_by"`
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+type OrganizerActionLogDetail struct {
+	// 操作した主催者のsub APIトークンは api_token:<ID>、なりすましは impersonation:<ID>
+	Subject   string `json:"subject"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type OrganizerActionLogsHandlerResult struct {
+	ActionLogs []OrganizerActionLogDetail `json:"action_logs"`
+}
+
+type OrganizersHandlerResult struct {
+	Organizers []OrganizerAccountDetail `json:"organizers"`
+}
+
+type PlayerAttributeOptionsHandlerResult struct {
+	Divisions  []string `json:"divisions"`
+	Categories []string `json:"categories"`
+}
+
+type PlayerAttributesHandlerResult struct {
+	Player PlayerDetail `json:"player"`
+}
+
+type PlayerCountStats struct {
+	Total        int64 `json:"total"`
+	Active       int64 `json:"active"`
+	Disqualified int64 `json:"disqualified"`
+}
+
+type PlayerDetail struct {
+	ID             string `json:"id"`
+	DisplayName    string `json:"display_name"`
+	IsDisqualified bool   `json:"is_disqualified"`
+	Division       string `json:"division"`
+	Category       string `json:"category"`
+}
+
+type PlayerDisqualifiedHandlerResult struct {
+	Player PlayerDetail `json:"player"`
+}
+
+type PlayerGrowthPoint struct {
+	Day   int64 `json:"day"`
+	Added int64 `json:"added"`
+	Total int64 `json:"total"`
+}
+
+type PlayerHandlerResult struct {
+	Player     PlayerDetail        `json:"player"`
+	Scores     []PlayerScoreDetail `json:"scores"`
+	TeamScores []TeamScoreDetail   `json:"team_scores"`
+}
+
+type PlayerRegisterHandlerResult struct {
+	Player PlayerDetail `json:"player"`
+}
+
+type PlayerScoreDetail struct {
+	CompetitionTitle string `json:"competition_title"`
+	Score            int64  `json:"score"`
+	ScoreText        string `json:"score_text"`
+}
+
+type PlayerSearchResult struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"display_name"`
+	TenantName        string `json:"tenant_name"`
+	TenantDisplayName string `json:"tenant_display_name"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
+type PlayersAddHandlerResult struct {
+	Players []PlayerDetail `json:"players"`
+}
+
+type PlayersListHandlerResult struct {
+	Players []PlayerDetail `json:"players"`
+}
+
+type ReadyzHandlerResult struct {
+	// 確認項目ごとに ok かエラーの内容
+	Checks map[string]string `json:"checks"`
+}
+
+type RevenueHandlerResult struct {
+	Months []RevenueSummaryRow `json:"months"`
+}
+
+type RevenueSummaryRow struct {
+	Month string `json:"month"`
+	// 請求額が0円より大きいテナント数
+	TenantCount       int64 `json:"tenant_count"`
+	BillingPlayerYen  int64 `json:"billing_player_yen"`
+	BillingVisitorYen int64 `json:"billing_visitor_yen"`
+	BillingYen        int64 `json:"billing_yen"`
+}
+
+type ScoreDistribution struct {
+	Count      int64          `json:"count"`
+	Min        int64          `json:"min"`
+	Median     int64          `json:"median"`
+	Max        int64          `json:"max"`
+	MinText    string         `json:"min_text"`
+	MedianText string         `json:"median_text"`
+	MaxText    string         `json:"max_text"`
+	Histogram  []HistogramBin `json:"histogram"`
+}
+
+type ScoreHandlerResult struct {
+	Rows int64 `json:"rows"`
+}
+
+type ScoreRuleDetail struct {
+	ScoreOrder string  `json:"score_order"`
+	ScoreType  string  `json:"score_type"`
+	MinScore   *string `json:"min_score"`
+	MaxScore   *string `json:"max_score"`
+	TieBreak   string  `json:"tie_break"`
+}
+
+type ScoreRuleHandlerResult struct {
+	ScoreRule ScoreRuleDetail `json:"score_rule"`
+}
+
+type SearchCompetitionsHandlerResult struct {
+	Competitions []CompetitionSearchResult `json:"competitions"`
+}
+
+type SearchPlayersHandlerResult struct {
+	Players []PlayerSearchResult `json:"players"`
+}
+
+type SearchTenantsHandlerResult struct {
+	Tenants []TenantSearchResult `json:"tenants"`
+}
+
+type SeasonDetail struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title"`
+	Mode           string   `json:"mode"`
+	PointsTable    []int64  `json:"points_table"`
+	CompetitionIDs []string `json:"competition_ids"`
+}
+
+type SeasonHandlerResult struct {
+	Season SeasonDetail `json:"season"`
+}
+
+type SeasonRank struct {
+	Rank              int64  `json:"rank"`
+	Points            int64  `json:"points"`
+	PlayerID          string `json:"player_id"`
+	PlayerDisplayName string `json:"player_display_name"`
+	CompetitionCount  int64  `json:"competition_count"`
+}
+
+type SeasonRankingHandlerResult struct {
+	Season SeasonDetail `json:"season"`
+	Ranks  []SeasonRank `json:"ranks"`
+}
+
+type SeasonsHandlerResult struct {
+	Seasons []SeasonDetail `json:"seasons"`
+}
+
+type StatsHandlerResult struct {
+	Days           int64               `json:"days"`
+	Players        PlayerCountStats    `json:"players"`
+	PlayerGrowth   []PlayerGrowthPoint `json:"player_growth"`
+	RankingViewers []DailyCount        `json:"ranking_viewers"`
+	Competitions   []CompetitionStats  `json:"competitions"`
+}
+
+type TeamCompetitionHandlerResult struct {
+	ScoreMode string `json:"score_mode"`
+	BestN     int64  `json:"best_n"`
+}
+
+type TeamDetail struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	PlayerIDs []string `json:"player_ids"`
+}
+
+type TeamHandlerResult struct {
+	Team TeamDetail `json:"team"`
+}
+
+type TeamRank struct {
+	Rank      int64  `json:"rank"`
+	Score     int64  `json:"score"`
+	ScoreText string `json:"score_text"`
+	TeamID    string `json:"team_id"`
+	TeamName  string `json:"team_name"`
+}
+
+type TeamScoreDetail struct {
+	CompetitionTitle string `json:"competition_title"`
+	TeamID           string `json:"team_id"`
+	TeamName         string `json:"team_name"`
+	Rank             int64  `json:"rank"`
+	Score            int64  `json:"score"`
+	ScoreText        string `json:"score_text"`
+}
+
+type TeamsHandlerResult struct {
+	Teams []TeamDetail `json:"teams"`
+}
+
+type TenantDetail struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type TenantDomainDetail struct {
+	Domain     string `json:"domain"`
+	TenantName string `json:"tenant_name"`
+}
+
+type TenantDomainsHandlerResult struct {
+	Domains []TenantDomainDetail `json:"domains"`
+}
+
+type TenantSearchResult struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type TenantWithBilling struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Billing     int64  `json:"billing"`
+	// 課金の計算に失敗した場合のみ
+	Error string `json:"error,omitempty"`
+}
+
+type TenantsAddHandlerResult struct {
+	Tenant TenantWithBilling `json:"tenant"`
+}
+
+type TenantsBillingHandlerResult struct {
+	Tenants []TenantWithBilling `json:"tenants"`
+}
+
+type WebhookDeliveriesHandlerResult struct {
+	Deliveries []WebhookDeliveryDetail `json:"deliveries"`
+}
+
+type WebhookDeliveryDetail struct {
+	ID       string `json:"id"`
+	Event    string `json:"event"`
+	Status   string `json:"status"`
+	Attempts int64  `json:"attempts"`
+	// 接続できなかった場合は0
+	StatusCode int64  `json:"status_code"`
+	Error      string `json:"error"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+type WebhookDetail struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+type WebhooksAddHandlerResult struct {
+	Webhook WebhookDetail `json:"webhook"`
+	Secret  string        `json:"secret"`
+}
+
+type WebhooksHandlerResult struct {
+	Webhooks []WebhookDetail `json:"webhooks"`
+}
@@ -0,0 +1,453 @@
+// openapi-gen は openapi/openapi.yaml から isuports APIのGoクライアント(client パッケージ)を生成する
+//
+// 使い方:
+//
+//	openapi-gen [-o client_gen.go] [-package client]
+//
+// 通常は webapp/go/client で go generate を実行する
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/openapi"
+)
+
+// Goの命名規則で大文字にする略語
+var initialisms = map[string]string{
+	"id":   "ID",
+	"ids":  "IDs",
+	"url":  "URL",
+	"api":  "API",
+	"csv":  "CSV",
+	"json": "JSON",
+}
+
+// player_display_name を PlayerDisplayName にする
+// フォームの配列のフィールド名(player_id[])は[]を取り除く
+func goName(s string) string {
+	s = strings.TrimSuffix(s, "[]")
+	var b strings.Builder
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if v, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(v)
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// apiTokenRevoke のようなoperationIdを APITokenRevoke にする
+func methodName(operationID string) string {
+	var b strings.Builder
+	for i, r := range operationID {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return goName(b.String())
+}
+
+type generator struct {
+	doc *openapi.Document
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// コメントとして出力する 複数行の説明にも対応する
+func (g *generator) comment(indent, s string) {
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		g.printf("%s// %s\n", indent, line)
+	}
+}
+
+// スキーマに対応するGoの型を返す
+func (g *generator) goType(s *openapi.Schema) (string, error) {
+	if len(s.AllOf) == 1 {
+		t, err := g.goType(s.AllOf[0])
+		if err != nil {
+			return "", err
+		}
+		if s.Nullable {
+			return "*" + t, nil
+		}
+		return t, nil
+	}
+	if s.Ref != "" {
+		if _, err := g.doc.ResolveSchema(s); err != nil {
+			return "", err
+		}
+		return openapi.RefName(s.Ref), nil
+	}
+	var t string
+	switch s.Type {
+	case "string":
+		t = "string"
+	case "integer":
+		t = "int64"
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		it, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + it, nil
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "", fmt.Errorf("inline object schema is not supported")
+		}
+		vt, err := g.goType(s.AdditionalProperties)
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + vt, nil
+	default:
+		return "", fmt.Errorf("unsupported type: %q", s.Type)
+	}
+	if s.Nullable {
+		return "*" + t, nil
+	}
+	return t, nil
+}
+
+func (g *generator) schemas() error {
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := g.doc.Components.Schemas[name]
+		if s.Description != "" {
+			g.comment("", s.Description)
+		}
+		g.printf("type %s struct {\n", name)
+		required := map[string]bool{}
+		for _, r := range s.Required {
+			required[r] = true
+		}
+		for _, prop := range s.PropertyNames {
+			ps := s.Properties[prop]
+			t, err := g.goType(ps)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, prop, err)
+			}
+			if ps.Description != "" {
+				g.comment("\t", ps.Description)
+			}
+			tag := prop
+			if !required[prop] {
+				tag += ",omitempty"
+			}
+			g.printf("\t%s %s `json:%q`\n", goName(prop), t, tag)
+		}
+		g.printf("}\n\n")
+	}
+	return nil
+}
+
+// オペレーションの引数になるフィールド
+type field struct {
+	name     string // API上の名前
+	goName   string
+	in       string // path, query, form, file
+	schema   *openapi.Schema
+	required bool
+	desc     string
+}
+
+func (g *generator) fields(op *openapi.Operation) ([]field, string, error) {
+	fs := []field{}
+	for _, p := range op.Parameters {
+		s, err := g.doc.ResolveSchema(p.Schema)
+		if err != nil {
+			return nil, "", err
+		}
+		fs = append(fs, field{name: p.Name, goName: goName(p.Name), in: p.In, schema: s, required: p.Required || p.In == "path", desc: p.Description})
+	}
+	if op.RequestBody == nil {
+		return fs, "", nil
+	}
+	contentType := ""
+	var mt *openapi.MediaType
+	for _, ct := range []string{openapi.ContentTypeMultipart, openapi.ContentTypeForm} {
+		if m, ok := op.RequestBody.Content[ct]; ok {
+			contentType, mt = ct, m
+			break
+		}
+	}
+	if mt == nil {
+		return nil, "", fmt.Errorf("unsupported request body")
+	}
+	body, err := g.doc.ResolveSchema(mt.Schema)
+	if err != nil {
+		return nil, "", err
+	}
+	required := map[string]bool{}
+	for _, r := range body.Required {
+		required[r] = true
+	}
+	for _, name := range body.PropertyNames {
+		s, err := g.doc.ResolveSchema(body.Properties[name])
+		if err != nil {
+			return nil, "", err
+		}
+		in := "form"
+		if s.Format == "binary" {
+			in = "file"
+		}
+		fs = append(fs, field{name: name, goName: goName(name), in: in, schema: s, required: required[name], desc: s.Description})
+	}
+	return fs, contentType, nil
+}
+
+// 引数の構造体のフィールドの型
+// 省略できるスカラー値はポインタにして、省略と空文字列・0を区別する
+func (g *generator) fieldType(f field) (string, error) {
+	if f.in == "file" {
+		return "*File", nil
+	}
+	t, err := g.goType(f.schema)
+	if err != nil {
+		return "", err
+	}
+	if f.required || f.schema.Type == "array" || f.in != "form" {
+		if f.in == "query" && !f.required && f.schema.Type != "string" {
+			return "*" + t, nil
+		}
+		return t, nil
+	}
+	return "*" + t, nil
+}
+
+// 値を文字列にする式
+func formatExpr(t, v string) string {
+	switch strings.TrimPrefix(t, "*") {
+	case "int64":
+		return "strconv.FormatInt(" + v + ", 10)"
+	case "float64":
+		return "strconv.FormatFloat(" + v + ", 'f', -1, 64)"
+	case "bool":
+		return "strconv.FormatBool(" + v + ")"
+	}
+	return v
+}
+
+// 200のレスポンスのdataの型を返す dataを返さないAPIなら空文字列
+func (g *generator) resultType(op *openapi.Operation) (string, error) {
+	res, ok := op.Responses["200"]
+	if !ok {
+		return "", fmt.Errorf("200 response is not defined")
+	}
+	r, err := g.doc.ResolveResponse(res)
+	if err != nil {
+		return "", err
+	}
+	mt, ok := r.Content[openapi.ContentTypeJSON]
+	if !ok {
+		return "", nil
+	}
+	s, err := g.doc.ResolveSchema(mt.Schema)
+	if err != nil {
+		return "", err
+	}
+	data, ok := s.Properties["data"]
+	if !ok {
+		return "", nil
+	}
+	if data.Ref == "" {
+		return "", fmt.Errorf("data must be a $ref")
+	}
+	return openapi.RefName(data.Ref), nil
+}
+
+func (g *generator) operation(op *openapi.Operation) error {
+	name := methodName(op.OperationID)
+	fs, contentType, err := g.fields(op)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op.OperationID, err)
+	}
+	result, err := g.resultType(op)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op.OperationID, err)
+	}
+
+	if len(fs) > 0 {
+		g.printf("// %s の引数\n", name)
+		g.printf("type %sParams struct {\n", name)
+		for _, f := range fs {
+			t, err := g.fieldType(f)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", op.OperationID, f.name, err)
+			}
+			if f.desc != "" {
+				g.comment("\t", f.desc)
+			}
+			g.printf("\t%s %s\n", f.goName, t)
+		}
+		g.printf("}\n\n")
+	}
+
+	g.printf("// %s は %s %s を呼ぶ\n", name, op.Method, op.Path)
+	if op.Summary != "" {
+		g.comment("", op.Summary)
+	}
+	args := "ctx context.Context"
+	if len(fs) > 0 {
+		args += fmt.Sprintf(", params *%sParams", name)
+	}
+	if result != "" {
+		g.printf("func (c *Client) %s(%s) (*%s, error) {\n", name, args, result)
+	} else {
+		g.printf("func (c *Client) %s(%s) error {\n", name, args)
+	}
+
+	// パスパラメータを埋め込む
+	path := fmt.Sprintf("%q", op.Path)
+	for _, f := range fs {
+		if f.in != "path" {
+			continue
+		}
+		t, err := g.fieldType(f)
+		if err != nil {
+			return err
+		}
+		v := formatExpr(t, "params."+f.goName)
+		if t == "string" {
+			v = "url.PathEscape(" + v + ")"
+		}
+		path = strings.Replace(path, "{"+f.name+"}", `" + `+v+` + "`, 1)
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+	g.printf("\tpath := %s\n", path)
+
+	hasQuery, hasForm, hasFile := false, contentType != "", false
+	for _, f := range fs {
+		switch f.in {
+		case "query":
+			hasQuery = true
+		case "file":
+			hasFile = true
+		}
+	}
+	queryArg, formArg, filesArg := "nil", "nil", "nil"
+	if hasQuery {
+		queryArg = "query"
+		g.printf("\tquery := url.Values{}\n")
+	}
+	if hasForm {
+		formArg = "form"
+		g.printf("\tform := url.Values{}\n")
+	}
+	if hasFile {
+		filesArg = "files"
+		g.printf("\tfiles := map[string]*File{}\n")
+	}
+	for _, f := range fs {
+		t, err := g.fieldType(f)
+		if err != nil {
+			return err
+		}
+		target := "query"
+		switch f.in {
+		case "path":
+			continue
+		case "file":
+			g.printf("\tif params.%s != nil {\n\t\tfiles[%q] = params.%s\n\t}\n", f.goName, f.name, f.goName)
+			continue
+		case "form":
+			target = "form"
+		}
+		switch {
+		case strings.HasPrefix(t, "[]"):
+			g.printf("\tfor _, v := range params.%s {\n\t\t%s.Add(%q, %s)\n\t}\n", f.goName, target, f.name, formatExpr(t[2:], "v"))
+		case strings.HasPrefix(t, "*"):
+			g.printf("\tif params.%s != nil {\n\t\t%s.Set(%q, %s)\n\t}\n", f.goName, target, f.name, formatExpr(t, "*params."+f.goName))
+		case t == "string" && f.in == "query":
+			g.printf("\tif params.%s != \"\" {\n\t\t%s.Set(%q, params.%s)\n\t}\n", f.goName, target, f.name, f.goName)
+		default:
+			g.printf("\t%s.Set(%q, %s)\n", target, f.name, formatExpr(t, "params."+f.goName))
+		}
+	}
+	if op.Method == "POST" && !hasForm {
+		// ボディのないPOSTも空のフォームとして送る
+		formArg = "url.Values{}"
+	}
+
+	if result != "" {
+		g.printf("\tvar out %s\n", result)
+		g.printf("\tif err := c.call(ctx, %q, path, %s, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", op.Method, queryArg, formArg, filesArg)
+		g.printf("\treturn &out, nil\n")
+	} else {
+		g.printf("\treturn c.call(ctx, %q, path, %s, %s, %s, nil)\n", op.Method, queryArg, formArg, filesArg)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+func generate(doc *openapi.Document, pkg string) ([]byte, error) {
+	g := &generator{doc: doc}
+	for _, op := range doc.Operations() {
+		if err := g.operation(op); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.schemas(); err != nil {
+		return nil, err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by openapi-gen from openapi/openapi.yaml. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	imports := []string{"context", "net/url"}
+	if bytes.Contains(g.buf.Bytes(), []byte("strconv.")) {
+		imports = append(imports, "strconv")
+	}
+	fmt.Fprintf(&src, "import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&src, "\t%q\n", imp)
+	}
+	fmt.Fprintf(&src, ")\n\n")
+	src.Write(g.buf.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error format.Source: %w\n%s", err, src.Bytes())
+	}
+	return formatted, nil
+}
+
+func main() {
+	out := flag.String("o", "client_gen.go", "output file")
+	pkg := flag.String("package", "client", "package name")
+	flag.Parse()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error openapi.Load: %s\n", err)
+		os.Exit(1)
+	}
+	src, err := generate(doc, *pkg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error generate: %s\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "error os.WriteFile: %s\n", err)
+		os.Exit(1)
+	}
+}
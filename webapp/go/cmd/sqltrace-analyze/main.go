@@ -0,0 +1,237 @@
+// sqltrace-analyze は ISUCON_SQLITE_TRACE_FILE に出力されたクエリログを集計する
+// ローテーションされたファイル(trace.json.1 など)もまとめて指定できる
+//
+// 使い方:
+//
+//	sqltrace-analyze [-format table|json] [-sort total|count|avg|p95|max] [-limit N] [-n1-threshold N] [trace.json ...]
+//
+// ファイルを指定しなければ標準入力から読み込む
+//
+// N+1は同じリクエスト(request_id)の中で同じフィンガープリントが連続して実行された回数で判定する
+// 並行するリクエストのクエリが交互に出力されても、別のリクエストのクエリは数えない
+// request_idのないクエリ(リクエスト以外で実行したものや古い形式のログ)はまとめて1つのリクエストとみなす
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// isuports の sqlTraceLog と同じ形式
+type traceLog struct {
+	Time         string  `json:"time"`
+	DB           string  `json:"db"`
+	RequestID    string  `json:"request_id"`
+	Statement    string  `json:"statement"`
+	QueryTime    float64 `json:"query_time"`
+	AffectedRows int64   `json:"affected_rows"`
+}
+
+// フィンガープリントごとの集計結果
+type digest struct {
+	DB           string  `json:"db,omitempty"`
+	Fingerprint  string  `json:"fingerprint"`
+	Example      string  `json:"example"`
+	Count        int64   `json:"count"`
+	TotalTime    float64 `json:"total_time"`
+	AvgTime      float64 `json:"avg_time"`
+	P95Time      float64 `json:"p95_time"`
+	MaxTime      float64 `json:"max_time"`
+	AffectedRows int64   `json:"affected_rows"`
+	MaxRepeat    int64   `json:"max_repeat"` // 同じリクエストの中で同じフィンガープリントが連続して実行された最大回数
+	NPlusOne     bool    `json:"n_plus_one"`
+
+	times []float64
+}
+
+var (
+	stringLiteralRegexp = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+	// 識別子の一部(tenant2など)は残し、負の数は符号ごと置き換える
+	numberLiteralRegexp = regexp.MustCompile(`(^|[\s(,=<>+*/%-])-?\d+(?:\.\d+)?\b`)
+	inListRegexp        = regexp.MustCompile(`(?i)\bIN\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	valuesListRegexp    = regexp.MustCompile(`(?i)\bVALUES\s*(\([^()]*\))(?:\s*,\s*\([^()]*\))+`)
+	spacesRegexp        = regexp.MustCompile(`\s+`)
+)
+
+// リテラルを取り除いてクエリを正規化する
+func fingerprint(stmt string) string {
+	s := stringLiteralRegexp.ReplaceAllString(stmt, "?")
+	s = numberLiteralRegexp.ReplaceAllString(s, "${1}?")
+	s = inListRegexp.ReplaceAllString(s, "IN (?+)")
+	s = valuesListRegexp.ReplaceAllString(s, "VALUES $1+")
+	s = spacesRegexp.ReplaceAllString(s, " ")
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, ";")
+	return strings.TrimSpace(s)
+}
+
+// ソート済みのスライスからパーセンタイル値を返す
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// リクエストごとの直前のクエリと、それが連続して実行された回数
+type repeatState struct {
+	prev   string
+	repeat int64
+}
+
+func analyze(r io.Reader, digests map[string]*digest, n1Threshold int64) error {
+	repeats := map[string]*repeatState{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var l traceLog
+		if err := json.Unmarshal(line, &l); err != nil {
+			return fmt.Errorf("error json.Unmarshal: %s: %w", string(line), err)
+		}
+		// sqliteとMySQLで同じクエリがあっても別に集計する
+		fp := fingerprint(l.Statement)
+		key := l.DB + "\x00" + fp
+		d, ok := digests[key]
+		if !ok {
+			d = &digest{DB: l.DB, Fingerprint: fp, Example: l.Statement}
+			digests[key] = d
+		}
+		d.Count++
+		d.TotalTime += l.QueryTime
+		d.AffectedRows += l.AffectedRows
+		if l.QueryTime > d.MaxTime {
+			d.MaxTime = l.QueryTime
+		}
+		d.times = append(d.times, l.QueryTime)
+
+		// 同じリクエストで同じクエリが引数だけ変えて連続しているものはN+1とみなす
+		rs, ok := repeats[l.RequestID]
+		if !ok {
+			rs = &repeatState{}
+			repeats[l.RequestID] = rs
+		}
+		if key == rs.prev {
+			rs.repeat++
+		} else {
+			rs.prev, rs.repeat = key, 1
+		}
+		if rs.repeat > d.MaxRepeat {
+			d.MaxRepeat = rs.repeat
+		}
+		if n1Threshold > 0 && rs.repeat >= n1Threshold {
+			d.NPlusOne = true
+		}
+	}
+	return sc.Err()
+}
+
+func main() {
+	var (
+		format      = flag.String("format", "table", "output format: table or json")
+		sortKey     = flag.String("sort", "total", "sort key: total, count, avg, p95 or max")
+		limit       = flag.Int("limit", 20, "number of fingerprints to show (0 means all)")
+		n1Threshold = flag.Int64("n1-threshold", 10, "consecutive executions of the same fingerprint to flag as N+1 (0 disables)")
+	)
+	flag.Parse()
+
+	digests := map[string]*digest{}
+	if flag.NArg() == 0 {
+		if err := analyze(os.Stdin, digests, *n1Threshold); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = analyze(f, digests, *n1Threshold)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
+
+	ds := make([]*digest, 0, len(digests))
+	for _, d := range digests {
+		sort.Float64s(d.times)
+		d.AvgTime = d.TotalTime / float64(d.Count)
+		d.P95Time = percentile(d.times, 0.95)
+		ds = append(ds, d)
+	}
+	key := func(d *digest) float64 {
+		switch *sortKey {
+		case "count":
+			return float64(d.Count)
+		case "avg":
+			return d.AvgTime
+		case "p95":
+			return d.P95Time
+		case "max":
+			return d.MaxTime
+		default:
+			return d.TotalTime
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		if key(ds[i]) == key(ds[j]) {
+			if ds[i].Fingerprint == ds[j].Fingerprint {
+				return ds[i].DB < ds[j].DB
+			}
+			return ds[i].Fingerprint < ds[j].Fingerprint
+		}
+		return key(ds[i]) > key(ds[j])
+	})
+	if *limit > 0 && len(ds) > *limit {
+		ds = ds[:*limit]
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ds); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COUNT\tTOTAL(s)\tAVG(ms)\tP95(ms)\tMAX(ms)\tROWS\tN+1\tDB\tFINGERPRINT")
+		for _, d := range ds {
+			n1 := ""
+			if d.NPlusOne {
+				n1 = fmt.Sprintf("x%d", d.MaxRepeat)
+			}
+			fmt.Fprintf(w, "%d\t%.3f\t%.3f\t%.3f\t%.3f\t%d\t%s\t%s\t%s\n",
+				d.Count, d.TotalTime, d.AvgTime*1000, d.P95Time*1000, d.MaxTime*1000, d.AffectedRows, n1, d.DB, d.Fingerprint,
+			)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *format)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	for _, tc := range []struct {
+		stmt string
+		want string
+	}{
+		{"SELECT * FROM player WHERE id = 'abc'", "SELECT * FROM player WHERE id = ?"},
+		{`SELECT * FROM player WHERE name = "it\"s"`, "SELECT * FROM player WHERE name = ?"},
+		{"SELECT * FROM player WHERE name = 'it''s'", "SELECT * FROM player WHERE name = ?"},
+		{"SELECT * FROM player_score WHERE row_num > 10 AND score < -1.5", "SELECT * FROM player_score WHERE row_num > ? AND score < ?"},
+		// 識別子に含まれる数字は残す
+		{"SELECT * FROM tenant2 WHERE id = 1", "SELECT * FROM tenant2 WHERE id = ?"},
+		{"SELECT id FROM player LIMIT 10,20", "SELECT id FROM player LIMIT ?,?"},
+		{"UPDATE player_invite SET used_count = used_count-1", "UPDATE player_invite SET used_count = used_count-?"},
+		{"SELECT * FROM player WHERE id IN (?, ?, ?)", "SELECT * FROM player WHERE id IN (?+)"},
+		{"SELECT * FROM player WHERE id IN ('a','b')", "SELECT * FROM player WHERE id IN (?+)"},
+		{"INSERT INTO player (id, name) VALUES (?, ?), (?, ?), (?, ?)", "INSERT INTO player (id, name) VALUES (?, ?)+"},
+		{"INSERT INTO player (id, name) VALUES (?, ?)", "INSERT INTO player (id, name) VALUES (?, ?)"},
+		{"SELECT *\n\tFROM player\n  WHERE id = ?;", "SELECT * FROM player WHERE id = ?"},
+	} {
+		if got := fingerprint(tc.stmt); got != tc.want {
+			t.Errorf("fingerprint(%q) = %q, want %q", tc.stmt, got, tc.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	times := make([]float64, 100)
+	for i := range times {
+		times[i] = float64(i + 1)
+	}
+	for _, tc := range []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 0.95, 0},
+		{[]float64{3}, 0.95, 3},
+		{[]float64{1, 2}, 0.95, 2},
+		{times, 0.95, 95},
+		{times, 0.5, 50},
+		{times, 1, 100},
+		{times, 0, 1},
+	} {
+		if got := percentile(tc.sorted, tc.p); got != tc.want {
+			t.Errorf("percentile(len=%d, %f) = %f, want %f", len(tc.sorted), tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeNPlusOne(t *testing.T) {
+	// 2つのリクエストのクエリが交互に出力されていても、リクエストごとに数える
+	var b strings.Builder
+	for i := 0; i < 3; i++ {
+		b.WriteString(`{"db":"sqlite","request_id":"a","statement":"SELECT * FROM player WHERE id = 1","query_time":0.001}` + "\n")
+		b.WriteString(`{"db":"sqlite","request_id":"b","statement":"SELECT * FROM player WHERE id = 2","query_time":0.001}` + "\n")
+		b.WriteString(`{"db":"sqlite","request_id":"b","statement":"SELECT * FROM competition WHERE id = 3","query_time":0.001}` + "\n")
+	}
+	digests := map[string]*digest{}
+	if err := analyze(strings.NewReader(b.String()), digests, 3); err != nil {
+		t.Fatalf("error analyze: %s", err)
+	}
+	player := digests["sqlite\x00SELECT * FROM player WHERE id = ?"]
+	if player == nil || player.Count != 6 || player.MaxRepeat != 3 || !player.NPlusOne {
+		t.Fatalf("unexpected digest: %+v", player)
+	}
+	// リクエストbではplayerとcompetitionが交互なので連続していない
+	competition := digests["sqlite\x00SELECT * FROM competition WHERE id = ?"]
+	if competition == nil || competition.MaxRepeat != 1 || competition.NPlusOne {
+		t.Fatalf("unexpected digest: %+v", competition)
+	}
+
+	// 別のリクエストにまたがって連続していてもN+1とはみなさない
+	b.Reset()
+	for _, id := range []string{"c", "d", "e"} {
+		b.WriteString(`{"db":"sqlite","request_id":"` + id + `","statement":"SELECT * FROM tenant WHERE id = 1","query_time":0.001}` + "\n")
+	}
+	digests = map[string]*digest{}
+	if err := analyze(strings.NewReader(b.String()), digests, 3); err != nil {
+		t.Fatalf("error analyze: %s", err)
+	}
+	if d := digests["sqlite\x00SELECT * FROM tenant WHERE id = ?"]; d == nil || d.MaxRepeat != 1 || d.NPlusOne {
+		t.Fatalf("unexpected digest: %+v", d)
+	}
+}
@@ -0,0 +1,390 @@
+package isuports
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"gopkg.in/yaml.v3"
+)
+
+// isuportsの設定
+// デフォルト値 → 設定ファイル(YAMLかTOML) → 環境変数 の順に上書きする
+// 環境変数名はenvタグで指定する
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	AdminDB     AdminDBConfig     `yaml:"admin_db" toml:"admin_db"`
+	TenantDB    TenantDBConfig    `yaml:"tenant_db" toml:"tenant_db"`
+	Routing     RoutingConfig     `yaml:"routing" toml:"routing"`
+	JWT         JWTConfig         `yaml:"jwt" toml:"jwt"`
+	TenantCache TenantCacheConfig `yaml:"tenant_cache" toml:"tenant_cache"`
+	Billing     BillingConfig     `yaml:"billing" toml:"billing"`
+	SQLTrace    SQLTraceConfig    `yaml:"sql_trace" toml:"sql_trace"`
+	OTel        OTelConfig        `yaml:"otel" toml:"otel"`
+	OpenAPI     OpenAPIConfig     `yaml:"openapi" toml:"openapi"`
+}
+
+type ServerConfig struct {
+	Port        string `yaml:"port" toml:"port" env:"SERVER_APP_PORT"`
+	MetricsPort string `yaml:"metrics_port" toml:"metrics_port" env:"ISUCON_METRICS_PORT"`
+	// 終了時に処理中のリクエストを待つ時間
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"ISUCON_SHUTDOWN_TIMEOUT"`
+}
+
+type AdminDBConfig struct {
+	// mysql か sqlite3 sqlite3はMySQLを用意できない結合テストやローカルでの動作確認向け (admindb_sqlite.go を参照)
+	Driver       string `yaml:"driver" toml:"driver" env:"ISUCON_DB_DRIVER"`
+	Host         string `yaml:"host" toml:"host" env:"ISUCON_DB_HOST"`
+	Port         string `yaml:"port" toml:"port" env:"ISUCON_DB_PORT"`
+	User         string `yaml:"user" toml:"user" env:"ISUCON_DB_USER"`
+	Password     string `yaml:"password" toml:"password" env:"ISUCON_DB_PASSWORD"`
+	Name         string `yaml:"name" toml:"name" env:"ISUCON_DB_NAME"`
+	MaxOpenConns int    `yaml:"max_open_conns" toml:"max_open_conns" env:"ISUCON_DB_MAX_OPEN_CONNS"`
+	// driverがsqlite3のときのデータベースファイルのパス
+	File string `yaml:"file" toml:"file" env:"ISUCON_DB_FILE"`
+}
+
+type TenantDBConfig struct {
+	Dir string `yaml:"dir" toml:"dir" env:"ISUCON_TENANT_DB_DIR"`
+	// テナントのロックを待つ時間の上限 0なら取得できるまで待つ
+	LockTimeout time.Duration `yaml:"lock_timeout" toml:"lock_timeout" env:"ISUCON_TENANT_LOCK_TIMEOUT"`
+}
+
+type RoutingConfig struct {
+	// host: ホスト名でテナントを判別する path: /t/{テナント名}/api/... で判別する
+	Mode          string `yaml:"mode" toml:"mode" env:"ISUCON_TENANT_ROUTING"`
+	BaseHostname  string `yaml:"base_hostname" toml:"base_hostname" env:"ISUCON_BASE_HOSTNAME"`
+	AdminHostname string `yaml:"admin_hostname" toml:"admin_hostname" env:"ISUCON_ADMIN_HOSTNAME"`
+}
+
+type JWTConfig struct {
+	KeyFile string `yaml:"key_file" toml:"key_file" env:"ISUCON_JWT_KEY_FILE"`
+}
+
+type TenantCacheConfig struct {
+	TTL time.Duration `yaml:"ttl" toml:"ttl" env:"ISUCON_TENANT_CACHE_TTL"`
+	// 存在しないテナント名のキャッシュの有効期限
+	NegativeTTL time.Duration `yaml:"negative_ttl" toml:"negative_ttl" env:"ISUCON_TENANT_NEGATIVE_CACHE_TTL"`
+}
+
+type BillingConfig struct {
+	// SaaS管理者向けの課金計算で同時に処理するテナント数
+	Concurrency   int           `yaml:"concurrency" toml:"concurrency" env:"ISUCON_BILLING_CONCURRENCY"`
+	TenantTimeout time.Duration `yaml:"tenant_timeout" toml:"tenant_timeout" env:"ISUCON_BILLING_TENANT_TIMEOUT"`
+}
+
+type SQLTraceConfig struct {
+	// 空ならクエリログを出力しない
+	File            string  `yaml:"file" toml:"file" env:"ISUCON_SQLITE_TRACE_FILE"`
+	SampleRate      float64 `yaml:"sample_rate" toml:"sample_rate" env:"ISUCON_SQL_TRACE_SAMPLE_RATE"`
+	SlowThresholdMs float64 `yaml:"slow_threshold_ms" toml:"slow_threshold_ms" env:"ISUCON_SQL_TRACE_SLOW_THRESHOLD_MS"`
+	MaxSizeMB       int64   `yaml:"max_size_mb" toml:"max_size_mb" env:"ISUCON_SQL_TRACE_MAX_SIZE_MB"`
+	MaxBackups      int     `yaml:"max_backups" toml:"max_backups" env:"ISUCON_SQL_TRACE_MAX_BACKUPS"`
+}
+
+type OTelConfig struct {
+	// 空ならトレースを出力しない otlp か file
+	Exporter  string `yaml:"exporter" toml:"exporter" env:"ISUCON_OTEL_EXPORTER"`
+	TraceFile string `yaml:"trace_file" toml:"trace_file" env:"ISUCON_OTEL_TRACE_FILE"`
+}
+
+// openapi/openapi.yaml の定義による検証の設定
+// openapivalidation.go を参照
+type OpenAPIConfig struct {
+	// 定義に合わないリクエストを400で拒否する
+	ValidateRequests bool `yaml:"validate_requests" toml:"validate_requests" env:"ISUCON_OPENAPI_VALIDATE_REQUESTS"`
+	// 定義に合わないレスポンスをログに出力する
+	ValidateResponses bool `yaml:"validate_responses" toml:"validate_responses" env:"ISUCON_OPENAPI_VALIDATE_RESPONSES"`
+}
+
+// Runで読み込んだ設定に差し替える
+var appConfig = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            "3000",
+			MetricsPort:     "9101",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		AdminDB: AdminDBConfig{
+			Driver:       AdminDBDriverMySQL,
+			Host:         "127.0.0.1",
+			Port:         "3306",
+			User:         "isucon",
+			Password:     "isucon",
+			Name:         "isuports",
+			MaxOpenConns: 10,
+		},
+		TenantDB: TenantDBConfig{
+			Dir: "../tenant_db",
+		},
+		Routing: RoutingConfig{
+			Mode:          TenantRoutingHost,
+			BaseHostname:  ".t.isucon.dev",
+			AdminHostname: "admin.t.isucon.dev",
+		},
+		JWT: JWTConfig{
+			KeyFile: "../public.pem",
+		},
+		TenantCache: TenantCacheConfig{
+			TTL:         60 * time.Second,
+			NegativeTTL: 5 * time.Second,
+		},
+		Billing: BillingConfig{
+			Concurrency:   4,
+			TenantTimeout: 10 * time.Second,
+		},
+		SQLTrace: SQLTraceConfig{
+			SampleRate: 1,
+			MaxBackups: 5,
+		},
+		OTel: OTelConfig{
+			TraceFile: "otel-trace.json",
+		},
+	}
+}
+
+// 設定を読み込む 検証はvalidateで行う
+// pathが空なら設定ファイルは読まない 拡張子が .toml ならTOML、それ以外はYAMLとして読む
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error os.ReadFile: path=%s, %w", path, err)
+		}
+		if strings.EqualFold(filepath.Ext(path), ".toml") {
+			err = decodeTOMLConfig(b, cfg)
+		} else {
+			err = decodeYAMLConfig(b, cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: path=%s", err, path)
+		}
+	}
+	if err := applyEnvOverrides(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 設定項目の書き間違いに気づけるよう、どちらの形式でも知らないキーはエラーにする
+func decodeYAMLConfig(b []byte, cfg *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("error yaml.Decode: %w", err)
+	}
+	return nil
+}
+
+func decodeTOMLConfig(b []byte, cfg *Config) error {
+	md, err := toml.Decode(string(b), cfg)
+	if err != nil {
+		return fmt.Errorf("error toml.Decode: %w", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		return fmt.Errorf("error toml.Decode: unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// envタグで指定した環境変数が設定されていれば上書きする
+func applyEnvOverrides(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(f); err != nil {
+				return err
+			}
+			continue
+		}
+		key := t.Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(f, val); err != nil {
+			return fmt.Errorf("invalid %s: %s, %w", key, val, err)
+		}
+	}
+	return nil
+}
+
+func setConfigValue(f reflect.Value, val string) error {
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported config type: %s", f.Type())
+	}
+	return nil
+}
+
+func validatePort(name, port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%s must be a port number: %q", name, port)
+	}
+	return nil
+}
+
+// 起動時に設定をまとめて検証し、問題をすべて返す
+func (cfg *Config) validate() error {
+	var errs []string
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	checkf := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(validatePort("server.port", cfg.Server.Port))
+	check(validatePort("server.metrics_port", cfg.Server.MetricsPort))
+	checkf(cfg.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive: %s", cfg.Server.ShutdownTimeout)
+
+	switch cfg.AdminDB.Driver {
+	case AdminDBDriverMySQL:
+		checkf(cfg.AdminDB.Host != "", "admin_db.host is required")
+		check(validatePort("admin_db.port", cfg.AdminDB.Port))
+		checkf(cfg.AdminDB.Name != "", "admin_db.name is required")
+	case AdminDBDriverSQLite:
+		checkf(cfg.AdminDB.File != "", "admin_db.file is required when admin_db.driver is %s", AdminDBDriverSQLite)
+	default:
+		errs = append(errs, fmt.Sprintf("admin_db.driver must be %s or %s: %q", AdminDBDriverMySQL, AdminDBDriverSQLite, cfg.AdminDB.Driver))
+	}
+	checkf(cfg.AdminDB.MaxOpenConns > 0, "admin_db.max_open_conns must be positive: %d", cfg.AdminDB.MaxOpenConns)
+
+	if st, err := os.Stat(cfg.TenantDB.Dir); err != nil {
+		errs = append(errs, fmt.Sprintf("tenant_db.dir is not accessible: %s", err))
+	} else {
+		checkf(st.IsDir(), "tenant_db.dir is not a directory: %s", cfg.TenantDB.Dir)
+	}
+	checkf(cfg.TenantDB.LockTimeout >= 0, "tenant_db.lock_timeout must not be negative: %s", cfg.TenantDB.LockTimeout)
+
+	checkf(
+		cfg.Routing.Mode == TenantRoutingHost || cfg.Routing.Mode == TenantRoutingPath,
+		"routing.mode must be %s or %s: %q", TenantRoutingHost, TenantRoutingPath, cfg.Routing.Mode,
+	)
+	// ベースのホスト名を間違えると全てのテナントが「存在しない」扱いになるので、形式を確かめておく
+	checkf(
+		strings.HasPrefix(cfg.Routing.BaseHostname, ".") &&
+			tenantDomainRegexp.MatchString(strings.TrimPrefix(cfg.Routing.BaseHostname, ".")),
+		"routing.base_hostname must be a lowercase hostname starting with '.' (e.g. .t.isucon.dev): %q", cfg.Routing.BaseHostname,
+	)
+	checkf(
+		tenantDomainRegexp.MatchString(cfg.Routing.AdminHostname),
+		"routing.admin_hostname must be a lowercase hostname: %q", cfg.Routing.AdminHostname,
+	)
+
+	if b, err := os.ReadFile(cfg.JWT.KeyFile); err != nil {
+		errs = append(errs, fmt.Sprintf("jwt.key_file is not readable: %s", err))
+	} else if _, _, err := jwk.DecodePEM(b); err != nil {
+		errs = append(errs, fmt.Sprintf("jwt.key_file is not a valid PEM key: %s", err))
+	}
+
+	checkf(cfg.TenantCache.TTL > 0, "tenant_cache.ttl must be positive: %s", cfg.TenantCache.TTL)
+	checkf(cfg.TenantCache.NegativeTTL > 0, "tenant_cache.negative_ttl must be positive: %s", cfg.TenantCache.NegativeTTL)
+
+	checkf(cfg.Billing.Concurrency > 0, "billing.concurrency must be positive: %d", cfg.Billing.Concurrency)
+	checkf(cfg.Billing.TenantTimeout > 0, "billing.tenant_timeout must be positive: %s", cfg.Billing.TenantTimeout)
+
+	checkf(cfg.SQLTrace.SampleRate >= 0 && cfg.SQLTrace.SampleRate <= 1, "sql_trace.sample_rate must be between 0 and 1: %v", cfg.SQLTrace.SampleRate)
+	checkf(cfg.SQLTrace.SlowThresholdMs >= 0, "sql_trace.slow_threshold_ms must not be negative: %v", cfg.SQLTrace.SlowThresholdMs)
+	checkf(cfg.SQLTrace.MaxSizeMB >= 0, "sql_trace.max_size_mb must not be negative: %d", cfg.SQLTrace.MaxSizeMB)
+	checkf(cfg.SQLTrace.MaxBackups >= 0, "sql_trace.max_backups must not be negative: %d", cfg.SQLTrace.MaxBackups)
+
+	switch cfg.OTel.Exporter {
+	case "", "otlp":
+	case "file":
+		checkf(cfg.OTel.TraceFile != "", "otel.trace_file is required when otel.exporter is file")
+	default:
+		errs = append(errs, fmt.Sprintf("otel.exporter must be empty, otlp or file: %q", cfg.OTel.Exporter))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// --print-config で出力する
+// パスワードは伏せる
+func (cfg *Config) print(w io.Writer) error {
+	c := *cfg
+	if c.AdminDB.Password != "" {
+		c.AdminDB.Password = "********"
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&c); err != nil {
+		return fmt.Errorf("error yaml.Encode: %w", err)
+	}
+	return enc.Close()
+}
+
+type commandLineOptions struct {
+	configPath    string
+	printConfig   bool
+	reindexSearch bool
+}
+
+func parseCommandLine(args []string) (*commandLineOptions, error) {
+	opts := &commandLineOptions{}
+	fs := flag.NewFlagSet("isuports", flag.ContinueOnError)
+	fs.StringVar(&opts.configPath, "config", os.Getenv("ISUCON_CONFIG_FILE"), "path to YAML or TOML (.toml) config file (env: ISUCON_CONFIG_FILE)")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "print the effective config and exit")
+	fs.BoolVar(&opts.reindexSearch, "reindex-search", false, "rebuild the admin search index from all tenant DBs and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
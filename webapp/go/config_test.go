@@ -0,0 +1,84 @@
+package isuports
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigTOML(t *testing.T) {
+	// 同じ内容の例なので、どちらの形式で読んでも同じ設定になる
+	fromYAML, err := loadConfig("config.example.yaml")
+	if err != nil {
+		t.Fatalf("error loadConfig: %s", err)
+	}
+	fromTOML, err := loadConfig("config.example.toml")
+	if err != nil {
+		t.Fatalf("error loadConfig: %s", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromTOML) {
+		t.Fatalf("config mismatch:\nyaml=%+v\ntoml=%+v", fromYAML, fromTOML)
+	}
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "isuports.toml")
+	if err := os.WriteFile(p, []byte("[tenant_db]\nlock_timeout = \"3s\"\n"), 0644); err != nil {
+		t.Fatalf("error os.WriteFile: %s", err)
+	}
+	cfg, err := loadConfig(p)
+	if err != nil {
+		t.Fatalf("error loadConfig: %s", err)
+	}
+	if cfg.TenantDB.LockTimeout.String() != "3s" {
+		t.Fatalf("unexpected lock_timeout: %s", cfg.TenantDB.LockTimeout)
+	}
+
+	// 知らないキーはエラーにする
+	if err := os.WriteFile(p, []byte("[tenant_db]\nlock_timout = \"3s\"\n"), 0644); err != nil {
+		t.Fatalf("error os.WriteFile: %s", err)
+	}
+	if _, err := loadConfig(p); err == nil || !strings.Contains(err.Error(), "tenant_db.lock_timout") {
+		t.Fatalf("expected unknown key error: %v", err)
+	}
+}
+
+func TestLoadConfigEnvOverride(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "isuports.yaml")
+	if err := os.WriteFile(p, []byte("tenant_db:\n  lock_timeout: 2s\nbilling:\n  concurrency: 8\n"), 0644); err != nil {
+		t.Fatalf("error os.WriteFile: %s", err)
+	}
+	// デフォルト値 → 設定ファイル → 環境変数 の順に上書きする
+	t.Setenv("ISUCON_BILLING_CONCURRENCY", "16")
+	cfg, err := loadConfig(p)
+	if err != nil {
+		t.Fatalf("error loadConfig: %s", err)
+	}
+	if cfg.TenantDB.LockTimeout != 2*time.Second || cfg.Billing.Concurrency != 16 || cfg.Server.Port != defaultConfig().Server.Port {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	t.Setenv("ISUCON_BILLING_CONCURRENCY", "many")
+	if _, err := loadConfig(p); err == nil || !strings.Contains(err.Error(), "ISUCON_BILLING_CONCURRENCY") {
+		t.Fatalf("expected invalid env error: %v", err)
+	}
+	t.Setenv("ISUCON_BILLING_CONCURRENCY", "16")
+
+	// 知らないキーはエラーにする
+	if err := os.WriteFile(p, []byte("tenant_db:\n  lock_timout: 2s\n"), 0644); err != nil {
+		t.Fatalf("error os.WriteFile: %s", err)
+	}
+	if _, err := loadConfig(p); err == nil {
+		t.Fatalf("expected unknown key error")
+	}
+
+	// 問題はまとめて返す
+	cfg.Server.Port = "http"
+	cfg.Routing.Mode = "cookie"
+	err = cfg.validate()
+	if err == nil || !strings.Contains(err.Error(), "server.port") || !strings.Contains(err.Error(), "routing.mode") {
+		t.Fatalf("expected validation errors: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// テナント全体のバージョンを表すcompetition_id
+const tenantWideVersionKey = ""
+
+// テナント・大会ごとの内容のバージョンを取得する
+// 一度も更新されていなければ0を返す
+func retrieveContentVersion(ctx context.Context, tenantID int64, competitionID string) (int64, error) {
+	var version int64
+	if err := adminDB.GetContext(
+		ctx,
+		&version,
+		"SELECT version FROM content_version WHERE tenant_id = ? AND competition_id = ?",
+		tenantID, competitionID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error Select content_version: tenantID=%d, competitionID=%s, %w", tenantID, competitionID, err)
+	}
+	return version, nil
+}
+
+// テナント全体と全ての大会のバージョンのうち、最新のものを返す
+// 大会ごとのバージョンしか上げない更新があっても、テナント内のどこかが変われば値が変わる
+func retrieveLatestContentVersion(ctx context.Context, tenantID int64) (int64, error) {
+	var version int64
+	if err := adminDB.GetContext(
+		ctx,
+		&version,
+		"SELECT COALESCE(MAX(version), 0) FROM content_version WHERE tenant_id = ?",
+		tenantID,
+	); err != nil {
+		return 0, fmt.Errorf("error Select max content_version: tenantID=%d, %w", tenantID, err)
+	}
+	return version, nil
+}
+
+// テナント・大会の内容が変わったのでバージョンを上げる
+// competitionIDを指定した場合はテナント全体のバージョンも上げる
+// 単調増加すればよいので現在時刻をバージョンにする
+func bumpContentVersion(ctx context.Context, tenantID int64, competitionID string) error {
+	version := time.Now().UnixNano()
+	keys := []string{tenantWideVersionKey}
+	if competitionID != tenantWideVersionKey {
+		keys = append(keys, competitionID)
+	}
+	for _, key := range keys {
+		if _, err := adminDB.ExecContext(
+			ctx,
+			"REPLACE INTO content_version (tenant_id, competition_id, version) VALUES (?, ?, ?)",
+			tenantID, key, version,
+		); err != nil {
+			return fmt.Errorf("error Replace content_version: tenantID=%d, competitionID=%s, version=%d, %w", tenantID, key, version, err)
+		}
+	}
+	return nil
+}
+
+// 弱いETagを作る
+func weakETag(kind string, versions ...int64) string {
+	parts := make([]string, 0, len(versions)+1)
+	parts = append(parts, kind)
+	for _, v := range versions {
+		parts = append(parts, fmt.Sprintf("%x", v))
+	}
+	return `W/"` + strings.Join(parts, "-") + `"`
+}
+
+// If-None-Matchが指定されたETagと一致するかどうか
+// 弱い比較なので W/ の有無は無視する
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	target := strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagを設定し、リクエストのIf-None-Matchと一致していればtrueを返す
+// trueの場合は304を返せばよい
+func checkNotModified(c echo.Context, etag string) bool {
+	c.Response().Header().Set("ETag", etag)
+	return etagMatch(c.Request().Header.Get("If-None-Match"), etag)
+}
+
+// 304 Not Modifiedを返す
+func notModified(c echo.Context) error {
+	return c.NoContent(http.StatusNotModified)
+}
@@ -0,0 +1,95 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/labstack/echo/v4"
+)
+
+// If-None-Matchを付けてGETし、ステータスとETagを返す
+func getWithETag(t *testing.T, cl *client.Client, path, etag string) (int, string) {
+	t.Helper()
+	cl.Header.Set("If-None-Match", etag)
+	defer cl.Header.Del("If-None-Match")
+	res, err := cl.Do(context.Background(), http.MethodGet, path, nil, nil, "")
+	if err != nil {
+		t.Fatalf("error Do: %s", err)
+	}
+	res.Body.Close()
+	return res.StatusCode, res.Header.Get("ETag")
+}
+
+func TestPlayerETag(t *testing.T) {
+	tenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	competitionID := addTestCompetition(t, tenantName, "competition")
+	player := newPlayerClient(t, tenantName, ids[0])
+
+	status, etag := getWithETag(t, player, "/api/player/player/"+ids[0], "")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("unexpected response: status=%d, etag=%s", status, etag)
+	}
+	if status, _ := getWithETag(t, player, "/api/player/player/"+ids[0], etag); status != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", status)
+	}
+	// 他の参加者や存在しない参加者には同じETagを使えない
+	if status, _ := getWithETag(t, player, "/api/player/player/"+ids[1], etag); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if status, _ := getWithETag(t, player, "/api/player/player/unknown", etag); status != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", status)
+	}
+
+	// スコアの入稿や大会の終了で変わる
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100")
+	status, next := getWithETag(t, player, "/api/player/player/"+ids[0], etag)
+	if status != http.StatusOK || next == etag {
+		t.Fatalf("expected new etag after score upload: status=%d, etag=%s", status, next)
+	}
+	_, competitionsETag := getWithETag(t, player, "/api/player/competitions", "")
+	if err := newOrganizerClient(t, tenantName).CompetitionFinish(context.Background(), &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	if status, _ := getWithETag(t, player, "/api/player/competitions", competitionsETag); status != http.StatusOK {
+		t.Fatalf("expected 200 after finish, got %d", status)
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	etag := weakETag("ranking", 10, 255)
+	if etag != `W/"ranking-a-ff"` {
+		t.Fatalf("unexpected weakETag: %s", etag)
+	}
+	for _, tc := range []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`W/"ranking-a-ff"`, true},
+		// 弱い比較なので W/ の有無は無視する
+		{`"ranking-a-ff"`, true},
+		{`W/"ranking-a-fe"`, false},
+		{`W/"player-1", W/"ranking-a-ff"`, true},
+		{"*", true},
+	} {
+		if got := etagMatch(tc.ifNoneMatch, etag); got != tc.want {
+			t.Errorf("etagMatch(%q) = %t, want %t", tc.ifNoneMatch, got, tc.want)
+		}
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if !checkNotModified(c, etag) {
+		t.Fatalf("checkNotModified must be true")
+	}
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Fatalf("unexpected ETag header: %s", got)
+	}
+}
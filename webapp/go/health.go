@@ -0,0 +1,76 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type ReadyzHandlerResult struct {
+	Checks map[string]string `json:"checks"` // 確認項目ごとに "ok" かエラーの内容
+}
+
+// GET /healthz
+// プロセスが応答できるかだけを返す
+// テナントの判別はしない
+func healthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
+
+// GET /readyz
+// リクエストを受け付けられるかを返す
+// 管理用DBに接続できることと、テナントDBのディレクトリに書き込めることを確認する
+// テナントの判別はしない
+func readyzHandler(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(requestContext(c), readinessCheckTimeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"admin_db":      "ok",
+		"tenant_db_dir": "ok",
+	}
+	ready := true
+	if err := adminDB.PingContext(ctx); err != nil {
+		checks["admin_db"] = err.Error()
+		ready = false
+	}
+	if err := checkTenantDBDirWritable(); err != nil {
+		checks["tenant_db_dir"] = err.Error()
+		ready = false
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, SuccessResult{Status: ready, Data: ReadyzHandlerResult{Checks: checks}})
+}
+
+// テナントDBのディレクトリに一時ファイルを作って書き込めるか確認する
+func checkTenantDBDirWritable() error {
+	tenantDBDir := appConfig.TenantDB.Dir
+	f, err := os.CreateTemp(tenantDBDir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("error os.CreateTemp: dir=%s, %w", tenantDBDir, err)
+	}
+	name := f.Name()
+	if _, err := f.WriteString("ok"); err != nil {
+		f.Close()
+		os.Remove(name)
+		return fmt.Errorf("error f.WriteString: path=%s, %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("error f.Close: path=%s, %w", name, err)
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("error os.Remove: path=%s, %w", name, err)
+	}
+	return nil
+}
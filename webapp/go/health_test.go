@@ -0,0 +1,60 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	// テナントを判別しないので、どのホスト名でも応答する
+	cl := newTestClient("unknown.example.com", "")
+	if err := cl.Healthz(ctx); err != nil {
+		t.Fatalf("error Healthz: %s", err)
+	}
+	res, err := cl.Readyz(ctx)
+	if err != nil {
+		t.Fatalf("error Readyz: %s", err)
+	}
+	for name, check := range res.Checks {
+		if check != "ok" {
+			t.Fatalf("%s is not ready: %s", name, check)
+		}
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	if err := healthzHandler(e.NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)); err != nil {
+		t.Fatalf("error healthzHandler: %s", err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":true}`+"\n" {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCheckTenantDBDirWritable(t *testing.T) {
+	dir := t.TempDir()
+	orig := appConfig.TenantDB.Dir
+	defer func() { appConfig.TenantDB.Dir = orig }()
+	appConfig.TenantDB.Dir = dir
+	if err := checkTenantDBDirWritable(); err != nil {
+		t.Fatalf("error checkTenantDBDirWritable: %s", err)
+	}
+	// 確認用のファイルは残さない
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected entries: %v, %v", entries, err)
+	}
+
+	appConfig.TenantDB.Dir = filepath.Join(dir, "missing")
+	if err := checkTenantDBDirWritable(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
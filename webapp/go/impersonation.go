@@ -0,0 +1,403 @@
+package isuports
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SaaS管理者のなりすましセッション
+// サポート担当が主催者や参加者の画面を確認するため、テナントとロールを指定して短時間だけ使えるトークンを発行する
+// トークンは Authorization: Bearer で送る 主催者のAPIトークンとはprefixで区別する
+// 既定では読み取り専用(GETのみ)で、トークンを使ったリクエストは全てimpersonation_audit_logに記録する
+
+const (
+	impersonationTokenPrefix = "isuports_imp_"
+	// なりすましであることをレスポンスでも示すヘッダ 値はセッションID
+	impersonationResponseHeader = "X-Isuports-Impersonation"
+
+	impersonationDefaultTTL = 15 * time.Minute
+	impersonationMaxTTL     = time.Hour
+
+	impersonationAuditLogLimit = 1000
+)
+
+type ImpersonationSessionRow struct {
+	ID        int64         `db:"id"`
+	TenantID  int64         `db:"tenant_id"`
+	Role      string        `db:"role"`
+	PlayerID  string        `db:"player_id"` // roleがplayerの場合のみ
+	TokenHash string        `db:"token_hash"`
+	Writable  bool          `db:"writable"`
+	Reason    string        `db:"reason"`
+	CreatedBy string        `db:"created_by"`
+	CreatedAt int64         `db:"created_at"`
+	ExpiresAt int64         `db:"expires_at"`
+	RevokedAt sql.NullInt64 `db:"revoked_at"`
+}
+
+type ImpersonationAuditLogRow struct {
+	ID        int64  `db:"id"`
+	SessionID int64  `db:"session_id"`
+	Method    string `db:"method"`
+	Path      string `db:"path"`
+	Allowed   bool   `db:"allowed"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// なりすましセッションでアクセスしているか
+func (v *Viewer) isImpersonated() bool {
+	return v.impersonationID != 0
+}
+
+// なりすましセッションのトークンを検証してViewerを返す
+// 読み取り専用のセッションでGET以外のリクエストをした場合は、記録したうえで403を返す
+func parseImpersonationViewer(c echo.Context, token string) (*Viewer, error) {
+	ctx := requestContext(c)
+	var s ImpersonationSessionRow
+	if err := adminDB.GetContext(
+		ctx,
+		&s,
+		"SELECT * FROM impersonation_session WHERE token_hash = ? AND revoked_at IS NULL",
+		hashAPIToken(token),
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid impersonation token")
+		}
+		return nil, fmt.Errorf("error Select impersonation_session: %w", err)
+	}
+	now := time.Now().Unix()
+	if s.ExpiresAt <= now {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "impersonation session is expired")
+	}
+
+	tenant, err := retrieveTenantRowFromHeader(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "tenant not found")
+		}
+		return nil, fmt.Errorf("error retrieveTenantRowFromHeader at parseImpersonationViewer: %w", err)
+	}
+	// JWTのaudと同様に、セッションを発行したテナント以外では使えない
+	if tenant.ID != s.TenantID {
+		return nil, echo.NewHTTPError(
+			http.StatusUnauthorized,
+			fmt.Sprintf("invalid impersonation token: tenant is not match with %s", c.Request().Host),
+		)
+	}
+
+	method := c.Request().Method
+	allowed := s.Writable || method == http.MethodGet || method == http.MethodHead
+	if _, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO impersonation_audit_log (session_id, method, path, allowed, created_at) VALUES (:session_id, :method, :path, :allowed, :created_at)",
+		ImpersonationAuditLogRow{
+			SessionID: s.ID,
+			Method:    method,
+			Path:      c.Request().URL.RequestURI(),
+			Allowed:   allowed,
+			CreatedAt: now,
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error Insert impersonation_audit_log: sessionID=%d, %w", s.ID, err)
+	}
+	c.Response().Header().Set(impersonationResponseHeader, strconv.FormatInt(s.ID, 10))
+	if !allowed {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "impersonation session is read-only")
+	}
+
+	playerID := s.PlayerID
+	if s.Role == RoleOrganizer {
+		playerID = fmt.Sprintf("impersonation:%d", s.ID)
+	}
+	return &Viewer{
+		role:                  s.Role,
+		playerID:              playerID,
+		tenantName:            tenant.Name,
+		tenantID:              tenant.ID,
+		impersonationID:       s.ID,
+		impersonatedBy:        s.CreatedBy,
+		impersonationWritable: s.Writable,
+	}, nil
+}
+
+type ImpersonationDetail struct {
+	ID         string `json:"id"`
+	TenantName string `json:"tenant_name"`
+	Role       string `json:"role"`
+	PlayerID   string `json:"player_id"`
+	Writable   bool   `json:"writable"`
+	Reason     string `json:"reason"`
+	CreatedBy  string `json:"created_by"`
+	CreatedAt  int64  `json:"created_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  *int64 `json:"revoked_at"`
+}
+
+func impersonationDetail(s ImpersonationSessionRow, tenantName string) ImpersonationDetail {
+	d := ImpersonationDetail{
+		ID:         strconv.FormatInt(s.ID, 10),
+		TenantName: tenantName,
+		Role:       s.Role,
+		PlayerID:   s.PlayerID,
+		Writable:   s.Writable,
+		Reason:     s.Reason,
+		CreatedBy:  s.CreatedBy,
+		CreatedAt:  s.CreatedAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+	if s.RevokedAt.Valid {
+		d.RevokedAt = &s.RevokedAt.Int64
+	}
+	return d
+}
+
+type ImpersonationsAddHandlerResult struct {
+	Impersonation ImpersonationDetail `json:"impersonation"`
+	Token         string              `json:"token"` // 作成時にのみ返す
+}
+
+type ImpersonationsHandlerResult struct {
+	Impersonations []ImpersonationDetail `json:"impersonations"`
+}
+
+// SaaS管理者向けAPI
+// POST /api/admin/impersonations/add
+// テナントの主催者か参加者になりすますセッションを発行する
+func impersonationsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := tenants.getByName(ctx, c.FormValue("tenant_name"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+		}
+		return fmt.Errorf("error tenants.getByName: %w", err)
+	}
+	role := c.FormValue("role")
+	playerID := c.FormValue("player_id")
+	switch role {
+	case RoleOrganizer:
+		if playerID != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "player_id is only for role player")
+		}
+	case RolePlayer:
+		if playerID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "player_id required")
+		}
+		tenantDB, err := connectToTenantDB(tenant.ID)
+		if err != nil {
+			return err
+		}
+		defer tenantDB.Close()
+		if _, err := retrievePlayer(ctx, tenantDB, playerID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "player not found")
+			}
+			return fmt.Errorf("error retrievePlayer: %w", err)
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid role: %s", role))
+	}
+	reason := c.FormValue("reason")
+	if reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason required")
+	}
+	writable := false
+	if s := c.FormValue("writable"); s != "" {
+		if writable, err = strconv.ParseBool(s); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid writable: %s", s))
+		}
+	}
+	ttl := impersonationDefaultTTL
+	if s := c.FormValue("expires_in"); s != "" {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || sec <= 0 || time.Duration(sec)*time.Second > impersonationMaxTTL {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid expires_in: %s", s))
+		}
+		ttl = time.Duration(sec) * time.Second
+	}
+
+	token, err := generateRandomToken(impersonationTokenPrefix)
+	if err != nil {
+		return fmt.Errorf("error generateRandomToken: %w", err)
+	}
+	now := time.Now()
+	s := ImpersonationSessionRow{
+		TenantID:  tenant.ID,
+		Role:      role,
+		PlayerID:  playerID,
+		TokenHash: hashAPIToken(token),
+		Writable:  writable,
+		Reason:    reason,
+		CreatedBy: v.playerID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	res, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO impersonation_session (tenant_id, role, player_id, token_hash, writable, reason, created_by, created_at, expires_at, revoked_at) VALUES (:tenant_id, :role, :player_id, :token_hash, :writable, :reason, :created_by, :created_at, :expires_at, :revoked_at)",
+		s,
+	)
+	if err != nil {
+		return fmt.Errorf("error Insert impersonation_session: tenantID=%d, role=%s, %w", tenant.ID, role, err)
+	}
+	if s.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("error get LastInsertId: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: ImpersonationsAddHandlerResult{
+			Impersonation: impersonationDetail(s, tenant.Name),
+			Token:         token,
+		},
+	})
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/impersonations
+// なりすましセッションの一覧を新しい順に最大100件返す
+// URL引数tenant_nameを指定した場合、そのテナントのセッションのみ返す
+func impersonationsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	type row struct {
+		ImpersonationSessionRow
+		TenantName string `db:"tenant_name"`
+	}
+	query := "SELECT impersonation_session.*, tenant.name AS tenant_name FROM impersonation_session JOIN tenant ON tenant.id = impersonation_session.tenant_id"
+	args := []any{}
+	if tenantName := c.QueryParam("tenant_name"); tenantName != "" {
+		query += " WHERE tenant.name = ?"
+		args = append(args, tenantName)
+	}
+	query += " ORDER BY impersonation_session.id DESC LIMIT 100"
+	rows := []row{}
+	if err := adminDB.SelectContext(ctx, &rows, query, args...); err != nil {
+		return fmt.Errorf("error Select impersonation_session: %w", err)
+	}
+	ds := make([]ImpersonationDetail, 0, len(rows))
+	for _, r := range rows {
+		ds = append(ds, impersonationDetail(r.ImpersonationSessionRow, r.TenantName))
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   ImpersonationsHandlerResult{Impersonations: ds},
+	})
+}
+
+// なりすましセッションをテナント名とあわせて取得する
+func retrieveImpersonationSession(c echo.Context) (*ImpersonationSessionRow, string, error) {
+	ctx := requestContext(c)
+	id, err := strconv.ParseInt(c.Param("impersonation_id"), 10, 64)
+	if err != nil {
+		return nil, "", echo.NewHTTPError(http.StatusBadRequest, "invalid impersonation_id")
+	}
+	var s ImpersonationSessionRow
+	if err := adminDB.GetContext(ctx, &s, "SELECT * FROM impersonation_session WHERE id = ?", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", echo.NewHTTPError(http.StatusNotFound, "impersonation not found")
+		}
+		return nil, "", fmt.Errorf("error Select impersonation_session: id=%d, %w", id, err)
+	}
+	tenant, err := tenants.getByID(ctx, s.TenantID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error tenants.getByID: %w", err)
+	}
+	return &s, tenant.Name, nil
+}
+
+// SaaS管理者向けAPI
+// POST /api/admin/impersonation/:impersonation_id/revoke
+// なりすましセッションを期限前に無効にする
+func impersonationRevokeHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	s, tenantName, err := retrieveImpersonationSession(c)
+	if err != nil {
+		return err
+	}
+	if !s.RevokedAt.Valid {
+		now := time.Now().Unix()
+		if _, err := adminDB.ExecContext(
+			ctx,
+			"UPDATE impersonation_session SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+			now, s.ID,
+		); err != nil {
+			return fmt.Errorf("error Update impersonation_session: id=%d, revokedAt=%d, %w", s.ID, now, err)
+		}
+		s.RevokedAt = sql.NullInt64{Int64: now, Valid: true}
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   ImpersonationsHandlerResult{Impersonations: []ImpersonationDetail{impersonationDetail(*s, tenantName)}},
+	})
+}
+
+type ImpersonationAuditLogDetail struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Allowed   bool   `json:"allowed"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ImpersonationAuditLogsHandlerResult struct {
+	Impersonation ImpersonationDetail           `json:"impersonation"`
+	AuditLogs     []ImpersonationAuditLogDetail `json:"audit_logs"`
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/impersonation/:impersonation_id/audit_logs
+// なりすましセッションで行われたリクエストを古い順に返す
+func impersonationAuditLogsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	s, tenantName, err := retrieveImpersonationSession(c)
+	if err != nil {
+		return err
+	}
+	ls := []ImpersonationAuditLogRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&ls,
+		"SELECT * FROM impersonation_audit_log WHERE session_id = ? ORDER BY id ASC LIMIT ?",
+		s.ID, impersonationAuditLogLimit,
+	); err != nil {
+		return fmt.Errorf("error Select impersonation_audit_log: sessionID=%d, %w", s.ID, err)
+	}
+	ds := make([]ImpersonationAuditLogDetail, 0, len(ls))
+	for _, l := range ls {
+		ds = append(ds, ImpersonationAuditLogDetail{
+			Method:    l.Method,
+			Path:      l.Path,
+			Allowed:   l.Allowed,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: ImpersonationAuditLogsHandlerResult{
+			Impersonation: impersonationDetail(*s, tenantName),
+			AuditLogs:     ds,
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+// なりすましセッションのトークンを付けたクライアントを返す
+func newImpersonationClient(t *testing.T, tenantName string, params *client.ImpersonationsAddParams) (*client.Client, *client.ImpersonationsAddHandlerResult) {
+	t.Helper()
+	params.TenantName = tenantName
+	added, err := newAdminClient(t).ImpersonationsAdd(context.Background(), params)
+	if err != nil {
+		t.Fatalf("error ImpersonationsAdd: %s", err)
+	}
+	cl := newTestClient(tenantHost(tenantName), "")
+	cl.Header.Set("Authorization", "Bearer "+added.Token)
+	return cl, added
+}
+
+func TestImpersonation(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice")
+	admin := newAdminClient(t)
+
+	// 参加者を指定しないplayerロールや理由のないセッションは発行できない
+	_, err := admin.ImpersonationsAdd(ctx, &client.ImpersonationsAddParams{TenantName: tenantName, Role: RolePlayer, Reason: "support"})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = admin.ImpersonationsAdd(ctx, &client.ImpersonationsAddParams{TenantName: tenantName, Role: RoleOrganizer})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = admin.ImpersonationsAdd(ctx, &client.ImpersonationsAddParams{TenantName: tenantName, Role: RolePlayer, PlayerID: ptr("unknown"), Reason: "support"})
+	assertStatus(t, err, http.StatusNotFound)
+	// 主催者はSaaS管理者のAPIでなりすましを発行できない
+	_, err = newOrganizerClient(t, tenantName).ImpersonationsAdd(ctx, &client.ImpersonationsAddParams{TenantName: tenantName, Role: RoleOrganizer, Reason: "support"})
+	assertStatus(t, err, http.StatusNotFound)
+
+	org, added := newImpersonationClient(t, tenantName, &client.ImpersonationsAddParams{Role: RoleOrganizer, Reason: "support"})
+	if added.Impersonation.Writable || added.Impersonation.CreatedBy != "admin" {
+		t.Fatalf("unexpected impersonation: %+v", added.Impersonation)
+	}
+	if _, err := org.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList with impersonation: %s", err)
+	}
+	me, err := org.Me(ctx)
+	if err != nil {
+		t.Fatalf("error Me: %s", err)
+	}
+	if !me.Impersonated || me.Role != RoleOrganizer {
+		t.Fatalf("unexpected me: %+v", me)
+	}
+	// 既定では読み取り専用
+	_, err = org.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"bob"}})
+	assertStatus(t, err, http.StatusForbidden)
+	// 書き込みを許可していても、なりすましでAPIトークンは発行できない
+	writable, _ := newImpersonationClient(t, tenantName, &client.ImpersonationsAddParams{Role: RoleOrganizer, Reason: "fix data", Writable: ptr(true)})
+	if _, err := writable.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"bob"}}); err != nil {
+		t.Fatalf("error PlayersAdd with writable impersonation: %s", err)
+	}
+	_, err = writable.APITokensAdd(ctx, &client.APITokensAddParams{Name: "ci", Scopes: []string{ScopePlayersRead}})
+	assertStatus(t, err, http.StatusForbidden)
+
+	// 全てのリクエストが記録される
+	logs, err := admin.ImpersonationAuditLogs(ctx, &client.ImpersonationAuditLogsParams{ImpersonationID: added.Impersonation.ID})
+	if err != nil {
+		t.Fatalf("error ImpersonationAuditLogs: %s", err)
+	}
+	if len(logs.AuditLogs) != 3 {
+		t.Fatalf("expected 3 audit logs, got %+v", logs.AuditLogs)
+	}
+	if l := logs.AuditLogs[2]; l.Method != http.MethodPost || l.Path != "/api/organizer/players/add" || l.Allowed {
+		t.Fatalf("unexpected audit log: %+v", l)
+	}
+
+	// 他のテナントでは使えない
+	other := newTestTenant(t)
+	cl := newTestClient(tenantHost(other), "")
+	cl.Header.Set("Authorization", "Bearer "+added.Token)
+	_, err = cl.PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+
+	list, err := admin.Impersonations(ctx, &client.ImpersonationsParams{TenantName: tenantName})
+	if err != nil {
+		t.Fatalf("error Impersonations: %s", err)
+	}
+	if len(list.Impersonations) != 2 || list.Impersonations[1].ID != added.Impersonation.ID {
+		t.Fatalf("unexpected impersonations: %+v", list.Impersonations)
+	}
+
+	revoked, err := admin.ImpersonationRevoke(ctx, &client.ImpersonationRevokeParams{ImpersonationID: added.Impersonation.ID})
+	if err != nil {
+		t.Fatalf("error ImpersonationRevoke: %s", err)
+	}
+	if revoked.Impersonations[0].RevokedAt == nil {
+		t.Fatalf("unexpected impersonation: %+v", revoked.Impersonations[0])
+	}
+	_, err = org.PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+
+	// 期限切れのセッションは使えない
+	player, playerAdded := newImpersonationClient(t, tenantName, &client.ImpersonationsAddParams{Role: RolePlayer, PlayerID: ptr(ids[0]), Reason: "support"})
+	me, err = player.Me(ctx)
+	if err != nil {
+		t.Fatalf("error Me: %s", err)
+	}
+	if !me.Impersonated || me.Me == nil || me.Me.ID != ids[0] {
+		t.Fatalf("unexpected me: %+v", me)
+	}
+	id, err := strconv.ParseInt(playerAdded.Impersonation.ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	if _, err := adminDB.ExecContext(ctx, "UPDATE impersonation_session SET expires_at = ? WHERE id = ?", time.Now().Unix()-1, id); err != nil {
+		t.Fatalf("error Update impersonation_session: %s", err)
+	}
+	_, err = player.Player(ctx, &client.PlayerParams{PlayerID: ids[0]})
+	assertStatus(t, err, http.StatusUnauthorized)
+}
+
+func TestImpersonationVisitHistory(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice")
+	competitionID := addTestCompetition(t, tenantName, "competition")
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100")
+
+	// なりすましで閲覧しても、課金対象の閲覧履歴には残らない
+	player, _ := newImpersonationClient(t, tenantName, &client.ImpersonationsAddParams{Role: RolePlayer, PlayerID: ptr(ids[0]), Reason: "support"})
+	if _, err := player.CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	var count int
+	if err := adminDB.GetContext(ctx, &count, "SELECT COUNT(*) FROM visit_history WHERE competition_id = ?", competitionID); err != nil {
+		t.Fatalf("error Select visit_history: %s", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no visit_history, got %d", count)
+	}
+}
@@ -0,0 +1,318 @@
+package isuports
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 参加者の招待コード
+// 主催者が発行したコードを使って、参加者が自分で参加登録できる
+// 登録した参加者のIDで blackauth の /auth/login/player からログインする
+// コードはAPIトークンと同様に平文では保存せずハッシュ値で照合するので、発行時にのみ返す
+
+const (
+	// 招待コードのバイト数 16進数にするので文字数はこの2倍
+	inviteCodeBytes = 8
+)
+
+type PlayerInviteRow struct {
+	ID        int64         `db:"id"`
+	TenantID  int64         `db:"tenant_id"`
+	CodeHash  string        `db:"code_hash"`
+	MaxUses   int64         `db:"max_uses"`   // 0なら無制限
+	UsedCount int64         `db:"used_count"` // 登録に使われた回数
+	ExpiresAt int64         `db:"expires_at"` // 0なら無期限
+	CreatedBy string        `db:"created_by"`
+	CreatedAt int64         `db:"created_at"`
+	RevokedAt sql.NullInt64 `db:"revoked_at"`
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error rand.Read: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type InviteDetail struct {
+	ID        string `json:"id"`
+	MaxUses   int64  `json:"max_uses"`
+	UsedCount int64  `json:"used_count"`
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	RevokedAt *int64 `json:"revoked_at"`
+}
+
+func inviteDetail(i PlayerInviteRow) InviteDetail {
+	d := InviteDetail{
+		ID:        strconv.FormatInt(i.ID, 10),
+		MaxUses:   i.MaxUses,
+		UsedCount: i.UsedCount,
+		ExpiresAt: i.ExpiresAt,
+		CreatedBy: i.CreatedBy,
+		CreatedAt: i.CreatedAt,
+	}
+	if i.RevokedAt.Valid {
+		d.RevokedAt = &i.RevokedAt.Int64
+	}
+	return d
+}
+
+type InvitesAddHandlerResult struct {
+	Invite InviteDetail `json:"invite"`
+	Code   string       `json:"code"` // 発行時にのみ返す
+}
+
+type InvitesHandlerResult struct {
+	Invites []InviteDetail `json:"invites"`
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/invites/add
+// 参加者の招待コードを発行する
+func invitesAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	var maxUses int64
+	if s := c.FormValue("max_uses"); s != "" {
+		if maxUses, err = strconv.ParseInt(s, 10, 64); err != nil || maxUses < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid max_uses: %s", s))
+		}
+	}
+	now := time.Now().Unix()
+	var expiresAt int64
+	if s := c.FormValue("expires_in"); s != "" {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || sec <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid expires_in: %s", s))
+		}
+		expiresAt = now + sec
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return fmt.Errorf("error generateInviteCode: %w", err)
+	}
+	i := PlayerInviteRow{
+		TenantID:  v.tenantID,
+		CodeHash:  hashAPIToken(code),
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedBy: v.playerID,
+		CreatedAt: now,
+	}
+	res, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO player_invite (tenant_id, code_hash, max_uses, used_count, expires_at, created_by, created_at, revoked_at) VALUES (:tenant_id, :code_hash, :max_uses, :used_count, :expires_at, :created_by, :created_at, :revoked_at)",
+		i,
+	)
+	if err != nil {
+		return fmt.Errorf("error Insert player_invite: tenantID=%d, %w", v.tenantID, err)
+	}
+	if i.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("error get LastInsertId: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: InvitesAddHandlerResult{
+			Invite: inviteDetail(i),
+			Code:   code,
+		},
+	})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/invites
+// 招待コードの一覧を返す 無効にしたコードも含む
+func invitesHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersRead, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	is := []PlayerInviteRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&is,
+		"SELECT * FROM player_invite WHERE tenant_id = ? ORDER BY id DESC",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select player_invite: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]InviteDetail, 0, len(is))
+	for _, i := range is {
+		ds = append(ds, inviteDetail(i))
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   InvitesHandlerResult{Invites: ds},
+	})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/invite/:invite_id/revoke
+// 招待コードを無効にする
+func inviteRevokeHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	inviteID, err := strconv.ParseInt(c.Param("invite_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid invite_id")
+	}
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE player_invite SET revoked_at = ? WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL",
+		now, inviteID, v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Update player_invite: id=%d, revokedAt=%d, %w", inviteID, now, err)
+	}
+	var i PlayerInviteRow
+	if err := adminDB.GetContext(
+		ctx,
+		&i,
+		"SELECT * FROM player_invite WHERE id = ? AND tenant_id = ?",
+		inviteID, v.tenantID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "invite not found")
+		}
+		return fmt.Errorf("error Select player_invite: id=%d, %w", inviteID, err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   InvitesHandlerResult{Invites: []InviteDetail{inviteDetail(i)}},
+	})
+}
+
+type PlayerRegisterHandlerResult struct {
+	Player PlayerDetail `json:"player"`
+}
+
+// 参加者向けAPI
+// POST /api/player/register
+// 招待コードを使って参加者を登録する ログインしていなくても呼び出せる
+func playerRegisterHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	tenant, err := retrieveTenantRowFromHeader(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+		}
+		return fmt.Errorf("error retrieveTenantRowFromHeader: %w", err)
+	}
+	if tenant.Name == "admin" {
+		return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+	}
+	// コードの総当たりを防ぐため、コードが正しいかどうかに関わらず数える
+	if err := checkPlayerRegisterRateLimit(c, tenant.ID); err != nil {
+		return err
+	}
+
+	code := c.FormValue("code")
+	if code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code required")
+	}
+	displayName := c.FormValue("display_name")
+	if displayName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "display_name required")
+	}
+
+	tenantDB, err := connectToTenantDB(tenant.ID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	// 同時に登録されて上限を超えないよう、数えてから追加し終わるまでロックする
+	fl, err := flockByTenantID(ctx, tenant.ID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	if err := checkPlayerQuota(ctx, tenantDB, tenant.ID, 1); err != nil {
+		return err
+	}
+
+	// 回数の上限を超えて使われないよう、残っている場合のみ使用回数を増やす
+	now := time.Now().Unix()
+	codeHash := hashAPIToken(code)
+	res, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE player_invite SET used_count = used_count + 1 WHERE tenant_id = ? AND code_hash = ? AND revoked_at IS NULL AND (max_uses = 0 OR used_count < max_uses) AND (expires_at = 0 OR expires_at > ?)",
+		tenant.ID, codeHash, now,
+	)
+	if err != nil {
+		return fmt.Errorf("error Update player_invite: tenantID=%d, %w", tenant.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error RowsAffected: %w", err)
+	} else if n == 0 {
+		// 存在しない・無効・期限切れ・使い切ったコードを区別しない
+		return echo.NewHTTPError(http.StatusForbidden, "invalid invite code")
+	}
+
+	id, err := insertPlayer(ctx, tenantDB, tenant.ID, displayName, now)
+	if err != nil {
+		// 登録できなかった分の使用回数を戻す
+		if _, rerr := adminDB.ExecContext(
+			ctx,
+			"UPDATE player_invite SET used_count = used_count - 1 WHERE tenant_id = ? AND code_hash = ?",
+			tenant.ID, codeHash,
+		); rerr != nil {
+			c.Logger().Errorf("error Update player_invite: tenantID=%d, %s", tenant.ID, rerr)
+		}
+		return err
+	}
+	// SaaS管理者向けの検索用インデックス search.go を参照
+	// 登録は終わっているので、失敗してもエラーにせずログに出す --reindex-search で作り直せる
+	if err := indexPlayers(ctx, adminDB, []PlayerSearchIndexRow{{
+		PlayerID:    id,
+		TenantID:    tenant.ID,
+		DisplayName: displayName,
+		CreatedAt:   now,
+	}}); err != nil {
+		c.Logger().Errorf("error indexPlayers: %s", err)
+	}
+	p, err := retrievePlayer(ctx, tenantDB, id)
+	if err != nil {
+		return fmt.Errorf("error retrievePlayer: %w", err)
+	}
+	pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   PlayerRegisterHandlerResult{Player: *pd},
+	})
+}
@@ -0,0 +1,189 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"golang.org/x/time/rate"
+)
+
+func TestInvites(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	anonymous := newTestClient(tenantHost(tenantName), "")
+
+	added, err := org.InvitesAdd(ctx, &client.InvitesAddParams{MaxUses: ptr(int64(1))})
+	if err != nil {
+		t.Fatalf("error InvitesAdd: %s", err)
+	}
+	code := added.Code
+	// コードは平文では保存しない
+	var n int
+	if err := adminDB.GetContext(ctx, &n, "SELECT COUNT(*) FROM player_invite WHERE code_hash = ?", hashAPIToken(code)); err != nil {
+		t.Fatalf("error Select player_invite: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	_, err = anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: "unknown", DisplayName: "alice"})
+	assertStatus(t, err, http.StatusForbidden)
+	// 他のテナントのコードは使えない
+	_, err = newTestClient(tenantHost(newTestTenant(t)), "").PlayerRegister(ctx, &client.PlayerRegisterParams{Code: code, DisplayName: "alice"})
+	assertStatus(t, err, http.StatusForbidden)
+
+	registered, err := anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: code, DisplayName: "alice"})
+	if err != nil {
+		t.Fatalf("error PlayerRegister: %s", err)
+	}
+	if registered.Player.DisplayName != "alice" {
+		t.Fatalf("unexpected player: %+v", registered.Player)
+	}
+	// 登録したIDでログインできる
+	if _, err := newPlayerClient(t, tenantName, registered.Player.ID).Player(ctx, &client.PlayerParams{PlayerID: registered.Player.ID}); err != nil {
+		t.Fatalf("error Player: %s", err)
+	}
+	// 回数の上限まで使ったコードは使えない
+	_, err = anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: code, DisplayName: "bob"})
+	assertStatus(t, err, http.StatusForbidden)
+
+	invites, err := org.Invites(ctx)
+	if err != nil {
+		t.Fatalf("error Invites: %s", err)
+	}
+	if len(invites.Invites) != 1 || invites.Invites[0].ID != added.Invite.ID || invites.Invites[0].UsedCount != 1 {
+		t.Fatalf("unexpected invites: %+v", invites.Invites)
+	}
+
+	// 無効にしたコードや期限切れのコードは使えない
+	unlimited, err := org.InvitesAdd(ctx, &client.InvitesAddParams{})
+	if err != nil {
+		t.Fatalf("error InvitesAdd: %s", err)
+	}
+	id, err := strconv.ParseInt(unlimited.Invite.ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	if _, err := anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: unlimited.Code, DisplayName: "bob"}); err != nil {
+		t.Fatalf("error PlayerRegister: %s", err)
+	}
+	if _, err := org.InviteRevoke(ctx, &client.InviteRevokeParams{InviteID: id}); err != nil {
+		t.Fatalf("error InviteRevoke: %s", err)
+	}
+	_, err = anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: unlimited.Code, DisplayName: "carol"})
+	assertStatus(t, err, http.StatusForbidden)
+
+	expiring, err := org.InvitesAdd(ctx, &client.InvitesAddParams{ExpiresIn: ptr(int64(3600))})
+	if err != nil {
+		t.Fatalf("error InvitesAdd: %s", err)
+	}
+	if _, err := adminDB.ExecContext(ctx, "UPDATE player_invite SET expires_at = ? WHERE code_hash = ?", time.Now().Unix()-1, hashAPIToken(expiring.Code)); err != nil {
+		t.Fatalf("error Update player_invite: %s", err)
+	}
+	_, err = anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: expiring.Code, DisplayName: "carol"})
+	assertStatus(t, err, http.StatusForbidden)
+}
+
+func TestInvitesQuota(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	addTestPlayers(t, tenantName, "alice")
+	if err := newAdminClient(t).TenantQuota(ctx, &client.TenantQuotaParams{TenantName: tenantName, MaxPlayers: ptr(int64(1))}); err != nil {
+		t.Fatalf("error TenantQuota: %s", err)
+	}
+	added, err := newOrganizerClient(t, tenantName).InvitesAdd(ctx, &client.InvitesAddParams{})
+	if err != nil {
+		t.Fatalf("error InvitesAdd: %s", err)
+	}
+
+	// 参加者数の上限を超える場合は登録できず、コードの使用回数も増えない
+	_, err = newTestClient(tenantHost(tenantName), "").PlayerRegister(ctx, &client.PlayerRegisterParams{Code: added.Code, DisplayName: "bob"})
+	assertStatus(t, err, http.StatusForbidden)
+	invites, err := newOrganizerClient(t, tenantName).Invites(ctx)
+	if err != nil {
+		t.Fatalf("error Invites: %s", err)
+	}
+	if invites.Invites[0].UsedCount != 0 {
+		t.Fatalf("unexpected invites: %+v", invites.Invites)
+	}
+}
+
+func TestInvitesQuotaConcurrent(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	addTestPlayers(t, tenantName, "alice")
+	if err := newAdminClient(t).TenantQuota(ctx, &client.TenantQuotaParams{TenantName: tenantName, MaxPlayers: ptr(int64(3))}); err != nil {
+		t.Fatalf("error TenantQuota: %s", err)
+	}
+	added, err := newOrganizerClient(t, tenantName).InvitesAdd(ctx, &client.InvitesAddParams{})
+	if err != nil {
+		t.Fatalf("error InvitesAdd: %s", err)
+	}
+
+	// 同時に登録しても上限を超えない
+	anonymous := newTestClient(tenantHost(tenantName), "")
+	var wg sync.WaitGroup
+	var registered int64
+	for i := 0; i < registerIPBurst; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: added.Code, DisplayName: fmt.Sprintf("player-%d", i)}); err == nil {
+				atomic.AddInt64(&registered, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if registered != 2 {
+		t.Fatalf("unexpected count: %d", registered)
+	}
+}
+
+func TestInvitesRateLimit(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	anonymous := newTestClient(tenantHost(tenantName), "")
+
+	// 間違ったコードでも回数に数え、バーストを超えたら429を返す
+	for i := 0; i < registerIPBurst; i++ {
+		_, err := anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: "unknown", DisplayName: "alice"})
+		assertStatus(t, err, http.StatusForbidden)
+	}
+	_, err := anonymous.PlayerRegister(ctx, &client.PlayerRegisterParams{Code: "unknown", DisplayName: "alice"})
+	assertStatus(t, err, http.StatusTooManyRequests)
+
+	// 他のテナントには影響しない
+	_, err = newTestClient(tenantHost(newTestTenant(t)), "").PlayerRegister(ctx, &client.PlayerRegisterParams{Code: "unknown", DisplayName: "alice"})
+	assertStatus(t, err, http.StatusForbidden)
+}
+
+func TestRegisterRateLimiterSweep(t *testing.T) {
+	rl := &registerRateLimiter{
+		tenants: map[int64]*rate.Limiter{},
+		ips:     map[registerRateLimitKey]*registerIPLimiter{},
+	}
+	now := time.Now()
+	for i := 0; i < registerIPMaxEntries; i++ {
+		if ok, _ := rl.allow(int64(i), fmt.Sprintf("192.0.2.%d", i), now); !ok {
+			t.Fatalf("expected allowed: %d", i)
+		}
+	}
+	// 上限に達したら新しいIPは拒否し、バケットが満タンに戻った分は捨てて受け付ける
+	if ok, _ := rl.allow(1, "198.51.100.1", now); ok {
+		t.Fatalf("expected denied")
+	}
+	if ok, _ := rl.allow(1, "198.51.100.1", now.Add(registerIPBurst/registerIPRate*time.Second)); !ok {
+		t.Fatalf("expected allowed after sweep")
+	}
+	if len(rl.ips) != 1 {
+		t.Fatalf("unexpected entries: %d", len(rl.ips))
+	}
+}
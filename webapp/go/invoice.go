@@ -0,0 +1,463 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 請求は大会の終了日時(finished_at)が属する月ごとにまとめる
+// 月の区切りは日本時間
+var billingLocation = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+const billingMonthLayout = "2006-01"
+
+type InvoiceRow struct {
+	ID                int64  `db:"id"`
+	TenantID          int64  `db:"tenant_id"`
+	Month             string `db:"month"`
+	BillingPlayerYen  int64  `db:"billing_player_yen"`
+	BillingVisitorYen int64  `db:"billing_visitor_yen"`
+	BillingYen        int64  `db:"billing_yen"`
+	CreatedAt         int64  `db:"created_at"`
+}
+
+type InvoiceLineRow struct {
+	InvoiceID         int64  `db:"invoice_id"`
+	LineNo            int64  `db:"line_no"`
+	CompetitionID     string `db:"competition_id"`
+	CompetitionTitle  string `db:"competition_title"`
+	PlayerCount       int64  `db:"player_count"`
+	VisitorCount      int64  `db:"visitor_count"`
+	BillingPlayerYen  int64  `db:"billing_player_yen"`
+	BillingVisitorYen int64  `db:"billing_visitor_yen"`
+	BillingYen        int64  `db:"billing_yen"`
+}
+
+type InvoiceDetail struct {
+	TenantID          string          `json:"tenant_id"`
+	TenantName        string          `json:"tenant_name"`
+	Month             string          `json:"month"`
+	IsClosed          bool            `json:"is_closed"` // 確定した請求書ならtrue
+	ClosedAt          *int64          `json:"closed_at"` // 請求書を確定した日時
+	BillingPlayerYen  int64           `json:"billing_player_yen"`
+	BillingVisitorYen int64           `json:"billing_visitor_yen"`
+	BillingYen        int64           `json:"billing_yen"`
+	Reports           []BillingReport `json:"reports"`
+}
+
+type InvoiceSummary struct {
+	Month      string `json:"month"`
+	IsClosed   bool   `json:"is_closed"`
+	BillingYen int64  `json:"billing_yen"`
+}
+
+type InvoicesHandlerResult struct {
+	Invoices []InvoiceSummary `json:"invoices"`
+}
+
+type InvoiceHandlerResult struct {
+	Invoice InvoiceDetail `json:"invoice"`
+}
+
+// 月の文字列(YYYY-MM)を月初の時刻にする
+func parseBillingMonth(month string) (time.Time, error) {
+	start, err := time.ParseInLocation(billingMonthLayout, month, billingLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error time.ParseInLocation: month=%s, %w", month, err)
+	}
+	return start, nil
+}
+
+func billingMonthOf(unix int64) string {
+	return time.Unix(unix, 0).In(billingLocation).Format(billingMonthLayout)
+}
+
+// 月が締まっているか
+// 大会の終了日時は終了したときの時刻になるので、締まった月の請求額は変わらない
+func isBillingMonthClosed(start time.Time, now time.Time) bool {
+	return !now.Before(start.AddDate(0, 1, 0))
+}
+
+// 指定した月に終了した大会の請求額を計算する
+func computeInvoice(ctx context.Context, tenantDB dbOrTx, tenant *TenantRow, start time.Time) (*InvoiceDetail, error) {
+	cs := []CompetitionRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&cs,
+		"SELECT * FROM competition WHERE tenant_id = ? AND finished_at >= ? AND finished_at < ? ORDER BY finished_at ASC",
+		tenant.ID, start.Unix(), start.AddDate(0, 1, 0).Unix(),
+	); err != nil {
+		return nil, fmt.Errorf("error Select competition: tenantID=%d, month=%s, %w", tenant.ID, start.Format(billingMonthLayout), err)
+	}
+	inv := InvoiceDetail{
+		TenantID:   strconv.FormatInt(tenant.ID, 10),
+		TenantName: tenant.Name,
+		Month:      start.Format(billingMonthLayout),
+		Reports:    make([]BillingReport, 0, len(cs)),
+	}
+	for _, comp := range cs {
+		report, err := billingReportByCompetition(ctx, tenantDB, tenant.ID, comp.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error billingReportByCompetition: %w", err)
+		}
+		inv.Reports = append(inv.Reports, *report)
+		inv.BillingPlayerYen += report.BillingPlayerYen
+		inv.BillingVisitorYen += report.BillingVisitorYen
+		inv.BillingYen += report.BillingYen
+	}
+	return &inv, nil
+}
+
+// 確定した請求書を取得する
+// 存在しなければsql.ErrNoRowsを返す
+func retrieveStoredInvoice(ctx context.Context, tenant *TenantRow, month string) (*InvoiceDetail, error) {
+	var row InvoiceRow
+	if err := adminDB.GetContext(
+		ctx,
+		&row,
+		"SELECT * FROM invoice WHERE tenant_id = ? AND month = ?",
+		tenant.ID, month,
+	); err != nil {
+		return nil, fmt.Errorf("error Select invoice: tenantID=%d, month=%s, %w", tenant.ID, month, err)
+	}
+	lines := []InvoiceLineRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&lines,
+		"SELECT * FROM invoice_line WHERE invoice_id = ? ORDER BY line_no ASC",
+		row.ID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select invoice_line: invoiceID=%d, %w", row.ID, err)
+	}
+	inv := InvoiceDetail{
+		TenantID:          strconv.FormatInt(tenant.ID, 10),
+		TenantName:        tenant.Name,
+		Month:             row.Month,
+		IsClosed:          true,
+		ClosedAt:          &row.CreatedAt,
+		BillingPlayerYen:  row.BillingPlayerYen,
+		BillingVisitorYen: row.BillingVisitorYen,
+		BillingYen:        row.BillingYen,
+		Reports:           make([]BillingReport, 0, len(lines)),
+	}
+	for _, l := range lines {
+		inv.Reports = append(inv.Reports, BillingReport{
+			CompetitionID:     l.CompetitionID,
+			CompetitionTitle:  l.CompetitionTitle,
+			PlayerCount:       l.PlayerCount,
+			VisitorCount:      l.VisitorCount,
+			BillingPlayerYen:  l.BillingPlayerYen,
+			BillingVisitorYen: l.BillingVisitorYen,
+			BillingYen:        l.BillingYen,
+		})
+	}
+	return &inv, nil
+}
+
+// 請求書を確定して保存する
+// 一度確定した請求書は変更しない。既に確定していれば保存済みのものを返す
+func storeInvoice(ctx context.Context, tenant *TenantRow, inv *InvoiceDetail) (*InvoiceDetail, error) {
+	tx, err := adminDB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error adminDB.BeginTxx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT IGNORE INTO invoice (tenant_id, month, billing_player_yen, billing_visitor_yen, billing_yen, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		tenant.ID, inv.Month, inv.BillingPlayerYen, inv.BillingVisitorYen, inv.BillingYen, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error Insert invoice: tenantID=%d, month=%s, %w", tenant.ID, inv.Month, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("error get RowsAffected: %w", err)
+	} else if n == 0 {
+		// 他のリクエストが先に確定させた
+		if err := tx.Rollback(); err != nil {
+			return nil, fmt.Errorf("error tx.Rollback: %w", err)
+		}
+		return retrieveStoredInvoice(ctx, tenant, inv.Month)
+	}
+	invoiceID, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error get LastInsertId: %w", err)
+	}
+	for i, r := range inv.Reports {
+		if _, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO invoice_line (invoice_id, line_no, competition_id, competition_title, player_count, visitor_count, billing_player_yen, billing_visitor_yen, billing_yen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			invoiceID, i+1, r.CompetitionID, r.CompetitionTitle, r.PlayerCount, r.VisitorCount, r.BillingPlayerYen, r.BillingVisitorYen, r.BillingYen,
+		); err != nil {
+			return nil, fmt.Errorf("error Insert invoice_line: invoiceID=%d, competitionID=%s, %w", invoiceID, r.CompetitionID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error tx.Commit: %w", err)
+	}
+	inv.IsClosed = true
+	inv.ClosedAt = &now
+	return inv, nil
+}
+
+// 指定した月の請求書を返す
+// 確定した請求書があれば保存したものを返し、なければその時点の請求額を計算して返す
+// 閲覧で請求書を確定させないよう、ここでは保存しない 確定させるのはcloseInvoiceのみ
+func retrieveInvoice(ctx context.Context, tenantDB dbOrTx, tenant *TenantRow, start time.Time) (*InvoiceDetail, error) {
+	inv, err := retrieveStoredInvoice(ctx, tenant, start.Format(billingMonthLayout))
+	if err == nil {
+		return inv, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return computeInvoice(ctx, tenantDB, tenant, start)
+}
+
+// 締まった月の請求書を確定させる
+// 既に確定していれば保存済みのものを返す
+func closeInvoice(ctx context.Context, tenantDB dbOrTx, tenant *TenantRow, start time.Time) (*InvoiceDetail, error) {
+	inv, err := retrieveInvoice(ctx, tenantDB, tenant, start)
+	if err != nil {
+		return nil, err
+	}
+	if inv.IsClosed {
+		return inv, nil
+	}
+	return storeInvoice(ctx, tenant, inv)
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/invoices
+// 大会が終了した月と今月の請求書の一覧を返す
+func invoicesHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeBillingRead, PermissionViewBilling); err != nil {
+		return err
+	}
+	tenant, err := tenants.getByID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error tenants.getByID: %w", err)
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	finishedAts := []int64{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&finishedAts,
+		"SELECT finished_at FROM competition WHERE tenant_id = ? AND finished_at IS NOT NULL",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select competition: tenantID=%d, %w", v.tenantID, err)
+	}
+	now := time.Now()
+	monthSet := map[string]struct{}{now.In(billingLocation).Format(billingMonthLayout): {}}
+	for _, f := range finishedAts {
+		monthSet[billingMonthOf(f)] = struct{}{}
+	}
+	months := make([]string, 0, len(monthSet))
+	for m := range monthSet {
+		months = append(months, m)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(months)))
+
+	summaries := make([]InvoiceSummary, 0, len(months))
+	for _, m := range months {
+		start, err := parseBillingMonth(m)
+		if err != nil {
+			return err
+		}
+		inv, err := retrieveInvoice(ctx, tenantDB, tenant, start)
+		if err != nil {
+			return fmt.Errorf("error retrieveInvoice: %w", err)
+		}
+		summaries = append(summaries, InvoiceSummary{
+			Month:      inv.Month,
+			IsClosed:   inv.IsClosed,
+			BillingYen: inv.BillingYen,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: InvoicesHandlerResult{Invoices: summaries}})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/invoice/:month
+// 月の請求書をJSONまたはCSVで返す
+func invoiceHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeBillingRead, PermissionViewBilling); err != nil {
+		return err
+	}
+	start, err := parseBillingMonth(c.Param("month"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid month: %s", c.Param("month")))
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid format: %s", format))
+	}
+	tenant, err := tenants.getByID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error tenants.getByID: %w", err)
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	inv, err := retrieveInvoice(ctx, tenantDB, tenant, start)
+	if err != nil {
+		return fmt.Errorf("error retrieveInvoice: %w", err)
+	}
+	if format != "csv" {
+		return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: InvoiceHandlerResult{Invoice: *inv}})
+	}
+	return writeInvoiceCSV(c, inv)
+}
+
+// 請求書を大会ごとの明細のCSVで返す
+func writeInvoiceCSV(c echo.Context, inv *InvoiceDetail) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(
+		echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="invoice-%s-%s.csv"`, inv.TenantName, inv.Month),
+	)
+	c.Response().WriteHeader(http.StatusOK)
+	w := csv.NewWriter(c.Response())
+	rows := [][]string{{
+		"month", "competition_id", "competition_title", "player_count", "visitor_count",
+		"billing_player_yen", "billing_visitor_yen", "billing_yen",
+	}}
+	for _, r := range inv.Reports {
+		rows = append(rows, []string{
+			inv.Month,
+			r.CompetitionID,
+			r.CompetitionTitle,
+			strconv.FormatInt(r.PlayerCount, 10),
+			strconv.FormatInt(r.VisitorCount, 10),
+			strconv.FormatInt(r.BillingPlayerYen, 10),
+			strconv.FormatInt(r.BillingVisitorYen, 10),
+			strconv.FormatInt(r.BillingYen, 10),
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("error w.WriteAll: %w", err)
+	}
+	return nil
+}
+
+type InvoicesCloseHandlerResult struct {
+	Month   string `json:"month"`
+	Tenants int64  `json:"tenants"`
+}
+
+// 全テナントの指定した月の請求書を確定させる
+// 失敗したテナントがあれば、他のテナントを処理したあとで最初のエラーを返す
+func closeInvoices(ctx context.Context, start time.Time) (int64, error) {
+	ts := []TenantRow{}
+	if err := adminDB.SelectContext(ctx, &ts, "SELECT * FROM tenant ORDER BY id ASC"); err != nil {
+		return 0, fmt.Errorf("error Select tenant: %w", err)
+	}
+	errs := billingPool.run(ctx, ts, func(ctx context.Context, i int) error {
+		tenantDB, err := connectToTenantDB(ts[i].ID)
+		if err != nil {
+			return fmt.Errorf("failed to connectToTenantDB: %w", err)
+		}
+		defer tenantDB.Close()
+		if _, err := closeInvoice(ctx, tenantDB, &ts[i], start); err != nil {
+			return fmt.Errorf("error closeInvoice: tenantID=%d, %w", ts[i].ID, err)
+		}
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ts)), nil
+}
+
+// SaaS管理者向けAPI
+// POST /api/admin/invoices/close
+// 締まった月の全テナントの請求書を確定させる
+func invoicesCloseHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+	month := c.FormValue("month")
+	start, err := parseBillingMonth(month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid month: %s", month))
+	}
+	if !isBillingMonthClosed(start, time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("month is not closed yet: %s", month))
+	}
+	n, err := closeInvoices(ctx, start)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   InvoicesCloseHandlerResult{Month: month, Tenants: n},
+	})
+}
+
+type RevenueSummaryRow struct {
+	Month             string `json:"month" db:"month"`
+	TenantCount       int64  `json:"tenant_count" db:"tenant_count"` // 請求額が0円より大きいテナント数
+	BillingPlayerYen  int64  `json:"billing_player_yen" db:"billing_player_yen"`
+	BillingVisitorYen int64  `json:"billing_visitor_yen" db:"billing_visitor_yen"`
+	BillingYen        int64  `json:"billing_yen" db:"billing_yen"`
+}
+
+type RevenueHandlerResult struct {
+	Months []RevenueSummaryRow `json:"months"`
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/invoices/revenue
+// 確定した請求書から月ごとの全テナントの売上を集計する 新しい月から最大12か月分
+func revenueHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+	rows := []RevenueSummaryRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&rows,
+		`SELECT month, SUM(billing_yen > 0) AS tenant_count,
+		SUM(billing_player_yen) AS billing_player_yen, SUM(billing_visitor_yen) AS billing_visitor_yen, SUM(billing_yen) AS billing_yen
+		FROM invoice GROUP BY month ORDER BY month DESC LIMIT 12`,
+	); err != nil {
+		return fmt.Errorf("error Select invoice: %w", err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: RevenueHandlerResult{Months: rows}})
+}
@@ -0,0 +1,142 @@
+package isuports
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/labstack/echo/v4"
+)
+
+func TestInvoices(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	competitionID := addTestCompetition(t, tenantName, "first")
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100", ids[1]+",200")
+	if err := org.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+
+	month := time.Now().Format("2006-01")
+	inv, err := org.Invoice(ctx, &client.InvoiceParams{Month: month})
+	if err != nil {
+		t.Fatalf("error Invoice: %s", err)
+	}
+	if inv.Invoice.IsClosed || inv.Invoice.BillingPlayerYen != 200 {
+		t.Fatalf("unexpected invoice: %+v", inv.Invoice)
+	}
+	_, err = org.Invoice(ctx, &client.InvoiceParams{Month: "2022-13"})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	res, err := org.Do(ctx, http.MethodGet, "/api/organizer/invoice/"+month, url.Values{"format": {"csv"}}, nil, "")
+	if err != nil {
+		t.Fatalf("error Do: %s", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error io.ReadAll: %s", err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/csv") || !strings.Contains(string(body), competitionID) {
+		t.Fatalf("unexpected csv: status=%d, body=%s", res.StatusCode, body)
+	}
+
+	invoices, err := org.Invoices(ctx)
+	if err != nil {
+		t.Fatalf("error Invoices: %s", err)
+	}
+	if len(invoices.Invoices) == 0 || invoices.Invoices[0].Month != month {
+		t.Fatalf("unexpected invoices: %+v", invoices.Invoices)
+	}
+
+	// 締まった月でも参照しただけでは確定しない
+	lastMonth := time.Now().AddDate(0, -1, 0).Format("2006-01")
+	last, err := org.Invoice(ctx, &client.InvoiceParams{Month: lastMonth})
+	if err != nil {
+		t.Fatalf("error Invoice: %s", err)
+	}
+	if last.Invoice.IsClosed {
+		t.Fatalf("invoice must not be closed by GET: %+v", last.Invoice)
+	}
+
+	admin := newAdminClient(t)
+	_, err = admin.InvoicesClose(ctx, &client.InvoicesCloseParams{Month: month})
+	assertStatus(t, err, http.StatusBadRequest)
+	if _, err := admin.InvoicesClose(ctx, &client.InvoicesCloseParams{Month: lastMonth}); err != nil {
+		t.Fatalf("error InvoicesClose: %s", err)
+	}
+	last, err = org.Invoice(ctx, &client.InvoiceParams{Month: lastMonth})
+	if err != nil {
+		t.Fatalf("error Invoice: %s", err)
+	}
+	if !last.Invoice.IsClosed {
+		t.Fatalf("invoice must be closed: %+v", last.Invoice)
+	}
+	if _, err := admin.Revenue(ctx); err != nil {
+		t.Fatalf("error Revenue: %s", err)
+	}
+}
+
+func TestBillingMonth(t *testing.T) {
+	start, err := parseBillingMonth("2022-05")
+	if err != nil {
+		t.Fatalf("error parseBillingMonth: %s", err)
+	}
+	// 月は日本時間で区切る
+	if start.Unix() != time.Date(2022, 4, 30, 15, 0, 0, 0, time.UTC).Unix() {
+		t.Fatalf("unexpected start: %s", start)
+	}
+	if _, err := parseBillingMonth("2022-5"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if got := billingMonthOf(start.Unix() - 1); got != "2022-04" {
+		t.Fatalf("unexpected billingMonthOf: %s", got)
+	}
+	if got := billingMonthOf(start.Unix()); got != "2022-05" {
+		t.Fatalf("unexpected billingMonthOf: %s", got)
+	}
+	if isBillingMonthClosed(start, start.AddDate(0, 1, 0).Add(-time.Second)) {
+		t.Fatalf("month must not be closed before the next month")
+	}
+	if !isBillingMonthClosed(start, start.AddDate(0, 1, 0)) {
+		t.Fatalf("month must be closed at the next month")
+	}
+}
+
+func TestWriteInvoiceCSV(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	inv := &InvoiceDetail{
+		TenantName: "tenant-1",
+		Month:      "2022-05",
+		Reports: []BillingReport{{
+			CompetitionID:     "c1",
+			CompetitionTitle:  "title, with comma",
+			PlayerCount:       2,
+			VisitorCount:      3,
+			BillingPlayerYen:  200,
+			BillingVisitorYen: 30,
+			BillingYen:        230,
+		}},
+	}
+	if err := writeInvoiceCSV(c, inv); err != nil {
+		t.Fatalf("error writeInvoiceCSV: %s", err)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); got != `attachment; filename="invoice-tenant-1-2022-05.csv"` {
+		t.Fatalf("unexpected Content-Disposition: %s", got)
+	}
+	want := "month,competition_id,competition_title,player_count,visitor_count,billing_player_yen,billing_visitor_yen,billing_yen\n" +
+		"2022-05,c1,\"title, with comma\",2,3,200,30,230\n"
+	if rec.Body.String() != want {
+		t.Fatalf("unexpected csv: %q", rec.Body.String())
+	}
+}
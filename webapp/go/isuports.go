@@ -7,19 +7,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/gofrs/flock"
+	"github.com/isucon/isucon12-qualify/webapp/go/openapi"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -27,12 +31,19 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/mattn/go-sqlite3"
+	proxy "github.com/shogo82148/go-sql-proxy"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	tenantDBSchemaFilePath = "../sql/tenant/10_schema.sql"
-	initializeScript       = "../sql/init.sh"
-	cookieName             = "isuports_session"
+	// 10_schema.sqlの後から追加したテーブル 既存のテナントDBにも適用できるようにCREATE TABLE IF NOT EXISTSで書く
+	tenantDBMigrationFileGlob = "../sql/tenant/[2-9]*.sql"
+	initializeScript          = "../sql/init.sh"
+	cookieName                = "isuports_session"
 
 	RoleAdmin     = "admin"
 	RoleOrganizer = "organizer"
@@ -46,37 +57,33 @@ var (
 
 	adminDB *sqlx.DB
 
-	sqliteDriverName = "sqlite3"
+	sqliteDriverName = tenantSQLiteBaseDriverName
+	mysqlDriverName  = "mysql"
 )
 
-// 環境変数を取得する、なければデフォルト値を返す
-func getEnv(key string, defaultValue string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
-	}
-	return defaultValue
-}
-
 // 管理用DBに接続する
 func connectAdminDB() (*sqlx.DB, error) {
+	if appConfig.AdminDB.Driver == AdminDBDriverSQLite {
+		return connectAdminSQLiteDB()
+	}
 	config := mysql.NewConfig()
 	config.Net = "tcp"
-	config.Addr = getEnv("ISUCON_DB_HOST", "127.0.0.1") + ":" + getEnv("ISUCON_DB_PORT", "3306")
-	config.User = getEnv("ISUCON_DB_USER", "isucon")
-	config.Passwd = getEnv("ISUCON_DB_PASSWORD", "isucon")
-	config.DBName = getEnv("ISUCON_DB_NAME", "isuports")
+	config.Addr = net.JoinHostPort(appConfig.AdminDB.Host, appConfig.AdminDB.Port)
+	config.User = appConfig.AdminDB.User
+	config.Passwd = appConfig.AdminDB.Password
+	config.DBName = appConfig.AdminDB.Name
 	config.ParseTime = true
 	dsn := config.FormatDSN()
-	return sqlx.Open("mysql", dsn)
+	return sqlx.Open(mysqlDriverName, dsn)
 }
 
 // テナントDBのパスを返す
 func tenantDBPath(id int64) string {
-	tenantDBDir := getEnv("ISUCON_TENANT_DB_DIR", "../tenant_db")
-	return filepath.Join(tenantDBDir, fmt.Sprintf("%d.db", id))
+	return filepath.Join(appConfig.TenantDB.Dir, fmt.Sprintf("%d.db", id))
 }
 
 // テナントDBに接続する
+// ファイルは最初のクエリで開かれる 開くのにかかった時間はドライバで計測する metrics.go を参照
 func connectToTenantDB(id int64) (*sqlx.DB, error) {
 	p := tenantDBPath(id)
 	db, err := sqlx.Open(sqliteDriverName, fmt.Sprintf("file:%s?mode=rw", p))
@@ -90,15 +97,24 @@ func connectToTenantDB(id int64) (*sqlx.DB, error) {
 func createTenantDB(id int64) error {
 	p := tenantDBPath(id)
 
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("sqlite3 %s < %s", p, tenantDBSchemaFilePath))
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to exec sqlite3 %s < %s, out=%s: %w", p, tenantDBSchemaFilePath, string(out), err)
+	migrations, err := filepath.Glob(tenantDBMigrationFileGlob)
+	if err != nil {
+		return fmt.Errorf("failed to glob %s: %w", tenantDBMigrationFileGlob, err)
+	}
+	for _, f := range append([]string{tenantDBSchemaFilePath}, migrations...) {
+		cmd := exec.Command("sh", "-c", fmt.Sprintf("sqlite3 %s < %s", p, f))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to exec sqlite3 %s < %s, out=%s: %w", p, f, string(out), err)
+		}
 	}
 	return nil
 }
 
 // システム全体で一意なIDを生成する
 func dispenseID(ctx context.Context) (string, error) {
+	ctx, span := tracer.Start(ctx, "dispenseID")
+	defer span.End()
+
 	var id int64
 	var lastErr error
 	for i := 0; i < 100; i++ {
@@ -107,6 +123,8 @@ func dispenseID(ctx context.Context) (string, error) {
 		if err != nil {
 			if merr, ok := err.(*mysql.MySQLError); ok && merr.Number == 1213 { // deadlock
 				lastErr = fmt.Errorf("error REPLACE INTO id_generator: %w", err)
+				dispenseIDRetriesTotal.Inc()
+				span.AddEvent("retry on deadlock")
 				continue
 			}
 			return "", fmt.Errorf("error REPLACE INTO id_generator: %w", err)
@@ -124,6 +142,7 @@ func dispenseID(ctx context.Context) (string, error) {
 }
 
 // 全APIにCache-Control: privateを設定する
+// ランキングなど一部のAPIはETagによる再検証にも対応している (etag.go を参照)
 func SetCacheControlPrivate(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		c.Response().Header().Set(echo.HeaderCacheControl, "private")
@@ -137,44 +156,224 @@ func Run() {
 	e.Debug = true
 	e.Logger.SetLevel(log.DEBUG)
 
-	var (
-		sqlLogger io.Closer
-		err       error
-	)
-	// sqliteのクエリログを出力する設定
-	// 環境変数 ISUCON_SQLITE_TRACE_FILE を設定すると、そのファイルにクエリログをJSON形式で出力する
+	// 設定ファイルと環境変数から設定を読み込み、起動前にまとめて検証する
+	// config.go を参照
+	opts, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		e.Logger.Fatalf("error parseCommandLine: %s", err)
+	}
+	cfg, err := loadConfig(opts.configPath)
+	if err != nil {
+		e.Logger.Fatalf("error loadConfig: %s", err)
+	}
+	if opts.printConfig {
+		if err := cfg.print(os.Stdout); err != nil {
+			e.Logger.Fatalf("error cfg.print: %s", err)
+		}
+		if err := cfg.validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		e.Logger.Fatal(err)
+	}
+	closeApp, err := setupApp(e, cfg)
+	if err != nil {
+		e.Logger.Fatalf("error setupApp: %s", err)
+	}
+	if opts.reindexSearch {
+		// SaaS管理者向けの検索用インデックスを全テナントのデータから作り直して終了する
+		// search.go を参照
+		err := reindexSearch(context.Background())
+		closeApp()
+		if err != nil {
+			e.Logger.Fatalf("error reindexSearch: %s", err)
+		}
+		e.Logger.Info("search index is rebuilt")
+		return
+	}
+	// 管理用DBやトレースのexporterは終了時に閉じる
+	defer closeApp()
+
+	// Webhookはoutboxに積んだものを別のgoroutineで配送する
+	webhookCtx, stopWebhookWorker := context.WithCancel(context.Background())
+	defer stopWebhookWorker()
+	webhookWorkerDone := startWebhookWorker(webhookCtx, e.Logger)
+
+	// Prometheus向けの /metrics はテナントのホスト名で公開しないよう別ポートで提供する
+	metricsPort := appConfig.Server.MetricsPort
+	e.Logger.Infof("starting metrics server on : %s ...", metricsPort)
+	metricsServer := startMetricsServer(fmt.Sprintf(":%s", metricsPort), e.Logger)
+
+	port := appConfig.Server.Port
+	e.Logger.Infof("starting isuports server on : %s ...", port)
+	serverPort := fmt.Sprintf(":%s", port)
+	go func() {
+		if err := e.Start(serverPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// SIGTERMを受けたら新しいリクエストの受付をやめ、処理中のリクエストが終わるのを待ってから終了する
+	// CSVの入稿中に終了してflockを握ったままにならないようにする
+	// テナントDBはリクエストごとに開いて閉じているので、リクエストが終われば全て閉じられる
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	e.Logger.Infof("received signal %s, shutting down ...", <-sig)
+
+	shutdownTimeout := appConfig.Server.ShutdownTimeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Errorf("error e.Shutdown: %s", err)
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Errorf("error metricsServer.Shutdown: %s", err)
+	}
+	stopWebhookWorker()
+	select {
+	case <-webhookWorkerDone:
+	case <-shutdownCtx.Done():
+		e.Logger.Errorf("webhook worker did not stop in %s", shutdownTimeout)
+	}
+}
+
+// 設定を反映し、ミドルウェアとルートを登録して管理用DBに接続する
+// Runと結合テストから呼ばれる 戻り値の関数で管理用DBなどを閉じる
+func setupApp(e *echo.Echo, cfg *Config) (func(), error) {
+	appConfig = cfg
+	closers := []func(){}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	// sqliteとMySQLのクエリログを出力する設定
+	// sql_trace.file (環境変数 ISUCON_SQLITE_TRACE_FILE) を設定すると、そのファイルにクエリログをJSON形式で出力する
 	// 未設定なら出力しない
 	// sqltrace.go を参照
-	sqliteDriverName, sqlLogger, err = initializeSQLLogger()
+	sqliteLogHooks, mysqlLogHooks, sqlLogger, err := initializeSQLLogger(appConfig.SQLTrace)
+	if err != nil {
+		return nil, fmt.Errorf("error initializeSQLLogger: %w", err)
+	}
+	closers = append(closers, func() { sqlLogger.Close() })
+
+	// OpenTelemetryのトレースを出力する設定
+	// tracing.go を参照
+	shutdownTracer, err := initializeTracer(context.Background(), appConfig.OTel)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("error initializeTracer: %w", err)
+	}
+	closers = append(closers, func() { shutdownTracer(context.Background()) })
+	var sqliteTraceHooks, mysqlTraceHooks *proxy.HooksContext
+	if tracingEnabled() {
+		sqliteTraceHooks = newSQLTraceHooks(semconv.DBSystemSqlite)
+		mysqlTraceHooks = newSQLTraceHooks(semconv.DBSystemMySQL)
+	}
+	sqliteDriverName = registerProxyDriver(tenantSQLiteBaseDriverName, &tenantDBOpenMetricsDriver{Driver: &sqlite3.SQLiteDriver{}}, sqliteLogHooks, sqliteTraceHooks)
+	mysqlDriverName = registerProxyDriver("mysql", &mysql.MySQLDriver{}, mysqlLogHooks, mysqlTraceHooks)
+	adminSQLiteDriverName = registerProxyDriver(adminSQLiteBaseDriverName, &mysqlDialectDriver{base: &sqlite3.SQLiteDriver{}}, sqliteLogHooks, sqliteTraceHooks)
+
+	// リクエストとレスポンスの検証に使うAPIの定義
+	// openapivalidation.go を参照
+	apiSpec, err = openapi.Load()
 	if err != nil {
-		e.Logger.Panicf("error initializeSQLLogger: %s", err)
+		closeAll()
+		return nil, fmt.Errorf("error openapi.Load: %w", err)
+	}
+
+	// テナントのルーティング方式の設定
+	// 環境変数 ISUCON_TENANT_ROUTING に path を設定すると /t/{テナント名}/api/... でアクセスできる
+	// tenantdomain.go を参照
+	if err := initializeTenantRouting(); err != nil {
+		closeAll()
+		return nil, fmt.Errorf("error initializeTenantRouting: %w", err)
+	}
+	if tenantRoutingMode == TenantRoutingPath {
+		e.Pre(RewriteTenantPath)
 	}
-	defer sqlLogger.Close()
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	e.Use(TraceRequest)
+	e.Use(RecordMetrics)
 	e.Use(SetCacheControlPrivate)
+	e.Use(ValidateOpenAPI)
+	e.Use(RecordOrganizerAction)
+
+	// 死活監視 テナントを判別せずに応答する
+	e.GET("/healthz", healthzHandler)
+	e.GET("/readyz", readyzHandler)
 
 	// SaaS管理者向けAPI
 	e.POST("/api/admin/tenants/add", tenantsAddHandler)
 	e.GET("/api/admin/tenants/billing", tenantsBillingHandler)
+	e.POST("/api/admin/tenants/domains/add", tenantDomainsAddHandler)
+	e.POST("/api/admin/tenants/domains/delete", tenantDomainsDeleteHandler)
+	e.GET("/api/admin/tenants/domains", tenantDomainsHandler)
+	e.POST("/api/admin/tenants/rate_limit", tenantRateLimitHandler)
+	e.POST("/api/admin/tenants/quota", tenantQuotaHandler)
+	e.POST("/api/admin/invoices/close", invoicesCloseHandler)
+	e.GET("/api/admin/invoices/revenue", revenueHandler)
+	e.GET("/api/admin/search/tenants", searchTenantsHandler)
+	e.GET("/api/admin/search/players", searchPlayersHandler)
+	e.GET("/api/admin/search/competitions", searchCompetitionsHandler)
+	e.POST("/api/admin/impersonations/add", impersonationsAddHandler)
+	e.GET("/api/admin/impersonations", impersonationsHandler)
+	e.POST("/api/admin/impersonation/:impersonation_id/revoke", impersonationRevokeHandler)
+	e.GET("/api/admin/impersonation/:impersonation_id/audit_logs", impersonationAuditLogsHandler)
 
 	// テナント管理者向けAPI - 参加者追加、一覧、失格
 	e.GET("/api/organizer/players", playersListHandler)
 	e.POST("/api/organizer/players/add", playersAddHandler)
 	e.POST("/api/organizer/player/:player_id/disqualified", playerDisqualifiedHandler)
+	e.POST("/api/organizer/player/:player_id/attributes", playerAttributesHandler)
+	e.POST("/api/organizer/player_attributes/add", playerAttributeOptionsAddHandler)
+	e.GET("/api/organizer/player_attributes", playerAttributeOptionsHandler)
+	e.POST("/api/organizer/teams/add", teamsAddHandler)
+	e.POST("/api/organizer/team/:team_id/members", teamMembersHandler)
+	e.GET("/api/organizer/teams", teamsHandler)
+	e.POST("/api/organizer/competition/:competition_id/team", competitionTeamHandler)
 
 	// テナント管理者向けAPI - 大会管理
 	e.POST("/api/organizer/competitions/add", competitionsAddHandler)
 	e.POST("/api/organizer/competition/:competition_id/finish", competitionFinishHandler)
 	e.POST("/api/organizer/competition/:competition_id/score", competitionScoreHandler)
+	e.POST("/api/organizer/competition/:competition_id/score_rule", competitionScoreRuleHandler)
 	e.GET("/api/organizer/billing", billingHandler)
+	e.GET("/api/organizer/invoices", invoicesHandler)
+	e.GET("/api/organizer/invoice/:month", invoiceHandler)
+	e.GET("/api/organizer/stats", statsHandler)
 	e.GET("/api/organizer/competitions", organizerCompetitionsHandler)
+	e.POST("/api/organizer/seasons/add", seasonsAddHandler)
+	e.POST("/api/organizer/season/:season_id/competitions/add", seasonCompetitionsAddHandler)
+	e.GET("/api/organizer/seasons", seasonsHandler)
+	e.POST("/api/organizer/api_tokens/add", apiTokensAddHandler)
+	e.GET("/api/organizer/api_tokens", apiTokensHandler)
+	e.POST("/api/organizer/api_token/:token_id/revoke", apiTokenRevokeHandler)
+	e.POST("/api/organizer/organizers/add", organizersAddHandler)
+	e.GET("/api/organizer/organizers", organizersHandler)
+	e.POST("/api/organizer/organizer/:organizer_id/permissions", organizerPermissionsHandler)
+	e.POST("/api/organizer/organizer/:organizer_id/delete", organizerDeleteHandler)
+	e.GET("/api/organizer/action_logs", organizerActionLogsHandler)
+	e.POST("/api/organizer/invites/add", invitesAddHandler)
+	e.GET("/api/organizer/invites", invitesHandler)
+	e.POST("/api/organizer/invite/:invite_id/revoke", inviteRevokeHandler)
+	e.POST("/api/organizer/webhooks/add", webhooksAddHandler)
+	e.GET("/api/organizer/webhooks", webhooksHandler)
+	e.POST("/api/organizer/webhook/:webhook_id/delete", webhookDeleteHandler)
+	e.GET("/api/organizer/webhook/:webhook_id/deliveries", webhookDeliveriesHandler)
 
 	// 参加者向けAPI
+	e.POST("/api/player/register", playerRegisterHandler)
 	e.GET("/api/player/player/:player_id", playerHandler)
 	e.GET("/api/player/competition/:competition_id/ranking", competitionRankingHandler)
 	e.GET("/api/player/competitions", playerCompetitionsHandler)
+	e.GET("/api/player/season/:season_id/ranking", seasonRankingHandler)
 
 	// 全ロール及び未認証でも使えるhandler
 	e.GET("/api/me", meHandler)
@@ -183,19 +382,40 @@ func Run() {
 	e.POST("/initialize", initializeHandler)
 
 	e.HTTPErrorHandler = errorResponseHandler
+	// 参加登録のレート制限にクライアントのIPを使う
+	// nginxが付けるX-Real-IPは、ループバックやプライベートアドレスから来たリクエストでのみ信頼する
+	e.IPExtractor = echo.ExtractIPFromRealIPHeader()
+
+	// ルートを追加したらopenapi/openapi.yamlにも定義を書く
+	for _, r := range e.Routes() {
+		if apiSpec.Operation(r.Method, r.Path) == nil {
+			e.Logger.Warnf("route is not documented in openapi.yaml: %s %s", r.Method, r.Path)
+		}
+	}
 
 	adminDB, err = connectAdminDB()
 	if err != nil {
-		e.Logger.Fatalf("failed to connect db: %v", err)
-		return
+		closeAll()
+		return nil, fmt.Errorf("failed to connect db: %w", err)
+	}
+	adminDB.SetMaxOpenConns(appConfig.AdminDB.MaxOpenConns)
+	closers = append(closers, func() { adminDB.Close() })
+	if err := registerAdminDBMetrics(adminDB); err != nil {
+		closeAll()
+		return nil, fmt.Errorf("failed to register admin DB metrics: %w", err)
 	}
-	adminDB.SetMaxOpenConns(10)
-	defer adminDB.Close()
 
-	port := getEnv("SERVER_APP_PORT", "3000")
-	e.Logger.Infof("starting isuports server on : %s ...", port)
-	serverPort := fmt.Sprintf(":%s", port)
-	e.Logger.Fatal(e.Start(serverPort))
+	// テナントのキャッシュの有効期限
+	// 存在しないテナント名のキャッシュは短めにする
+	tenants = newTenantCache(appConfig.TenantCache.TTL, appConfig.TenantCache.NegativeTTL)
+
+	// SaaS管理者向けの課金計算の並列数とテナントごとのタイムアウト
+	billingPool = &tenantBillingPool{
+		concurrency:   appConfig.Billing.Concurrency,
+		tenantTimeout: appConfig.Billing.TenantTimeout,
+	}
+
+	return closeAll, nil
 }
 
 // エラー処理関数
@@ -229,10 +449,41 @@ type Viewer struct {
 	playerID   string
 	tenantName string
 	tenantID   int64
+
+	// Authorization: Bearer のAPIトークンでアクセスした場合のみ値が入る
+	apiTokenID int64
+	scopes     []string
+
+	// SaaS管理者のなりすましセッションでアクセスした場合のみ値が入る impersonation.go を参照
+	impersonationID       int64
+	impersonatedBy        string
+	impersonationWritable bool
+
+	// JWTでログインした主催者のみ値が入る organizer.go を参照
+	organizerRole string
+	permissions   []string
 }
 
 // リクエストヘッダをパースしてViewerを返す
 func parseViewer(c echo.Context) (*Viewer, error) {
+	// 主催者のAPIトークンか、SaaS管理者のなりすましセッションのトークン
+	if authz := c.Request().Header.Get(echo.HeaderAuthorization); strings.HasPrefix(authz, "Bearer ") {
+		token := strings.TrimPrefix(authz, "Bearer ")
+		parse := parseAPITokenViewer
+		if strings.HasPrefix(token, impersonationTokenPrefix) {
+			parse = parseImpersonationViewer
+		}
+		v, err := parse(c, token)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRateLimit(c, v); err != nil {
+			return nil, err
+		}
+		c.Set(contextKeyViewer, v)
+		return v, nil
+	}
+
 	cookie, err := c.Request().Cookie(cookieName)
 	if err != nil {
 		return nil, echo.NewHTTPError(
@@ -242,7 +493,7 @@ func parseViewer(c echo.Context) (*Viewer, error) {
 	}
 	tokenStr := cookie.Value
 
-	keyFilename := getEnv("ISUCON_JWT_KEY_FILE", "../public.pem")
+	keyFilename := appConfig.JWT.KeyFile
 	keysrc, err := os.ReadFile(keyFilename)
 	if err != nil {
 		return nil, fmt.Errorf("error os.ReadFile: keyFilename=%s: %w", keyFilename, err)
@@ -315,16 +566,28 @@ func parseViewer(c echo.Context) (*Viewer, error) {
 		tenantName: tenant.Name,
 		tenantID:   tenant.ID,
 	}
+	if role == RoleOrganizer {
+		if err := applyOrganizerAccount(requestContext(c), v); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRateLimit(c, v); err != nil {
+		return nil, err
+	}
+	c.Set(contextKeyViewer, v)
 	return v, nil
 }
 
 func retrieveTenantRowFromHeader(c echo.Context) (*TenantRow, error) {
-	// JWTに入っているテナント名とHostヘッダのテナント名が一致しているか確認
-	baseHost := getEnv("ISUCON_BASE_HOSTNAME", ".t.isucon.dev")
-	tenantName := strings.TrimSuffix(c.Request().Host, baseHost)
+	// JWTに入っているテナント名とHostヘッダ(またはパス)のテナント名が一致しているか確認
+	tenantName, domain, err := tenantNameOrDomainFromRequest(c)
+	if err != nil {
+		return nil, err
+	}
 
 	// SaaS管理者用ドメイン
-	if tenantName == "admin" {
+	if domain == "" && tenantName == "admin" {
+		c.Set(contextKeyTenantName, tenantName)
 		return &TenantRow{
 			Name:        "admin",
 			DisplayName: "admin",
@@ -332,16 +595,22 @@ func retrieveTenantRowFromHeader(c echo.Context) (*TenantRow, error) {
 	}
 
 	// テナントの存在確認
-	var tenant TenantRow
-	if err := adminDB.GetContext(
-		context.Background(),
-		&tenant,
-		"SELECT * FROM tenant WHERE name = ?",
-		tenantName,
-	); err != nil {
-		return nil, fmt.Errorf("failed to Select tenant: name=%s, %w", tenantName, err)
+	var tenant *TenantRow
+	if domain != "" {
+		// 独自ドメイン
+		tenant, err = tenants.getByDomain(requestContext(c), domain)
+		if err != nil {
+			return nil, fmt.Errorf("error tenants.getByDomain: %w", err)
+		}
+	} else {
+		tenant, err = tenants.getByName(requestContext(c), tenantName)
+		if err != nil {
+			return nil, fmt.Errorf("error tenants.getByName: %w", err)
+		}
 	}
-	return &tenant, nil
+	c.Set(contextKeyTenantName, tenant.Name)
+	setTraceLogTenant(c, tenant.ID)
+	return tenant, nil
 }
 
 type TenantRow struct {
@@ -423,18 +692,35 @@ type PlayerScoreRow struct {
 
 // 排他ロックのためのファイル名を生成する
 func lockFilePath(id int64) string {
-	tenantDBDir := getEnv("ISUCON_TENANT_DB_DIR", "../tenant_db")
-	return filepath.Join(tenantDBDir, fmt.Sprintf("%d.lock", id))
+	return filepath.Join(appConfig.TenantDB.Dir, fmt.Sprintf("%d.lock", id))
 }
 
 // 排他ロックする
-func flockByTenantID(tenantID int64) (io.Closer, error) {
+func flockByTenantID(ctx context.Context, tenantID int64) (io.Closer, error) {
+	_, span := tracer.Start(ctx, "flockByTenantID", trace.WithAttributes(attribute.Int64("isuports.tenant_id", tenantID)))
+	defer span.End()
 	p := lockFilePath(tenantID)
 
 	fl := flock.New(p)
-	if err := fl.Lock(); err != nil {
+	start := time.Now()
+	if timeout := appConfig.TenantDB.LockTimeout; timeout > 0 {
+		lockCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if _, err := fl.TryLockContext(lockCtx, 10*time.Millisecond); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && lockCtx.Err() != nil && ctx.Err() == nil {
+				return nil, echo.NewHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("tenant is locked: tenantID=%d", tenantID))
+			}
+			return nil, fmt.Errorf("error flock.TryLockContext: path=%s, %w", p, err)
+		}
+	} else if ctx.Done() != nil {
+		// 課金計算のテナントごとのタイムアウトなど、ctxがキャンセルされうる場合はキャンセルされるまでしか待たない
+		if _, err := fl.TryLockContext(ctx, 10*time.Millisecond); err != nil {
+			return nil, fmt.Errorf("error flock.TryLockContext: path=%s, %w", p, err)
+		}
+	} else if err := fl.Lock(); err != nil {
 		return nil, fmt.Errorf("error flock.Lock: path=%s, %w", p, err)
 	}
+	tenantLockWaitDuration.Observe(time.Since(start).Seconds())
 	return fl, nil
 }
 
@@ -467,7 +753,7 @@ func tenantsAddHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	ctx := context.Background()
+	ctx := requestContext(c)
 	now := time.Now().Unix()
 	insertRes, err := adminDB.ExecContext(
 		ctx,
@@ -475,7 +761,7 @@ func tenantsAddHandler(c echo.Context) error {
 		name, displayName, now, now,
 	)
 	if err != nil {
-		if merr, ok := err.(*mysql.MySQLError); ok && merr.Number == 1062 { // duplicate entry
+		if isDuplicateEntryError(err) {
 			return echo.NewHTTPError(http.StatusBadRequest, "duplicate tenant")
 		}
 		return fmt.Errorf(
@@ -488,6 +774,8 @@ func tenantsAddHandler(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("error get LastInsertId: %w", err)
 	}
+	// 存在しないテナント名としてキャッシュされているかもしれないので消す
+	tenants.invalidate(name)
 	// NOTE: 先にadminDBに書き込まれることでこのAPIの処理中に
 	//       /api/admin/tenants/billingにアクセスされるとエラーになりそう
 	//       ロックなどで対処したほうが良さそう
@@ -565,7 +853,7 @@ func billingReportByCompetition(ctx context.Context, tenantDB dbOrTx, tenantID i
 	}
 
 	// player_scoreを読んでいるときに更新が走ると不整合が起こるのでロックを取得する
-	fl, err := flockByTenantID(tenantID)
+	fl, err := flockByTenantID(ctx, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("error flockByTenantID: %w", err)
 	}
@@ -585,6 +873,15 @@ func billingReportByCompetition(ctx context.Context, tenantDB dbOrTx, tenantID i
 		// スコアが登録されている参加者
 		billingMap[pid] = "player"
 	}
+	// チーム戦では、スコアが登録されたチームのメンバー全員をスコアを登録した参加者とみなす
+	// メンバーはスコアを登録した時点のものを使う
+	memberIDs, err := retrieveScoredTeamMemberIDs(ctx, tenantDB, tenantID, comp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieveScoredTeamMemberIDs: %w", err)
+	}
+	for _, pid := range memberIDs {
+		billingMap[pid] = "player"
+	}
 
 	// 大会が終了している場合のみ請求金額が確定するので計算する
 	var playerCount, visitorCount int64
@@ -614,25 +911,32 @@ type TenantWithBilling struct {
 	Name        string `json:"name"`
 	DisplayName string `json:"display_name"`
 	BillingYen  int64  `json:"billing"`
+	Error       string `json:"error,omitempty"` // 課金の計算に失敗した場合のみ
 }
 
 type TenantsBillingHandlerResult struct {
 	Tenants []TenantWithBilling `json:"tenants"`
 }
 
+const (
+	tenantsBillingDefaultLimit = 10
+	tenantsBillingMaxLimit     = 100
+)
+
 // SaaS管理者用API
 // テナントごとの課金レポートを最大10件、テナントのid降順で取得する
 // GET /api/admin/tenants/billing
 // URL引数beforeを指定した場合、指定した値よりもidが小さいテナントの課金レポートを取得する
+// URL引数limitで件数を変更できる(最大100件)
 func tenantsBillingHandler(c echo.Context) error {
-	if host := c.Request().Host; host != getEnv("ISUCON_ADMIN_HOSTNAME", "admin.t.isucon.dev") {
+	if host := c.Request().Host; !isAdminRequest(c) {
 		return echo.NewHTTPError(
 			http.StatusNotFound,
 			fmt.Sprintf("invalid hostname %s", host),
 		)
 	}
 
-	ctx := context.Background()
+	ctx := requestContext(c)
 	if v, err := parseViewer(c); err != nil {
 		return err
 	} else if v.role != RoleAdmin {
@@ -651,6 +955,17 @@ func tenantsBillingHandler(c echo.Context) error {
 			)
 		}
 	}
+	limit := int64(tenantsBillingDefaultLimit)
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit <= 0 || limit > tenantsBillingMaxLimit {
+			return echo.NewHTTPError(
+				http.StatusBadRequest,
+				fmt.Sprintf("invalid query parameter 'limit': %s", l),
+			)
+		}
+	}
 	// テナントごとに
 	//   大会ごとに
 	//     scoreが登録されているplayer * 100
@@ -658,49 +973,34 @@ func tenantsBillingHandler(c echo.Context) error {
 	//   を合計したものを
 	// テナントの課金とする
 	ts := []TenantRow{}
-	if err := adminDB.SelectContext(ctx, &ts, "SELECT * FROM tenant ORDER BY id DESC"); err != nil {
-		return fmt.Errorf("error Select tenant: %w", err)
-	}
-	tenantBillings := make([]TenantWithBilling, 0, len(ts))
-	for _, t := range ts {
-		if beforeID != 0 && beforeID <= t.ID {
-			continue
+	if beforeID != 0 {
+		if err := adminDB.SelectContext(ctx, &ts, "SELECT * FROM tenant WHERE id < ? ORDER BY id DESC LIMIT ?", beforeID, limit); err != nil {
+			return fmt.Errorf("error Select tenant: beforeID=%d, %w", beforeID, err)
 		}
-		err := func(t TenantRow) error {
-			tb := TenantWithBilling{
-				ID:          strconv.FormatInt(t.ID, 10),
-				Name:        t.Name,
-				DisplayName: t.DisplayName,
-			}
-			tenantDB, err := connectToTenantDB(t.ID)
-			if err != nil {
-				return fmt.Errorf("failed to connectToTenantDB: %w", err)
-			}
-			defer tenantDB.Close()
-			cs := []CompetitionRow{}
-			if err := tenantDB.SelectContext(
-				ctx,
-				&cs,
-				"SELECT * FROM competition WHERE tenant_id=?",
-				t.ID,
-			); err != nil {
-				return fmt.Errorf("failed to Select competition: %w", err)
-			}
-			for _, comp := range cs {
-				report, err := billingReportByCompetition(ctx, tenantDB, t.ID, comp.ID)
-				if err != nil {
-					return fmt.Errorf("failed to billingReportByCompetition: %w", err)
-				}
-				tb.BillingYen += report.BillingYen
-			}
-			tenantBillings = append(tenantBillings, tb)
-			return nil
-		}(t)
+	} else {
+		if err := adminDB.SelectContext(ctx, &ts, "SELECT * FROM tenant ORDER BY id DESC LIMIT ?", limit); err != nil {
+			return fmt.Errorf("error Select tenant: %w", err)
+		}
+	}
+	tenantBillings := make([]TenantWithBilling, len(ts))
+	// クライアントが切断したら残りのテナントは計算しない
+	errs := billingPool.run(cancelableRequestContext(c), ts, func(ctx context.Context, i int) error {
+		billingYen, err := tenantBillingYen(ctx, &ts[i])
 		if err != nil {
 			return err
 		}
-		if len(tenantBillings) >= 10 {
-			break
+		tenantBillings[i].BillingYen = billingYen
+		return nil
+	})
+	for i, t := range ts {
+		tenantBillings[i].ID = strconv.FormatInt(t.ID, 10)
+		tenantBillings[i].Name = t.Name
+		tenantBillings[i].DisplayName = t.DisplayName
+		if errs[i] != nil {
+			// 失敗したテナントがあってもページ全体は返す
+			c.Logger().Errorf("error tenantBillingYen: tenantID=%d, %s", t.ID, errs[i])
+			tenantBillings[i].BillingYen = 0
+			tenantBillings[i].Error = "failed to calculate billing"
 		}
 	}
 	return c.JSON(http.StatusOK, SuccessResult{
@@ -715,6 +1015,8 @@ type PlayerDetail struct {
 	ID             string `json:"id"`
 	DisplayName    string `json:"display_name"`
 	IsDisqualified bool   `json:"is_disqualified"`
+	Division       string `json:"division"`
+	Category       string `json:"category"`
 }
 
 type PlayersListHandlerResult struct {
@@ -725,12 +1027,13 @@ type PlayersListHandlerResult struct {
 // GET /api/organizer/players
 // 参加者一覧を返す
 func playersListHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return err
-	} else if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if err := authorizeOrganizer(v, ScopePlayersRead, ""); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -748,13 +1051,13 @@ func playersListHandler(c echo.Context) error {
 	); err != nil {
 		return fmt.Errorf("error Select player: %w", err)
 	}
+	attrs, err := retrieveAllPlayerAttributes(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return err
+	}
 	var pds []PlayerDetail
 	for _, p := range pls {
-		pds = append(pds, PlayerDetail{
-			ID:             p.ID,
-			DisplayName:    p.DisplayName,
-			IsDisqualified: p.IsDisqualified,
-		})
+		pds = append(pds, newPlayerDetail(&p, attrs[p.ID]))
 	}
 
 	res := PlayersListHandlerResult{
@@ -763,6 +1066,48 @@ func playersListHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: res})
 }
 
+// 参加者数の上限を超えずにn人追加できるか確かめる
+// 数えてから追加するまでの間に他のリクエストが追加しないよう、呼び出し側でテナントのロックを取得しておくこと
+func checkPlayerQuota(ctx context.Context, tenantDB dbOrTx, tenantID int64, n int) error {
+	quota, err := retrieveTenantQuota(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("error retrieveTenantQuota: %w", err)
+	}
+	if quota.MaxPlayers == 0 {
+		return nil
+	}
+	var playerCount int64
+	if err := tenantDB.GetContext(ctx, &playerCount, "SELECT COUNT(*) FROM player WHERE tenant_id = ?", tenantID); err != nil {
+		return fmt.Errorf("error Select count player: tenantID=%d, %w", tenantID, err)
+	}
+	if playerCount+int64(n) > quota.MaxPlayers {
+		return echo.NewHTTPError(
+			http.StatusForbidden,
+			fmt.Sprintf("player quota exceeded: max=%d", quota.MaxPlayers),
+		)
+	}
+	return nil
+}
+
+// 参加者のIDを払い出して追加する
+func insertPlayer(ctx context.Context, tenantDB dbOrTx, tenantID int64, displayName string, now int64) (string, error) {
+	id, err := dispenseID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error dispenseID: %w", err)
+	}
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT INTO player (id, tenant_id, display_name, is_disqualified, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id, tenantID, displayName, false, now, now,
+	); err != nil {
+		return "", fmt.Errorf(
+			"error Insert player at tenantDB: id=%s, displayName=%s, isDisqualified=%t, createdAt=%d, updatedAt=%d, %w",
+			id, displayName, false, now, now, err,
+		)
+	}
+	return id, nil
+}
+
 type PlayersAddHandlerResult struct {
 	Players []PlayerDetail `json:"players"`
 }
@@ -771,12 +1116,13 @@ type PlayersAddHandlerResult struct {
 // GET /api/organizer/players/add
 // テナントに参加者を追加する
 func playersAddHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
-	} else if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -790,35 +1136,67 @@ func playersAddHandler(c echo.Context) error {
 		return fmt.Errorf("error c.FormParams: %w", err)
 	}
 	displayNames := params["display_name[]"]
+	// 部門・カテゴリはdisplay_name[]と同じ順で指定する
+	divisions := params["division[]"]
+	categories := params["category[]"]
+	attributes := map[string][]string{
+		PlayerAttributeDivision: divisions,
+		PlayerAttributeCategory: categories,
+	}
+	// 途中の参加者だけ追加されてしまわないよう、追加する前に全ての値を確かめる
+	for name, values := range attributes {
+		if err := validatePlayerAttributeValues(ctx, tenantDB, v.tenantID, name, values); err != nil {
+			return err
+		}
+	}
+
+	// 同時に追加されて上限を超えないよう、数えてから追加し終わるまでロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	if err := checkPlayerQuota(ctx, tenantDB, v.tenantID, len(displayNames)); err != nil {
+		return err
+	}
 
 	pds := make([]PlayerDetail, 0, len(displayNames))
-	for _, displayName := range displayNames {
-		id, err := dispenseID(ctx)
+	indexRows := make([]PlayerSearchIndexRow, 0, len(displayNames))
+	for i, displayName := range displayNames {
+		now := time.Now().Unix()
+		id, err := insertPlayer(ctx, tenantDB, v.tenantID, displayName, now)
 		if err != nil {
-			return fmt.Errorf("error dispenseID: %w", err)
+			return err
 		}
-
-		now := time.Now().Unix()
-		if _, err := tenantDB.ExecContext(
-			ctx,
-			"INSERT INTO player (id, tenant_id, display_name, is_disqualified, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-			id, v.tenantID, displayName, false, now, now,
-		); err != nil {
-			return fmt.Errorf(
-				"error Insert player at tenantDB: id=%s, displayName=%s, isDisqualified=%t, createdAt=%d, updatedAt=%d, %w",
-				id, displayName, false, now, now, err,
-			)
+		for name, values := range attributes {
+			if i >= len(values) {
+				continue
+			}
+			if err := setPlayerAttribute(ctx, tenantDB, v.tenantID, id, name, values[i], now); err != nil {
+				return err
+			}
 		}
 		p, err := retrievePlayer(ctx, tenantDB, id)
 		if err != nil {
 			return fmt.Errorf("error retrievePlayer: %w", err)
 		}
-		pds = append(pds, PlayerDetail{
-			ID:             p.ID,
-			DisplayName:    p.DisplayName,
-			IsDisqualified: p.IsDisqualified,
+		pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+		if err != nil {
+			return err
+		}
+		pds = append(pds, *pd)
+		indexRows = append(indexRows, PlayerSearchIndexRow{
+			PlayerID:    id,
+			TenantID:    v.tenantID,
+			DisplayName: displayName,
+			CreatedAt:   now,
 		})
 	}
+	// SaaS管理者向けの検索用インデックス search.go を参照
+	// テナントDBへの追加は終わっているので、失敗してもエラーにせずログに出す --reindex-search で作り直せる
+	if err := indexPlayers(ctx, adminDB, indexRows); err != nil {
+		c.Logger().Errorf("error indexPlayers: %s", err)
+	}
 
 	res := PlayersAddHandlerResult{
 		Players: pds,
@@ -834,12 +1212,13 @@ type PlayerDisqualifiedHandlerResult struct {
 // POST /api/organizer/player/:player_id/disqualified
 // 参加者を失格にする
 func playerDisqualifiedHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
-	} else if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -869,13 +1248,21 @@ func playerDisqualifiedHandler(c echo.Context) error {
 		}
 		return fmt.Errorf("error retrievePlayer: %w", err)
 	}
+	if err := bumpContentVersion(ctx, v.tenantID, tenantWideVersionKey); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+	if err := emitWebhookEvent(ctx, v, WebhookEventPlayerDisqualified, map[string]any{
+		"player_id": p.ID,
+	}); err != nil {
+		c.Logger().Errorf("error emitWebhookEvent: %s", err)
+	}
 
+	pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+	if err != nil {
+		return err
+	}
 	res := PlayerDisqualifiedHandlerResult{
-		Player: PlayerDetail{
-			ID:             p.ID,
-			DisplayName:    p.DisplayName,
-			IsDisqualified: p.IsDisqualified,
-		},
+		Player: *pd,
 	}
 	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: res})
 }
@@ -894,12 +1281,13 @@ type CompetitionsAddHandlerResult struct {
 // POST /api/organizer/competitions/add
 // 大会を追加する
 func competitionsAddHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
-	} else if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionManageCompetitions); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -909,6 +1297,33 @@ func competitionsAddHandler(c echo.Context) error {
 	defer tenantDB.Close()
 
 	title := c.FormValue("title")
+	rule := defaultScoreRule(v.tenantID, "")
+	if err := rule.applyForm(c); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// 同時に追加されて上限を超えないよう、数えてから追加し終わるまでロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	quota, err := retrieveTenantQuota(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error retrieveTenantQuota: %w", err)
+	}
+	if quota.MaxCompetitions > 0 {
+		var competitionCount int64
+		if err := tenantDB.GetContext(ctx, &competitionCount, "SELECT COUNT(*) FROM competition WHERE tenant_id = ?", v.tenantID); err != nil {
+			return fmt.Errorf("error Select count competition: tenantID=%d, %w", v.tenantID, err)
+		}
+		if competitionCount >= quota.MaxCompetitions {
+			return echo.NewHTTPError(
+				http.StatusForbidden,
+				fmt.Sprintf("competition quota exceeded: max=%d", quota.MaxCompetitions),
+			)
+		}
+	}
 
 	now := time.Now().Unix()
 	id, err := dispenseID(ctx)
@@ -925,6 +1340,28 @@ func competitionsAddHandler(c echo.Context) error {
 			id, v.tenantID, title, now, now, err,
 		)
 	}
+	rule.CompetitionID = id
+	if err := saveScoreRule(ctx, tenantDB, rule, now); err != nil {
+		return err
+	}
+	// SaaS管理者向けの検索用インデックス 失敗してもエラーにせずログに出す --reindex-search で作り直せる
+	if err := indexCompetitions(ctx, adminDB, []CompetitionSearchIndexRow{{
+		CompetitionID: id,
+		TenantID:      v.tenantID,
+		Title:         title,
+		CreatedAt:     now,
+	}}); err != nil {
+		c.Logger().Errorf("error indexCompetitions: %s", err)
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, tenantWideVersionKey); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+	if err := emitWebhookEvent(ctx, v, WebhookEventCompetitionCreated, map[string]any{
+		"competition_id": id,
+		"title":          title,
+	}); err != nil {
+		c.Logger().Errorf("error emitWebhookEvent: %s", err)
+	}
 
 	res := CompetitionsAddHandlerResult{
 		Competition: CompetitionDetail{
@@ -940,12 +1377,13 @@ func competitionsAddHandler(c echo.Context) error {
 // POST /api/organizer/competition/:competition_id/finish
 // 大会を終了する
 func competitionFinishHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
-	} else if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionFinishCompetitions); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -978,6 +1416,15 @@ func competitionFinishHandler(c echo.Context) error {
 			now, now, id, err,
 		)
 	}
+	if err := bumpContentVersion(ctx, v.tenantID, id); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+	if err := emitWebhookEvent(ctx, v, WebhookEventCompetitionFinished, map[string]any{
+		"competition_id": id,
+		"finished_at":    now,
+	}); err != nil {
+		c.Logger().Errorf("error emitWebhookEvent: %s", err)
+	}
 	return c.JSON(http.StatusOK, SuccessResult{Status: true})
 }
 
@@ -989,13 +1436,13 @@ type ScoreHandlerResult struct {
 // POST /api/organizer/competition/:competition_id/score
 // 大会のスコアをCSVでアップロードする
 func competitionScoreHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
 	}
-	if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	if err := authorizeOrganizer(v, ScopeScoresWrite, PermissionUploadScores); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -1034,21 +1481,63 @@ func competitionScoreHandler(c echo.Context) error {
 	}
 	defer f.Close()
 
+	// チームのスコアを入稿する大会では team_id,score のCSVを受け付ける
+	teamUpload := false
+	teamCompetition, err := retrieveTeamCompetition(ctx, tenantDB, competitionID)
+	if err == nil {
+		teamUpload = teamCompetition.ScoreMode == TeamScoreModeUpload
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error retrieveTeamCompetition: %w", err)
+	}
+	expectedHeaders := []string{"player_id", "score"}
+	if teamUpload {
+		expectedHeaders = []string{"team_id", "score"}
+	}
+
 	r := csv.NewReader(f)
 	headers, err := r.Read()
 	if err != nil {
 		return fmt.Errorf("error r.Read at header: %w", err)
 	}
-	if !reflect.DeepEqual(headers, []string{"player_id", "score"}) {
+	if !reflect.DeepEqual(headers, expectedHeaders) {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid CSV headers")
 	}
 
+	quota, err := retrieveTenantQuota(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error retrieveTenantQuota: %w", err)
+	}
+	rule, err := retrieveScoreRule(ctx, tenantDB, v.tenantID, competitionID)
+	if err != nil {
+		return err
+	}
+
 	// / DELETEしたタイミングで参照が来ると空っぽのランキングになるのでロックする
-	fl, err := flockByTenantID(v.tenantID)
+	fl, err := flockByTenantID(ctx, v.tenantID)
 	if err != nil {
 		return fmt.Errorf("error flockByTenantID: %w", err)
 	}
 	defer fl.Close()
+	if teamUpload {
+		rows, err := saveTeamScores(ctx, tenantDB, v, competitionID, rule, quota.MaxCSVRows, r)
+		if err != nil {
+			return err
+		}
+		if err := bumpContentVersion(ctx, v.tenantID, competitionID); err != nil {
+			return fmt.Errorf("error bumpContentVersion: %w", err)
+		}
+		if err := emitWebhookEvent(ctx, v, WebhookEventScoresUploaded, map[string]any{
+			"competition_id": competitionID,
+			"rows":           rows,
+		}); err != nil {
+			c.Logger().Errorf("error emitWebhookEvent: %s", err)
+		}
+		return c.JSON(http.StatusOK, SuccessResult{
+			Status: true,
+			Data:   ScoreHandlerResult{Rows: rows},
+		})
+	}
+
 	var rowNum int64
 	playerScoreRows := []PlayerScoreRow{}
 	for {
@@ -1063,6 +1552,12 @@ func competitionScoreHandler(c echo.Context) error {
 		if len(row) != 2 {
 			return fmt.Errorf("row must have two columns: %#v", row)
 		}
+		if quota.MaxCSVRows > 0 && rowNum > quota.MaxCSVRows {
+			return echo.NewHTTPError(
+				http.StatusForbidden,
+				fmt.Sprintf("CSV row quota exceeded: max=%d", quota.MaxCSVRows),
+			)
+		}
 		playerID, scoreStr := row[0], row[1]
 		if _, err := retrievePlayer(ctx, tenantDB, playerID); err != nil {
 			// 存在しない参加者が含まれている
@@ -1075,10 +1570,10 @@ func competitionScoreHandler(c echo.Context) error {
 			return fmt.Errorf("error retrievePlayer: %w", err)
 		}
 		var score int64
-		if score, err = strconv.ParseInt(scoreStr, 10, 64); err != nil {
+		if score, err = rule.parseScore(scoreStr); err != nil {
 			return echo.NewHTTPError(
 				http.StatusBadRequest,
-				fmt.Sprintf("error strconv.ParseUint: scoreStr=%s, %s", scoreStr, err),
+				fmt.Sprintf("error rule.parseScore: scoreStr=%s, %s", scoreStr, err),
 			)
 		}
 		id, err := dispenseID(ctx)
@@ -1119,6 +1614,21 @@ func competitionScoreHandler(c echo.Context) error {
 
 		}
 	}
+	// チームのスコアは入稿した時点のメンバーで計算して保存する
+	if teamCompetition != nil {
+		if err := refreshTeamScores(ctx, tenantDB, v.tenantID, teamCompetition); err != nil {
+			return fmt.Errorf("error refreshTeamScores: %w", err)
+		}
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, competitionID); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+	if err := emitWebhookEvent(ctx, v, WebhookEventScoresUploaded, map[string]any{
+		"competition_id": competitionID,
+		"rows":           len(playerScoreRows),
+	}); err != nil {
+		c.Logger().Errorf("error emitWebhookEvent: %s", err)
+	}
 
 	return c.JSON(http.StatusOK, SuccessResult{
 		Status: true,
@@ -1134,13 +1644,13 @@ type BillingHandlerResult struct {
 // GET /api/organizer/billing
 // テナント内の課金レポートを取得する
 func billingHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return fmt.Errorf("error parseViewer: %w", err)
 	}
-	if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	if err := authorizeOrganizer(v, ScopeBillingRead, PermissionViewBilling); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -1179,18 +1689,20 @@ func billingHandler(c echo.Context) error {
 type PlayerScoreDetail struct {
 	CompetitionTitle string `json:"competition_title"`
 	Score            int64  `json:"score"`
+	ScoreText        string `json:"score_text"`
 }
 
 type PlayerHandlerResult struct {
-	Player PlayerDetail        `json:"player"`
-	Scores []PlayerScoreDetail `json:"scores"`
+	Player     PlayerDetail        `json:"player"`
+	Scores     []PlayerScoreDetail `json:"scores"`
+	TeamScores []TeamScoreDetail   `json:"team_scores"`
 }
 
 // 参加者向けAPI
 // GET /api/player/player/:player_id
 // 参加者の詳細情報を取得する
 func playerHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 
 	v, err := parseViewer(c)
 	if err != nil {
@@ -1221,6 +1733,14 @@ func playerHandler(c echo.Context) error {
 		}
 		return fmt.Errorf("error retrievePlayer: %w", err)
 	}
+	// 参加者の情報・全ての大会のスコアや終了状態・チームのいずれかが変わったらETagが変わる
+	version, err := retrieveLatestContentVersion(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error retrieveLatestContentVersion: %w", err)
+	}
+	if checkNotModified(c, weakETag("player-"+p.ID, version)) {
+		return notModified(c)
+	}
 	cs := []CompetitionRow{}
 	if err := tenantDB.SelectContext(
 		ctx,
@@ -1232,7 +1752,7 @@ func playerHandler(c echo.Context) error {
 	}
 
 	// player_scoreを読んでいるときに更新が走ると不整合が起こるのでロックを取得する
-	fl, err := flockByTenantID(v.tenantID)
+	fl, err := flockByTenantID(ctx, v.tenantID)
 	if err != nil {
 		return fmt.Errorf("error flockByTenantID: %w", err)
 	}
@@ -1258,27 +1778,40 @@ func playerHandler(c echo.Context) error {
 		pss = append(pss, ps)
 	}
 
+	// 大会ごとに引かないよう、テナントのルールをまとめて取得する
+	rules, err := retrieveScoreRules(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return err
+	}
 	psds := make([]PlayerScoreDetail, 0, len(pss))
 	for _, ps := range pss {
 		comp, err := retrieveCompetition(ctx, tenantDB, ps.CompetitionID)
 		if err != nil {
 			return fmt.Errorf("error retrieveCompetition: %w", err)
 		}
+		rule := scoreRuleOf(rules, v.tenantID, ps.CompetitionID)
 		psds = append(psds, PlayerScoreDetail{
 			CompetitionTitle: comp.Title,
 			Score:            ps.Score,
+			ScoreText:        formatScoreValue(rule.ScoreType, ps.Score),
 		})
 	}
 
+	tsds, err := retrievePlayerTeamScores(ctx, tenantDB, v.tenantID, p.ID)
+	if err != nil {
+		return fmt.Errorf("error retrievePlayerTeamScores: %w", err)
+	}
+
+	pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+	if err != nil {
+		return err
+	}
 	res := SuccessResult{
 		Status: true,
 		Data: PlayerHandlerResult{
-			Player: PlayerDetail{
-				ID:             p.ID,
-				DisplayName:    p.DisplayName,
-				IsDisqualified: p.IsDisqualified,
-			},
-			Scores: psds,
+			Player:     *pd,
+			Scores:     psds,
+			TeamScores: tsds,
 		},
 	}
 	return c.JSON(http.StatusOK, res)
@@ -1287,6 +1820,7 @@ func playerHandler(c echo.Context) error {
 type CompetitionRank struct {
 	Rank              int64  `json:"rank"`
 	Score             int64  `json:"score"`
+	ScoreText         string `json:"score_text"` // 大会のスコアの種類に応じて整形したスコア
 	PlayerID          string `json:"player_id"`
 	PlayerDisplayName string `json:"player_display_name"`
 	RowNum            int64  `json:"-"` // APIレスポンスのJSONには含まれない
@@ -1295,13 +1829,14 @@ type CompetitionRank struct {
 type CompetitionRankingHandlerResult struct {
 	Competition CompetitionDetail `json:"competition"`
 	Ranks       []CompetitionRank `json:"ranks"`
+	TeamRanks   []TeamRank        `json:"team_ranks"` // チーム戦でなければ空
 }
 
 // 参加者向けAPI
 // GET /api/player/competition/:competition_id/ranking
 // 大会ごとのランキングを取得する
 func competitionRankingHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 	v, err := parseViewer(c)
 	if err != nil {
 		return err
@@ -1335,20 +1870,23 @@ func competitionRankingHandler(c echo.Context) error {
 	}
 
 	now := time.Now().Unix()
-	var tenant TenantRow
-	if err := adminDB.GetContext(ctx, &tenant, "SELECT * FROM tenant WHERE id = ?", v.tenantID); err != nil {
-		return fmt.Errorf("error Select tenant: id=%d, %w", v.tenantID, err)
+	tenant, err := tenants.getByID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error tenants.getByID: %w", err)
 	}
 
-	if _, err := adminDB.ExecContext(
-		ctx,
-		"INSERT INTO visit_history (player_id, tenant_id, competition_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		v.playerID, tenant.ID, competitionID, now, now,
-	); err != nil {
-		return fmt.Errorf(
-			"error Insert visit_history: playerID=%s, tenantID=%d, competitionID=%s, createdAt=%d, updatedAt=%d, %w",
-			v.playerID, tenant.ID, competitionID, now, now, err,
-		)
+	// なりすましセッションでの閲覧は課金の対象にしない
+	if !v.isImpersonated() {
+		if _, err := adminDB.ExecContext(
+			ctx,
+			"INSERT INTO visit_history (player_id, tenant_id, competition_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			v.playerID, tenant.ID, competitionID, now, now,
+		); err != nil {
+			return fmt.Errorf(
+				"error Insert visit_history: playerID=%s, tenantID=%d, competitionID=%s, createdAt=%d, updatedAt=%d, %w",
+				v.playerID, tenant.ID, competitionID, now, now, err,
+			)
+		}
 	}
 
 	var rankAfter int64
@@ -1359,21 +1897,99 @@ func competitionRankingHandler(c echo.Context) error {
 		}
 	}
 
+	// visit_historyは課金の計算に使うので、304を返す場合でも記録したあとで判定する
+	version, err := retrieveContentVersion(ctx, v.tenantID, competitionID)
+	if err != nil {
+		return fmt.Errorf("error retrieveContentVersion: %w", err)
+	}
+	teamCompetition, err := retrieveTeamCompetition(ctx, tenantDB, competitionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error retrieveTeamCompetition: %w", err)
+	}
+	etag := weakETag("ranking", version)
+	division := c.QueryParam("division")
+	if division != "" || teamCompetition != nil {
+		// 部門やチームの割り当ては参加者の変更なのでテナント全体のバージョンも見る
+		tenantVersion, err := retrieveContentVersion(ctx, v.tenantID, tenantWideVersionKey)
+		if err != nil {
+			return fmt.Errorf("error retrieveContentVersion: %w", err)
+		}
+		etag = weakETag("ranking-"+division, version, tenantVersion)
+	}
+	if checkNotModified(c, etag) {
+		return notModified(c)
+	}
+
 	// player_scoreを読んでいるときに更新が走ると不整合が起こるのでロックを取得する
-	fl, err := flockByTenantID(v.tenantID)
+	fl, err := flockByTenantID(ctx, v.tenantID)
 	if err != nil {
 		return fmt.Errorf("error flockByTenantID: %w", err)
 	}
 	defer fl.Close()
+	ranks, err := retrieveCompetitionRanks(ctx, tenantDB, tenant.ID, competitionID, division)
+	if err != nil {
+		return fmt.Errorf("error retrieveCompetitionRanks: %w", err)
+	}
+	teamRanks := []TeamRank{}
+	if teamCompetition != nil {
+		if teamRanks, err = retrieveTeamRanks(ctx, tenantDB, tenant.ID, teamCompetition); err != nil {
+			return fmt.Errorf("error retrieveTeamRanks: %w", err)
+		}
+		if len(teamRanks) > 100 {
+			teamRanks = teamRanks[:100]
+		}
+	}
+	pagedRanks := make([]CompetitionRank, 0, 100)
+	for i, rank := range ranks {
+		// 同順位がありうるので順位ではなく位置でページングする
+		if int64(i) < rankAfter {
+			continue
+		}
+		pagedRanks = append(pagedRanks, rank)
+		if len(pagedRanks) >= 100 {
+			break
+		}
+	}
+
+	res := SuccessResult{
+		Status: true,
+		Data: CompetitionRankingHandlerResult{
+			Competition: CompetitionDetail{
+				ID:         competition.ID,
+				Title:      competition.Title,
+				IsFinished: competition.FinishedAt.Valid,
+			},
+			Ranks:     pagedRanks,
+			TeamRanks: teamRanks,
+		},
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// 大会のランキングを順位の昇順で返す
+// 参加者ごとに最後に登録されたスコアのみを採用する
+// 呼び出し側でテナントのロックを取得しておくこと
+// divisionを指定した場合はその部門の参加者だけで順位をつける
+func retrieveCompetitionRanks(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string, division string) ([]CompetitionRank, error) {
+	rule, err := retrieveScoreRule(ctx, tenantDB, tenantID, competitionID)
+	if err != nil {
+		return nil, err
+	}
+	var divisionPlayerSet map[string]struct{}
+	if division != "" {
+		if divisionPlayerSet, err = retrievePlayerIDsByAttribute(ctx, tenantDB, tenantID, PlayerAttributeDivision, division); err != nil {
+			return nil, err
+		}
+	}
 	pss := []PlayerScoreRow{}
 	if err := tenantDB.SelectContext(
 		ctx,
 		&pss,
 		"SELECT * FROM player_score WHERE tenant_id = ? AND competition_id = ? ORDER BY row_num DESC",
-		tenant.ID,
+		tenantID,
 		competitionID,
 	); err != nil {
-		return fmt.Errorf("error Select player_score: tenantID=%d, competitionID=%s, %w", tenant.ID, competitionID, err)
+		return nil, fmt.Errorf("error Select player_score: tenantID=%d, competitionID=%s, %w", tenantID, competitionID, err)
 	}
 	ranks := make([]CompetitionRank, 0, len(pss))
 	scoredPlayerSet := make(map[string]struct{}, len(pss))
@@ -1384,9 +2000,14 @@ func competitionRankingHandler(c echo.Context) error {
 			continue
 		}
 		scoredPlayerSet[ps.PlayerID] = struct{}{}
+		if divisionPlayerSet != nil {
+			if _, ok := divisionPlayerSet[ps.PlayerID]; !ok {
+				continue
+			}
+		}
 		p, err := retrievePlayer(ctx, tenantDB, ps.PlayerID)
 		if err != nil {
-			return fmt.Errorf("error retrievePlayer: %w", err)
+			return nil, fmt.Errorf("error retrievePlayer: %w", err)
 		}
 		ranks = append(ranks, CompetitionRank{
 			Score:             ps.Score,
@@ -1396,39 +2017,10 @@ func competitionRankingHandler(c echo.Context) error {
 		})
 	}
 	sort.Slice(ranks, func(i, j int) bool {
-		if ranks[i].Score == ranks[j].Score {
-			return ranks[i].RowNum < ranks[j].RowNum
-		}
-		return ranks[i].Score > ranks[j].Score
+		return rule.less(ranks[i], ranks[j])
 	})
-	pagedRanks := make([]CompetitionRank, 0, 100)
-	for i, rank := range ranks {
-		if int64(i) < rankAfter {
-			continue
-		}
-		pagedRanks = append(pagedRanks, CompetitionRank{
-			Rank:              int64(i + 1),
-			Score:             rank.Score,
-			PlayerID:          rank.PlayerID,
-			PlayerDisplayName: rank.PlayerDisplayName,
-		})
-		if len(pagedRanks) >= 100 {
-			break
-		}
-	}
-
-	res := SuccessResult{
-		Status: true,
-		Data: CompetitionRankingHandlerResult{
-			Competition: CompetitionDetail{
-				ID:         competition.ID,
-				Title:      competition.Title,
-				IsFinished: competition.FinishedAt.Valid,
-			},
-			Ranks: pagedRanks,
-		},
-	}
-	return c.JSON(http.StatusOK, res)
+	rule.assignRanks(ranks)
+	return ranks, nil
 }
 
 type CompetitionsHandlerResult struct {
@@ -1439,7 +2031,7 @@ type CompetitionsHandlerResult struct {
 // GET /api/player/competitions
 // 大会の一覧を取得する
 func playerCompetitionsHandler(c echo.Context) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 
 	v, err := parseViewer(c)
 	if err != nil {
@@ -1469,8 +2061,8 @@ func organizerCompetitionsHandler(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	if v.role != RoleOrganizer {
-		return echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	if err := authorizeOrganizer(v, ScopeCompetitionsRead, ""); err != nil {
+		return err
 	}
 
 	tenantDB, err := connectToTenantDB(v.tenantID)
@@ -1483,7 +2075,16 @@ func organizerCompetitionsHandler(c echo.Context) error {
 }
 
 func competitionsHandler(c echo.Context, v *Viewer, tenantDB dbOrTx) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
+
+	// 大会の追加と、いずれかの大会の終了で変わる
+	version, err := retrieveLatestContentVersion(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error retrieveLatestContentVersion: %w", err)
+	}
+	if checkNotModified(c, weakETag("competitions", version)) {
+		return notModified(c)
+	}
 
 	cs := []CompetitionRow{}
 	if err := tenantDB.SelectContext(
@@ -1522,6 +2123,8 @@ type MeHandlerResult struct {
 	Me       *PlayerDetail `json:"me"`
 	Role     string        `json:"role"`
 	LoggedIn bool          `json:"logged_in"`
+	// SaaS管理者のなりすましセッションならtrue 画面でなりすまし中であることを表示する
+	Impersonated bool `json:"impersonated"`
 }
 
 // 共通API
@@ -1556,10 +2159,11 @@ func meHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, SuccessResult{
 			Status: true,
 			Data: MeHandlerResult{
-				Tenant:   td,
-				Me:       nil,
-				Role:     v.role,
-				LoggedIn: true,
+				Tenant:       td,
+				Me:           nil,
+				Role:         v.role,
+				LoggedIn:     true,
+				Impersonated: v.isImpersonated(),
 			},
 		})
 	}
@@ -1568,7 +2172,7 @@ func meHandler(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("error connectToTenantDB: %w", err)
 	}
-	ctx := context.Background()
+	ctx := requestContext(c)
 	p, err := retrievePlayer(ctx, tenantDB, v.playerID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1585,17 +2189,18 @@ func meHandler(c echo.Context) error {
 		return fmt.Errorf("error retrievePlayer: %w", err)
 	}
 
+	pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+	if err != nil {
+		return err
+	}
 	return c.JSON(http.StatusOK, SuccessResult{
 		Status: true,
 		Data: MeHandlerResult{
-			Tenant: td,
-			Me: &PlayerDetail{
-				ID:             p.ID,
-				DisplayName:    p.DisplayName,
-				IsDisqualified: p.IsDisqualified,
-			},
-			Role:     v.role,
-			LoggedIn: true,
+			Tenant:       td,
+			Me:           pd,
+			Role:         v.role,
+			LoggedIn:     true,
+			Impersonated: v.isImpersonated(),
 		},
 	})
 }
@@ -1609,10 +2214,19 @@ type InitializeHandlerResult struct {
 // ベンチマーカーが起動したときに最初に呼ぶ
 // データベースの初期化などが実行されるため、スキーマを変更した場合などは適宜改変すること
 func initializeHandler(c echo.Context) error {
-	out, err := exec.Command(initializeScript).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error exec.Command: %s %e", string(out), err)
+	if appConfig.AdminDB.Driver == AdminDBDriverSQLite {
+		// init.shはMySQLを初期化するので使えない 管理用DBとテナントDBを空にする
+		if err := resetAdminSQLiteDB(); err != nil {
+			return fmt.Errorf("error resetAdminSQLiteDB: %w", err)
+		}
+	} else {
+		out, err := exec.Command(initializeScript).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("error exec.Command: %s %e", string(out), err)
+		}
 	}
+	// 管理用DBが初期化されたのでキャッシュも捨てる
+	tenants.purge()
 	res := InitializeHandlerResult{
 		Lang: "go",
 	}
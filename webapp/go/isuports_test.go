@@ -0,0 +1,612 @@
+package isuports
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/labstack/echo/v4"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// 結合テスト
+// Runと同じsetupAppでechoのアプリケーションを組み立て、httptest.Serverで動かす
+// 管理用DBはSQLiteのファイル(admindb_sqlite.go)、テナントDBは一時ディレクトリに作る
+// JWTはblackauthと同じクレームでテスト用の鍵で署名する
+
+var (
+	testServer *httptest.Server
+	// JWTの署名に使う鍵 公開鍵をjwt.key_fileに書き出す
+	testSigningKey *rsa.PrivateKey
+	// テスト間でテナント名が重ならないようにする
+	testTenantSeq int64
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "isuports-test-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error os.MkdirTemp: %s\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	cfg, err := newTestConfig(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	closeApp, err := setupApp(e, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error setupApp: %s\n", err)
+		return 1
+	}
+	defer closeApp()
+
+	testServer = httptest.NewServer(e)
+	defer testServer.Close()
+
+	return m.Run()
+}
+
+func newTestConfig(dir string) (*Config, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("error rsa.GenerateKey: %w", err)
+	}
+	testSigningKey = key
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error x509.MarshalPKIXPublicKey: %w", err)
+	}
+	keyFile := filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0644); err != nil {
+		return nil, fmt.Errorf("error os.WriteFile: %w", err)
+	}
+	tenantDBDir := filepath.Join(dir, "tenant_db")
+	if err := os.Mkdir(tenantDBDir, 0755); err != nil {
+		return nil, fmt.Errorf("error os.Mkdir: %w", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.AdminDB.Driver = AdminDBDriverSQLite
+	cfg.AdminDB.File = filepath.Join(dir, "admin.db")
+	cfg.TenantDB.Dir = tenantDBDir
+	cfg.JWT.KeyFile = keyFile
+	// テストのリクエストが定義どおりかも確かめる
+	cfg.OpenAPI.ValidateRequests = true
+	return cfg, nil
+}
+
+// blackauthと同じクレームのJWTを作る
+func newTestToken(t *testing.T, sub, role, aud string) string {
+	t.Helper()
+	return signTestToken(t, testSigningKey, map[string]any{
+		jwt.IssuerKey:     "isuports",
+		jwt.SubjectKey:    sub,
+		jwt.AudienceKey:   aud,
+		"role":            role,
+		jwt.ExpirationKey: time.Now().Add(24 * time.Hour).Unix(),
+	})
+}
+
+// 任意のクレームで署名する 不正なJWTのテストに使う
+func signTestToken(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	token := jwt.New()
+	for k, v := range claims {
+		if err := token.Set(k, v); err != nil {
+			t.Fatalf("error token.Set: %s=%v, %s", k, v, err)
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatalf("error jwt.Sign: %s", err)
+	}
+	return string(signed)
+}
+
+func tenantHost(name string) string {
+	return name + appConfig.Routing.BaseHostname
+}
+
+// Hostヘッダとセッションのcookieを付けたクライアントを返す tokenが空なら未ログイン
+func newTestClient(host, token string) *client.Client {
+	cl := client.New(testServer.URL)
+	cl.Host = host
+	if token != "" {
+		cl.Header.Set("Cookie", (&http.Cookie{Name: cookieName, Value: token}).String())
+	}
+	return cl
+}
+
+func newAdminClient(t *testing.T) *client.Client {
+	return newTestClient(appConfig.Routing.AdminHostname, newTestToken(t, "admin", RoleAdmin, "admin"))
+}
+
+func newOrganizerClient(t *testing.T, tenantName string) *client.Client {
+	return newTestClient(tenantHost(tenantName), newTestToken(t, "organizer", RoleOrganizer, tenantName))
+}
+
+func newPlayerClient(t *testing.T, tenantName, playerID string) *client.Client {
+	return newTestClient(tenantHost(tenantName), newTestToken(t, playerID, RolePlayer, tenantName))
+}
+
+// テスト用のテナントを作り、テナント名を返す
+func newTestTenant(t *testing.T) string {
+	t.Helper()
+	name := fmt.Sprintf("test-%d", atomic.AddInt64(&testTenantSeq, 1))
+	if _, err := newAdminClient(t).TenantsAdd(context.Background(), &client.TenantsAddParams{
+		Name:        name,
+		DisplayName: strings.ToUpper(name),
+	}); err != nil {
+		t.Fatalf("error TenantsAdd: %s", err)
+	}
+	return name
+}
+
+// 参加者を追加し、IDを追加した順に返す
+func addTestPlayers(t *testing.T, tenantName string, displayNames ...string) []string {
+	t.Helper()
+	res, err := newOrganizerClient(t, tenantName).PlayersAdd(context.Background(), &client.PlayersAddParams{
+		DisplayName: displayNames,
+	})
+	if err != nil {
+		t.Fatalf("error PlayersAdd: %s", err)
+	}
+	ids := make([]string, 0, len(res.Players))
+	for _, p := range res.Players {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func addTestCompetition(t *testing.T, tenantName, title string) string {
+	t.Helper()
+	res, err := newOrganizerClient(t, tenantName).CompetitionsAdd(context.Background(), &client.CompetitionsAddParams{
+		Title: title,
+	})
+	if err != nil {
+		t.Fatalf("error CompetitionsAdd: %s", err)
+	}
+	return res.Competition.ID
+}
+
+// player_id,score のCSVを入稿する
+func uploadTestScores(t *testing.T, tenantName, competitionID string, rows ...string) {
+	t.Helper()
+	csv := "player_id,score\n" + strings.Join(rows, "\n") + "\n"
+	if _, err := newOrganizerClient(t, tenantName).CompetitionScore(context.Background(), &client.CompetitionScoreParams{
+		CompetitionID: competitionID,
+		Scores:        &client.File{Name: "scores.csv", Body: strings.NewReader(csv)},
+	}); err != nil {
+		t.Fatalf("error CompetitionScore: %s", err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// APIがstatusのエラーを返したことを確かめる
+func assertStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var aerr *client.APIError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("expected status %d, got err=%v", status, err)
+	}
+	if aerr.StatusCode != status {
+		t.Fatalf("expected status %d, got %s", status, aerr)
+	}
+}
+
+func TestPlayers(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 players, got %d", len(ids))
+	}
+
+	list, err := org.PlayersList(ctx)
+	if err != nil {
+		t.Fatalf("error PlayersList: %s", err)
+	}
+	if len(list.Players) != 2 {
+		t.Fatalf("expected 2 players, got %+v", list.Players)
+	}
+
+	dq, err := org.PlayerDisqualified(ctx, &client.PlayerDisqualifiedParams{PlayerID: ids[1]})
+	if err != nil {
+		t.Fatalf("error PlayerDisqualified: %s", err)
+	}
+	if !dq.Player.IsDisqualified {
+		t.Fatalf("expected disqualified, got %+v", dq.Player)
+	}
+
+	_, err = org.PlayerDisqualified(ctx, &client.PlayerDisqualifiedParams{PlayerID: "not-found"})
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestCompetitions(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	competitionID := addTestCompetition(t, tenantName, "first")
+
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100", ids[1]+",200")
+
+	comps, err := org.OrganizerCompetitions(ctx)
+	if err != nil {
+		t.Fatalf("error OrganizerCompetitions: %s", err)
+	}
+	if len(comps.Competitions) != 1 || comps.Competitions[0].ID != competitionID {
+		t.Fatalf("unexpected competitions: %+v", comps.Competitions)
+	}
+
+	player := newPlayerClient(t, tenantName, ids[0])
+	ranking, err := player.CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.Ranks) != 2 || ranking.Ranks[0].PlayerID != ids[1] || ranking.Ranks[0].Score != 200 {
+		t.Fatalf("unexpected ranks: %+v", ranking.Ranks)
+	}
+
+	detail, err := player.Player(ctx, &client.PlayerParams{PlayerID: ids[0]})
+	if err != nil {
+		t.Fatalf("error Player: %s", err)
+	}
+	if len(detail.Scores) != 1 || detail.Scores[0].Score != 100 {
+		t.Fatalf("unexpected scores: %+v", detail.Scores)
+	}
+
+	playerComps, err := player.PlayerCompetitions(ctx)
+	if err != nil {
+		t.Fatalf("error PlayerCompetitions: %s", err)
+	}
+	if len(playerComps.Competitions) != 1 {
+		t.Fatalf("unexpected competitions: %+v", playerComps.Competitions)
+	}
+
+	if err := org.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	// 終了した大会にはスコアを入稿できない
+	_, err = org.CompetitionScore(ctx, &client.CompetitionScoreParams{
+		CompetitionID: competitionID,
+		Scores:        &client.File{Name: "scores.csv", Body: strings.NewReader("player_id,score\n")},
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	billing, err := org.Billing(ctx)
+	if err != nil {
+		t.Fatalf("error Billing: %s", err)
+	}
+	if len(billing.Reports) != 1 || billing.Reports[0].PlayerCount != 2 {
+		t.Fatalf("unexpected reports: %+v", billing.Reports)
+	}
+}
+
+func TestScoreCSVValidation(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice")
+	competitionID := addTestCompetition(t, tenantName, "first")
+
+	for name, csv := range map[string]string{
+		"invalid headers": "id,score\n",
+		"unknown player":  "player_id,score\nnot-found,1\n",
+		"invalid score":   "player_id,score\n" + ids[0] + ",abc\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := org.CompetitionScore(ctx, &client.CompetitionScoreParams{
+				CompetitionID: competitionID,
+				Scores:        &client.File{Name: "scores.csv", Body: strings.NewReader(csv)},
+			})
+			assertStatus(t, err, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestMe(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice")
+
+	me, err := newTestClient(tenantHost(tenantName), "").Me(ctx)
+	if err != nil {
+		t.Fatalf("error Me: %s", err)
+	}
+	if me.LoggedIn || me.Role != RoleNone {
+		t.Fatalf("expected not logged in, got %+v", me)
+	}
+
+	me, err = newOrganizerClient(t, tenantName).Me(ctx)
+	if err != nil {
+		t.Fatalf("error Me: %s", err)
+	}
+	if !me.LoggedIn || me.Role != RoleOrganizer || me.Tenant.Name != tenantName {
+		t.Fatalf("unexpected me: %+v", me)
+	}
+
+	me, err = newPlayerClient(t, tenantName, ids[0]).Me(ctx)
+	if err != nil {
+		t.Fatalf("error Me: %s", err)
+	}
+	if !me.LoggedIn || me.Role != RolePlayer || me.Me == nil || me.Me.ID != ids[0] {
+		t.Fatalf("unexpected me: %+v", me)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	admin := newAdminClient(t)
+	tenantName := newTestTenant(t)
+
+	_, err := admin.TenantsAdd(ctx, &client.TenantsAddParams{Name: tenantName, DisplayName: "dup"})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = admin.TenantsAdd(ctx, &client.TenantsAddParams{Name: "Invalid_Name", DisplayName: "invalid"})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	billing, err := admin.TenantsBilling(ctx, &client.TenantsBillingParams{Limit: ptr(int64(100))})
+	if err != nil {
+		t.Fatalf("error TenantsBilling: %s", err)
+	}
+	found := false
+	for _, tb := range billing.Tenants {
+		if tb.Name == tenantName {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("tenant %s is not found in billing: %+v", tenantName, billing.Tenants)
+	}
+}
+
+// 全てのテナントが消えるが、他のテストはそれぞれテナントを作るので影響しない
+// t.Parallelにはしない
+func TestInitialize(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+
+	res, err := newTestClient(appConfig.Routing.AdminHostname, "").Initialize(ctx)
+	if err != nil {
+		t.Fatalf("error Initialize: %s", err)
+	}
+	if res.Lang != "go" {
+		t.Fatalf("unexpected lang: %s", res.Lang)
+	}
+	// 初期化したテナントには入れない
+	_, err = newOrganizerClient(t, tenantName).PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+	// 初期化後もテナントを作れる
+	newTestTenant(t)
+}
+
+func TestParseViewer(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	otherTenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	if _, err := newOrganizerClient(t, tenantName).PlayerDisqualified(ctx, &client.PlayerDisqualifiedParams{PlayerID: ids[1]}); err != nil {
+		t.Fatalf("error PlayerDisqualified: %s", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error rsa.GenerateKey: %s", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	organizerAPI := func(cl *client.Client) error {
+		_, err := cl.PlayersList(ctx)
+		return err
+	}
+	playerAPI := func(cl *client.Client) error {
+		_, err := cl.PlayerCompetitions(ctx)
+		return err
+	}
+	adminAPI := func(cl *client.Client) error {
+		_, err := cl.TenantsBilling(ctx, &client.TenantsBillingParams{})
+		return err
+	}
+
+	cases := []struct {
+		name   string
+		host   string
+		token  string
+		call   func(*client.Client) error
+		status int
+	}{
+		{
+			name:   "organizer",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "organizer", RoleOrganizer, tenantName),
+			call:   organizerAPI,
+			status: http.StatusOK,
+		},
+		{
+			name:   "player",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, ids[0], RolePlayer, tenantName),
+			call:   playerAPI,
+			status: http.StatusOK,
+		},
+		{
+			name:   "admin",
+			host:   appConfig.Routing.AdminHostname,
+			token:  newTestToken(t, "admin", RoleAdmin, "admin"),
+			call:   adminAPI,
+			status: http.StatusOK,
+		},
+		{
+			name:   "no cookie",
+			host:   tenantHost(tenantName),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "malformed token",
+			host:   tenantHost(tenantName),
+			token:  "not-a-jwt",
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "signed by other key",
+			host: tenantHost(tenantName),
+			token: signTestToken(t, otherKey, map[string]any{
+				jwt.SubjectKey: "organizer", jwt.AudienceKey: tenantName, "role": RoleOrganizer, jwt.ExpirationKey: exp,
+			}),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			host: tenantHost(tenantName),
+			token: signTestToken(t, testSigningKey, map[string]any{
+				jwt.SubjectKey: "organizer", jwt.AudienceKey: tenantName, "role": RoleOrganizer, jwt.ExpirationKey: time.Now().Add(-time.Hour).Unix(),
+			}),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "no subject",
+			host: tenantHost(tenantName),
+			token: signTestToken(t, testSigningKey, map[string]any{
+				jwt.AudienceKey: tenantName, "role": RoleOrganizer, jwt.ExpirationKey: exp,
+			}),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "no role",
+			host: tenantHost(tenantName),
+			token: signTestToken(t, testSigningKey, map[string]any{
+				jwt.SubjectKey: "organizer", jwt.AudienceKey: tenantName, jwt.ExpirationKey: exp,
+			}),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown role",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "organizer", "superuser", tenantName),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "multiple audiences",
+			host: tenantHost(tenantName),
+			token: signTestToken(t, testSigningKey, map[string]any{
+				jwt.SubjectKey: "organizer", jwt.AudienceKey: []string{tenantName, otherTenantName}, "role": RoleOrganizer, jwt.ExpirationKey: exp,
+			}),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "audience of other tenant",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "organizer", RoleOrganizer, otherTenantName),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "tenant not found",
+			host:   tenantHost("not-found"),
+			token:  newTestToken(t, "organizer", RoleOrganizer, "not-found"),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "organizer on admin host",
+			host:   appConfig.Routing.AdminHostname,
+			token:  newTestToken(t, "organizer", RoleOrganizer, "admin"),
+			call:   adminAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "admin token on tenant host",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "admin", RoleAdmin, "admin"),
+			call:   organizerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "admin API on tenant host",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "organizer", RoleOrganizer, tenantName),
+			call:   adminAPI,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "player calls organizer API",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, ids[0], RolePlayer, tenantName),
+			call:   organizerAPI,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "organizer calls player API",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "organizer", RoleOrganizer, tenantName),
+			call:   playerAPI,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "player not found",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, "not-found", RolePlayer, tenantName),
+			call:   playerAPI,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "disqualified player",
+			host:   tenantHost(tenantName),
+			token:  newTestToken(t, ids[1], RolePlayer, tenantName),
+			call:   playerAPI,
+			status: http.StatusForbidden,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call(newTestClient(tc.host, tc.token))
+			if tc.status == http.StatusOK {
+				if err != nil {
+					t.Fatalf("expected success, got %s", err)
+				}
+				return
+			}
+			assertStatus(t, err, tc.status)
+		})
+	}
+}
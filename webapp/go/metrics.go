@@ -0,0 +1,158 @@
+package isuports
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// echo.Contextに解決済みのテナント名を保存するキー
+	contextKeyTenantName = "isuports.tenant_name"
+
+	// テナントDBを開く時間を計測するドライバの名前
+	tenantSQLiteBaseDriverName = "sqlite3-tenant"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "isuports",
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "route", "status"},
+	)
+	tenantRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "isuports",
+			Name:      "tenant_requests_total",
+			Help:      "Number of HTTP requests by tenant.",
+		},
+		[]string{"tenant"},
+	)
+	tenantDBOpenDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "isuports",
+			Name:      "tenant_db_open_duration_seconds",
+			Help:      "Time spent opening a tenant DB file on the first connection.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		},
+	)
+	tenantLockWaitDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "isuports",
+			Name:      "tenant_lock_wait_duration_seconds",
+			Help:      "Time spent waiting for the tenant DB lock in flockByTenantID.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		},
+	)
+	dispenseIDRetriesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "isuports",
+			Name:      "dispense_id_retries_total",
+			Help:      "Number of dispenseID retries caused by deadlocks.",
+		},
+	)
+)
+
+func init() {
+	sql.Register(tenantSQLiteBaseDriverName, &tenantDBOpenMetricsDriver{Driver: &sqlite3.SQLiteDriver{}})
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		tenantRequestsTotal,
+		tenantDBOpenDuration,
+		tenantLockWaitDuration,
+		dispenseIDRetriesTotal,
+	)
+}
+
+// テナントDBのファイルを開くのにかかった時間を計測するドライバ
+// sqlx.Openではファイルは開かれず、最初のクエリで接続するときに開かれる
+// 計測のためだけにリクエストごとにPingしないよう、接続するときに計測する
+type tenantDBOpenMetricsDriver struct {
+	driver.Driver
+}
+
+func (d *tenantDBOpenMetricsDriver) Open(name string) (driver.Conn, error) {
+	start := time.Now()
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	tenantDBOpenDuration.Observe(time.Since(start).Seconds())
+	return conn, nil
+}
+
+// 管理用DBのコネクションプールの統計をメトリクスに登録する
+func registerAdminDBMetrics(db *sqlx.DB) error {
+	return metricsRegistry.Register(collectors.NewDBStatsCollector(db.DB, "admin"))
+}
+
+// リクエストごとのレイテンシとテナントごとのリクエスト数を記録する
+func RecordMetrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		httpRequestDuration.WithLabelValues(
+			c.Request().Method,
+			c.Path(),
+			strconv.Itoa(responseStatus(c, err)),
+		).Observe(time.Since(start).Seconds())
+
+		// Hostヘッダは任意の値を送れるので、解決できたテナントのみラベルにする
+		tenantName, ok := c.Get(contextKeyTenantName).(string)
+		if !ok {
+			tenantName = "unknown"
+		}
+		tenantRequestsTotal.WithLabelValues(tenantName).Inc()
+		return err
+	}
+}
+
+// レスポンスのステータスコードを返す
+// エラーはこのあとerrorResponseHandlerで書き込まれるので、エラーがあればエラーから決める
+func responseStatus(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// メトリクス用のサーバーを起動する
+// テナントのホスト名で公開されないように、アプリケーションとは別のポートで待ち受ける
+func startMetricsServer(addr string, logger echo.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// メトリクスが取れなくてもサービスは継続する
+			logger.Errorf("error metrics server: %s", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,68 @@
+package isuports
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMetricsServer(t *testing.T) {
+	// 空いているポートで起動する
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error net.Listen: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	srv := startMetricsServer(addr, echo.New().Logger)
+	defer srv.Close()
+
+	e := echo.New()
+	e.Use(RecordMetrics)
+	e.GET("/api/metrics-test/:id", func(c echo.Context) error {
+		c.Set(contextKeyTenantName, "metrics-test")
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/api/metrics-test-error", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "not found")
+	})
+	for _, path := range []string{"/api/metrics-test/1", "/api/metrics-test/2", "/api/metrics-test-error"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// 起動するまで少し待つ
+	var body string
+	for i := 0; i < 50; i++ {
+		res, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("error io.ReadAll: %s", err)
+		}
+		body = string(b)
+		break
+	}
+	// ルートはパスパラメータを含まない定義のまま、テナントは解決できたもののみラベルにする
+	for _, want := range []string{
+		`isuports_http_request_duration_seconds_count{method="GET",route="/api/metrics-test/:id",status="200"} 2`,
+		`isuports_http_request_duration_seconds_count{method="GET",route="/api/metrics-test-error",status="404"} 1`,
+		`isuports_tenant_requests_total{tenant="metrics-test"} 2`,
+		`isuports_tenant_lock_wait_duration_seconds_count`,
+		`isuports_dispense_id_retries_total`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics must contain %s", want)
+		}
+	}
+}
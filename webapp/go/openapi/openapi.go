@@ -0,0 +1,295 @@
+// Package openapi はisuports APIのOpenAPI定義を埋め込み、
+// リクエスト・レスポンスの検証とクライアント生成に必要な範囲で読み込む
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
+
+type Document struct {
+	OpenAPI    string                `yaml:"openapi"`
+	Info       Info                  `yaml:"info"`
+	Paths      map[string]*PathItem  `yaml:"paths"`
+	Components Components            `yaml:"components"`
+	Security   []map[string][]string `yaml:"security"`
+}
+
+type Info struct {
+	Title   string `yaml:"title"`
+	Version string `yaml:"version"`
+}
+
+type Components struct {
+	Schemas   map[string]*Schema   `yaml:"schemas"`
+	Responses map[string]*Response `yaml:"responses"`
+}
+
+type PathItem struct {
+	Get  *Operation `yaml:"get"`
+	Post *Operation `yaml:"post"`
+}
+
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Tags        []string             `yaml:"tags"`
+	Summary     string               `yaml:"summary"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+
+	// 読み込み時に埋める
+	Method string `yaml:"-"`
+	Path   string `yaml:"-"`
+}
+
+type Parameter struct {
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"` // path, query
+	Required    bool    `yaml:"required"`
+	Description string  `yaml:"description"`
+	Schema      *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref         string                `yaml:"$ref"`
+	Description string                `yaml:"description"`
+	Content     map[string]*MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Enum                 []string           `yaml:"enum"`
+	Nullable             bool               `yaml:"nullable"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	Items                *Schema            `yaml:"items"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	AdditionalProperties *Schema            `yaml:"additionalProperties"`
+	AllOf                []*Schema          `yaml:"allOf"`
+
+	// propertiesを定義に書かれた順に並べたもの クライアントの生成に使う
+	PropertyNames []string `yaml:"-"`
+}
+
+func (s *Schema) UnmarshalYAML(node *yaml.Node) error {
+	type plain Schema
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "properties" {
+			continue
+		}
+		props := node.Content[i+1]
+		for j := 0; j+1 < len(props.Content); j += 2 {
+			s.PropertyNames = append(s.PropertyNames, props.Content[j].Value)
+		}
+	}
+	return nil
+}
+
+const (
+	ContentTypeJSON      = "application/json"
+	ContentTypeForm      = "application/x-www-form-urlencoded"
+	ContentTypeMultipart = "multipart/form-data"
+)
+
+// 埋め込んだ定義を読み込む
+func Load() (*Document, error) {
+	return Parse(Spec)
+}
+
+// 定義を読み込み、$refが解決できることを確認する
+func Parse(b []byte) (*Document, error) {
+	var doc Document
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error yaml.Decode: %w", err)
+	}
+	ids := map[string]string{}
+	for _, op := range doc.Operations() {
+		if op.OperationID == "" {
+			return nil, fmt.Errorf("operationId is missing: %s %s", op.Method, op.Path)
+		}
+		if prev, ok := ids[op.OperationID]; ok {
+			return nil, fmt.Errorf("duplicate operationId %s: %s and %s %s", op.OperationID, prev, op.Method, op.Path)
+		}
+		ids[op.OperationID] = op.Method + " " + op.Path
+		for code, res := range op.Responses {
+			r, err := doc.ResolveResponse(res)
+			if err != nil {
+				return nil, fmt.Errorf("error ResolveResponse: %s %s %s, %w", op.Method, op.Path, code, err)
+			}
+			for _, mt := range r.Content {
+				if err := doc.checkRefs(mt.Schema); err != nil {
+					return nil, fmt.Errorf("%s %s %s: %w", op.Method, op.Path, code, err)
+				}
+			}
+		}
+	}
+	for name, s := range doc.Components.Schemas {
+		if err := doc.checkRefs(s); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	return &doc, nil
+}
+
+func (d *Document) checkRefs(s *Schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		_, err := d.ResolveSchema(s)
+		return err
+	}
+	for _, p := range s.Properties {
+		if err := d.checkRefs(p); err != nil {
+			return err
+		}
+	}
+	for _, a := range s.AllOf {
+		if err := d.checkRefs(a); err != nil {
+			return err
+		}
+	}
+	if err := d.checkRefs(s.Items); err != nil {
+		return err
+	}
+	return d.checkRefs(s.AdditionalProperties)
+}
+
+// 全てのオペレーションをパス、メソッドの順に返す
+func (d *Document) Operations() []*Operation {
+	paths := make([]string, 0, len(d.Paths))
+	for p := range d.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	ops := []*Operation{}
+	for _, p := range paths {
+		item := d.Paths[p]
+		for _, m := range []struct {
+			method string
+			op     *Operation
+		}{{"GET", item.Get}, {"POST", item.Post}} {
+			if m.op == nil {
+				continue
+			}
+			m.op.Method = m.method
+			m.op.Path = p
+			ops = append(ops, m.op)
+		}
+	}
+	return ops
+}
+
+// echoのルート(/api/player/player/:player_id)に対応するオペレーションを返す
+// 定義されていなければnilを返す
+func (d *Document) Operation(method, echoPath string) *Operation {
+	item, ok := d.Paths[EchoPathToOpenAPI(echoPath)]
+	if !ok {
+		return nil
+	}
+	switch method {
+	case "GET":
+		return item.Get
+	case "POST":
+		return item.Post
+	}
+	return nil
+}
+
+// /api/player/player/:player_id を /api/player/player/{player_id} に変換する
+func EchoPathToOpenAPI(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		if strings.HasPrefix(s, ":") {
+			parts[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// #/components/schemas/Name のNameを返す
+func RefName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// $refと要素が1つのallOfを辿ったスキーマを返す
+func (d *Document) ResolveSchema(s *Schema) (*Schema, error) {
+	for s != nil {
+		if len(s.AllOf) == 1 {
+			s = s.AllOf[0]
+			continue
+		}
+		if s.Ref == "" {
+			return s, nil
+		}
+		if !strings.HasPrefix(s.Ref, "#/components/schemas/") {
+			return nil, fmt.Errorf("unsupported $ref: %s", s.Ref)
+		}
+		next, ok := d.Components.Schemas[RefName(s.Ref)]
+		if !ok {
+			return nil, fmt.Errorf("schema not found: %s", s.Ref)
+		}
+		s = next
+	}
+	return nil, fmt.Errorf("schema is nil")
+}
+
+func (d *Document) ResolveResponse(r *Response) (*Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	if !strings.HasPrefix(r.Ref, "#/components/responses/") {
+		return nil, fmt.Errorf("unsupported $ref: %s", r.Ref)
+	}
+	res, ok := d.Components.Responses[RefName(r.Ref)]
+	if !ok {
+		return nil, fmt.Errorf("response not found: %s", r.Ref)
+	}
+	return res, nil
+}
+
+// ステータスコードに対応するレスポンスのスキーマを返す
+// 定義にないステータスコードならdefaultを使う
+func (d *Document) ResponseSchema(op *Operation, status int, contentType string) (*Schema, error) {
+	res, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		if res, ok = op.Responses["default"]; !ok {
+			return nil, fmt.Errorf("undocumented status: %d", status)
+		}
+	}
+	r, err := d.ResolveResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	mt, ok := r.Content[contentType]
+	if !ok {
+		return nil, fmt.Errorf("undocumented content type for status %d: %s", status, contentType)
+	}
+	return mt.Schema, nil
+}
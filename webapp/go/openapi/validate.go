@@ -0,0 +1,237 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// パスとクエリのパラメータを検証する
+// valuesにはパラメータ名ごとの値を渡す パスパラメータは要素1つのスライスにする
+func (d *Document) ValidateParameters(op *Operation, in string, values map[string][]string) error {
+	for _, p := range op.Parameters {
+		if p.In != in {
+			continue
+		}
+		vs := values[p.Name]
+		if len(vs) == 0 || vs[0] == "" {
+			if p.Required {
+				return fmt.Errorf("%s parameter %s is required", in, p.Name)
+			}
+			continue
+		}
+		s, err := d.ResolveSchema(p.Schema)
+		if err != nil {
+			return err
+		}
+		if err := validateString(s, vs[0]); err != nil {
+			return fmt.Errorf("%s parameter %s: %w", in, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// フォームで送られたリクエストボディを検証する
+// 定義にないフィールドは無視する
+// filesにはmultipartで送られたファイルのフィールド名を渡す
+func (d *Document) ValidateForm(op *Operation, contentType string, form url.Values, files map[string]bool) error {
+	if op.RequestBody == nil {
+		return nil
+	}
+	mt, ok := op.RequestBody.Content[contentType]
+	if !ok {
+		if op.RequestBody.Required {
+			return fmt.Errorf("unsupported content type: %s", contentType)
+		}
+		return nil
+	}
+	schema, err := d.ResolveSchema(mt.Schema)
+	if err != nil {
+		return err
+	}
+	for _, name := range schema.Required {
+		if _, ok := form[name]; !ok && !files[name] {
+			return fmt.Errorf("field %s is required", name)
+		}
+	}
+	for _, name := range sortedKeys(schema.Properties) {
+		prop, err := d.ResolveSchema(schema.Properties[name])
+		if err != nil {
+			return err
+		}
+		if prop.Format == "binary" {
+			if _, ok := form[name]; ok && !files[name] {
+				return fmt.Errorf("field %s must be a file", name)
+			}
+			continue
+		}
+		vs, ok := form[name]
+		if !ok {
+			continue
+		}
+		if prop.Type == "array" {
+			item, err := d.ResolveSchema(prop.Items)
+			if err != nil {
+				return err
+			}
+			for i, v := range vs {
+				if err := validateString(item, v); err != nil {
+					return fmt.Errorf("field %s[%d]: %w", name, i, err)
+				}
+			}
+			continue
+		}
+		// 空文字列は「未設定にする」の意味で使うフィールドがあるので型の検証はしない
+		if len(vs) == 0 || vs[0] == "" {
+			continue
+		}
+		if err := validateString(prop, vs[0]); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// フォームやクエリの文字列の値がスキーマの型に合うかを検証する
+func validateString(s *Schema, v string) error {
+	var n float64
+	switch s.Type {
+	case "integer":
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer: %q", v)
+		}
+		n = float64(i)
+	case "number":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number: %q", v)
+		}
+		n = f
+	case "boolean":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("must be a boolean: %q", v)
+		}
+	}
+	if err := validateRange(s, n); err != nil {
+		return err
+	}
+	return validateEnum(s, v)
+}
+
+func validateRange(s *Schema, n float64) error {
+	if s.Type != "integer" && s.Type != "number" {
+		return nil
+	}
+	if s.Minimum != nil && n < *s.Minimum {
+		return fmt.Errorf("must be greater than or equal to %v: %v", *s.Minimum, n)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		return fmt.Errorf("must be less than or equal to %v: %v", *s.Maximum, n)
+	}
+	return nil
+}
+
+func validateEnum(s *Schema, v string) error {
+	if len(s.Enum) == 0 {
+		return nil
+	}
+	for _, e := range s.Enum {
+		if e == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %v: %q", s.Enum, v)
+}
+
+// JSONのレスポンスボディを検証する
+func (d *Document) ValidateJSON(s *Schema, body []byte) error {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("error json.Unmarshal: %w", err)
+	}
+	return d.validateValue(s, v, "$")
+}
+
+func (d *Document) validateValue(s *Schema, v any, path string) error {
+	nullable := s.Nullable
+	s, err := d.ResolveSchema(s)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if nullable || s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: must not be null", path)
+	}
+	switch s.Type {
+	case "object":
+		o, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := o[name]; !ok {
+				return fmt.Errorf("%s: property %s is required", path, name)
+			}
+		}
+		for _, name := range sortedKeys(o) {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if prop == nil {
+				continue
+			}
+			if err := d.validateValue(prop, o[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an array", path)
+		}
+		for i, item := range a {
+			if err := d.validateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", path)
+		}
+		if err := validateEnum(s, str); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s: must be a %s", path, s.Type)
+		}
+		if s.Type == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+		if err := validateRange(s, n); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", path)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: test
+  version: "1"
+paths:
+  /api/things/{id}:
+    post:
+      operationId: ThingsEdit
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+      requestBody:
+        required: true
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              $ref: "#/components/schemas/ThingForm"
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Thing"
+components:
+  schemas:
+    ThingForm:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        order:
+          type: string
+          enum: [asc, desc]
+        tags:
+          type: array
+          items:
+            type: integer
+    Thing:
+      type: object
+      required: [id, score]
+      properties:
+        id:
+          type: string
+        score:
+          type: integer
+        finished_at:
+          type: integer
+          nullable: true
+`
+
+func TestValidate(t *testing.T) {
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("error Parse: %s", err)
+	}
+	op := doc.Paths["/api/things/{id}"].Post
+	if op.OperationID != "ThingsEdit" {
+		t.Fatalf("unexpected operation: %+v", op)
+	}
+
+	for _, tc := range []struct {
+		in      string
+		values  map[string][]string
+		wantErr string
+	}{
+		{"path", map[string][]string{"id": {"a"}}, ""},
+		{"path", map[string][]string{}, "path parameter id is required"},
+		{"query", map[string][]string{"limit": {"10"}}, ""},
+		{"query", map[string][]string{"limit": {"ten"}}, "must be an integer"},
+		{"query", map[string][]string{"limit": {"0"}}, "greater than or equal to 1"},
+	} {
+		err := doc.ValidateParameters(op, tc.in, tc.values)
+		if (tc.wantErr == "" && err != nil) || (tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr))) {
+			t.Errorf("ValidateParameters(%s, %v) = %v, want %q", tc.in, tc.values, err, tc.wantErr)
+		}
+	}
+
+	for _, tc := range []struct {
+		form    url.Values
+		wantErr string
+	}{
+		{url.Values{"name": {"x"}, "order": {"asc"}, "tags": {"1", "2"}, "unknown": {"y"}}, ""},
+		// 空文字列は未設定の意味なので検証しない
+		{url.Values{"name": {"x"}, "order": {""}}, ""},
+		{url.Values{"order": {"asc"}}, "field name is required"},
+		{url.Values{"name": {"x"}, "order": {"random"}}, "must be one of"},
+		{url.Values{"name": {"x"}, "tags": {"1", "b"}}, "field tags[1]"},
+	} {
+		err := doc.ValidateForm(op, ContentTypeForm, tc.form, nil)
+		if (tc.wantErr == "" && err != nil) || (tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr))) {
+			t.Errorf("ValidateForm(%v) = %v, want %q", tc.form, err, tc.wantErr)
+		}
+	}
+	if err := doc.ValidateForm(op, ContentTypeJSON, url.Values{}, nil); err == nil {
+		t.Errorf("unsupported content type must be rejected")
+	}
+
+	schema := op.Responses["200"].Content[ContentTypeJSON].Schema
+	for _, tc := range []struct {
+		body    string
+		wantErr string
+	}{
+		{`{"id":"a","score":1,"finished_at":null,"extra":true}`, ""},
+		{`{"id":"a"}`, "property score is required"},
+		{`{"id":"a","score":1.5}`, "$.score: must be an integer"},
+		{`{"id":null,"score":1}`, "$.id: must not be null"},
+	} {
+		err := doc.ValidateJSON(schema, []byte(tc.body))
+		if (tc.wantErr == "" && err != nil) || (tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr))) {
+			t.Errorf("ValidateJSON(%s) = %v, want %q", tc.body, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	// 埋め込んだ定義の$refが全て解決できる
+	doc, err := Load()
+	if err != nil {
+		t.Fatalf("error Load: %s", err)
+	}
+	if len(doc.Operations()) == 0 {
+		t.Fatalf("no operations")
+	}
+}
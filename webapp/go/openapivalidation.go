@@ -0,0 +1,108 @@
+package isuports
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+// Runで openapi/openapi.yaml を読み込む
+var apiSpec *openapi.Document
+
+// リクエストとレスポンスをOpenAPIの定義で検証する
+// openapi.validate_requests を有効にすると、定義に合わないリクエストを400で拒否する
+// openapi.validate_responses を有効にすると、定義に合わないレスポンスをログに出力する(レスポンスは変えない)
+// 定義にないルートは検証しない
+func ValidateOpenAPI(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg := appConfig.OpenAPI
+		if !cfg.ValidateRequests && !cfg.ValidateResponses {
+			return next(c)
+		}
+		op := apiSpec.Operation(c.Request().Method, c.Path())
+		if op == nil {
+			return next(c)
+		}
+		if cfg.ValidateRequests {
+			if err := validateAPIRequest(c, op); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request for %s: %s", op.OperationID, err))
+			}
+		}
+		if !cfg.ValidateResponses {
+			return next(c)
+		}
+
+		res := c.Response()
+		w := &responseRecorder{ResponseWriter: res.Writer}
+		res.Writer = w
+		err := next(c)
+		res.Writer = w.ResponseWriter
+		// エラーはこのあとerrorResponseHandlerで書き込まれるので、成功したレスポンスのみ検証する
+		if err == nil {
+			if verr := validateAPIResponse(op, res.Status, res.Header().Get(echo.HeaderContentType), w.body.Bytes()); verr != nil {
+				c.Logger().Warnf("response does not match openapi spec: %s %s: %s", op.OperationID, c.Request().URL.Path, verr)
+			}
+		}
+		return err
+	}
+}
+
+func validateAPIRequest(c echo.Context, op *openapi.Operation) error {
+	pathValues := map[string][]string{}
+	for _, name := range c.ParamNames() {
+		pathValues[name] = []string{c.Param(name)}
+	}
+	if err := apiSpec.ValidateParameters(op, "path", pathValues); err != nil {
+		return err
+	}
+	if err := apiSpec.ValidateParameters(op, "query", c.QueryParams()); err != nil {
+		return err
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	// c.FormParamsで読んだ内容はリクエストにキャッシュされるので、ハンドラでも同じ値を読める
+	form, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	files := map[string]bool{}
+	if mf := c.Request().MultipartForm; mf != nil {
+		for name, fhs := range mf.File {
+			files[name] = len(fhs) > 0
+		}
+	}
+	return apiSpec.ValidateForm(op, contentType, form, files)
+}
+
+func validateAPIResponse(op *openapi.Operation, status int, contentType string, body []byte) error {
+	if status == http.StatusNotModified {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	schema, err := apiSpec.ResponseSchema(op, status, mediaType)
+	if err != nil {
+		return err
+	}
+	if mediaType != openapi.ContentTypeJSON {
+		return nil
+	}
+	return apiSpec.ValidateJSON(schema, body)
+}
+
+// 書き込んだレスポンスボディを控えておく
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
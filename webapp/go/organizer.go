@@ -0,0 +1,436 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// テナントごとの主催者アカウント
+// JWTのsubをアカウント名として、テナントの管理用DBに登録したアカウントの権限で主催者向けAPIを認可する
+// blackauthが全員に発行していた sub: "organizer" はアカウントを登録しなくてもオーナーとして扱う
+
+const (
+	// 全ての権限を持ち、主催者アカウント・APIトークンを管理できる
+	OrganizerRoleOwner = "owner"
+	// 付与された権限の操作のみ行える 閲覧は権限がなくても行える
+	OrganizerRoleMember = "member"
+
+	PermissionManagePlayers      = "manage_players"
+	PermissionManageCompetitions = "manage_competitions"
+	PermissionUploadScores       = "upload_scores"
+	PermissionFinishCompetitions = "finish_competitions"
+	PermissionViewBilling        = "view_billing"
+	PermissionManageWebhooks     = "manage_webhooks"
+
+	// blackauthが発行する共有の主催者のsub
+	defaultOrganizerSubject = "organizer"
+
+	// echo.Contextに認可済みのViewerを保存するキー
+	contextKeyViewer = "isuports.viewer"
+
+	organizerActionLogLimit = 100
+)
+
+var allOrganizerPermissions = []string{
+	PermissionManagePlayers,
+	PermissionManageCompetitions,
+	PermissionUploadScores,
+	PermissionFinishCompetitions,
+	PermissionViewBilling,
+	PermissionManageWebhooks,
+}
+
+type OrganizerAccountRow struct {
+	ID          int64  `db:"id"`
+	TenantID    int64  `db:"tenant_id"`
+	Name        string `db:"name"`
+	Role        string `db:"role"`
+	Permissions string `db:"permissions"` // スペース区切り
+	CreatedBy   string `db:"created_by"`
+	CreatedAt   int64  `db:"created_at"`
+	UpdatedAt   int64  `db:"updated_at"`
+}
+
+// 主催者向けAPIで行われた更新の記録
+type OrganizerActionLogRow struct {
+	ID        int64  `db:"id"`
+	TenantID  int64  `db:"tenant_id"`
+	Subject   string `db:"subject"`
+	Method    string `db:"method"`
+	Path      string `db:"path"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// JWTでログインした主催者のアカウントの権限をViewerに設定する
+func applyOrganizerAccount(ctx context.Context, v *Viewer) error {
+	if v.playerID == defaultOrganizerSubject {
+		v.organizerRole = OrganizerRoleOwner
+		return nil
+	}
+	var a OrganizerAccountRow
+	if err := adminDB.GetContext(
+		ctx,
+		&a,
+		"SELECT * FROM organizer_account WHERE tenant_id = ? AND name = ?",
+		v.tenantID, v.playerID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "organizer account not found")
+		}
+		return fmt.Errorf("error Select organizer_account: tenantID=%d, name=%s, %w", v.tenantID, v.playerID, err)
+	}
+	v.organizerRole = a.Role
+	v.permissions = strings.Fields(a.Permissions)
+	return nil
+}
+
+// 主催者アカウントの権限を持っているか
+// オーナー、共有の主催者、APIトークン、なりすましセッションは全ての権限を持っているとみなす
+// APIトークンはスコープで、なりすましセッションは書き込みの可否で別に制限する
+// それ以外は付与された権限を持つメンバーのみ許可し、ロールが分からなければ拒否する
+func (v *Viewer) hasPermission(permission string) bool {
+	switch {
+	case v.apiTokenID != 0, v.isImpersonated():
+		return true
+	case v.organizerRole == OrganizerRoleOwner, v.playerID == defaultOrganizerSubject:
+		return true
+	case v.organizerRole == OrganizerRoleMember:
+		for _, p := range v.permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 主催者アカウントとAPIトークンの管理は、ブラウザでログインしたオーナーのみ行える
+func authorizeOrganizerOwner(c echo.Context) (*Viewer, error) {
+	v, err := parseViewer(c)
+	if err != nil {
+		return nil, fmt.Errorf("error parseViewer: %w", err)
+	}
+	if v.role != RoleOrganizer {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "role organizer required")
+	}
+	if v.apiTokenID != 0 {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "api token cannot manage organizers and api tokens")
+	}
+	// なりすましセッションが終わったあとも使えるトークンやアカウントを作らせない
+	if v.isImpersonated() && c.Request().Method != http.MethodGet {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "impersonation session cannot manage organizers and api tokens")
+	}
+	if !v.isImpersonated() && v.organizerRole != OrganizerRoleOwner && v.playerID != defaultOrganizerSubject {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "organizer role owner required")
+	}
+	return v, nil
+}
+
+// 主催者向けAPIで成功した更新を、操作した主催者のsubとあわせて記録する
+// ハンドラがparseViewerで保存したViewerを使うので、認可に失敗したリクエストは記録しない
+func RecordOrganizerAction(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if c.Request().Method == http.MethodGet || !strings.HasPrefix(c.Path(), "/api/organizer/") {
+			return err
+		}
+		v, ok := c.Get(contextKeyViewer).(*Viewer)
+		if !ok || v.role != RoleOrganizer || responseStatus(c, err) >= http.StatusBadRequest {
+			return err
+		}
+		if _, lerr := adminDB.NamedExecContext(
+			requestContext(c),
+			"INSERT INTO organizer_action_log (tenant_id, subject, method, path, created_at) VALUES (:tenant_id, :subject, :method, :path, :created_at)",
+			OrganizerActionLogRow{
+				TenantID:  v.tenantID,
+				Subject:   v.playerID,
+				Method:    c.Request().Method,
+				Path:      c.Request().URL.Path,
+				CreatedAt: time.Now().Unix(),
+			},
+		); lerr != nil {
+			// 更新は終わっているので、記録に失敗してもレスポンスは変えない
+			c.Logger().Errorf("error Insert organizer_action_log: tenantID=%d, subject=%s, %s", v.tenantID, v.playerID, lerr)
+		}
+		return err
+	}
+}
+
+type OrganizerAccountDetail struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	CreatedBy   string   `json:"created_by"`
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+func organizerAccountDetail(a OrganizerAccountRow) OrganizerAccountDetail {
+	return OrganizerAccountDetail{
+		ID:          strconv.FormatInt(a.ID, 10),
+		Name:        a.Name,
+		Role:        a.Role,
+		Permissions: strings.Fields(a.Permissions),
+		CreatedBy:   a.CreatedBy,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+	}
+}
+
+type OrganizersHandlerResult struct {
+	Organizers []OrganizerAccountDetail `json:"organizers"`
+}
+
+// フォームのroleとpermissions[]を検証する
+// オーナーは全ての権限を持つので、permissions[]は保存しない
+func parseOrganizerRoleAndPermissions(c echo.Context) (string, string, error) {
+	role := c.FormValue("role")
+	if role == "" {
+		role = OrganizerRoleMember
+	}
+	if role != OrganizerRoleOwner && role != OrganizerRoleMember {
+		return "", "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid role: %s", role))
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return "", "", fmt.Errorf("error c.FormParams: %w", err)
+	}
+	permissionSet := map[string]struct{}{}
+	for _, p := range params["permissions[]"] {
+		valid := false
+		for _, ap := range allOrganizerPermissions {
+			if p == ap {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid permission: %s", p))
+		}
+		permissionSet[p] = struct{}{}
+	}
+	if role == OrganizerRoleOwner {
+		return role, "", nil
+	}
+	permissions := make([]string, 0, len(permissionSet))
+	for p := range permissionSet {
+		permissions = append(permissions, p)
+	}
+	sort.Strings(permissions)
+	return role, strings.Join(permissions, " "), nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/organizers/add
+// 主催者アカウントを追加する
+func organizersAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	name := c.FormValue("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name required")
+	}
+	if name == defaultOrganizerSubject {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name %s is reserved", name))
+	}
+	role, permissions, err := parseOrganizerRoleAndPermissions(c)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	a := OrganizerAccountRow{
+		TenantID:    v.tenantID,
+		Name:        name,
+		Role:        role,
+		Permissions: permissions,
+		CreatedBy:   v.playerID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	res, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO organizer_account (tenant_id, name, role, permissions, created_by, created_at, updated_at) VALUES (:tenant_id, :name, :role, :permissions, :created_by, :created_at, :updated_at)",
+		a,
+	)
+	if err != nil {
+		if isDuplicateEntryError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, "duplicate organizer name")
+		}
+		return fmt.Errorf("error Insert organizer_account: tenantID=%d, name=%s, %w", v.tenantID, name, err)
+	}
+	if a.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("error get LastInsertId: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   OrganizersHandlerResult{Organizers: []OrganizerAccountDetail{organizerAccountDetail(a)}},
+	})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/organizers
+// 主催者アカウントの一覧を返す
+func organizersHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	as := []OrganizerAccountRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&as,
+		"SELECT * FROM organizer_account WHERE tenant_id = ? ORDER BY id ASC",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select organizer_account: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]OrganizerAccountDetail, 0, len(as))
+	for _, a := range as {
+		ds = append(ds, organizerAccountDetail(a))
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   OrganizersHandlerResult{Organizers: ds},
+	})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/organizer/:organizer_id/permissions
+// 主催者アカウントのロールと権限を置き換える
+func organizerPermissionsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseInt(c.Param("organizer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid organizer_id")
+	}
+	role, permissions, err := parseOrganizerRoleAndPermissions(c)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE organizer_account SET role = ?, permissions = ?, updated_at = ? WHERE id = ? AND tenant_id = ?",
+		role, permissions, now, id, v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Update organizer_account: id=%d, role=%s, permissions=%s, %w", id, role, permissions, err)
+	}
+	var a OrganizerAccountRow
+	if err := adminDB.GetContext(
+		ctx,
+		&a,
+		"SELECT * FROM organizer_account WHERE id = ? AND tenant_id = ?",
+		id, v.tenantID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "organizer not found")
+		}
+		return fmt.Errorf("error Select organizer_account: id=%d, %w", id, err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   OrganizersHandlerResult{Organizers: []OrganizerAccountDetail{organizerAccountDetail(a)}},
+	})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/organizer/:organizer_id/delete
+// 主催者アカウントを削除する 削除したアカウントのJWTは使えなくなる
+func organizerDeleteHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseInt(c.Param("organizer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid organizer_id")
+	}
+	res, err := adminDB.ExecContext(
+		ctx,
+		"DELETE FROM organizer_account WHERE id = ? AND tenant_id = ?",
+		id, v.tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("error Delete organizer_account: id=%d, %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error RowsAffected: %w", err)
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "organizer not found")
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
+
+type OrganizerActionLogDetail struct {
+	Subject   string `json:"subject"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type OrganizerActionLogsHandlerResult struct {
+	ActionLogs []OrganizerActionLogDetail `json:"action_logs"`
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/action_logs
+// 主催者向けAPIで行われた更新を新しい順に最大100件返す
+// URL引数subjectを指定した場合、その主催者の更新のみ返す
+func organizerActionLogsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := authorizeOrganizerOwner(c)
+	if err != nil {
+		return err
+	}
+
+	query := "SELECT * FROM organizer_action_log WHERE tenant_id = ?"
+	args := []any{v.tenantID}
+	if subject := c.QueryParam("subject"); subject != "" {
+		query += " AND subject = ?"
+		args = append(args, subject)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, organizerActionLogLimit)
+	ls := []OrganizerActionLogRow{}
+	if err := adminDB.SelectContext(ctx, &ls, query, args...); err != nil {
+		return fmt.Errorf("error Select organizer_action_log: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]OrganizerActionLogDetail, 0, len(ls))
+	for _, l := range ls {
+		ds = append(ds, OrganizerActionLogDetail{
+			Subject:   l.Subject,
+			Method:    l.Method,
+			Path:      l.Path,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   OrganizerActionLogsHandlerResult{ActionLogs: ds},
+	})
+}
@@ -0,0 +1,160 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func newOrganizerAccountClient(t *testing.T, tenantName, name string) *client.Client {
+	return newTestClient(tenantHost(tenantName), newTestToken(t, name, RoleOrganizer, tenantName))
+}
+
+func TestOrganizerAccounts(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	owner := newOrganizerClient(t, tenantName)
+	competitionID := addTestCompetition(t, tenantName, "competition")
+
+	// 登録していないアカウントではログインできない
+	alice := newOrganizerAccountClient(t, tenantName, "alice")
+	_, err := alice.PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+
+	_, err = owner.OrganizersAdd(ctx, &client.OrganizersAddParams{Name: "organizer"})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = owner.OrganizersAdd(ctx, &client.OrganizersAddParams{Name: "alice", Permissions: []string{"unknown"}})
+	assertStatus(t, err, http.StatusBadRequest)
+	added, err := owner.OrganizersAdd(ctx, &client.OrganizersAddParams{Name: "alice", Permissions: []string{PermissionManagePlayers}})
+	if err != nil {
+		t.Fatalf("error OrganizersAdd: %s", err)
+	}
+	if a := added.Organizers[0]; a.Role != OrganizerRoleMember || a.CreatedBy != "organizer" || len(a.Permissions) != 1 {
+		t.Fatalf("unexpected organizer: %+v", a)
+	}
+	_, err = owner.OrganizersAdd(ctx, &client.OrganizersAddParams{Name: "alice"})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	// 権限のある操作と閲覧のみ行える
+	if _, err := alice.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"bob"}}); err != nil {
+		t.Fatalf("error PlayersAdd: %s", err)
+	}
+	if _, err := alice.OrganizerCompetitions(ctx); err != nil {
+		t.Fatalf("error OrganizerCompetitions: %s", err)
+	}
+	err = alice.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID})
+	assertStatus(t, err, http.StatusForbidden)
+	_, err = alice.Billing(ctx)
+	assertStatus(t, err, http.StatusForbidden)
+	// メンバーは主催者アカウントとAPIトークンを管理できない
+	_, err = alice.Organizers(ctx)
+	assertStatus(t, err, http.StatusForbidden)
+	_, err = alice.APITokensAdd(ctx, &client.APITokensAddParams{Name: "ci", Scopes: []string{ScopePlayersRead}})
+	assertStatus(t, err, http.StatusForbidden)
+
+	id, err := strconv.ParseInt(added.Organizers[0].ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	if _, err := owner.OrganizerPermissions(ctx, &client.OrganizerPermissionsParams{
+		OrganizerID: id,
+		Permissions: []string{PermissionFinishCompetitions, PermissionViewBilling},
+	}); err != nil {
+		t.Fatalf("error OrganizerPermissions: %s", err)
+	}
+	if err := alice.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	if _, err := alice.Billing(ctx); err != nil {
+		t.Fatalf("error Billing: %s", err)
+	}
+	_, err = alice.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"carol"}})
+	assertStatus(t, err, http.StatusForbidden)
+
+	// オーナーに変更すると全ての操作を行える
+	if _, err := owner.OrganizerPermissions(ctx, &client.OrganizerPermissionsParams{OrganizerID: id, Role: ptr(OrganizerRoleOwner)}); err != nil {
+		t.Fatalf("error OrganizerPermissions: %s", err)
+	}
+	organizers, err := alice.Organizers(ctx)
+	if err != nil {
+		t.Fatalf("error Organizers: %s", err)
+	}
+	if len(organizers.Organizers) != 1 || organizers.Organizers[0].Role != OrganizerRoleOwner {
+		t.Fatalf("unexpected organizers: %+v", organizers.Organizers)
+	}
+
+	// 他のテナントのアカウントは変更できない
+	err = newOrganizerClient(t, newTestTenant(t)).OrganizerDelete(ctx, &client.OrganizerDeleteParams{OrganizerID: id})
+	assertStatus(t, err, http.StatusNotFound)
+	if err := owner.OrganizerDelete(ctx, &client.OrganizerDeleteParams{OrganizerID: id}); err != nil {
+		t.Fatalf("error OrganizerDelete: %s", err)
+	}
+	_, err = alice.OrganizerCompetitions(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+}
+
+func TestOrganizerActionLogs(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	owner := newOrganizerClient(t, tenantName)
+	if _, err := owner.OrganizersAdd(ctx, &client.OrganizersAddParams{Name: "alice", Permissions: []string{PermissionManagePlayers}}); err != nil {
+		t.Fatalf("error OrganizersAdd: %s", err)
+	}
+	alice := newOrganizerAccountClient(t, tenantName, "alice")
+	if _, err := alice.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"bob"}}); err != nil {
+		t.Fatalf("error PlayersAdd: %s", err)
+	}
+	// 失敗した操作と閲覧は記録しない
+	_, err := alice.CompetitionsAdd(ctx, &client.CompetitionsAddParams{Title: "competition"})
+	assertStatus(t, err, http.StatusForbidden)
+	if _, err := alice.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList: %s", err)
+	}
+
+	logs, err := owner.OrganizerActionLogs(ctx, &client.OrganizerActionLogsParams{})
+	if err != nil {
+		t.Fatalf("error OrganizerActionLogs: %s", err)
+	}
+	if len(logs.ActionLogs) != 2 {
+		t.Fatalf("expected 2 action logs, got %+v", logs.ActionLogs)
+	}
+	if l := logs.ActionLogs[0]; l.Subject != "alice" || l.Method != http.MethodPost || l.Path != "/api/organizer/players/add" {
+		t.Fatalf("unexpected action log: %+v", l)
+	}
+	if l := logs.ActionLogs[1]; l.Subject != "organizer" || l.Path != "/api/organizer/organizers/add" {
+		t.Fatalf("unexpected action log: %+v", l)
+	}
+
+	logs, err = owner.OrganizerActionLogs(ctx, &client.OrganizerActionLogsParams{Subject: "organizer"})
+	if err != nil {
+		t.Fatalf("error OrganizerActionLogs: %s", err)
+	}
+	if len(logs.ActionLogs) != 1 {
+		t.Fatalf("expected 1 action log, got %+v", logs.ActionLogs)
+	}
+}
+
+func TestViewerHasPermission(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		v    Viewer
+		want bool
+	}{
+		{"owner", Viewer{role: RoleOrganizer, playerID: "alice", organizerRole: OrganizerRoleOwner}, true},
+		{"default subject", Viewer{role: RoleOrganizer, playerID: defaultOrganizerSubject}, true},
+		{"api token", Viewer{role: RoleOrganizer, playerID: "api_token:1", apiTokenID: 1}, true},
+		{"impersonation", Viewer{role: RoleOrganizer, playerID: "impersonation:1", impersonationID: 1}, true},
+		{"member with permission", Viewer{role: RoleOrganizer, playerID: "bob", organizerRole: OrganizerRoleMember, permissions: []string{PermissionManagePlayers}}, true},
+		{"member without permission", Viewer{role: RoleOrganizer, playerID: "bob", organizerRole: OrganizerRoleMember, permissions: []string{PermissionViewBilling}}, false},
+		// ロールが分からなければ拒否する
+		{"unknown role", Viewer{role: RoleOrganizer, playerID: "carol", organizerRole: "admin"}, false},
+		{"no role", Viewer{role: RoleOrganizer, playerID: "carol"}, false},
+	} {
+		if got := tc.v.hasPermission(PermissionManagePlayers); got != tc.want {
+			t.Errorf("%s: hasPermission = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
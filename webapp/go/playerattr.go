@@ -0,0 +1,367 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 参加者の属性
+// 値はテナントごとにplayer_attribute_optionで定義する
+const (
+	PlayerAttributeDivision = "division"
+	PlayerAttributeCategory = "category"
+)
+
+var playerAttributeNames = []string{PlayerAttributeDivision, PlayerAttributeCategory}
+
+// テナントで定義した属性の値
+type PlayerAttributeOptionRow struct {
+	TenantID  int64  `db:"tenant_id"`
+	Name      string `db:"name"`
+	Value     string `db:"value"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// 参加者に設定された属性
+type PlayerAttributeRow struct {
+	TenantID  int64  `db:"tenant_id"`
+	PlayerID  string `db:"player_id"`
+	Name      string `db:"name"`
+	Value     string `db:"value"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+type PlayerAttributeOptionsHandlerResult struct {
+	Divisions  []string `json:"divisions"`
+	Categories []string `json:"categories"`
+}
+
+func isPlayerAttributeName(name string) bool {
+	for _, n := range playerAttributeNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 参加者の属性を取得する
+func retrievePlayerAttributes(ctx context.Context, tenantDB dbOrTx, playerID string) (map[string]string, error) {
+	rows := []PlayerAttributeRow{}
+	if err := tenantDB.SelectContext(ctx, &rows, "SELECT * FROM player_attribute WHERE player_id = ?", playerID); err != nil {
+		return nil, fmt.Errorf("error Select player_attribute: playerID=%s, %w", playerID, err)
+	}
+	attrs := make(map[string]string, len(rows))
+	for _, r := range rows {
+		attrs[r.Name] = r.Value
+	}
+	return attrs, nil
+}
+
+// テナントの全参加者の属性を参加者IDごとに取得する
+func retrieveAllPlayerAttributes(ctx context.Context, tenantDB dbOrTx, tenantID int64) (map[string]map[string]string, error) {
+	rows := []PlayerAttributeRow{}
+	if err := tenantDB.SelectContext(ctx, &rows, "SELECT * FROM player_attribute WHERE tenant_id = ?", tenantID); err != nil {
+		return nil, fmt.Errorf("error Select player_attribute: tenantID=%d, %w", tenantID, err)
+	}
+	attrs := map[string]map[string]string{}
+	for _, r := range rows {
+		if _, ok := attrs[r.PlayerID]; !ok {
+			attrs[r.PlayerID] = map[string]string{}
+		}
+		attrs[r.PlayerID][r.Name] = r.Value
+	}
+	return attrs, nil
+}
+
+// 属性が指定した値の参加者IDの集合を返す
+func retrievePlayerIDsByAttribute(ctx context.Context, tenantDB dbOrTx, tenantID int64, name, value string) (map[string]struct{}, error) {
+	ids := []string{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ids,
+		"SELECT player_id FROM player_attribute WHERE tenant_id = ? AND name = ? AND value = ?",
+		tenantID, name, value,
+	); err != nil {
+		return nil, fmt.Errorf("error Select player_attribute: tenantID=%d, name=%s, value=%s, %w", tenantID, name, value, err)
+	}
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set, nil
+}
+
+func newPlayerDetail(p *PlayerRow, attrs map[string]string) PlayerDetail {
+	return PlayerDetail{
+		ID:             p.ID,
+		DisplayName:    p.DisplayName,
+		IsDisqualified: p.IsDisqualified,
+		Division:       attrs[PlayerAttributeDivision],
+		Category:       attrs[PlayerAttributeCategory],
+	}
+}
+
+// 属性を含めたPlayerDetailを作る
+func retrievePlayerDetail(ctx context.Context, tenantDB dbOrTx, p *PlayerRow) (*PlayerDetail, error) {
+	attrs, err := retrievePlayerAttributes(ctx, tenantDB, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	pd := newPlayerDetail(p, attrs)
+	return &pd, nil
+}
+
+// 参加者の属性を設定する
+// 空文字の場合は属性を削除する
+// テナントで定義されていない値の場合は400を返す
+func setPlayerAttribute(ctx context.Context, tenantDB dbOrTx, tenantID int64, playerID, name, value string, now int64) error {
+	if value == "" {
+		if _, err := tenantDB.ExecContext(
+			ctx,
+			"DELETE FROM player_attribute WHERE player_id = ? AND name = ?",
+			playerID, name,
+		); err != nil {
+			return fmt.Errorf("error Delete player_attribute: playerID=%s, name=%s, %w", playerID, name, err)
+		}
+		return nil
+	}
+
+	var o PlayerAttributeOptionRow
+	if err := tenantDB.GetContext(
+		ctx,
+		&o,
+		"SELECT * FROM player_attribute_option WHERE tenant_id = ? AND name = ? AND value = ?",
+		tenantID, name, value,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is not defined: %s", name, value))
+		}
+		return fmt.Errorf("error Select player_attribute_option: name=%s, value=%s, %w", name, value, err)
+	}
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT INTO player_attribute (player_id, name, value, tenant_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT(player_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at",
+		playerID, name, value, tenantID, now, now,
+	); err != nil {
+		return fmt.Errorf(
+			"error Upsert player_attribute: playerID=%s, name=%s, value=%s, updatedAt=%d, %w",
+			playerID, name, value, now, err,
+		)
+	}
+	return nil
+}
+
+// 属性の値が全てテナントで定義されているか確かめる
+// 空文字は属性なしとして扱う
+// 定義されていない値があれば400を返す
+func validatePlayerAttributeValues(ctx context.Context, tenantDB dbOrTx, tenantID int64, name string, values []string) error {
+	defined := []string{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&defined,
+		"SELECT value FROM player_attribute_option WHERE tenant_id = ? AND name = ?",
+		tenantID, name,
+	); err != nil {
+		return fmt.Errorf("error Select player_attribute_option: tenantID=%d, name=%s, %w", tenantID, name, err)
+	}
+	set := make(map[string]struct{}, len(defined))
+	for _, d := range defined {
+		set[d] = struct{}{}
+	}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, ok := set[value]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is not defined: %s", name, value))
+		}
+	}
+	return nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/player_attributes/add
+// 参加者の属性の値を定義する
+func playerAttributeOptionsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	name := c.FormValue("name")
+	if !isPlayerAttributeName(name) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid name: %s", name))
+	}
+	value := c.FormValue("value")
+	if value == "" || len(value) > 255 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value: %s", value))
+	}
+	now := time.Now().Unix()
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT OR IGNORE INTO player_attribute_option (tenant_id, name, value, created_at) VALUES (?, ?, ?, ?)",
+		v.tenantID, name, value, now,
+	); err != nil {
+		return fmt.Errorf("error Insert player_attribute_option: name=%s, value=%s, %w", name, value, err)
+	}
+	return respondPlayerAttributeOptions(c, tenantDB, v.tenantID)
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/player_attributes
+// 定義済みの参加者の属性の値の一覧を返す
+func playerAttributeOptionsHandler(c echo.Context) error {
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersRead, ""); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	return respondPlayerAttributeOptions(c, tenantDB, v.tenantID)
+}
+
+func respondPlayerAttributeOptions(c echo.Context, tenantDB dbOrTx, tenantID int64) error {
+	opts := []PlayerAttributeOptionRow{}
+	if err := tenantDB.SelectContext(
+		requestContext(c),
+		&opts,
+		"SELECT * FROM player_attribute_option WHERE tenant_id = ? ORDER BY name, value",
+		tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select player_attribute_option: tenantID=%d, %w", tenantID, err)
+	}
+	res := PlayerAttributeOptionsHandlerResult{
+		Divisions:  []string{},
+		Categories: []string{},
+	}
+	for _, o := range opts {
+		switch o.Name {
+		case PlayerAttributeDivision:
+			res.Divisions = append(res.Divisions, o.Value)
+		case PlayerAttributeCategory:
+			res.Categories = append(res.Categories, o.Value)
+		}
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: res})
+}
+
+type PlayerAttributesHandlerResult struct {
+	Player PlayerDetail `json:"player"`
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/player/:player_id/attributes
+// 参加者の部門・カテゴリを設定する
+func playerAttributesHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	p, err := retrievePlayer(ctx, tenantDB, c.Param("player_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "player not found")
+		}
+		return fmt.Errorf("error retrievePlayer: %w", err)
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+
+	// ランキングの絞り込みに影響するのでロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+
+	// 指定されなかった属性は変更しない
+	values := map[string]string{}
+	for _, name := range playerAttributeNames {
+		vs, ok := params[name]
+		if !ok {
+			continue
+		}
+		value := ""
+		if len(vs) > 0 {
+			value = vs[0]
+		}
+		values[name] = value
+	}
+	// 一部の属性だけが変更されないよう、書き込む前に全ての値を確かめる
+	for _, name := range playerAttributeNames {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := validatePlayerAttributeValues(ctx, tenantDB, v.tenantID, name, []string{value}); err != nil {
+			return err
+		}
+	}
+
+	tx, err := tenantDB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error tenantDB.BeginTxx: %w", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	for _, name := range playerAttributeNames {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := setPlayerAttribute(ctx, tx, v.tenantID, p.ID, name, value, now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error tx.Commit: %w", err)
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, tenantWideVersionKey); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+
+	pd, err := retrievePlayerDetail(ctx, tenantDB, p)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: PlayerAttributesHandlerResult{Player: *pd}})
+}
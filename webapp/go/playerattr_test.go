@@ -0,0 +1,150 @@
+package isuports
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPlayerAttributes(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+
+	if _, err := org.PlayerAttributeOptionsAdd(ctx, &client.PlayerAttributeOptionsAddParams{Name: PlayerAttributeDivision, Value: "open"}); err != nil {
+		t.Fatalf("error PlayerAttributeOptionsAdd: %s", err)
+	}
+	opts, err := org.PlayerAttributeOptions(ctx)
+	if err != nil {
+		t.Fatalf("error PlayerAttributeOptions: %s", err)
+	}
+	if len(opts.Divisions) != 1 || opts.Divisions[0] != "open" {
+		t.Fatalf("unexpected divisions: %+v", opts.Divisions)
+	}
+
+	res, err := org.PlayerAttributes(ctx, &client.PlayerAttributesParams{PlayerID: ids[0], Division: ptr("open")})
+	if err != nil {
+		t.Fatalf("error PlayerAttributes: %s", err)
+	}
+	if res.Player.Division != "open" {
+		t.Fatalf("unexpected player: %+v", res.Player)
+	}
+	// 選択肢にない値は設定できない
+	_, err = org.PlayerAttributes(ctx, &client.PlayerAttributesParams{PlayerID: ids[1], Division: ptr("pro")})
+	assertStatus(t, err, http.StatusBadRequest)
+	// どれかの値が選択肢になければ、どの属性も変更しない
+	_, err = org.PlayerAttributes(ctx, &client.PlayerAttributesParams{PlayerID: ids[0], Division: ptr(""), Category: ptr("u18")})
+	assertStatus(t, err, http.StatusBadRequest)
+	pd, err := newPlayerClient(t, tenantName, ids[0]).Player(ctx, &client.PlayerParams{PlayerID: ids[0]})
+	if err != nil {
+		t.Fatalf("error Player: %s", err)
+	}
+	if pd.Player.Division != "open" {
+		t.Fatalf("division must not be changed: %+v", pd.Player)
+	}
+	// 追加時に選択肢にない値があれば、どの参加者も追加しない
+	_, err = org.PlayersAdd(ctx, &client.PlayersAddParams{
+		DisplayName: []string{"carol", "dave"},
+		Division:    []string{"open", "pro"},
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+	players, err := org.PlayersList(ctx)
+	if err != nil {
+		t.Fatalf("error PlayersList: %s", err)
+	}
+	if len(players.Players) != 2 {
+		t.Fatalf("unexpected players: %+v", players.Players)
+	}
+
+	// 部門を指定すると、その部門の参加者だけで順位をつける
+	competitionID := addTestCompetition(t, tenantName, "first")
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100", ids[1]+",200")
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{
+		CompetitionID: competitionID,
+		Division:      "open",
+	})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.Ranks) != 1 || ranking.Ranks[0].PlayerID != ids[0] || ranking.Ranks[0].Rank != 1 {
+		t.Fatalf("unexpected ranks: %+v", ranking.Ranks)
+	}
+}
+
+// createTenantDBと同じスキーマのテナントDBをメモリ上に作る
+func openTestTenantDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatalf("error sqlx.Open: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	migrations, err := filepath.Glob(tenantDBMigrationFileGlob)
+	if err != nil {
+		t.Fatalf("error filepath.Glob: %s", err)
+	}
+	for _, f := range append([]string{tenantDBSchemaFilePath}, migrations...) {
+		schema, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("error os.ReadFile: %s", err)
+		}
+		if _, err := db.Exec(string(schema)); err != nil {
+			t.Fatalf("error Exec %s: %s", f, err)
+		}
+	}
+	return db
+}
+
+func TestSetPlayerAttribute(t *testing.T) {
+	ctx := context.Background()
+	db := openTestTenantDB(t)
+	if _, err := db.Exec(
+		"INSERT INTO player_attribute_option (tenant_id, name, value, created_at) VALUES (1, ?, 'pro', 0), (1, ?, 'u18', 0)",
+		PlayerAttributeDivision, PlayerAttributeCategory,
+	); err != nil {
+		t.Fatalf("error Insert player_attribute_option: %s", err)
+	}
+
+	for _, id := range []string{"p1", "p2"} {
+		if err := setPlayerAttribute(ctx, db, 1, id, PlayerAttributeDivision, "pro", 1); err != nil {
+			t.Fatalf("error setPlayerAttribute: %s", err)
+		}
+	}
+	if err := setPlayerAttribute(ctx, db, 1, "p1", PlayerAttributeCategory, "u18", 1); err != nil {
+		t.Fatalf("error setPlayerAttribute: %s", err)
+	}
+	// 定義されていない値は400
+	var he *echo.HTTPError
+	if err := setPlayerAttribute(ctx, db, 1, "p1", PlayerAttributeDivision, "amateur", 2); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400: %v", err)
+	}
+
+	attrs, err := retrievePlayerAttributes(ctx, db, "p1")
+	if err != nil {
+		t.Fatalf("error retrievePlayerAttributes: %s", err)
+	}
+	if attrs[PlayerAttributeDivision] != "pro" || attrs[PlayerAttributeCategory] != "u18" {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+
+	// 空文字なら属性を削除する
+	if err := setPlayerAttribute(ctx, db, 1, "p2", PlayerAttributeDivision, "", 3); err != nil {
+		t.Fatalf("error setPlayerAttribute: %s", err)
+	}
+	ids, err := retrievePlayerIDsByAttribute(ctx, db, 1, PlayerAttributeDivision, "pro")
+	if err != nil {
+		t.Fatalf("error retrievePlayerIDsByAttribute: %s", err)
+	}
+	if _, ok := ids["p1"]; !ok || len(ids) != 1 {
+		t.Fatalf("unexpected player ids: %v", ids)
+	}
+}
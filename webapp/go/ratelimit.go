@@ -0,0 +1,380 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// テナント・ロールごとのレート制限の設定
+// tenant_idが0の行は全テナントのデフォルト値
+type TenantRateLimitRow struct {
+	TenantID  int64   `db:"tenant_id"`
+	Role      string  `db:"role"`
+	Rate      float64 `db:"rate"`  // 1秒あたりのリクエスト数
+	Burst     int     `db:"burst"` // バケットの大きさ
+	UpdatedAt int64   `db:"updated_at"`
+}
+
+// テナントごとの上限
+// 0は無制限
+type TenantQuotaRow struct {
+	TenantID        int64 `db:"tenant_id"`
+	MaxPlayers      int64 `db:"max_players"`
+	MaxCompetitions int64 `db:"max_competitions"`
+	MaxCSVRows      int64 `db:"max_csv_rows"`
+	UpdatedAt       int64 `db:"updated_at"`
+}
+
+type rateLimitKey struct {
+	tenantID int64
+	role     string
+}
+
+// テナント・ロールごとのトークンバケット
+// 設定は管理用DBから定期的に読み直す
+// 読み直しのSELECTはmuの外で行い、結果を入れ替えるときだけmuを取る
+type tenantRateLimiter struct {
+	mu         sync.Mutex
+	reloadedAt time.Time
+	interval   time.Duration
+	configs    map[rateLimitKey]TenantRateLimitRow
+	limiters   map[rateLimitKey]*rate.Limiter
+	// 読み直し中なら他のリクエストは読み直さず今の設定を使う
+	reloading bool
+	// invalidateのたびに増やす 読み直し中に呼ばれたら、その結果は古い可能性がある
+	generation int64
+}
+
+var rateLimiter = &tenantRateLimiter{
+	interval: 10 * time.Second,
+	configs:  map[rateLimitKey]TenantRateLimitRow{},
+	limiters: map[rateLimitKey]*rate.Limiter{},
+}
+
+func (rl *tenantRateLimiter) reloadIfNeeded(ctx context.Context) error {
+	rl.mu.Lock()
+	if rl.reloading || time.Since(rl.reloadedAt) < rl.interval {
+		rl.mu.Unlock()
+		return nil
+	}
+	rl.reloading = true
+	generation := rl.generation
+	rl.mu.Unlock()
+
+	rows := []TenantRateLimitRow{}
+	err := adminDB.SelectContext(ctx, &rows, "SELECT * FROM tenant_rate_limit")
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.reloading = false
+	if err != nil {
+		return fmt.Errorf("error Select tenant_rate_limit: %w", err)
+	}
+	configs := make(map[rateLimitKey]TenantRateLimitRow, len(rows))
+	for _, r := range rows {
+		configs[rateLimitKey{tenantID: r.TenantID, role: r.Role}] = r
+	}
+	// 設定が変わったバケットは作り直す
+	for k, l := range rl.limiters {
+		conf, ok := rl.config(configs, k)
+		if !ok || l.Limit() != rate.Limit(conf.Rate) || l.Burst() != conf.Burst {
+			delete(rl.limiters, k)
+		}
+	}
+	rl.configs = configs
+	// 読み直している間にinvalidateされていたら、次のリクエストでもう一度読み直す
+	if rl.generation == generation {
+		rl.reloadedAt = time.Now()
+	}
+	return nil
+}
+
+// テナント固有の設定がなければデフォルトの設定を使う
+func (rl *tenantRateLimiter) config(configs map[rateLimitKey]TenantRateLimitRow, k rateLimitKey) (TenantRateLimitRow, bool) {
+	if conf, ok := configs[k]; ok {
+		return conf, true
+	}
+	conf, ok := configs[rateLimitKey{tenantID: 0, role: k.role}]
+	return conf, ok
+}
+
+// リクエストを許可するかどうか
+// 許可しない場合は次に許可されるまでの時間を返す
+func (rl *tenantRateLimiter) allow(ctx context.Context, tenantID int64, role string) (bool, time.Duration, error) {
+	if err := rl.reloadIfNeeded(ctx); err != nil {
+		return false, 0, err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	k := rateLimitKey{tenantID: tenantID, role: role}
+	l, ok := rl.limiters[k]
+	if !ok {
+		conf, ok := rl.config(rl.configs, k)
+		if !ok {
+			// 設定がなければ制限しない
+			return true, 0, nil
+		}
+		l = rate.NewLimiter(rate.Limit(conf.Rate), conf.Burst)
+		rl.limiters[k] = l
+	}
+
+	ok, retryAfter := reserveRateLimit(l, time.Now())
+	return ok, retryAfter, nil
+}
+
+// バケットから1つ取り出せるかどうか
+// 取り出せない場合は次に取り出せるまでの時間を返す
+func reserveRateLimit(l *rate.Limiter, now time.Time) (bool, time.Duration) {
+	r := l.ReserveN(now, 1)
+	if !r.OK() {
+		// burstが0の場合は常に拒否する
+		return false, time.Second
+	}
+	if d := r.DelayFrom(now); d > 0 {
+		r.CancelAt(now)
+		return false, d
+	}
+	return true, 0
+}
+
+// 次の読み込み時に設定を読み直す
+func (rl *tenantRateLimiter) invalidate() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.reloadedAt = time.Time{}
+	rl.generation++
+}
+
+// レート制限を超えていたら429を返す
+// parseViewerから呼ばれる
+func checkRateLimit(c echo.Context, v *Viewer) error {
+	// SaaS管理者は制限しない
+	if v.role == RoleAdmin {
+		return nil
+	}
+	ok, retryAfter, err := rateLimiter.allow(requestContext(c), v.tenantID, v.role)
+	if err != nil {
+		return fmt.Errorf("error rateLimiter.allow: %w", err)
+	}
+	if ok {
+		return nil
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+}
+
+// 招待コードでの参加登録のレート制限
+// ログインしていなくても呼び出せるので、招待コードの総当たりを防ぐためテナントごととクライアントのIPごとに制限する
+const (
+	registerTenantRate  = 10 // テナントごとの1秒あたりのリクエスト数
+	registerTenantBurst = 50
+	registerIPRate      = 1 // テナント・IPごとの1秒あたりのリクエスト数
+	registerIPBurst     = 10
+	// テナント・IPごとのバケットの数の上限
+	registerIPMaxEntries = 10000
+)
+
+type registerRateLimitKey struct {
+	tenantID int64
+	ip       string
+}
+
+type registerIPLimiter struct {
+	limiter    *rate.Limiter
+	lastUsedAt time.Time
+}
+
+type registerRateLimiter struct {
+	mu      sync.Mutex
+	tenants map[int64]*rate.Limiter
+	ips     map[registerRateLimitKey]*registerIPLimiter
+}
+
+var playerRegisterRateLimiter = &registerRateLimiter{
+	tenants: map[int64]*rate.Limiter{},
+	ips:     map[registerRateLimitKey]*registerIPLimiter{},
+}
+
+// リクエストを許可するかどうか
+// 許可しない場合は次に許可されるまでの時間を返す
+// 1つのIPからの大量のリクエストでテナント全体の枠を使い切らないよう、IPごとの制限を先に確かめる
+func (rl *registerRateLimiter) allow(tenantID int64, ip string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	k := registerRateLimitKey{tenantID: tenantID, ip: ip}
+	il, ok := rl.ips[k]
+	if !ok {
+		if len(rl.ips) >= registerIPMaxEntries {
+			rl.sweep(now)
+		}
+		if len(rl.ips) >= registerIPMaxEntries {
+			// 掃除しても空かなければ、新しいIPからのリクエストはバケットが空くまで拒否する
+			return false, time.Duration(registerIPBurst/registerIPRate) * time.Second
+		}
+		il = &registerIPLimiter{limiter: rate.NewLimiter(registerIPRate, registerIPBurst)}
+		rl.ips[k] = il
+	}
+	il.lastUsedAt = now
+	if ok, retryAfter := reserveRateLimit(il.limiter, now); !ok {
+		return false, retryAfter
+	}
+
+	tl, ok := rl.tenants[tenantID]
+	if !ok {
+		tl = rate.NewLimiter(registerTenantRate, registerTenantBurst)
+		rl.tenants[tenantID] = tl
+	}
+	return reserveRateLimit(tl, now)
+}
+
+// 満タンに戻ったバケットを捨てる 作り直しても同じ状態になる
+func (rl *registerRateLimiter) sweep(now time.Time) {
+	full := time.Duration(registerIPBurst/registerIPRate) * time.Second
+	for k, il := range rl.ips {
+		if now.Sub(il.lastUsedAt) >= full {
+			delete(rl.ips, k)
+		}
+	}
+}
+
+// 参加登録のレート制限を超えていたら429を返す
+func checkPlayerRegisterRateLimit(c echo.Context, tenantID int64) error {
+	ok, retryAfter := playerRegisterRateLimiter.allow(tenantID, c.RealIP(), time.Now())
+	if ok {
+		return nil
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+}
+
+// テナントの上限を取得する
+// 設定されていなければ全て無制限
+func retrieveTenantQuota(ctx context.Context, tenantID int64) (*TenantQuotaRow, error) {
+	var q TenantQuotaRow
+	if err := adminDB.GetContext(ctx, &q, "SELECT * FROM tenant_quota WHERE tenant_id = ?", tenantID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &TenantQuotaRow{TenantID: tenantID}, nil
+		}
+		return nil, fmt.Errorf("error Select tenant_quota: tenantID=%d, %w", tenantID, err)
+	}
+	return &q, nil
+}
+
+// SaaS管理者用API
+// テナント・ロールごとのレート制限を設定する
+// POST /api/admin/tenants/rate_limit
+// tenant_nameを指定しなければ全テナントのデフォルト値を設定する
+func tenantRateLimitHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	var tenantID int64
+	if tenantName := c.FormValue("tenant_name"); tenantName != "" {
+		tenant, err := tenants.getByName(ctx, tenantName)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+			}
+			return fmt.Errorf("error tenants.getByName: %w", err)
+		}
+		tenantID = tenant.ID
+	}
+	role := c.FormValue("role")
+	if role != RoleOrganizer && role != RolePlayer {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid role: %s", role))
+	}
+
+	// rateを空にすると設定を削除する
+	if c.FormValue("rate") == "" {
+		if _, err := adminDB.ExecContext(
+			ctx,
+			"DELETE FROM tenant_rate_limit WHERE tenant_id = ? AND role = ?",
+			tenantID, role,
+		); err != nil {
+			return fmt.Errorf("error Delete tenant_rate_limit: tenantID=%d, role=%s, %w", tenantID, role, err)
+		}
+		rateLimiter.invalidate()
+		return c.JSON(http.StatusOK, SuccessResult{Status: true})
+	}
+
+	r, err := strconv.ParseFloat(c.FormValue("rate"), 64)
+	if err != nil || r < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid rate: %s", c.FormValue("rate")))
+	}
+	burst, err := strconv.Atoi(c.FormValue("burst"))
+	if err != nil || burst < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid burst: %s", c.FormValue("burst")))
+	}
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"REPLACE INTO tenant_rate_limit (tenant_id, role, rate, burst, updated_at) VALUES (?, ?, ?, ?, ?)",
+		tenantID, role, r, burst, now,
+	); err != nil {
+		return fmt.Errorf(
+			"error Replace tenant_rate_limit: tenantID=%d, role=%s, rate=%f, burst=%d, updatedAt=%d, %w",
+			tenantID, role, r, burst, now, err,
+		)
+	}
+	rateLimiter.invalidate()
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
+
+// SaaS管理者用API
+// テナントの参加者数・大会数・CSVの行数の上限を設定する
+// POST /api/admin/tenants/quota
+func tenantQuotaHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	tenant, err := tenants.getByName(ctx, c.FormValue("tenant_name"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+		}
+		return fmt.Errorf("error tenants.getByName: %w", err)
+	}
+	q := TenantQuotaRow{
+		TenantID:  tenant.ID,
+		UpdatedAt: time.Now().Unix(),
+	}
+	for name, dest := range map[string]*int64{
+		"max_players":      &q.MaxPlayers,
+		"max_competitions": &q.MaxCompetitions,
+		"max_csv_rows":     &q.MaxCSVRows,
+	} {
+		s := c.FormValue(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", name, s))
+		}
+		*dest = n
+	}
+	if _, err := adminDB.NamedExecContext(
+		ctx,
+		"REPLACE INTO tenant_quota (tenant_id, max_players, max_competitions, max_csv_rows, updated_at) VALUES (:tenant_id, :max_players, :max_competitions, :max_csv_rows, :updated_at)",
+		q,
+	); err != nil {
+		return fmt.Errorf("error Replace tenant_quota: tenantID=%d, %w", tenant.ID, err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
@@ -0,0 +1,134 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"golang.org/x/time/rate"
+)
+
+func TestTenantRateLimit(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+
+	if err := newAdminClient(t).TenantRateLimit(ctx, &client.TenantRateLimitParams{
+		TenantName: ptr(tenantName),
+		Role:       RoleOrganizer,
+		Rate:       ptr(0.001),
+		Burst:      ptr(int64(1)),
+	}); err != nil {
+		t.Fatalf("error TenantRateLimit: %s", err)
+	}
+	if _, err := org.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList: %s", err)
+	}
+	_, err := org.PlayersList(ctx)
+	assertStatus(t, err, http.StatusTooManyRequests)
+
+	// 設定を削除すると制限されなくなる
+	if err := newAdminClient(t).TenantRateLimit(ctx, &client.TenantRateLimitParams{
+		TenantName: ptr(tenantName),
+		Role:       RoleOrganizer,
+	}); err != nil {
+		t.Fatalf("error TenantRateLimit: %s", err)
+	}
+	if _, err := org.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList: %s", err)
+	}
+}
+
+func TestTenantQuota(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+
+	if err := newAdminClient(t).TenantQuota(ctx, &client.TenantQuotaParams{
+		TenantName: tenantName,
+		MaxPlayers: ptr(int64(2)),
+	}); err != nil {
+		t.Fatalf("error TenantQuota: %s", err)
+	}
+	addTestPlayers(t, tenantName, "alice", "bob")
+	_, err := newOrganizerClient(t, tenantName).PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{"carol"}})
+	assertStatus(t, err, http.StatusForbidden)
+}
+
+func TestTenantQuotaConcurrent(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	if err := newAdminClient(t).TenantQuota(ctx, &client.TenantQuotaParams{
+		TenantName:      tenantName,
+		MaxPlayers:      ptr(int64(3)),
+		MaxCompetitions: ptr(int64(3)),
+	}); err != nil {
+		t.Fatalf("error TenantQuota: %s", err)
+	}
+
+	// 同時に追加しても上限を超えない
+	org := newOrganizerClient(t, tenantName)
+	var wg sync.WaitGroup
+	var players, competitions int64
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := org.PlayersAdd(ctx, &client.PlayersAddParams{DisplayName: []string{fmt.Sprintf("player-%d", i)}}); err == nil {
+				atomic.AddInt64(&players, 1)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := org.CompetitionsAdd(ctx, &client.CompetitionsAddParams{Title: fmt.Sprintf("competition-%d", i)}); err == nil {
+				atomic.AddInt64(&competitions, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if players != 3 || competitions != 3 {
+		t.Fatalf("unexpected count: players=%d, competitions=%d", players, competitions)
+	}
+}
+
+func TestTenantRateLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	// 読み直さないように、読み込んだばかりの状態にしておく
+	rl := &tenantRateLimiter{
+		reloadedAt: time.Now(),
+		interval:   time.Hour,
+		configs: map[rateLimitKey]TenantRateLimitRow{
+			{tenantID: 0, role: RolePlayer}: {Role: RolePlayer, Rate: 0.001, Burst: 2},
+			{tenantID: 5, role: RolePlayer}: {TenantID: 5, Role: RolePlayer, Rate: 0.001, Burst: 0},
+		},
+		limiters: map[rateLimitKey]*rate.Limiter{},
+	}
+
+	// テナント固有の設定がなければデフォルトの設定を使う
+	for i := 0; i < 2; i++ {
+		if ok, _, err := rl.allow(ctx, 1, RolePlayer); err != nil || !ok {
+			t.Fatalf("request %d must be allowed: %v", i, err)
+		}
+	}
+	if ok, retryAfter, err := rl.allow(ctx, 1, RolePlayer); err != nil || ok || retryAfter <= 0 {
+		t.Fatalf("request must be limited: ok=%t, retryAfter=%s, %v", ok, retryAfter, err)
+	}
+	// バケットはテナントごと
+	if ok, _, err := rl.allow(ctx, 2, RolePlayer); err != nil || !ok {
+		t.Fatalf("other tenant must be allowed: %v", err)
+	}
+	// burstが0なら常に拒否する
+	if ok, retryAfter, err := rl.allow(ctx, 5, RolePlayer); err != nil || ok || retryAfter != time.Second {
+		t.Fatalf("burst 0 must be limited: ok=%t, retryAfter=%s, %v", ok, retryAfter, err)
+	}
+	// 設定がなければ制限しない
+	for i := 0; i < 10; i++ {
+		if ok, _, err := rl.allow(ctx, 1, RoleOrganizer); err != nil || !ok {
+			t.Fatalf("role without config must not be limited: %v", err)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 大会ごとのスコアの扱い
+const (
+	// 大きいほうが上位
+	ScoreOrderDesc = "desc"
+	// 小さいほうが上位 タイムなど
+	ScoreOrderAsc = "asc"
+
+	// 整数
+	ScoreTypeInteger = "integer"
+	// 小数第3位までの小数 1000倍した整数でplayer_scoreに保存する
+	ScoreTypeDecimal = "decimal"
+	// mm:ss.fff 形式の時間 ミリ秒でplayer_scoreに保存する
+	ScoreTypeDuration = "duration"
+
+	// 同じスコアならCSV上で先に出現したほうが上位
+	TieBreakFirst = "first"
+	// 同じスコアなら同じ順位
+	TieBreakShared = "shared"
+
+	decimalScoreScale = 1000
+)
+
+// 大会のスコアのルール
+// 行がなければdefaultScoreRuleを使う
+type ScoreRuleRow struct {
+	TenantID      int64         `db:"tenant_id"`
+	CompetitionID string        `db:"competition_id"`
+	ScoreOrder    string        `db:"score_order"`
+	ScoreType     string        `db:"score_type"`
+	MinScore      sql.NullInt64 `db:"min_score"` // player_scoreに保存する値と同じ単位
+	MaxScore      sql.NullInt64 `db:"max_score"`
+	TieBreak      string        `db:"tie_break"`
+	CreatedAt     int64         `db:"created_at"`
+	UpdatedAt     int64         `db:"updated_at"`
+}
+
+type ScoreRuleDetail struct {
+	ScoreOrder string  `json:"score_order"`
+	ScoreType  string  `json:"score_type"`
+	MinScore   *string `json:"min_score"`
+	MaxScore   *string `json:"max_score"`
+	TieBreak   string  `json:"tie_break"`
+}
+
+type ScoreRuleHandlerResult struct {
+	ScoreRule ScoreRuleDetail `json:"score_rule"`
+}
+
+// 従来通り、大きい整数が上位でCSV上で先に出現したほうが上位
+func defaultScoreRule(tenantID int64, competitionID string) *ScoreRuleRow {
+	return &ScoreRuleRow{
+		TenantID:      tenantID,
+		CompetitionID: competitionID,
+		ScoreOrder:    ScoreOrderDesc,
+		ScoreType:     ScoreTypeInteger,
+		TieBreak:      TieBreakFirst,
+	}
+}
+
+func retrieveScoreRule(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string) (*ScoreRuleRow, error) {
+	var r ScoreRuleRow
+	if err := tenantDB.GetContext(ctx, &r, "SELECT * FROM score_rule WHERE competition_id = ?", competitionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return defaultScoreRule(tenantID, competitionID), nil
+		}
+		return nil, fmt.Errorf("error Select score_rule: competitionID=%s, %w", competitionID, err)
+	}
+	return &r, nil
+}
+
+// テナント内の全ての大会のスコアのルールを大会IDごとに返す
+// 行がない大会はdefaultScoreRuleを使う
+func retrieveScoreRules(ctx context.Context, tenantDB dbOrTx, tenantID int64) (map[string]*ScoreRuleRow, error) {
+	rs := []ScoreRuleRow{}
+	if err := tenantDB.SelectContext(ctx, &rs, "SELECT * FROM score_rule WHERE tenant_id = ?", tenantID); err != nil {
+		return nil, fmt.Errorf("error Select score_rule: tenantID=%d, %w", tenantID, err)
+	}
+	rules := make(map[string]*ScoreRuleRow, len(rs))
+	for i := range rs {
+		rules[rs[i].CompetitionID] = &rs[i]
+	}
+	return rules, nil
+}
+
+// retrieveScoreRulesの結果から大会のルールを返す
+func scoreRuleOf(rules map[string]*ScoreRuleRow, tenantID int64, competitionID string) *ScoreRuleRow {
+	if r, ok := rules[competitionID]; ok {
+		return r
+	}
+	return defaultScoreRule(tenantID, competitionID)
+}
+
+// スコアの種類と順序が同じで、合計や比較ができるか
+func (r *ScoreRuleRow) sameScoreUnit(o *ScoreRuleRow) bool {
+	return r.ScoreOrder == o.ScoreOrder && r.ScoreType == o.ScoreType
+}
+
+// 文字列のスコアを保存用の整数にする
+// 範囲のチェックはしない
+func parseScoreValue(scoreType, s string) (int64, error) {
+	switch scoreType {
+	case ScoreTypeDecimal:
+		return parseDecimalScore(s)
+	case ScoreTypeDuration:
+		return parseDurationScore(s)
+	default:
+		return strconv.ParseInt(s, 10, 64)
+	}
+}
+
+// "-12.345" → -12345
+func parseDecimalScore(s string) (int64, error) {
+	neg := strings.HasPrefix(s, "-")
+	intPart, fracPart, hasFrac := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if !isDigits(intPart) || (hasFrac && !isDigits(fracPart)) || len(fracPart) > 3 {
+		return 0, fmt.Errorf("invalid decimal: %s", s)
+	}
+	i, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal: %s", s)
+	}
+	var f int64
+	if fracPart != "" {
+		f, err = strconv.ParseInt(fracPart+strings.Repeat("0", 3-len(fracPart)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid decimal: %s", s)
+		}
+	}
+	// 1000倍するとint64に収まらない
+	if i > (math.MaxInt64-f)/decimalScoreScale {
+		return 0, fmt.Errorf("decimal out of range: %s", s)
+	}
+	v := i*decimalScoreScale + f
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// "hh:mm:ss.fff" "mm:ss.fff" "ss.fff" → ミリ秒
+func parseDurationScore(s string) (int64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	// 秒の部分は小数として読む
+	ms, err := parseDecimalScore(parts[len(parts)-1])
+	if err != nil || ms < 0 || (len(parts) > 1 && ms >= 60*1000) {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	unit := int64(60 * 1000)
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil || !isDigits(parts[i]) || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		if n > (math.MaxInt64-ms)/unit {
+			return 0, fmt.Errorf("duration out of range: %s", s)
+		}
+		ms += n * unit
+		unit *= 60
+	}
+	return ms, nil
+}
+
+// 保存用の整数を表示用の文字列にする
+func formatScoreValue(scoreType string, v int64) string {
+	switch scoreType {
+	case ScoreTypeDecimal:
+		sign := ""
+		if v < 0 {
+			sign = "-"
+			v = -v
+		}
+		return fmt.Sprintf("%s%d.%03d", sign, v/decimalScoreScale, v%decimalScoreScale)
+	case ScoreTypeDuration:
+		h := v / (60 * 60 * 1000)
+		m := v / (60 * 1000) % 60
+		sec := v / 1000 % 60
+		ms := v % 1000
+		if h > 0 {
+			return fmt.Sprintf("%d:%02d:%02d.%03d", h, m, sec, ms)
+		}
+		return fmt.Sprintf("%02d:%02d.%03d", m, sec, ms)
+	default:
+		return strconv.FormatInt(v, 10)
+	}
+}
+
+// CSVのスコアをパースし、範囲をチェックする
+func (r *ScoreRuleRow) parseScore(s string) (int64, error) {
+	v, err := parseScoreValue(r.ScoreType, s)
+	if err != nil {
+		return 0, err
+	}
+	if r.MinScore.Valid && v < r.MinScore.Int64 {
+		return 0, fmt.Errorf("score is less than %s: %s", formatScoreValue(r.ScoreType, r.MinScore.Int64), s)
+	}
+	if r.MaxScore.Valid && v > r.MaxScore.Int64 {
+		return 0, fmt.Errorf("score is greater than %s: %s", formatScoreValue(r.ScoreType, r.MaxScore.Int64), s)
+	}
+	return v, nil
+}
+
+// aのほうが上位ならtrue
+// スコアが同じ場合はCSV上で先に出現したほうを前に並べる
+func (r *ScoreRuleRow) less(a, b CompetitionRank) bool {
+	return r.lessScore(a.Score, a.RowNum, b.Score, b.RowNum)
+}
+
+func (r *ScoreRuleRow) lessScore(aScore, aRowNum, bScore, bRowNum int64) bool {
+	if aScore == bScore {
+		return aRowNum < bRowNum
+	}
+	if r.ScoreOrder == ScoreOrderAsc {
+		return aScore < bScore
+	}
+	return aScore > bScore
+}
+
+// 並べ替え済みのランキングに順位をつける
+func (r *ScoreRuleRow) assignRanks(ranks []CompetitionRank) {
+	for i := range ranks {
+		ranks[i].Rank = int64(i + 1)
+		if r.TieBreak == TieBreakShared && i > 0 && ranks[i].Score == ranks[i-1].Score {
+			ranks[i].Rank = ranks[i-1].Rank
+		}
+		ranks[i].ScoreText = formatScoreValue(r.ScoreType, ranks[i].Score)
+	}
+}
+
+func (r *ScoreRuleRow) detail() ScoreRuleDetail {
+	d := ScoreRuleDetail{
+		ScoreOrder: r.ScoreOrder,
+		ScoreType:  r.ScoreType,
+		TieBreak:   r.TieBreak,
+	}
+	if r.MinScore.Valid {
+		s := formatScoreValue(r.ScoreType, r.MinScore.Int64)
+		d.MinScore = &s
+	}
+	if r.MaxScore.Valid {
+		s := formatScoreValue(r.ScoreType, r.MaxScore.Int64)
+		d.MaxScore = &s
+	}
+	return d
+}
+
+// フォームの値でルールを上書きする
+// 指定されなかった項目は元の値のまま
+func (r *ScoreRuleRow) applyForm(c echo.Context) error {
+	if s := c.FormValue("score_order"); s != "" {
+		if s != ScoreOrderDesc && s != ScoreOrderAsc {
+			return fmt.Errorf("invalid score_order: %s", s)
+		}
+		r.ScoreOrder = s
+	}
+	if s := c.FormValue("score_type"); s != "" {
+		if s != ScoreTypeInteger && s != ScoreTypeDecimal && s != ScoreTypeDuration {
+			return fmt.Errorf("invalid score_type: %s", s)
+		}
+		if s != r.ScoreType {
+			// 単位が変わるので範囲は指定し直す
+			r.MinScore = sql.NullInt64{}
+			r.MaxScore = sql.NullInt64{}
+		}
+		r.ScoreType = s
+	}
+	if s := c.FormValue("tie_break"); s != "" {
+		if s != TieBreakFirst && s != TieBreakShared {
+			return fmt.Errorf("invalid tie_break: %s", s)
+		}
+		r.TieBreak = s
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	for name, dest := range map[string]*sql.NullInt64{
+		"min_score": &r.MinScore,
+		"max_score": &r.MaxScore,
+	} {
+		vs, ok := params[name]
+		if !ok {
+			continue
+		}
+		// 空文字を指定すると範囲の指定をなくす
+		if len(vs) == 0 || vs[0] == "" {
+			*dest = sql.NullInt64{}
+			continue
+		}
+		v, err := parseScoreValue(r.ScoreType, vs[0])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, vs[0])
+		}
+		*dest = sql.NullInt64{Int64: v, Valid: true}
+	}
+	if r.MinScore.Valid && r.MaxScore.Valid && r.MinScore.Int64 > r.MaxScore.Int64 {
+		return errors.New("min_score is greater than max_score")
+	}
+	return nil
+}
+
+// 大会に参加者かチームのスコアが登録されているか
+func hasCompetitionScores(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string) (bool, error) {
+	var scored bool
+	if err := tenantDB.GetContext(
+		ctx,
+		&scored,
+		"SELECT EXISTS(SELECT 1 FROM player_score WHERE tenant_id = ? AND competition_id = ?) OR EXISTS(SELECT 1 FROM team_score WHERE tenant_id = ? AND competition_id = ?)",
+		tenantID, competitionID, tenantID, competitionID,
+	); err != nil {
+		return false, fmt.Errorf("error Select player_score, team_score: competitionID=%s, %w", competitionID, err)
+	}
+	return scored, nil
+}
+
+func saveScoreRule(ctx context.Context, tenantDB dbOrTx, r *ScoreRuleRow, now int64) error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = now
+	}
+	r.UpdatedAt = now
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"REPLACE INTO score_rule (competition_id, tenant_id, score_order, score_type, min_score, max_score, tie_break, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.CompetitionID, r.TenantID, r.ScoreOrder, r.ScoreType, r.MinScore, r.MaxScore, r.TieBreak, r.CreatedAt, r.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("error Replace score_rule: competitionID=%s, %w", r.CompetitionID, err)
+	}
+	return nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/competition/:competition_id/score_rule
+// 大会のスコアのルールを変更する
+func competitionScoreRuleHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionManageCompetitions); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	competitionID := c.Param("competition_id")
+	comp, err := retrieveCompetition(ctx, tenantDB, competitionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "competition not found")
+		}
+		return fmt.Errorf("error retrieveCompetition: %w", err)
+	}
+
+	// ランキングを読んでいる途中でルールが変わらないようにロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	rule, err := retrieveScoreRule(ctx, tenantDB, v.tenantID, competitionID)
+	if err != nil {
+		return err
+	}
+	scoreType := rule.ScoreType
+	if err := rule.applyForm(c); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// 登録済みのスコアは変換しないので、単位が変わるとランキングや課金が壊れる
+	if rule.ScoreType != scoreType {
+		if comp.FinishedAt.Valid {
+			return echo.NewHTTPError(http.StatusBadRequest, "score_type of finished competition cannot be changed")
+		}
+		scored, err := hasCompetitionScores(ctx, tenantDB, v.tenantID, competitionID)
+		if err != nil {
+			return err
+		}
+		if scored {
+			return echo.NewHTTPError(http.StatusBadRequest, "score_type cannot be changed after scores are uploaded")
+		}
+	}
+	if err := validateSumSeasonsScoreRule(ctx, tenantDB, v.tenantID, rule); err != nil {
+		return err
+	}
+	if err := saveScoreRule(ctx, tenantDB, rule, time.Now().Unix()); err != nil {
+		return err
+	}
+	// 上位N人の選び方が変わるので、計算して保存しているチームのスコアを求め直す
+	if tc, err := retrieveTeamCompetition(ctx, tenantDB, competitionID); err == nil {
+		if err := refreshTeamScores(ctx, tenantDB, v.tenantID, tc); err != nil {
+			return fmt.Errorf("error refreshTeamScores: %w", err)
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error retrieveTeamCompetition: %w", err)
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, competitionID); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   ScoreRuleHandlerResult{ScoreRule: rule.detail()},
+	})
+}
@@ -0,0 +1,175 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestCompetitionScoreRule(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	competitionID := addTestCompetition(t, tenantName, "time attack")
+
+	res, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreOrder:    ptr(ScoreOrderAsc),
+	})
+	if err != nil {
+		t.Fatalf("error CompetitionScoreRule: %s", err)
+	}
+	if res.ScoreRule.ScoreOrder != ScoreOrderAsc || res.ScoreRule.ScoreType != ScoreTypeInteger {
+		t.Fatalf("unexpected score rule: %+v", res.ScoreRule)
+	}
+
+	_, err = org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreOrder:    ptr("random"),
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	// 昇順なのでスコアが小さい方が上位
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",300", ids[1]+",100")
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.Ranks) != 2 || ranking.Ranks[0].PlayerID != ids[1] {
+		t.Fatalf("unexpected ranks: %+v", ranking.Ranks)
+	}
+}
+
+func TestCompetitionScoreRuleTypeChange(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice")
+
+	// スコアがなければ変更できる
+	competitionID := addTestCompetition(t, tenantName, "decimal")
+	if _, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreType:     ptr(ScoreTypeDecimal),
+	}); err != nil {
+		t.Fatalf("error CompetitionScoreRule: %s", err)
+	}
+
+	// スコアを登録した後は、登録済みのスコアの単位が変わるので変更できない
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",1.5")
+	_, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreType:     ptr(ScoreTypeInteger),
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+	// 同じ種類の指定や、種類以外の変更はできる
+	res, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreType:     ptr(ScoreTypeDecimal),
+		ScoreOrder:    ptr(ScoreOrderAsc),
+	})
+	if err != nil {
+		t.Fatalf("error CompetitionScoreRule: %s", err)
+	}
+	if res.ScoreRule.ScoreType != ScoreTypeDecimal || res.ScoreRule.ScoreOrder != ScoreOrderAsc {
+		t.Fatalf("unexpected score rule: %+v", res.ScoreRule)
+	}
+
+	// 終了した大会も変更できない
+	finishedID := addTestCompetition(t, tenantName, "finished")
+	if err := org.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: finishedID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	_, err = org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{
+		CompetitionID: finishedID,
+		ScoreType:     ptr(ScoreTypeDuration),
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestParseScoreValue(t *testing.T) {
+	for _, tc := range []struct {
+		scoreType string
+		s         string
+		want      int64
+		wantErr   bool
+	}{
+		{ScoreTypeDecimal, "12.345", 12345, false},
+		{ScoreTypeDecimal, "-0.5", -500, false},
+		{ScoreTypeDecimal, "9223372036854775.807", 9223372036854775807, false},
+		{ScoreTypeDecimal, "9223372036854776", 0, true},
+		{ScoreTypeDecimal, "1.2345", 0, true},
+		{ScoreTypeDuration, "01:02.003", 62003, false},
+		{ScoreTypeDuration, "1:00:00.000", 3600000, false},
+		{ScoreTypeDuration, "9223372036854775807:00:00.000", 0, true},
+		{ScoreTypeInteger, "-7", -7, false},
+	} {
+		got, err := parseScoreValue(tc.scoreType, tc.s)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseScoreValue(%s, %s) = %d, %v", tc.scoreType, tc.s, got, err)
+		}
+	}
+
+	// 範囲外の値は400
+	tenantName := newTestTenant(t)
+	competitionID := addTestCompetition(t, tenantName, "decimal")
+	_, err := newOrganizerClient(t, tenantName).CompetitionScoreRule(context.Background(), &client.CompetitionScoreRuleParams{
+		CompetitionID: competitionID,
+		ScoreType:     ptr(ScoreTypeDecimal),
+		MaxScore:      ptr("9223372036854776"),
+	})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestScoreRuleRanks(t *testing.T) {
+	// タイムは小さいほうが上位で、同じタイムなら同じ順位
+	r := &ScoreRuleRow{ScoreOrder: ScoreOrderAsc, ScoreType: ScoreTypeDuration, TieBreak: TieBreakShared}
+	ranks := []CompetitionRank{
+		{PlayerID: "a", Score: 62003, RowNum: 1},
+		{PlayerID: "b", Score: 61000, RowNum: 2},
+		{PlayerID: "c", Score: 62003, RowNum: 3},
+		{PlayerID: "d", Score: 3600000, RowNum: 4},
+	}
+	sort.SliceStable(ranks, func(i, j int) bool { return r.less(ranks[i], ranks[j]) })
+	r.assignRanks(ranks)
+	want := []struct {
+		playerID  string
+		rank      int64
+		scoreText string
+	}{
+		{"b", 1, "01:01.000"},
+		{"a", 2, "01:02.003"},
+		{"c", 2, "01:02.003"},
+		{"d", 4, "1:00:00.000"},
+	}
+	for i, w := range want {
+		if ranks[i].PlayerID != w.playerID || ranks[i].Rank != w.rank || ranks[i].ScoreText != w.scoreText {
+			t.Errorf("unexpected rank %d: %+v", i, ranks[i])
+		}
+	}
+
+	// 従来通りなら同じスコアでもCSV上で先に出現したほうが上位
+	r = defaultScoreRule(1, "c1")
+	ranks = []CompetitionRank{{PlayerID: "a", Score: 10, RowNum: 2}, {PlayerID: "b", Score: 10, RowNum: 1}}
+	sort.SliceStable(ranks, func(i, j int) bool { return r.less(ranks[i], ranks[j]) })
+	r.assignRanks(ranks)
+	if ranks[0].PlayerID != "b" || ranks[0].Rank != 1 || ranks[1].Rank != 2 || ranks[1].ScoreText != "10" {
+		t.Fatalf("unexpected ranks: %+v", ranks)
+	}
+
+	// 範囲外のスコアはエラー
+	r = &ScoreRuleRow{ScoreType: ScoreTypeDecimal, MinScore: sql.NullInt64{Int64: 0, Valid: true}, MaxScore: sql.NullInt64{Int64: 100000, Valid: true}}
+	for s, valid := range map[string]bool{"0.000": true, "100": true, "100.001": false, "-0.5": false} {
+		if _, err := r.parseScore(s); (err == nil) != valid {
+			t.Errorf("parseScore(%s) = %v, want valid=%t", s, err, valid)
+		}
+	}
+	if got := formatScoreValue(ScoreTypeDecimal, -500); got != "-0.500" {
+		t.Fatalf("unexpected formatScoreValue: %s", got)
+	}
+}
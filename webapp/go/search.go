@@ -0,0 +1,340 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// SaaS管理者向けのテナント横断検索
+// 参加者と大会はテナントDBに分かれているので、管理用DBの検索用インデックス
+// (player_search_index, competition_search_index) を引く
+// インデックスは参加者・大会の追加時に書き込み、既存のデータは isuports --reindex-search で作り直す
+// 追加時の書き込みに失敗してもリクエストは成功させるので、インデックスが欠けることがある その場合も --reindex-search で直す
+// /initialize (init.sh) はインデックスを作り直さない 初期データの分は init.sql で残し、
+// まだなければ init.sh が初期データのテナントDBから作る
+
+const (
+	searchDefaultLimit = 100
+	searchMaxLimit     = 1000
+	// 一度にインデックスへ書き込む行数
+	searchIndexBatchSize = 1000
+)
+
+type PlayerSearchIndexRow struct {
+	PlayerID    string `db:"player_id"`
+	TenantID    int64  `db:"tenant_id"`
+	DisplayName string `db:"display_name"`
+	CreatedAt   int64  `db:"created_at"`
+}
+
+type CompetitionSearchIndexRow struct {
+	CompetitionID string `db:"competition_id"`
+	TenantID      int64  `db:"tenant_id"`
+	Title         string `db:"title"`
+	CreatedAt     int64  `db:"created_at"`
+}
+
+// 参加者を検索用インデックスに書き込む
+func indexPlayers(ctx context.Context, db sqlx.ExtContext, rows []PlayerSearchIndexRow) error {
+	for start := 0; start < len(rows); start += searchIndexBatchSize {
+		end := start + searchIndexBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if _, err := sqlx.NamedExecContext(
+			ctx,
+			db,
+			"REPLACE INTO player_search_index (player_id, tenant_id, display_name, created_at) VALUES (:player_id, :tenant_id, :display_name, :created_at)",
+			rows[start:end],
+		); err != nil {
+			return fmt.Errorf("error Replace player_search_index: %w", err)
+		}
+	}
+	return nil
+}
+
+// 大会を検索用インデックスに書き込む
+func indexCompetitions(ctx context.Context, db sqlx.ExtContext, rows []CompetitionSearchIndexRow) error {
+	for start := 0; start < len(rows); start += searchIndexBatchSize {
+		end := start + searchIndexBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if _, err := sqlx.NamedExecContext(
+			ctx,
+			db,
+			"REPLACE INTO competition_search_index (competition_id, tenant_id, title, created_at) VALUES (:competition_id, :tenant_id, :title, :created_at)",
+			rows[start:end],
+		); err != nil {
+			return fmt.Errorf("error Replace competition_search_index: %w", err)
+		}
+	}
+	return nil
+}
+
+// 全テナントの参加者と大会から検索用インデックスを作り直す
+// テナントごとに既存の行を消してから書き込む
+func reindexSearch(ctx context.Context) error {
+	ts := []TenantRow{}
+	if err := adminDB.SelectContext(ctx, &ts, "SELECT * FROM tenant ORDER BY id ASC"); err != nil {
+		return fmt.Errorf("error Select tenant: %w", err)
+	}
+	for _, t := range ts {
+		if err := reindexTenantSearch(ctx, t.ID); err != nil {
+			return fmt.Errorf("error reindexTenantSearch: tenantID=%d, %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+func reindexTenantSearch(ctx context.Context, tenantID int64) error {
+	tenantDB, err := connectToTenantDB(tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	players := []PlayerSearchIndexRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&players,
+		"SELECT id AS player_id, tenant_id, display_name, created_at FROM player WHERE tenant_id = ?",
+		tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select player: %w", err)
+	}
+	competitions := []CompetitionSearchIndexRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&competitions,
+		"SELECT id AS competition_id, tenant_id, title, created_at FROM competition WHERE tenant_id = ?",
+		tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select competition: %w", err)
+	}
+
+	tx, err := adminDB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error adminDB.BeginTxx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM player_search_index WHERE tenant_id = ?", tenantID); err != nil {
+		return fmt.Errorf("error Delete player_search_index: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM competition_search_index WHERE tenant_id = ?", tenantID); err != nil {
+		return fmt.Errorf("error Delete competition_search_index: %w", err)
+	}
+	if err := indexPlayers(ctx, tx, players); err != nil {
+		return err
+	}
+	if err := indexCompetitions(ctx, tx, competitions); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error tx.Commit: %w", err)
+	}
+	return nil
+}
+
+// LIKEの部分一致のパターンにする
+// MySQLとSQLiteの両方で使えるよう、エスケープ文字には ! を使う
+func searchLikePattern(q string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(q) + "%"
+}
+
+// 検索のURL引数 q と limit を読む
+func parseSearchQuery(c echo.Context) (string, int64, error) {
+	q := strings.TrimSpace(c.QueryParam("q"))
+	if q == "" {
+		return "", 0, echo.NewHTTPError(http.StatusBadRequest, "query parameter 'q' is required")
+	}
+	limit := int64(searchDefaultLimit)
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit <= 0 || limit > searchMaxLimit {
+			return "", 0, echo.NewHTTPError(
+				http.StatusBadRequest,
+				fmt.Sprintf("invalid query parameter 'limit': %s", l),
+			)
+		}
+	}
+	return q, limit, nil
+}
+
+type TenantSearchResult struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type SearchTenantsHandlerResult struct {
+	Tenants []TenantSearchResult `json:"tenants"`
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/search/tenants
+// テナント名・表示名の部分一致でテナントを検索する
+func searchTenantsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+	q, limit, err := parseSearchQuery(c)
+	if err != nil {
+		return err
+	}
+
+	pattern := searchLikePattern(q)
+	ts := []TenantRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&ts,
+		"SELECT * FROM tenant WHERE name LIKE ? ESCAPE '!' OR display_name LIKE ? ESCAPE '!' ORDER BY id ASC LIMIT ?",
+		pattern, pattern, limit,
+	); err != nil {
+		return fmt.Errorf("error Select tenant: q=%s, %w", q, err)
+	}
+	rs := make([]TenantSearchResult, 0, len(ts))
+	for _, t := range ts {
+		rs = append(rs, TenantSearchResult{
+			ID:          strconv.FormatInt(t.ID, 10),
+			Name:        t.Name,
+			DisplayName: t.DisplayName,
+			CreatedAt:   t.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   SearchTenantsHandlerResult{Tenants: rs},
+	})
+}
+
+type PlayerSearchResult struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"display_name"`
+	TenantName        string `json:"tenant_name"`
+	TenantDisplayName string `json:"tenant_display_name"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
+type SearchPlayersHandlerResult struct {
+	Players []PlayerSearchResult `json:"players"`
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/search/players
+// 参加者IDの完全一致か表示名の部分一致で、全テナントの参加者を検索する
+// URL引数tenant_nameを指定した場合、そのテナントの参加者のみ返す
+func searchPlayersHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+	q, limit, err := parseSearchQuery(c)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		PlayerSearchIndexRow
+		TenantName        string `db:"tenant_name"`
+		TenantDisplayName string `db:"tenant_display_name"`
+	}
+	query := "SELECT player_search_index.*, tenant.name AS tenant_name, tenant.display_name AS tenant_display_name" +
+		" FROM player_search_index JOIN tenant ON tenant.id = player_search_index.tenant_id" +
+		" WHERE (player_search_index.player_id = ? OR player_search_index.display_name LIKE ? ESCAPE '!')"
+	args := []any{q, searchLikePattern(q)}
+	if tenantName := c.QueryParam("tenant_name"); tenantName != "" {
+		query += " AND tenant.name = ?"
+		args = append(args, tenantName)
+	}
+	query += " ORDER BY player_search_index.created_at DESC, player_search_index.player_id ASC LIMIT ?"
+	args = append(args, limit)
+	rows := []row{}
+	if err := adminDB.SelectContext(ctx, &rows, query, args...); err != nil {
+		return fmt.Errorf("error Select player_search_index: q=%s, %w", q, err)
+	}
+	rs := make([]PlayerSearchResult, 0, len(rows))
+	for _, r := range rows {
+		rs = append(rs, PlayerSearchResult{
+			ID:                r.PlayerID,
+			DisplayName:       r.DisplayName,
+			TenantName:        r.TenantName,
+			TenantDisplayName: r.TenantDisplayName,
+			CreatedAt:         r.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   SearchPlayersHandlerResult{Players: rs},
+	})
+}
+
+type CompetitionSearchResult struct {
+	ID                string `json:"id"`
+	Title             string `json:"title"`
+	TenantName        string `json:"tenant_name"`
+	TenantDisplayName string `json:"tenant_display_name"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
+type SearchCompetitionsHandlerResult struct {
+	Competitions []CompetitionSearchResult `json:"competitions"`
+}
+
+// SaaS管理者向けAPI
+// GET /api/admin/search/competitions
+// 大会IDの完全一致かタイトルの部分一致で、全テナントの大会を検索する
+// URL引数tenant_nameを指定した場合、そのテナントの大会のみ返す
+func searchCompetitionsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+	q, limit, err := parseSearchQuery(c)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		CompetitionSearchIndexRow
+		TenantName        string `db:"tenant_name"`
+		TenantDisplayName string `db:"tenant_display_name"`
+	}
+	query := "SELECT competition_search_index.*, tenant.name AS tenant_name, tenant.display_name AS tenant_display_name" +
+		" FROM competition_search_index JOIN tenant ON tenant.id = competition_search_index.tenant_id" +
+		" WHERE (competition_search_index.competition_id = ? OR competition_search_index.title LIKE ? ESCAPE '!')"
+	args := []any{q, searchLikePattern(q)}
+	if tenantName := c.QueryParam("tenant_name"); tenantName != "" {
+		query += " AND tenant.name = ?"
+		args = append(args, tenantName)
+	}
+	query += " ORDER BY competition_search_index.created_at DESC, competition_search_index.competition_id ASC LIMIT ?"
+	args = append(args, limit)
+	rows := []row{}
+	if err := adminDB.SelectContext(ctx, &rows, query, args...); err != nil {
+		return fmt.Errorf("error Select competition_search_index: q=%s, %w", q, err)
+	}
+	rs := make([]CompetitionSearchResult, 0, len(rows))
+	for _, r := range rows {
+		rs = append(rs, CompetitionSearchResult{
+			ID:                r.CompetitionID,
+			Title:             r.Title,
+			TenantName:        r.TenantName,
+			TenantDisplayName: r.TenantDisplayName,
+			CreatedAt:         r.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   SearchCompetitionsHandlerResult{Competitions: rs},
+	})
+}
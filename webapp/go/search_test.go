@@ -0,0 +1,124 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	admin := newAdminClient(t)
+	tenantName := newTestTenant(t)
+	otherTenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "needle_100%", "haystack")
+	addTestPlayers(t, otherTenantName, "needle_100% too")
+	competitionID := addTestCompetition(t, tenantName, "Spring Cup")
+
+	tenants, err := admin.SearchTenants(ctx, &client.SearchTenantsParams{Q: tenantName})
+	if err != nil {
+		t.Fatalf("error SearchTenants: %s", err)
+	}
+	if len(tenants.Tenants) != 1 || tenants.Tenants[0].Name != tenantName {
+		t.Fatalf("unexpected tenants: %+v", tenants.Tenants)
+	}
+
+	// 参加者IDからテナントを引ける
+	players, err := admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: ids[1]})
+	if err != nil {
+		t.Fatalf("error SearchPlayers: %s", err)
+	}
+	// IDは短いので表示名の部分一致も含まれる
+	found := false
+	for _, p := range players.Players {
+		if p.ID == ids[1] {
+			found = p.TenantName == tenantName
+		}
+	}
+	if !found {
+		t.Fatalf("player %s is not found: %+v", ids[1], players.Players)
+	}
+	// %や_はワイルドカードとして扱わない
+	players, err = admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: "needle_100%"})
+	if err != nil {
+		t.Fatalf("error SearchPlayers: %s", err)
+	}
+	if len(players.Players) != 2 {
+		t.Fatalf("unexpected players: %+v", players.Players)
+	}
+	players, err = admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: "needle_100%", TenantName: otherTenantName})
+	if err != nil {
+		t.Fatalf("error SearchPlayers: %s", err)
+	}
+	if len(players.Players) != 1 || players.Players[0].TenantName != otherTenantName {
+		t.Fatalf("unexpected players: %+v", players.Players)
+	}
+	players, err = admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: "needle%100"})
+	if err != nil {
+		t.Fatalf("error SearchPlayers: %s", err)
+	}
+	if len(players.Players) != 0 {
+		t.Fatalf("unexpected players: %+v", players.Players)
+	}
+
+	comps, err := admin.SearchCompetitions(ctx, &client.SearchCompetitionsParams{Q: "spring cup"})
+	if err != nil {
+		t.Fatalf("error SearchCompetitions: %s", err)
+	}
+	if len(comps.Competitions) != 1 || comps.Competitions[0].ID != competitionID || comps.Competitions[0].TenantName != tenantName {
+		t.Fatalf("unexpected competitions: %+v", comps.Competitions)
+	}
+
+	_, err = admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: " "})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = newOrganizerClient(t, tenantName).SearchPlayers(ctx, &client.SearchPlayersParams{Q: "needle"})
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestReindexSearch(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	ids := addTestPlayers(t, tenantName, "alice")
+	competitionID := addTestCompetition(t, tenantName, "Autumn Cup")
+
+	// インデックスがない既存のデータを作り直す
+	if _, err := adminDB.ExecContext(ctx, "DELETE FROM player_search_index"); err != nil {
+		t.Fatalf("error Delete player_search_index: %s", err)
+	}
+	if _, err := adminDB.ExecContext(ctx, "DELETE FROM competition_search_index"); err != nil {
+		t.Fatalf("error Delete competition_search_index: %s", err)
+	}
+	if err := reindexSearch(ctx); err != nil {
+		t.Fatalf("error reindexSearch: %s", err)
+	}
+
+	admin := newAdminClient(t)
+	players, err := admin.SearchPlayers(ctx, &client.SearchPlayersParams{Q: ids[0]})
+	if err != nil {
+		t.Fatalf("error SearchPlayers: %s", err)
+	}
+	found := false
+	for _, p := range players.Players {
+		if p.ID == ids[0] {
+			found = p.DisplayName == "alice"
+		}
+	}
+	if !found {
+		t.Fatalf("player %s is not found: %+v", ids[0], players.Players)
+	}
+	comps, err := admin.SearchCompetitions(ctx, &client.SearchCompetitionsParams{Q: competitionID})
+	if err != nil {
+		t.Fatalf("error SearchCompetitions: %s", err)
+	}
+	found = false
+	for _, c := range comps.Competitions {
+		if c.ID == competitionID {
+			found = c.Title == "Autumn Cup"
+		}
+	}
+	if !found {
+		t.Fatalf("competition %s is not found: %+v", competitionID, comps.Competitions)
+	}
+}
@@ -0,0 +1,551 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// シーズンの集計方法
+const (
+	// 大会ごとの順位に応じたポイントの合計
+	SeasonModePoints = "points"
+	// 大会ごとのスコアの合計
+	SeasonModeSum = "sum"
+)
+
+// 複数の大会をまとめたシーズン
+type SeasonRow struct {
+	TenantID    int64  `db:"tenant_id"`
+	ID          string `db:"id"`
+	Title       string `db:"title"`
+	Mode        string `db:"mode"`
+	PointsTable string `db:"points_table"` // 1位から順にカンマ区切り
+	CreatedAt   int64  `db:"created_at"`
+	UpdatedAt   int64  `db:"updated_at"`
+}
+
+type SeasonCompetitionRow struct {
+	SeasonID      string `db:"season_id"`
+	CompetitionID string `db:"competition_id"`
+	TenantID      int64  `db:"tenant_id"`
+	CreatedAt     int64  `db:"created_at"`
+}
+
+type SeasonDetail struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title"`
+	Mode           string   `json:"mode"`
+	PointsTable    []int64  `json:"points_table"`
+	CompetitionIDs []string `json:"competition_ids"`
+}
+
+type SeasonRank struct {
+	Rank              int64  `json:"rank"`
+	Points            int64  `json:"points"`
+	PlayerID          string `json:"player_id"`
+	PlayerDisplayName string `json:"player_display_name"`
+	CompetitionCount  int64  `json:"competition_count"`
+}
+
+type SeasonHandlerResult struct {
+	Season SeasonDetail `json:"season"`
+}
+
+type SeasonsHandlerResult struct {
+	Seasons []SeasonDetail `json:"seasons"`
+}
+
+type SeasonRankingHandlerResult struct {
+	Season SeasonDetail `json:"season"`
+	Ranks  []SeasonRank `json:"ranks"`
+}
+
+// "25,18,15" のようなポイント表をパースする
+func parsePointsTable(s string) ([]int64, error) {
+	if s == "" {
+		return []int64{}, nil
+	}
+	parts := strings.Split(s, ",")
+	points := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid points: %s", p)
+		}
+		points = append(points, n)
+	}
+	return points, nil
+}
+
+func formatPointsTable(points []int64) string {
+	ss := make([]string, 0, len(points))
+	for _, p := range points {
+		ss = append(ss, strconv.FormatInt(p, 10))
+	}
+	return strings.Join(ss, ",")
+}
+
+func retrieveSeason(ctx context.Context, tenantDB dbOrTx, id string) (*SeasonRow, error) {
+	var s SeasonRow
+	if err := tenantDB.GetContext(ctx, &s, "SELECT * FROM season WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("error Select season: id=%s, %w", id, err)
+	}
+	return &s, nil
+}
+
+// シーズンに含まれる大会のIDを追加した順に返す
+func retrieveSeasonCompetitionIDs(ctx context.Context, tenantDB dbOrTx, seasonID string) ([]string, error) {
+	ids := []string{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ids,
+		"SELECT competition_id FROM season_competition WHERE season_id = ? ORDER BY created_at ASC, competition_id ASC",
+		seasonID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select season_competition: seasonID=%s, %w", seasonID, err)
+	}
+	return ids, nil
+}
+
+func seasonDetail(ctx context.Context, tenantDB dbOrTx, s SeasonRow) (*SeasonDetail, error) {
+	points, err := parsePointsTable(s.PointsTable)
+	if err != nil {
+		return nil, fmt.Errorf("error parsePointsTable: id=%s, %w", s.ID, err)
+	}
+	ids, err := retrieveSeasonCompetitionIDs(ctx, tenantDB, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &SeasonDetail{
+		ID:             s.ID,
+		Title:          s.Title,
+		Mode:           s.Mode,
+		PointsTable:    points,
+		CompetitionIDs: ids,
+	}, nil
+}
+
+// スコアを足す int64に収まらないときは上限・下限に張り付かせて、順位の比較が逆転しないようにする
+func addScoreSaturated(total, s int64) int64 {
+	if s > 0 && total > math.MaxInt64-s {
+		return math.MaxInt64
+	}
+	if s < 0 && total < math.MinInt64-s {
+		return math.MinInt64
+	}
+	return total + s
+}
+
+// シーズンのランキングを集計する
+// 大会ごとのランキングは大会ランキングAPIと同じく、参加者ごとに最後に登録されたスコアを採用する
+// 呼び出し側でテナントのロックを取得しておくこと
+func aggregateSeasonRanks(ctx context.Context, tenantDB dbOrTx, tenantID int64, season SeasonRow, competitionIDs []string) ([]SeasonRank, error) {
+	points, err := parsePointsTable(season.PointsTable)
+	if err != nil {
+		return nil, fmt.Errorf("error parsePointsTable: id=%s, %w", season.ID, err)
+	}
+	// 合計モードでは全ての大会のスコアの種類と順序が同じ validateSeasonCompetitions を参照
+	rule := defaultScoreRule(tenantID, "")
+	if season.Mode == SeasonModeSum && len(competitionIDs) > 0 {
+		if rule, err = retrieveScoreRule(ctx, tenantDB, tenantID, competitionIDs[0]); err != nil {
+			return nil, err
+		}
+	}
+	byPlayer := map[string]*SeasonRank{}
+	for _, competitionID := range competitionIDs {
+		ranks, err := retrieveCompetitionRanks(ctx, tenantDB, tenantID, competitionID, "")
+		if err != nil {
+			return nil, fmt.Errorf("error retrieveCompetitionRanks: %w", err)
+		}
+		for _, r := range ranks {
+			sr, ok := byPlayer[r.PlayerID]
+			if !ok {
+				sr = &SeasonRank{
+					PlayerID:          r.PlayerID,
+					PlayerDisplayName: r.PlayerDisplayName,
+				}
+				byPlayer[r.PlayerID] = sr
+			}
+			sr.CompetitionCount++
+			switch season.Mode {
+			case SeasonModeSum:
+				sr.Points = addScoreSaturated(sr.Points, r.Score)
+			default:
+				if r.Rank <= int64(len(points)) {
+					sr.Points = addScoreSaturated(sr.Points, points[r.Rank-1])
+				}
+			}
+		}
+	}
+
+	ranks := make([]SeasonRank, 0, len(byPlayer))
+	for _, sr := range byPlayer {
+		ranks = append(ranks, *sr)
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if rule.ScoreOrder == ScoreOrderAsc && ranks[i].CompetitionCount != ranks[j].CompetitionCount {
+			// 小さいほうが上位の合計では、出場しなかった大会があると有利になるので出場数の多いほうを上位にする
+			return ranks[i].CompetitionCount > ranks[j].CompetitionCount
+		}
+		if ranks[i].Points == ranks[j].Points {
+			return ranks[i].PlayerID < ranks[j].PlayerID
+		}
+		if rule.ScoreOrder == ScoreOrderAsc {
+			return ranks[i].Points < ranks[j].Points
+		}
+		return ranks[i].Points > ranks[j].Points
+	})
+	for i := range ranks {
+		ranks[i].Rank = int64(i + 1)
+	}
+	return ranks, nil
+}
+
+// シーズンに追加する大会が存在し、合計モードなら全ての大会のスコアの種類と順序が同じか確かめる
+// 単位や順序の違うスコアを合計しても意味がないので、合計モードでは揃っていない大会を追加できない
+func validateSeasonCompetitions(ctx context.Context, tenantDB dbOrTx, tenantID int64, mode string, existingIDs, newIDs []string) error {
+	for _, competitionID := range newIDs {
+		if _, err := retrieveCompetition(ctx, tenantDB, competitionID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("competition not found: %s", competitionID))
+			}
+			return fmt.Errorf("error retrieveCompetition: %w", err)
+		}
+	}
+	if mode != SeasonModeSum {
+		return nil
+	}
+	var base *ScoreRuleRow
+	for _, competitionID := range append(append([]string{}, existingIDs...), newIDs...) {
+		rule, err := retrieveScoreRule(ctx, tenantDB, tenantID, competitionID)
+		if err != nil {
+			return err
+		}
+		if base == nil {
+			base = rule
+			continue
+		}
+		if !base.sameScoreUnit(rule) {
+			return echo.NewHTTPError(
+				http.StatusBadRequest,
+				fmt.Sprintf("score rule of competition %s does not match the season: sum mode requires the same score_order and score_type", competitionID),
+			)
+		}
+	}
+	return nil
+}
+
+// 大会のスコアのルールを変えても、その大会を含む合計モードのシーズンで他の大会と揃っているか確かめる
+func validateSumSeasonsScoreRule(ctx context.Context, tenantDB dbOrTx, tenantID int64, rule *ScoreRuleRow) error {
+	seasonIDs := []string{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&seasonIDs,
+		"SELECT season.id FROM season JOIN season_competition ON season.id = season_competition.season_id WHERE season_competition.competition_id = ? AND season.mode = ?",
+		rule.CompetitionID, SeasonModeSum,
+	); err != nil {
+		return fmt.Errorf("error Select season: competitionID=%s, %w", rule.CompetitionID, err)
+	}
+	for _, seasonID := range seasonIDs {
+		competitionIDs, err := retrieveSeasonCompetitionIDs(ctx, tenantDB, seasonID)
+		if err != nil {
+			return err
+		}
+		for _, competitionID := range competitionIDs {
+			if competitionID == rule.CompetitionID {
+				continue
+			}
+			other, err := retrieveScoreRule(ctx, tenantDB, tenantID, competitionID)
+			if err != nil {
+				return err
+			}
+			if !rule.sameScoreUnit(other) {
+				return echo.NewHTTPError(
+					http.StatusBadRequest,
+					fmt.Sprintf("score rule does not match competition %s in sum mode season %s", competitionID, seasonID),
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// シーズンに大会を追加する
+// 事前に validateSeasonCompetitions で確かめておくこと
+func addSeasonCompetition(ctx context.Context, tenantDB dbOrTx, tenantID int64, seasonID, competitionID string, now int64) error {
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT OR IGNORE INTO season_competition (season_id, competition_id, tenant_id, created_at) VALUES (?, ?, ?, ?)",
+		seasonID, competitionID, tenantID, now,
+	); err != nil {
+		return fmt.Errorf(
+			"error Insert season_competition: seasonID=%s, competitionID=%s, tenantID=%d, createdAt=%d, %w",
+			seasonID, competitionID, tenantID, now, err,
+		)
+	}
+	return nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/seasons/add
+// シーズンを追加する
+func seasonsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionManageCompetitions); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	title := c.FormValue("title")
+	mode := c.FormValue("mode")
+	if mode == "" {
+		mode = SeasonModePoints
+	}
+	if mode != SeasonModePoints && mode != SeasonModeSum {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid mode: %s", mode))
+	}
+	points, err := parsePointsTable(c.FormValue("points_table"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if mode == SeasonModePoints && len(points) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "points_table required")
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	if err := validateSeasonCompetitions(ctx, tenantDB, v.tenantID, mode, nil, params["competition_ids[]"]); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	id, err := dispenseID(ctx)
+	if err != nil {
+		return fmt.Errorf("error dispenseID: %w", err)
+	}
+	s := SeasonRow{
+		TenantID:    v.tenantID,
+		ID:          id,
+		Title:       title,
+		Mode:        mode,
+		PointsTable: formatPointsTable(points),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := tenantDB.NamedExecContext(
+		ctx,
+		"INSERT INTO season (id, tenant_id, title, mode, points_table, created_at, updated_at) VALUES (:id, :tenant_id, :title, :mode, :points_table, :created_at, :updated_at)",
+		s,
+	); err != nil {
+		return fmt.Errorf("error Insert season: id=%s, tenantID=%d, title=%s, %w", id, v.tenantID, title, err)
+	}
+	for _, competitionID := range params["competition_ids[]"] {
+		if err := addSeasonCompetition(ctx, tenantDB, v.tenantID, id, competitionID, now); err != nil {
+			return err
+		}
+	}
+
+	d, err := seasonDetail(ctx, tenantDB, s)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: SeasonHandlerResult{Season: *d}})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/season/:season_id/competitions/add
+// シーズンに大会を追加する
+func seasonCompetitionsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionManageCompetitions); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	s, err := retrieveSeason(ctx, tenantDB, c.Param("season_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "season not found")
+		}
+		return fmt.Errorf("error retrieveSeason: %w", err)
+	}
+	competitionID := c.FormValue("competition_id")
+	if competitionID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "competition_id required")
+	}
+
+	existingIDs, err := retrieveSeasonCompetitionIDs(ctx, tenantDB, s.ID)
+	if err != nil {
+		return err
+	}
+	if err := validateSeasonCompetitions(ctx, tenantDB, v.tenantID, s.Mode, existingIDs, []string{competitionID}); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	if err := addSeasonCompetition(ctx, tenantDB, v.tenantID, s.ID, competitionID, now); err != nil {
+		return err
+	}
+	if _, err := tenantDB.ExecContext(ctx, "UPDATE season SET updated_at = ? WHERE id = ?", now, s.ID); err != nil {
+		return fmt.Errorf("error Update season: id=%s, %w", s.ID, err)
+	}
+
+	d, err := seasonDetail(ctx, tenantDB, *s)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: SeasonHandlerResult{Season: *d}})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/seasons
+// シーズンの一覧を取得する
+func seasonsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsRead, ""); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	ss := []SeasonRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ss,
+		"SELECT * FROM season WHERE tenant_id = ? ORDER BY created_at DESC",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select season: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]SeasonDetail, 0, len(ss))
+	for _, s := range ss {
+		d, err := seasonDetail(ctx, tenantDB, s)
+		if err != nil {
+			return err
+		}
+		ds = append(ds, *d)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: SeasonsHandlerResult{Seasons: ds}})
+}
+
+// 参加者向けAPI
+// GET /api/player/season/:season_id/ranking
+// シーズンの総合ランキングを取得する
+func seasonRankingHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return err
+	}
+	if v.role != RolePlayer {
+		return echo.NewHTTPError(http.StatusForbidden, "role player required")
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	if err := authorizePlayer(ctx, tenantDB, v.playerID); err != nil {
+		return err
+	}
+
+	season, err := retrieveSeason(ctx, tenantDB, c.Param("season_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "season not found")
+		}
+		return fmt.Errorf("error retrieveSeason: %w", err)
+	}
+
+	var rankAfter int64
+	if rankAfterStr := c.QueryParam("rank_after"); rankAfterStr != "" {
+		if rankAfter, err = strconv.ParseInt(rankAfterStr, 10, 64); err != nil {
+			return fmt.Errorf("error strconv.ParseUint: rankAfterStr=%s, %w", rankAfterStr, err)
+		}
+	}
+
+	d, err := seasonDetail(ctx, tenantDB, *season)
+	if err != nil {
+		return err
+	}
+	// シーズンの設定と、含まれる大会のいずれかが変わったらETagが変わる
+	versions := []int64{season.UpdatedAt, int64(len(d.CompetitionIDs))}
+	for _, competitionID := range d.CompetitionIDs {
+		version, err := retrieveContentVersion(ctx, v.tenantID, competitionID)
+		if err != nil {
+			return fmt.Errorf("error retrieveContentVersion: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if checkNotModified(c, weakETag("season", versions...)) {
+		return notModified(c)
+	}
+
+	// player_scoreを読んでいるときに更新が走ると不整合が起こるのでロックを取得する
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	ranks, err := aggregateSeasonRanks(ctx, tenantDB, v.tenantID, *season, d.CompetitionIDs)
+	if err != nil {
+		return fmt.Errorf("error aggregateSeasonRanks: %w", err)
+	}
+	pagedRanks := make([]SeasonRank, 0, 100)
+	for _, rank := range ranks {
+		if rank.Rank <= rankAfter {
+			continue
+		}
+		pagedRanks = append(pagedRanks, rank)
+		if len(pagedRanks) >= 100 {
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: SeasonRankingHandlerResult{
+			Season: *d,
+			Ranks:  pagedRanks,
+		},
+	})
+}
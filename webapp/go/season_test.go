@@ -0,0 +1,179 @@
+package isuports
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestSeasons(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	first := addTestCompetition(t, tenantName, "first")
+	second := addTestCompetition(t, tenantName, "second")
+	uploadTestScores(t, tenantName, first, ids[0]+",200", ids[1]+",100")
+	uploadTestScores(t, tenantName, second, ids[0]+",200", ids[1]+",100")
+
+	added, err := org.SeasonsAdd(ctx, &client.SeasonsAddParams{
+		Title:          "2022",
+		Mode:           ptr(SeasonModePoints),
+		PointsTable:    ptr("10,5"),
+		CompetitionIDs: []string{first},
+	})
+	if err != nil {
+		t.Fatalf("error SeasonsAdd: %s", err)
+	}
+	seasonID := added.Season.ID
+
+	res, err := org.SeasonCompetitionsAdd(ctx, &client.SeasonCompetitionsAddParams{SeasonID: seasonID, CompetitionID: second})
+	if err != nil {
+		t.Fatalf("error SeasonCompetitionsAdd: %s", err)
+	}
+	if len(res.Season.CompetitionIDs) != 2 {
+		t.Fatalf("unexpected competitions: %+v", res.Season.CompetitionIDs)
+	}
+	_, err = org.SeasonCompetitionsAdd(ctx, &client.SeasonCompetitionsAddParams{SeasonID: seasonID, CompetitionID: "not-found"})
+	assertStatus(t, err, http.StatusNotFound)
+
+	seasons, err := org.Seasons(ctx)
+	if err != nil {
+		t.Fatalf("error Seasons: %s", err)
+	}
+	if len(seasons.Seasons) != 1 || seasons.Seasons[0].ID != seasonID {
+		t.Fatalf("unexpected seasons: %+v", seasons.Seasons)
+	}
+
+	ranking, err := newPlayerClient(t, tenantName, ids[1]).SeasonRanking(ctx, &client.SeasonRankingParams{SeasonID: seasonID})
+	if err != nil {
+		t.Fatalf("error SeasonRanking: %s", err)
+	}
+	if len(ranking.Ranks) != 2 || ranking.Ranks[0].PlayerID != ids[0] || ranking.Ranks[0].Points != 20 {
+		t.Fatalf("unexpected ranks: %+v", ranking.Ranks)
+	}
+}
+
+func TestSeasonsSumScoreRule(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob", "carol")
+	first := addTestCompetition(t, tenantName, "first")
+	second := addTestCompetition(t, tenantName, "second")
+	decimal := addTestCompetition(t, tenantName, "decimal")
+	for _, competitionID := range []string{first, second} {
+		if _, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{CompetitionID: competitionID, ScoreOrder: ptr(ScoreOrderAsc)}); err != nil {
+			t.Fatalf("error CompetitionScoreRule: %s", err)
+		}
+	}
+	if _, err := org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{CompetitionID: decimal, ScoreOrder: ptr(ScoreOrderAsc), ScoreType: ptr(ScoreTypeDecimal)}); err != nil {
+		t.Fatalf("error CompetitionScoreRule: %s", err)
+	}
+	uploadTestScores(t, tenantName, first, ids[0]+",30", ids[1]+",20", ids[2]+",10")
+	uploadTestScores(t, tenantName, second, ids[0]+",30", ids[1]+",20")
+
+	// スコアの種類が違う大会は合計モードのシーズンに入れられない
+	_, err := org.SeasonsAdd(ctx, &client.SeasonsAddParams{Title: "mixed", Mode: ptr(SeasonModeSum), CompetitionIDs: []string{first, decimal}})
+	assertStatus(t, err, http.StatusBadRequest)
+	seasons, err := org.Seasons(ctx)
+	if err != nil {
+		t.Fatalf("error Seasons: %s", err)
+	}
+	if len(seasons.Seasons) != 0 {
+		t.Fatalf("season must not be created: %+v", seasons.Seasons)
+	}
+
+	added, err := org.SeasonsAdd(ctx, &client.SeasonsAddParams{Title: "sum", Mode: ptr(SeasonModeSum), CompetitionIDs: []string{first}})
+	if err != nil {
+		t.Fatalf("error SeasonsAdd: %s", err)
+	}
+	seasonID := added.Season.ID
+	_, err = org.SeasonCompetitionsAdd(ctx, &client.SeasonCompetitionsAddParams{SeasonID: seasonID, CompetitionID: decimal})
+	assertStatus(t, err, http.StatusBadRequest)
+	if _, err := org.SeasonCompetitionsAdd(ctx, &client.SeasonCompetitionsAddParams{SeasonID: seasonID, CompetitionID: second}); err != nil {
+		t.Fatalf("error SeasonCompetitionsAdd: %s", err)
+	}
+	// シーズンに入った後でルールを変えて揃わなくなることもできない
+	_, err = org.CompetitionScoreRule(ctx, &client.CompetitionScoreRuleParams{CompetitionID: second, ScoreOrder: ptr(ScoreOrderDesc)})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	// 小さいほうが上位 出場数の多い参加者が先に並ぶ
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).SeasonRanking(ctx, &client.SeasonRankingParams{SeasonID: seasonID})
+	if err != nil {
+		t.Fatalf("error SeasonRanking: %s", err)
+	}
+	got := []string{}
+	for _, r := range ranking.Ranks {
+		got = append(got, r.PlayerID)
+	}
+	if len(got) != 3 || got[0] != ids[1] || got[1] != ids[0] || got[2] != ids[2] || ranking.Ranks[0].Points != 40 {
+		t.Fatalf("unexpected ranks: %+v", ranking.Ranks)
+	}
+}
+
+func TestSeasonsSumOverflow(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob", "carol")
+	first := addTestCompetition(t, tenantName, "first")
+	second := addTestCompetition(t, tenantName, "second")
+	maxScore, minScore := strconv.FormatInt(math.MaxInt64, 10), strconv.FormatInt(math.MinInt64, 10)
+	uploadTestScores(t, tenantName, first, ids[0]+","+maxScore, ids[1]+",1", ids[2]+","+minScore)
+	uploadTestScores(t, tenantName, second, ids[0]+","+maxScore, ids[1]+",1", ids[2]+",-1")
+
+	added, err := org.SeasonsAdd(ctx, &client.SeasonsAddParams{Title: "sum", Mode: ptr(SeasonModeSum), CompetitionIDs: []string{first, second}})
+	if err != nil {
+		t.Fatalf("error SeasonsAdd: %s", err)
+	}
+	// 合計がint64に収まらなくても上限・下限に張り付くだけで、順位は入れ替わらない
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).SeasonRanking(ctx, &client.SeasonRankingParams{SeasonID: added.Season.ID})
+	if err != nil {
+		t.Fatalf("error SeasonRanking: %s", err)
+	}
+	got := []client.SeasonRank{}
+	for _, r := range ranking.Ranks {
+		got = append(got, client.SeasonRank{PlayerID: r.PlayerID, Points: r.Points})
+	}
+	want := []client.SeasonRank{
+		{PlayerID: ids[0], Points: math.MaxInt64},
+		{PlayerID: ids[1], Points: 2},
+		{PlayerID: ids[2], Points: math.MinInt64},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected ranks: got=%+v, want=%+v", got, want)
+	}
+}
+
+func TestParsePointsTable(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		want  []int64
+		valid bool
+	}{
+		{"", []int64{}, true},
+		{"25,18,15", []int64{25, 18, 15}, true},
+		{"10, 5 ,0", []int64{10, 5, 0}, true},
+		{"25,-1", nil, false},
+		{"25,,15", nil, false},
+		{"first", nil, false},
+	} {
+		got, err := parsePointsTable(tc.s)
+		if (err == nil) != tc.valid {
+			t.Errorf("parsePointsTable(%q) error = %v, want valid=%t", tc.s, err, tc.valid)
+			continue
+		}
+		if tc.valid && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parsePointsTable(%q) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+	if got := formatPointsTable([]int64{25, 18, 15}); got != "25,18,15" {
+		t.Fatalf("unexpected formatPointsTable: %s", got)
+	}
+}
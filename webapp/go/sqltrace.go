@@ -1,42 +1,159 @@
 package isuports
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/mattn/go-sqlite3"
+	"github.com/labstack/echo/v4"
 	proxy "github.com/shogo82148/go-sql-proxy"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var traceLogEncoder *json.Encoder
+var traceLogWriter *rotateWriter
 
-func initializeSQLLogger() (string, io.Closer, error) {
-	traceFilePath := getEnv("ISUCON_SQLITE_TRACE_FILE", "")
-	if traceFilePath == "" {
-		return "sqlite3", io.NopCloser(nil), nil
+// クエリログの出力条件
+var (
+	// 出力する割合 0〜1
+	traceLogSampleRate = 1.0
+	// これより速いクエリは出力しない
+	traceLogSlowThreshold time.Duration
+)
+
+// sql_trace.file (環境変数 ISUCON_SQLITE_TRACE_FILE) を設定するとsqliteとMySQLのクエリログを出力する
+// 以下の設定で出力量を調整できる (カッコ内は環境変数)
+//
+//	sql_trace.sample_rate       (ISUCON_SQL_TRACE_SAMPLE_RATE)       出力する割合 (0〜1, デフォルト1)
+//	sql_trace.slow_threshold_ms (ISUCON_SQL_TRACE_SLOW_THRESHOLD_MS) 指定したミリ秒以上かかったクエリのみ出力する (デフォルト0)
+//	sql_trace.max_size_mb       (ISUCON_SQL_TRACE_MAX_SIZE_MB)       ファイルがこのサイズを超えたらローテーションする (デフォルト0: ローテーションしない)
+//	sql_trace.max_backups       (ISUCON_SQL_TRACE_MAX_BACKUPS)       ローテーションしたファイルを残す数 (デフォルト5)
+func initializeSQLLogger(cfg SQLTraceConfig) (sqliteHooks, mysqlHooks *proxy.HooksContext, closer io.Closer, err error) {
+	if cfg.File == "" {
+		return nil, nil, io.NopCloser(nil), nil
+	}
+
+	w, err := newRotateWriter(cfg.File, cfg.MaxSizeMB*1024*1024, cfg.MaxBackups)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot open sql_trace.file: %w", err)
+	}
+	traceLogWriter = w
+	traceLogSampleRate = cfg.SampleRate
+	traceLogSlowThreshold = time.Duration(cfg.SlowThresholdMs * float64(time.Millisecond))
+
+	return newTraceLogHooks("sqlite"), newTraceLogHooks("mysql"), w, nil
+}
+
+// hookを挟んだドライバを登録してそのドライバ名を返す
+// hookがなければ元のドライバ名をそのまま返す
+func registerProxyDriver(name string, d driver.Driver, hooks ...*proxy.HooksContext) string {
+	hs := make([]*proxy.HooksContext, 0, len(hooks))
+	for _, h := range hooks {
+		if h != nil {
+			hs = append(hs, h)
+		}
+	}
+	if len(hs) == 0 {
+		return name
 	}
+	driverName := name + "-with-trace"
+	sql.Register(driverName, proxy.NewProxyContext(d, hs...))
+	return driverName
+}
+
+// コネクションごとの接続先テナントID
+// sqliteのDSNはテナントごとにファイルが異なるので、接続時に覚えておく
+var traceLogConnTenantIDs sync.Map // map[*proxy.Conn]int64
 
-	traceLogFile, err := os.OpenFile(traceFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+// sqliteのDSNからテナントIDを取り出す
+// 例: file:../tenant_db/12.db?mode=rw
+func tenantIDFromDSN(dsn string) (int64, bool) {
+	p := strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(p, "?"); i >= 0 {
+		p = p[:i]
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(p), ".db"), 10, 64)
 	if err != nil {
-		return "", nil, fmt.Errorf("cannot open ISUCON_SQLITE_TRACE_FILE: %w", err)
+		return 0, false
+	}
+	return id, true
+}
+
+// echo.Contextに保存するtraceLogTenantのキー
+const contextKeyTraceLogTenant = "isuports.trace_log_tenant"
+
+// MySQLのクエリログに出力するテナントIDとリクエストID
+// ハンドラはテナントを解決する前にcontextを作るので、あとから書き込めるようにポインタで持ち回す
+type traceLogTenant struct {
+	id int64
+	// 同じリクエストで実行したクエリをまとめるためのID トレースを出力していればトレースIDを使う
+	requestID string
+}
+
+type traceLogTenantKey struct{}
+
+func traceLogTenantFromEcho(c echo.Context) *traceLogTenant {
+	t, ok := c.Get(contextKeyTraceLogTenant).(*traceLogTenant)
+	if !ok {
+		t = &traceLogTenant{}
+		if traceLogWriter != nil {
+			t.requestID = traceLogRequestID(c)
+		}
+		c.Set(contextKeyTraceLogTenant, t)
 	}
+	return t
+}
+
+func traceLogRequestID(c echo.Context) string {
+	if sc := trace.SpanContextFromContext(c.Request().Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return strconv.FormatInt(rand.Int63(), 16)
+}
+
+// ハンドラ内で使うcontextにクエリログ用のテナントIDを持たせる
+func withTraceLogTenant(ctx context.Context, c echo.Context) context.Context {
+	return context.WithValue(ctx, traceLogTenantKey{}, traceLogTenantFromEcho(c))
+}
 
-	traceLogEncoder = json.NewEncoder(traceLogFile)
-	traceLogEncoder.SetEscapeHTML(false)
-	driverName := "sqlite3-with-trace"
-	sql.Register(driverName, proxy.NewProxyContext(&sqlite3.SQLiteDriver{}, &proxy.HooksContext{
+// リクエストのテナントIDをクエリログ用に記録する
+func setTraceLogTenant(c echo.Context, id int64) {
+	traceLogTenantFromEcho(c).id = id
+}
+
+func newTraceLogHooks(db string) *proxy.HooksContext {
+	hooks := &proxy.HooksContext{
 		PreExec:   traceLogPre,
-		PostExec:  traceLogPostExec,
+		PostExec:  traceLogPostExec(db),
 		PreQuery:  traceLogPre,
-		PostQuery: traceLogPostQuery,
-	}))
-	return driverName, traceLogFile, nil
+		PostQuery: traceLogPostQuery(db),
+	}
+	if db == "sqlite" {
+		hooks.PreOpen = func(_ context.Context, name string) (interface{}, error) {
+			return name, nil
+		}
+		hooks.Open = func(_ context.Context, ctx interface{}, conn *proxy.Conn) error {
+			if id, ok := tenantIDFromDSN(ctx.(string)); ok {
+				traceLogConnTenantIDs.Store(conn, id)
+			}
+			return nil
+		}
+		hooks.PostClose = func(_ context.Context, _ interface{}, conn *proxy.Conn, _ error) error {
+			traceLogConnTenantIDs.Delete(conn)
+			return nil
+		}
+	}
+	return hooks
 }
 
 func traceLogPre(_ context.Context, _ *proxy.Stmt, _ []driver.NamedValue) (interface{}, error) {
@@ -45,65 +162,181 @@ func traceLogPre(_ context.Context, _ *proxy.Stmt, _ []driver.NamedValue) (inter
 
 type sqlTraceLog struct {
 	Time         string        `json:"time"`
+	DB           string        `json:"db"`
+	TenantID     int64         `json:"tenant_id,omitempty"`
+	RequestID    string        `json:"request_id,omitempty"` // リクエスト以外で実行したクエリは空
 	Statement    string        `json:"statement"`
 	Args         []interface{} `json:"args"`
 	QueryTime    float64       `json:"query_time"`
 	AffectedRows int64         `json:"affected_rows"`
 }
 
-func traceLogPostExec(_ context.Context, ctx interface{}, stmt *proxy.Stmt, args []driver.NamedValue, result driver.Result, _ error) error {
-	if traceLogEncoder == nil {
-		return nil
+// クエリログを出力するかどうか
+func traceLogShouldWrite(queryTime time.Duration, err error) bool {
+	if traceLogWriter == nil {
+		return false
+	}
+	// MySQLのドライバはプレースホルダがあるとErrSkipを返してPrepareし直すので、その分は出力しない
+	if err == driver.ErrSkip {
+		return false
+	}
+	if queryTime < traceLogSlowThreshold {
+		return false
+	}
+	if traceLogSampleRate < 1 && rand.Float64() >= traceLogSampleRate {
+		return false
 	}
-	starts := ctx.(time.Time)
-	queryTime := time.Since(starts)
+	return true
+}
 
+func traceLogWrite(c context.Context, db string, starts time.Time, queryTime time.Duration, stmt *proxy.Stmt, args []driver.NamedValue, affected int64) error {
 	argsValues := make([]any, 0, len(args))
 	for _, arg := range args {
 		argsValues = append(argsValues, arg.Value)
 	}
-	var affected int64
-	if result != nil {
-		var err error
-		affected, err = result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("error driver.Result.RowsAffected at traceLogPost: %w", err)
-		}
-	}
-
 	log := sqlTraceLog{
 		Time:         starts.Format(time.RFC3339),
+		DB:           db,
 		Statement:    stmt.QueryString,
 		Args:         argsValues,
 		QueryTime:    queryTime.Seconds(),
 		AffectedRows: affected,
 	}
-	if err := traceLogEncoder.Encode(log); err != nil {
-		return fmt.Errorf("error encode.Encode at traceLogPostExec: %w", err)
+	if t, ok := c.Value(traceLogTenantKey{}).(*traceLogTenant); ok {
+		log.TenantID = t.id
+		log.RequestID = t.requestID
 	}
-	return nil
+	// sqliteは接続先のファイルから確実にわかるのでそちらを優先する
+	if stmt.Conn != nil {
+		if id, ok := traceLogConnTenantIDs.Load(stmt.Conn); ok {
+			log.TenantID = id.(int64)
+		}
+	}
+	return traceLogWriter.WriteJSON(log)
 }
 
-func traceLogPostQuery(_ context.Context, ctx interface{}, stmt *proxy.Stmt, args []driver.NamedValue, result driver.Rows, _ error) error {
-	if traceLogEncoder == nil {
+func traceLogPostExec(db string) func(context.Context, interface{}, *proxy.Stmt, []driver.NamedValue, driver.Result, error) error {
+	return func(c context.Context, ctx interface{}, stmt *proxy.Stmt, args []driver.NamedValue, result driver.Result, err error) error {
+		starts := ctx.(time.Time)
+		queryTime := time.Since(starts)
+		if !traceLogShouldWrite(queryTime, err) {
+			return nil
+		}
+
+		var affected int64
+		if result != nil {
+			var err error
+			affected, err = result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error driver.Result.RowsAffected at traceLogPost: %w", err)
+			}
+		}
+		if err := traceLogWrite(c, db, starts, queryTime, stmt, args, affected); err != nil {
+			return fmt.Errorf("error traceLogWrite at traceLogPostExec: %w", err)
+		}
 		return nil
 	}
-	starts := ctx.(time.Time)
-	queryTime := time.Since(starts)
+}
 
-	argsValues := make([]any, 0, len(args))
-	for _, arg := range args {
-		argsValues = append(argsValues, arg.Value)
+func traceLogPostQuery(db string) func(context.Context, interface{}, *proxy.Stmt, []driver.NamedValue, driver.Rows, error) error {
+	return func(c context.Context, ctx interface{}, stmt *proxy.Stmt, args []driver.NamedValue, _ driver.Rows, err error) error {
+		starts := ctx.(time.Time)
+		queryTime := time.Since(starts)
+		if !traceLogShouldWrite(queryTime, err) {
+			return nil
+		}
+		if err := traceLogWrite(c, db, starts, queryTime, stmt, args, 0); err != nil {
+			return fmt.Errorf("error traceLogWrite at traceLogPostQuery: %w", err)
+		}
+		return nil
 	}
-	log := sqlTraceLog{
-		Time:         starts.Format(time.RFC3339),
-		Statement:    stmt.QueryString,
-		Args:         argsValues,
-		QueryTime:    queryTime.Seconds(),
-		AffectedRows: 0,
+}
+
+// サイズでローテーションするファイル
+// path.1, path.2, ... の順に古いファイルが残る
+type rotateWriter struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	size       int64
+	maxSize    int64 // 0ならローテーションしない
+	maxBackups int
+}
+
+func newRotateWriter(path string, maxSize int64, maxBackups int) (*rotateWriter, error) {
+	w := &rotateWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
 	}
-	if err := traceLogEncoder.Encode(log); err != nil {
-		return fmt.Errorf("error encode.Encode at traceLogPostQuery: %w", err)
+	if err := w.open(); err != nil {
+		return nil, err
 	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = st.Size()
 	return nil
 }
+
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxBackups == 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return w.open()
+	}
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", w.path, i)
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", w.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+// 1行のJSONとして書き込む
+// 複数のgoroutineから呼ばれるので行が混ざらないようにロックする
+func (w *rotateWriter) WriteJSON(v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(b)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return fmt.Errorf("error rotate %s: %w", w.path, err)
+		}
+	}
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,78 @@
+package isuports
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateWriter(t *testing.T) {
+	readFile := func(p string) string {
+		t.Helper()
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("error os.ReadFile: %s", err)
+		}
+		return string(b)
+	}
+
+	// 1行は {"n":0} と改行の8バイトなので、2行ごとにローテーションする
+	p := filepath.Join(t.TempDir(), "trace.json")
+	w, err := newRotateWriter(p, 16, 2)
+	if err != nil {
+		t.Fatalf("error newRotateWriter: %s", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := w.WriteJSON(map[string]int{"n": i}); err != nil {
+			t.Fatalf("error WriteJSON: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error Close: %s", err)
+	}
+	// 古いものから消え、max_backupsの数だけ残る
+	for path, want := range map[string]string{
+		p:        `{"n":6}` + "\n",
+		p + ".1": `{"n":4}` + "\n" + `{"n":5}` + "\n",
+		p + ".2": `{"n":2}` + "\n" + `{"n":3}` + "\n",
+	} {
+		if got := readFile(path); got != want {
+			t.Errorf("unexpected %s: %q", filepath.Base(path), got)
+		}
+	}
+	if _, err := os.Stat(p + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backups must not exceed max_backups: %v", err)
+	}
+
+	// 開き直しても続きのサイズから数える
+	w, err = newRotateWriter(p, 16, 2)
+	if err != nil {
+		t.Fatalf("error newRotateWriter: %s", err)
+	}
+	if err := w.WriteJSON(map[string]int{"n": 7}); err != nil {
+		t.Fatalf("error WriteJSON: %s", err)
+	}
+	w.Close()
+	if got := readFile(p); got != `{"n":6}`+"\n"+`{"n":7}`+"\n" {
+		t.Errorf("unexpected current file: %q", got)
+	}
+
+	// max_backupsが0なら古いファイルは残さない
+	p = filepath.Join(t.TempDir(), "trace.json")
+	w, err = newRotateWriter(p, 8, 0)
+	if err != nil {
+		t.Fatalf("error newRotateWriter: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WriteJSON(map[string]int{"n": i}); err != nil {
+			t.Fatalf("error WriteJSON: %s", err)
+		}
+	}
+	w.Close()
+	if got := readFile(p); got != `{"n":2}`+"\n" {
+		t.Errorf("unexpected current file: %q", got)
+	}
+	if _, err := os.Stat(p + ".1"); !os.IsNotExist(err) {
+		t.Errorf("backup must not be kept: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// 集計対象にする大会の数(作成日時の新しい順)
+	statsCompetitionLimit = 20
+	// 時系列の集計期間(日)
+	statsDefaultDays = 30
+	statsMaxDays     = 90
+	// スコア分布のヒストグラムの階級数
+	statsHistogramBins = 10
+
+	secondsPerDay = 24 * 60 * 60
+)
+
+type PlayerCountStats struct {
+	Total        int64 `json:"total" db:"total"`
+	Active       int64 `json:"active" db:"-"`
+	Disqualified int64 `json:"disqualified" db:"disqualified"`
+}
+
+// 日ごとの件数
+// dayはその日の0時(UTC)のUNIX時間
+type DailyCount struct {
+	Day   int64 `json:"day" db:"day"`
+	Count int64 `json:"count" db:"count"`
+}
+
+type PlayerGrowthPoint struct {
+	Day   int64 `json:"day"`
+	Added int64 `json:"added"`
+	Total int64 `json:"total"` // その日の終わり時点の参加者数
+}
+
+type HistogramBin struct {
+	Lower int64 `json:"lower"` // 階級の下限(この値を含む)
+	Upper int64 `json:"upper"` // 階級の上限(この値を含む)
+	Count int64 `json:"count"`
+}
+
+type ScoreDistribution struct {
+	Count      int64          `json:"count"`
+	Min        int64          `json:"min"`
+	Median     int64          `json:"median"`
+	Max        int64          `json:"max"`
+	MinText    string         `json:"min_text"`
+	MedianText string         `json:"median_text"`
+	MaxText    string         `json:"max_text"`
+	Histogram  []HistogramBin `json:"histogram"`
+}
+
+type CompetitionStats struct {
+	CompetitionID     string            `json:"competition_id"`
+	Title             string            `json:"title"`
+	IsFinished        bool              `json:"is_finished"`
+	Participants      int64             `json:"participants"`
+	RankingViewers    int64             `json:"ranking_viewers"`
+	ScoreDistribution ScoreDistribution `json:"score_distribution"`
+}
+
+type StatsHandlerResult struct {
+	Days           int64               `json:"days"`
+	Players        PlayerCountStats    `json:"players"`
+	PlayerGrowth   []PlayerGrowthPoint `json:"player_growth"`
+	RankingViewers []DailyCount        `json:"ranking_viewers"`
+	Competitions   []CompetitionStats  `json:"competitions"`
+}
+
+// 大会ごとの最終的なスコアの分布を求める
+// 呼び出し側でテナントのロックを取得しておくこと
+func retrieveScoreDistribution(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string) (*ScoreDistribution, error) {
+	rule, err := retrieveScoreRule(ctx, tenantDB, tenantID, competitionID)
+	if err != nil {
+		return nil, err
+	}
+	// 参加者ごとにCSV上で最後に出現した行のスコアを使う
+	scores := []int64{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&scores,
+		`SELECT ps.score FROM player_score ps
+		JOIN (SELECT player_id, MAX(row_num) AS row_num FROM player_score WHERE tenant_id = ? AND competition_id = ? GROUP BY player_id) latest
+		ON ps.player_id = latest.player_id AND ps.row_num = latest.row_num
+		WHERE ps.tenant_id = ? AND ps.competition_id = ?
+		ORDER BY ps.score ASC`,
+		tenantID, competitionID, tenantID, competitionID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select player_score: tenantID=%d, competitionID=%s, %w", tenantID, competitionID, err)
+	}
+
+	d := ScoreDistribution{Histogram: []HistogramBin{}}
+	if len(scores) == 0 {
+		return &d, nil
+	}
+	d.Count = int64(len(scores))
+	d.Min = scores[0]
+	d.Max = scores[len(scores)-1]
+	d.Median = scores[len(scores)/2]
+	if len(scores)%2 == 0 {
+		// 足してから2で割るとint64の範囲を超えることがあるので、差の半分を足す
+		a, b := scores[len(scores)/2-1], scores[len(scores)/2]
+		d.Median = a + int64((uint64(b)-uint64(a))/2)
+	}
+	d.MinText = formatScoreValue(rule.ScoreType, d.Min)
+	d.MedianText = formatScoreValue(rule.ScoreType, d.Median)
+	d.MaxText = formatScoreValue(rule.ScoreType, d.Max)
+
+	// 最小値と最大値の差はint64に収まらないことがあるのでuint64で計算する
+	// widthはspan/statsHistogramBinsより大きいので、階級の数はstatsHistogramBins以下になる
+	span := uint64(d.Max) - uint64(d.Min)
+	width := span/statsHistogramBins + 1
+	bins := span/width + 1
+	for i := uint64(0); i < bins; i++ {
+		lower := uint64(d.Min) + i*width
+		d.Histogram = append(d.Histogram, HistogramBin{Lower: int64(lower), Upper: int64(lower + width - 1)})
+	}
+	d.Histogram[len(d.Histogram)-1].Upper = d.Max
+	for _, s := range scores {
+		i := (uint64(s) - uint64(d.Min)) / width
+		if i >= bins {
+			i = bins - 1
+		}
+		d.Histogram[i].Count++
+	}
+	return &d, nil
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/stats
+// テナントの参加者・大会・ランキング閲覧の統計を返す
+func statsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsRead, ""); err != nil {
+		return err
+	}
+
+	days := int64(statsDefaultDays)
+	if d := c.QueryParam("days"); d != "" {
+		days, err = strconv.ParseInt(d, 10, 64)
+		if err != nil || days <= 0 || days > statsMaxDays {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid days: %s", d))
+		}
+	}
+	today := time.Now().Unix() / secondsPerDay * secondsPerDay
+	since := today - (days-1)*secondsPerDay
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	res := StatsHandlerResult{
+		Days:           days,
+		PlayerGrowth:   []PlayerGrowthPoint{},
+		RankingViewers: []DailyCount{},
+		Competitions:   []CompetitionStats{},
+	}
+
+	// 参加者数
+	if err := tenantDB.GetContext(
+		ctx,
+		&res.Players,
+		"SELECT COUNT(*) AS total, COALESCE(SUM(is_disqualified), 0) AS disqualified FROM player WHERE tenant_id = ?",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select player count: tenantID=%d, %w", v.tenantID, err)
+	}
+	res.Players.Active = res.Players.Total - res.Players.Disqualified
+
+	// 参加者数の推移
+	var base int64
+	if err := tenantDB.GetContext(
+		ctx,
+		&base,
+		"SELECT COUNT(*) FROM player WHERE tenant_id = ? AND created_at < ?",
+		v.tenantID, since,
+	); err != nil {
+		return fmt.Errorf("error Select player count: tenantID=%d, since=%d, %w", v.tenantID, since, err)
+	}
+	added := []DailyCount{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&added,
+		"SELECT created_at / ? * ? AS day, COUNT(*) AS count FROM player WHERE tenant_id = ? AND created_at >= ? GROUP BY day",
+		secondsPerDay, secondsPerDay, v.tenantID, since,
+	); err != nil {
+		return fmt.Errorf("error Select player growth: tenantID=%d, since=%d, %w", v.tenantID, since, err)
+	}
+	addedByDay := make(map[int64]int64, len(added))
+	for _, a := range added {
+		addedByDay[a.Day] = a.Count
+	}
+	total := base
+	for day := since; day <= today; day += secondsPerDay {
+		total += addedByDay[day]
+		res.PlayerGrowth = append(res.PlayerGrowth, PlayerGrowthPoint{Day: day, Added: addedByDay[day], Total: total})
+	}
+
+	// ランキングを閲覧したユニークな参加者数の推移
+	viewers := []DailyCount{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&viewers,
+		"SELECT created_at DIV ? * ? AS day, COUNT(DISTINCT player_id) AS count FROM visit_history WHERE tenant_id = ? AND created_at >= ? GROUP BY day",
+		secondsPerDay, secondsPerDay, v.tenantID, since,
+	); err != nil {
+		return fmt.Errorf("error Select visit_history: tenantID=%d, since=%d, %w", v.tenantID, since, err)
+	}
+	viewersByDay := make(map[int64]int64, len(viewers))
+	for _, vc := range viewers {
+		viewersByDay[vc.Day] = vc.Count
+	}
+	for day := since; day <= today; day += secondsPerDay {
+		res.RankingViewers = append(res.RankingViewers, DailyCount{Day: day, Count: viewersByDay[day]})
+	}
+
+	// 大会ごとの統計
+	cs := []CompetitionRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&cs,
+		"SELECT * FROM competition WHERE tenant_id = ? ORDER BY created_at DESC LIMIT ?",
+		v.tenantID, statsCompetitionLimit,
+	); err != nil {
+		return fmt.Errorf("error Select competition: tenantID=%d, %w", v.tenantID, err)
+	}
+
+	// player_scoreを読むのでロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	for _, comp := range cs {
+		cst := CompetitionStats{
+			CompetitionID: comp.ID,
+			Title:         comp.Title,
+			IsFinished:    comp.FinishedAt.Valid,
+		}
+		dist, err := retrieveScoreDistribution(ctx, tenantDB, v.tenantID, comp.ID)
+		if err != nil {
+			return fmt.Errorf("error retrieveScoreDistribution: %w", err)
+		}
+		cst.ScoreDistribution = *dist
+		cst.Participants = dist.Count
+		if err := adminDB.GetContext(
+			ctx,
+			&cst.RankingViewers,
+			"SELECT COUNT(DISTINCT player_id) FROM visit_history WHERE tenant_id = ? AND competition_id = ?",
+			v.tenantID, comp.ID,
+		); err != nil {
+			return fmt.Errorf("error Select visit_history: tenantID=%d, competitionID=%s, %w", v.tenantID, comp.ID, err)
+		}
+		res.Competitions = append(res.Competitions, cst)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: res})
+}
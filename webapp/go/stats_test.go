@@ -0,0 +1,125 @@
+package isuports
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob")
+	competitionID := addTestCompetition(t, tenantName, "first")
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100", ids[1]+",200")
+	if _, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+
+	stats, err := org.Stats(ctx, &client.StatsParams{Days: ptr(int64(7))})
+	if err != nil {
+		t.Fatalf("error Stats: %s", err)
+	}
+	if stats.Days != 7 || stats.Players.Total != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(stats.Competitions) != 1 || stats.Competitions[0].Participants != 2 || stats.Competitions[0].RankingViewers != 1 {
+		t.Fatalf("unexpected competitions: %+v", stats.Competitions)
+	}
+}
+
+func TestRetrieveScoreDistribution(t *testing.T) {
+	ctx := context.Background()
+	db := openTestTenantDB(t)
+	insert := func(playerID string, score, rowNum int64) {
+		t.Helper()
+		if _, err := db.Exec(
+			"INSERT INTO player_score (id, tenant_id, player_id, competition_id, score, row_num, created_at, updated_at) VALUES (?, 1, ?, 'c1', ?, ?, 0, 0)",
+			fmt.Sprintf("ps-%d", rowNum), playerID, score, rowNum,
+		); err != nil {
+			t.Fatalf("error Insert player_score: %s", err)
+		}
+	}
+	// p0は後の行のスコアを採用する
+	insert("p0", 1000, 1)
+	for i := int64(0); i < 20; i++ {
+		insert(fmt.Sprintf("p%d", i), i, i+2)
+	}
+
+	d, err := retrieveScoreDistribution(ctx, db, 1, "c1")
+	if err != nil {
+		t.Fatalf("error retrieveScoreDistribution: %s", err)
+	}
+	if d.Count != 20 || d.Min != 0 || d.Max != 19 || d.Median != 9 || d.MaxText != "19" {
+		t.Fatalf("unexpected distribution: %+v", d)
+	}
+	if len(d.Histogram) != statsHistogramBins {
+		t.Fatalf("unexpected histogram: %+v", d.Histogram)
+	}
+	for i, b := range d.Histogram {
+		if b.Lower != int64(i*2) || b.Upper != int64(i*2+1) || b.Count != 2 {
+			t.Errorf("unexpected bin %d: %+v", i, b)
+		}
+	}
+
+	// スコアがなければ空
+	d, err = retrieveScoreDistribution(ctx, db, 1, "c2")
+	if err != nil {
+		t.Fatalf("error retrieveScoreDistribution: %s", err)
+	}
+	if d.Count != 0 || len(d.Histogram) != 0 {
+		t.Fatalf("unexpected distribution: %+v", d)
+	}
+}
+
+func TestScoreDistributionExtremes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestTenantDB(t)
+	for i, score := range []int64{math.MinInt64, -1, 0, math.MaxInt64} {
+		if _, err := db.Exec(
+			"INSERT INTO player_score (id, tenant_id, player_id, competition_id, score, row_num, created_at, updated_at) VALUES (?, 1, ?, 'c1', ?, ?, 0, 0)",
+			fmt.Sprintf("ps-%d", i), fmt.Sprintf("p%d", i), score, i+1,
+		); err != nil {
+			t.Fatalf("error Insert player_score: %s", err)
+		}
+	}
+
+	// int64の範囲いっぱいのスコアでも溢れない
+	d, err := retrieveScoreDistribution(ctx, db, 1, "c1")
+	if err != nil {
+		t.Fatalf("error retrieveScoreDistribution: %s", err)
+	}
+	if d.Count != 4 || d.Min != math.MinInt64 || d.Max != math.MaxInt64 || d.Median != -1 {
+		t.Fatalf("unexpected distribution: %+v", d)
+	}
+	if len(d.Histogram) != statsHistogramBins {
+		t.Fatalf("unexpected histogram: %+v", d.Histogram)
+	}
+	var total int64
+	for i, b := range d.Histogram {
+		if b.Lower > b.Upper || (i > 0 && b.Lower != d.Histogram[i-1].Upper+1) {
+			t.Errorf("unexpected bin %d: %+v", i, b)
+		}
+		total += b.Count
+	}
+	first, last := d.Histogram[0], d.Histogram[len(d.Histogram)-1]
+	if first.Lower != math.MinInt64 || first.Count != 1 || last.Upper != math.MaxInt64 || last.Count != 1 || total != 4 {
+		t.Fatalf("unexpected histogram: %+v", d.Histogram)
+	}
+
+	// 中央値を求めるときも溢れない
+	if _, err := db.Exec("DELETE FROM player_score WHERE player_id IN ('p1', 'p2')"); err != nil {
+		t.Fatalf("error Delete player_score: %s", err)
+	}
+	d, err = retrieveScoreDistribution(ctx, db, 1, "c1")
+	if err != nil {
+		t.Fatalf("error retrieveScoreDistribution: %s", err)
+	}
+	if d.Median != -1 {
+		t.Fatalf("unexpected median: %d", d.Median)
+	}
+}
@@ -0,0 +1,760 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// チーム戦のスコアの求め方
+const (
+	// team_id,score のCSVでチームのスコアを入稿する
+	TeamScoreModeUpload = "upload"
+	// メンバーのスコアの合計
+	TeamScoreModeSum = "sum"
+	// メンバーのスコアのうち上位N人の合計
+	TeamScoreModeBest = "best"
+)
+
+type TeamRow struct {
+	TenantID  int64  `db:"tenant_id"`
+	ID        string `db:"id"`
+	Name      string `db:"name"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+type TeamMemberRow struct {
+	TenantID  int64  `db:"tenant_id"`
+	TeamID    string `db:"team_id"`
+	PlayerID  string `db:"player_id"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// チーム戦として設定された大会
+type TeamCompetitionRow struct {
+	TenantID      int64  `db:"tenant_id"`
+	CompetitionID string `db:"competition_id"`
+	ScoreMode     string `db:"score_mode"`
+	BestN         int64  `db:"best_n"`
+	CreatedAt     int64  `db:"created_at"`
+	UpdatedAt     int64  `db:"updated_at"`
+}
+
+// CSVで入稿したチームのスコア
+type TeamScoreRow struct {
+	TenantID      int64  `db:"tenant_id"`
+	ID            string `db:"id"`
+	TeamID        string `db:"team_id"`
+	CompetitionID string `db:"competition_id"`
+	Score         int64  `db:"score"`
+	RowNum        int64  `db:"row_num"`
+	CreatedAt     int64  `db:"created_at"`
+	UpdatedAt     int64  `db:"updated_at"`
+}
+
+// スコアを登録した時点のチームのメンバー
+type TeamScoreMemberRow struct {
+	TenantID      int64  `db:"tenant_id"`
+	CompetitionID string `db:"competition_id"`
+	TeamID        string `db:"team_id"`
+	PlayerID      string `db:"player_id"`
+	CreatedAt     int64  `db:"created_at"`
+}
+
+type TeamDetail struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	PlayerIDs []string `json:"player_ids"`
+}
+
+type TeamRank struct {
+	Rank      int64  `json:"rank"`
+	Score     int64  `json:"score"`
+	ScoreText string `json:"score_text"`
+	TeamID    string `json:"team_id"`
+	TeamName  string `json:"team_name"`
+	RowNum    int64  `json:"-"` // APIレスポンスのJSONには含まれない
+}
+
+type TeamScoreDetail struct {
+	CompetitionTitle string `json:"competition_title"`
+	TeamID           string `json:"team_id"`
+	TeamName         string `json:"team_name"`
+	Rank             int64  `json:"rank"`
+	Score            int64  `json:"score"`
+	ScoreText        string `json:"score_text"`
+}
+
+type TeamHandlerResult struct {
+	Team TeamDetail `json:"team"`
+}
+
+type TeamsHandlerResult struct {
+	Teams []TeamDetail `json:"teams"`
+}
+
+type TeamCompetitionHandlerResult struct {
+	ScoreMode string `json:"score_mode"`
+	BestN     int64  `json:"best_n"`
+}
+
+func retrieveTeam(ctx context.Context, tenantDB dbOrTx, id string) (*TeamRow, error) {
+	var t TeamRow
+	if err := tenantDB.GetContext(ctx, &t, "SELECT * FROM team WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("error Select team: id=%s, %w", id, err)
+	}
+	return &t, nil
+}
+
+// チーム戦の設定を取得する
+// チーム戦でなければsql.ErrNoRowsを返す
+func retrieveTeamCompetition(ctx context.Context, tenantDB dbOrTx, competitionID string) (*TeamCompetitionRow, error) {
+	var tc TeamCompetitionRow
+	if err := tenantDB.GetContext(ctx, &tc, "SELECT * FROM team_competition WHERE competition_id = ?", competitionID); err != nil {
+		return nil, fmt.Errorf("error Select team_competition: competitionID=%s, %w", competitionID, err)
+	}
+	return &tc, nil
+}
+
+// チームのメンバーをチームIDごとに返す
+func retrieveTeamMembers(ctx context.Context, tenantDB dbOrTx, tenantID int64) (map[string][]string, error) {
+	ms := []TeamMemberRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ms,
+		"SELECT * FROM team_member WHERE tenant_id = ? ORDER BY created_at ASC, player_id ASC",
+		tenantID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select team_member: tenantID=%d, %w", tenantID, err)
+	}
+	members := map[string][]string{}
+	for _, m := range ms {
+		members[m.TeamID] = append(members[m.TeamID], m.PlayerID)
+	}
+	return members, nil
+}
+
+// チームのメンバーにする参加者が全て存在するか確かめる
+// 存在しない参加者が含まれていたら400を返す
+func validateTeamPlayers(ctx context.Context, tenantDB dbOrTx, playerIDs []string) error {
+	for _, playerID := range playerIDs {
+		if _, err := retrievePlayer(ctx, tenantDB, playerID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("player not found: %s", playerID))
+			}
+			return fmt.Errorf("error retrievePlayer: %w", err)
+		}
+	}
+	return nil
+}
+
+// チームのメンバーを入れ替える
+// 事前に validateTeamPlayers で確かめておくこと
+func replaceTeamMembers(ctx context.Context, tenantDB dbOrTx, tenantID int64, teamID string, playerIDs []string, now int64) error {
+	if _, err := tenantDB.ExecContext(ctx, "DELETE FROM team_member WHERE team_id = ?", teamID); err != nil {
+		return fmt.Errorf("error Delete team_member: teamID=%s, %w", teamID, err)
+	}
+	for _, playerID := range playerIDs {
+		if _, err := tenantDB.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO team_member (team_id, player_id, tenant_id, created_at) VALUES (?, ?, ?, ?)",
+			teamID, playerID, tenantID, now,
+		); err != nil {
+			return fmt.Errorf("error Insert team_member: teamID=%s, playerID=%s, %w", teamID, playerID, err)
+		}
+	}
+	return nil
+}
+
+// 大会のチームランキングを順位の昇順で返す
+// チームのスコアは入稿時に team_score に保存したものを使う refreshTeamScores を参照
+// 呼び出し側でテナントのロックを取得しておくこと
+func retrieveTeamRanks(ctx context.Context, tenantDB dbOrTx, tenantID int64, tc *TeamCompetitionRow) ([]TeamRank, error) {
+	rule, err := retrieveScoreRule(ctx, tenantDB, tenantID, tc.CompetitionID)
+	if err != nil {
+		return nil, err
+	}
+	teams := []TeamRow{}
+	if err := tenantDB.SelectContext(ctx, &teams, "SELECT * FROM team WHERE tenant_id = ?", tenantID); err != nil {
+		return nil, fmt.Errorf("error Select team: tenantID=%d, %w", tenantID, err)
+	}
+	teamByID := make(map[string]TeamRow, len(teams))
+	for _, t := range teams {
+		teamByID[t.ID] = t
+	}
+
+	tss := []TeamScoreRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&tss,
+		"SELECT * FROM team_score WHERE tenant_id = ? AND competition_id = ? ORDER BY row_num DESC",
+		tenantID, tc.CompetitionID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select team_score: competitionID=%s, %w", tc.CompetitionID, err)
+	}
+	ranks := []TeamRank{}
+	scoredTeamSet := map[string]struct{}{}
+	for _, ts := range tss {
+		// 参加者のスコアと同じく、CSV上で最後に出現した行を採用する
+		if _, ok := scoredTeamSet[ts.TeamID]; ok {
+			continue
+		}
+		scoredTeamSet[ts.TeamID] = struct{}{}
+		t, ok := teamByID[ts.TeamID]
+		if !ok {
+			continue
+		}
+		ranks = append(ranks, TeamRank{
+			Score:    ts.Score,
+			TeamID:   t.ID,
+			TeamName: t.Name,
+			RowNum:   ts.RowNum,
+		})
+	}
+
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Score == ranks[j].Score && ranks[i].RowNum == ranks[j].RowNum {
+			return ranks[i].TeamID < ranks[j].TeamID
+		}
+		return rule.lessScore(ranks[i].Score, ranks[i].RowNum, ranks[j].Score, ranks[j].RowNum)
+	})
+	for i := range ranks {
+		ranks[i].Rank = int64(i + 1)
+		if rule.TieBreak == TieBreakShared && i > 0 && ranks[i].Score == ranks[i-1].Score {
+			ranks[i].Rank = ranks[i-1].Rank
+		}
+		ranks[i].ScoreText = formatScoreValue(rule.ScoreType, ranks[i].Score)
+	}
+	return ranks, nil
+}
+
+// 合計・上位N人の合計モードで、現在のメンバーと参加者のスコアからチームのスコアを求める
+func computeTeamScores(ctx context.Context, tenantDB dbOrTx, tenantID int64, tc *TeamCompetitionRow, members map[string][]string) (map[string]int64, error) {
+	playerRanks, err := retrieveCompetitionRanks(ctx, tenantDB, tenantID, tc.CompetitionID, "")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieveCompetitionRanks: %w", err)
+	}
+	// 参加者のランキングは上位から並んでいる
+	scoreByPlayer := make(map[string]int64, len(playerRanks))
+	posByPlayer := make(map[string]int, len(playerRanks))
+	for i, r := range playerRanks {
+		scoreByPlayer[r.PlayerID] = r.Score
+		posByPlayer[r.PlayerID] = i
+	}
+	scores := map[string]int64{}
+	for teamID, playerIDs := range members {
+		scored := make([]string, 0, len(playerIDs))
+		for _, playerID := range playerIDs {
+			if _, ok := scoreByPlayer[playerID]; ok {
+				scored = append(scored, playerID)
+			}
+		}
+		if len(scored) == 0 {
+			continue
+		}
+		sort.Slice(scored, func(i, j int) bool {
+			return posByPlayer[scored[i]] < posByPlayer[scored[j]]
+		})
+		if tc.ScoreMode == TeamScoreModeBest && int64(len(scored)) > tc.BestN {
+			scored = scored[:tc.BestN]
+		}
+		// int64に収まらない合計は上限・下限に張り付かせる
+		var total int64
+		for _, playerID := range scored {
+			total = addScoreSaturated(total, scoreByPlayer[playerID])
+		}
+		scores[teamID] = total
+	}
+	return scores, nil
+}
+
+// 合計・上位N人の合計モードのチームのスコアを計算し直して保存する
+// 参加者のスコアの入稿、チーム戦の設定やスコアのルールの変更のたびに呼ぶ
+// 呼び出し側でテナントのロックを取得しておくこと
+func refreshTeamScores(ctx context.Context, tenantDB dbOrTx, tenantID int64, tc *TeamCompetitionRow) error {
+	if tc.ScoreMode == TeamScoreModeUpload {
+		return nil
+	}
+	members, err := retrieveTeamMembers(ctx, tenantDB, tenantID)
+	if err != nil {
+		return err
+	}
+	scores, err := computeTeamScores(ctx, tenantDB, tenantID, tc, members)
+	if err != nil {
+		return err
+	}
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"DELETE FROM team_score WHERE tenant_id = ? AND competition_id = ?",
+		tenantID, tc.CompetitionID,
+	); err != nil {
+		return fmt.Errorf("error Delete team_score: tenantID=%d, competitionID=%s, %w", tenantID, tc.CompetitionID, err)
+	}
+	now := time.Now().Unix()
+	teamIDs := make([]string, 0, len(scores))
+	for teamID, score := range scores {
+		id, err := dispenseID(ctx)
+		if err != nil {
+			return fmt.Errorf("error dispenseID: %w", err)
+		}
+		if _, err := tenantDB.ExecContext(
+			ctx,
+			"INSERT INTO team_score (id, tenant_id, team_id, competition_id, score, row_num, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			id, tenantID, teamID, tc.CompetitionID, score, 0, now, now,
+		); err != nil {
+			return fmt.Errorf("error Insert team_score: id=%s, teamID=%s, competitionID=%s, score=%d, %w", id, teamID, tc.CompetitionID, score, err)
+		}
+		teamIDs = append(teamIDs, teamID)
+	}
+	return saveTeamScoreMembers(ctx, tenantDB, tenantID, tc.CompetitionID, teamIDs, members, now)
+}
+
+// スコアが登録されたチームのその時点のメンバーを保存する
+func saveTeamScoreMembers(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string, teamIDs []string, members map[string][]string, now int64) error {
+	if err := deleteTeamScoreMembers(ctx, tenantDB, tenantID, competitionID); err != nil {
+		return err
+	}
+	for _, teamID := range teamIDs {
+		for _, playerID := range members[teamID] {
+			if _, err := tenantDB.ExecContext(
+				ctx,
+				"INSERT OR IGNORE INTO team_score_member (competition_id, team_id, player_id, tenant_id, created_at) VALUES (?, ?, ?, ?, ?)",
+				competitionID, teamID, playerID, tenantID, now,
+			); err != nil {
+				return fmt.Errorf("error Insert team_score_member: competitionID=%s, teamID=%s, playerID=%s, %w", competitionID, teamID, playerID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func deleteTeamScoreMembers(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string) error {
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"DELETE FROM team_score_member WHERE tenant_id = ? AND competition_id = ?",
+		tenantID, competitionID,
+	); err != nil {
+		return fmt.Errorf("error Delete team_score_member: tenantID=%d, competitionID=%s, %w", tenantID, competitionID, err)
+	}
+	return nil
+}
+
+// スコアが登録されたチームの、スコアを登録した時点のメンバーを返す
+// 課金の計算に使う
+func retrieveScoredTeamMemberIDs(ctx context.Context, tenantDB dbOrTx, tenantID int64, competitionID string) ([]string, error) {
+	ids := []string{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ids,
+		"SELECT DISTINCT(player_id) FROM team_score_member WHERE tenant_id = ? AND competition_id = ?",
+		tenantID, competitionID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select team_score_member: tenantID=%d, competitionID=%s, %w", tenantID, competitionID, err)
+	}
+	return ids, nil
+}
+
+// 参加者が所属していたチームの大会ごとの成績を返す
+// スコアを登録した時点のメンバーだった大会のみ返す
+// 呼び出し側でテナントのロックを取得しておくこと
+func retrievePlayerTeamScores(ctx context.Context, tenantDB dbOrTx, tenantID int64, playerID string) ([]TeamScoreDetail, error) {
+	ms := []TeamScoreMemberRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ms,
+		"SELECT team_score_member.* FROM team_score_member JOIN competition ON competition.id = team_score_member.competition_id WHERE team_score_member.tenant_id = ? AND team_score_member.player_id = ? ORDER BY competition.created_at ASC",
+		tenantID, playerID,
+	); err != nil {
+		return nil, fmt.Errorf("error Select team_score_member: playerID=%s, %w", playerID, err)
+	}
+	tsds := []TeamScoreDetail{}
+	for _, m := range ms {
+		tc, err := retrieveTeamCompetition(ctx, tenantDB, m.CompetitionID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, err
+		}
+		ranks, err := retrieveTeamRanks(ctx, tenantDB, tenantID, tc)
+		if err != nil {
+			return nil, err
+		}
+		comp, err := retrieveCompetition(ctx, tenantDB, m.CompetitionID)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieveCompetition: %w", err)
+		}
+		for _, r := range ranks {
+			if r.TeamID != m.TeamID {
+				continue
+			}
+			tsds = append(tsds, TeamScoreDetail{
+				CompetitionTitle: comp.Title,
+				TeamID:           r.TeamID,
+				TeamName:         r.TeamName,
+				Rank:             r.Rank,
+				Score:            r.Score,
+				ScoreText:        r.ScoreText,
+			})
+		}
+	}
+	return tsds, nil
+}
+
+// チームのスコアのCSVを読んで保存する
+// CSVのヘッダは読み終わっている状態で呼ぶ
+func saveTeamScores(ctx context.Context, tenantDB dbOrTx, v *Viewer, competitionID string, rule *ScoreRuleRow, maxRows int64, r *csv.Reader) (int64, error) {
+	var rowNum int64
+	tss := []TeamScoreRow{}
+	for {
+		rowNum++
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, fmt.Errorf("error r.Read at rows: %w", err)
+		}
+		if len(row) != 2 {
+			return 0, fmt.Errorf("row must have two columns: %#v", row)
+		}
+		if maxRows > 0 && rowNum > maxRows {
+			return 0, echo.NewHTTPError(
+				http.StatusForbidden,
+				fmt.Sprintf("CSV row quota exceeded: max=%d", maxRows),
+			)
+		}
+		teamID, scoreStr := row[0], row[1]
+		if _, err := retrieveTeam(ctx, tenantDB, teamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("team not found: %s", teamID))
+			}
+			return 0, fmt.Errorf("error retrieveTeam: %w", err)
+		}
+		score, err := rule.parseScore(scoreStr)
+		if err != nil {
+			return 0, echo.NewHTTPError(
+				http.StatusBadRequest,
+				fmt.Sprintf("error rule.parseScore: scoreStr=%s, %s", scoreStr, err),
+			)
+		}
+		id, err := dispenseID(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("error dispenseID: %w", err)
+		}
+		now := time.Now().Unix()
+		tss = append(tss, TeamScoreRow{
+			TenantID:      v.tenantID,
+			ID:            id,
+			TeamID:        teamID,
+			CompetitionID: competitionID,
+			Score:         score,
+			RowNum:        rowNum,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"DELETE FROM team_score WHERE tenant_id = ? AND competition_id = ?",
+		v.tenantID, competitionID,
+	); err != nil {
+		return 0, fmt.Errorf("error Delete team_score: tenantID=%d, competitionID=%s, %w", v.tenantID, competitionID, err)
+	}
+	for _, ts := range tss {
+		if _, err := tenantDB.ExecContext(
+			ctx,
+			"INSERT INTO team_score (id, tenant_id, team_id, competition_id, score, row_num, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			ts.ID, ts.TenantID, ts.TeamID, ts.CompetitionID, ts.Score, ts.RowNum, ts.CreatedAt, ts.UpdatedAt,
+		); err != nil {
+			return 0, fmt.Errorf(
+				"error Insert team_score: id=%s, teamID=%s, competitionID=%s, score=%d, rowNum=%d, %w",
+				ts.ID, ts.TeamID, ts.CompetitionID, ts.Score, ts.RowNum, err,
+			)
+		}
+	}
+	members, err := retrieveTeamMembers(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return 0, err
+	}
+	teamIDs := make([]string, 0, len(tss))
+	for _, ts := range tss {
+		teamIDs = append(teamIDs, ts.TeamID)
+	}
+	if err := saveTeamScoreMembers(ctx, tenantDB, v.tenantID, competitionID, teamIDs, members, time.Now().Unix()); err != nil {
+		return 0, err
+	}
+	return int64(len(tss)), nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/teams/add
+// チームを追加する
+func teamsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	name := c.FormValue("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name required")
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	playerIDs := params["player_id[]"]
+	// 存在しない参加者が含まれていてもチームだけ追加されてしまわないよう、追加する前に確かめる
+	if err := validateTeamPlayers(ctx, tenantDB, playerIDs); err != nil {
+		return err
+	}
+
+	// チームのランキングに影響するのでロックする
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	now := time.Now().Unix()
+	id, err := dispenseID(ctx)
+	if err != nil {
+		return fmt.Errorf("error dispenseID: %w", err)
+	}
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT INTO team (id, tenant_id, name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		id, v.tenantID, name, now, now,
+	); err != nil {
+		return fmt.Errorf("error Insert team: id=%s, tenantID=%d, name=%s, %w", id, v.tenantID, name, err)
+	}
+	if err := replaceTeamMembers(ctx, tenantDB, v.tenantID, id, playerIDs, now); err != nil {
+		return err
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, tenantWideVersionKey); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+
+	members, err := retrieveTeamMembers(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   TeamHandlerResult{Team: TeamDetail{ID: id, Name: name, PlayerIDs: append([]string{}, members[id]...)}},
+	})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/team/:team_id/members
+// チームのメンバーを入れ替える
+func teamMembersHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersWrite, PermissionManagePlayers); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	t, err := retrieveTeam(ctx, tenantDB, c.Param("team_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "team not found")
+		}
+		return fmt.Errorf("error retrieveTeam: %w", err)
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	if err := validateTeamPlayers(ctx, tenantDB, params["player_id[]"]); err != nil {
+		return err
+	}
+
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	now := time.Now().Unix()
+	if err := replaceTeamMembers(ctx, tenantDB, v.tenantID, t.ID, params["player_id[]"], now); err != nil {
+		return err
+	}
+	if _, err := tenantDB.ExecContext(ctx, "UPDATE team SET updated_at = ? WHERE id = ?", now, t.ID); err != nil {
+		return fmt.Errorf("error Update team: id=%s, %w", t.ID, err)
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, tenantWideVersionKey); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+
+	members, err := retrieveTeamMembers(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   TeamHandlerResult{Team: TeamDetail{ID: t.ID, Name: t.Name, PlayerIDs: append([]string{}, members[t.ID]...)}},
+	})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/teams
+// チームの一覧を取得する
+func teamsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopePlayersRead, ""); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	ts := []TeamRow{}
+	if err := tenantDB.SelectContext(
+		ctx,
+		&ts,
+		"SELECT * FROM team WHERE tenant_id = ? ORDER BY created_at DESC",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select team: tenantID=%d, %w", v.tenantID, err)
+	}
+	members, err := retrieveTeamMembers(ctx, tenantDB, v.tenantID)
+	if err != nil {
+		return err
+	}
+	tds := make([]TeamDetail, 0, len(ts))
+	for _, t := range ts {
+		tds = append(tds, TeamDetail{
+			ID:        t.ID,
+			Name:      t.Name,
+			PlayerIDs: append([]string{}, members[t.ID]...),
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true, Data: TeamsHandlerResult{Teams: tds}})
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/competition/:competition_id/team
+// 大会をチーム戦にする
+func competitionTeamHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeCompetitionsWrite, PermissionManageCompetitions); err != nil {
+		return err
+	}
+
+	tenantDB, err := connectToTenantDB(v.tenantID)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+
+	competitionID := c.Param("competition_id")
+	comp, err := retrieveCompetition(ctx, tenantDB, competitionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "competition not found")
+		}
+		return fmt.Errorf("error retrieveCompetition: %w", err)
+	}
+	if comp.FinishedAt.Valid {
+		return echo.NewHTTPError(http.StatusBadRequest, "competition is finished")
+	}
+
+	mode := c.FormValue("score_mode")
+	var bestN int64
+	switch mode {
+	case TeamScoreModeUpload, TeamScoreModeSum:
+	case TeamScoreModeBest:
+		bestN, err = strconv.ParseInt(c.FormValue("best_n"), 10, 64)
+		if err != nil || bestN <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid best_n: %s", c.FormValue("best_n")))
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid score_mode: %s", mode))
+	}
+
+	fl, err := flockByTenantID(ctx, v.tenantID)
+	if err != nil {
+		return fmt.Errorf("error flockByTenantID: %w", err)
+	}
+	defer fl.Close()
+	prev, err := retrieveTeamCompetition(ctx, tenantDB, competitionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	now := time.Now().Unix()
+	if _, err := tenantDB.ExecContext(
+		ctx,
+		"INSERT INTO team_competition (competition_id, tenant_id, score_mode, best_n, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT(competition_id) DO UPDATE SET score_mode = excluded.score_mode, best_n = excluded.best_n, updated_at = excluded.updated_at",
+		competitionID, v.tenantID, mode, bestN, now, now,
+	); err != nil {
+		return fmt.Errorf("error Upsert team_competition: competitionID=%s, scoreMode=%s, bestN=%d, %w", competitionID, mode, bestN, err)
+	}
+	if mode == TeamScoreModeUpload {
+		// 計算して保存していたスコアは入稿したものではないので消す
+		if prev != nil && prev.ScoreMode != TeamScoreModeUpload {
+			if _, err := tenantDB.ExecContext(
+				ctx,
+				"DELETE FROM team_score WHERE tenant_id = ? AND competition_id = ?",
+				v.tenantID, competitionID,
+			); err != nil {
+				return fmt.Errorf("error Delete team_score: tenantID=%d, competitionID=%s, %w", v.tenantID, competitionID, err)
+			}
+			if err := deleteTeamScoreMembers(ctx, tenantDB, v.tenantID, competitionID); err != nil {
+				return err
+			}
+		}
+	} else {
+		tc := &TeamCompetitionRow{TenantID: v.tenantID, CompetitionID: competitionID, ScoreMode: mode, BestN: bestN}
+		if err := refreshTeamScores(ctx, tenantDB, v.tenantID, tc); err != nil {
+			return fmt.Errorf("error refreshTeamScores: %w", err)
+		}
+	}
+	if err := bumpContentVersion(ctx, v.tenantID, competitionID); err != nil {
+		return fmt.Errorf("error bumpContentVersion: %w", err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   TeamCompetitionHandlerResult{ScoreMode: mode, BestN: bestN},
+	})
+}
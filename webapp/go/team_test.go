@@ -0,0 +1,199 @@
+package isuports
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+)
+
+func TestTeams(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob", "carol")
+
+	added, err := org.TeamsAdd(ctx, &client.TeamsAddParams{Name: "red", PlayerID: ids[:1]})
+	if err != nil {
+		t.Fatalf("error TeamsAdd: %s", err)
+	}
+	teamID := added.Team.ID
+	members, err := org.TeamMembers(ctx, &client.TeamMembersParams{TeamID: teamID, PlayerID: ids[:2]})
+	if err != nil {
+		t.Fatalf("error TeamMembers: %s", err)
+	}
+	if len(members.Team.PlayerIDs) != 2 {
+		t.Fatalf("unexpected members: %+v", members.Team.PlayerIDs)
+	}
+	if _, err := org.TeamsAdd(ctx, &client.TeamsAddParams{Name: "blue", PlayerID: ids[2:]}); err != nil {
+		t.Fatalf("error TeamsAdd: %s", err)
+	}
+	teams, err := org.Teams(ctx)
+	if err != nil {
+		t.Fatalf("error Teams: %s", err)
+	}
+	if len(teams.Teams) != 2 {
+		t.Fatalf("unexpected teams: %+v", teams.Teams)
+	}
+
+	// 合計モードでは個人のスコアからチームの順位をつける
+	competitionID := addTestCompetition(t, tenantName, "team match")
+	if _, err := org.CompetitionTeam(ctx, &client.CompetitionTeamParams{CompetitionID: competitionID, ScoreMode: TeamScoreModeSum}); err != nil {
+		t.Fatalf("error CompetitionTeam: %s", err)
+	}
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100", ids[1]+",100", ids[2]+",150")
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.TeamRanks) != 2 || ranking.TeamRanks[0].TeamID != teamID || ranking.TeamRanks[0].Score != 200 {
+		t.Fatalf("unexpected team ranks: %+v", ranking.TeamRanks)
+	}
+}
+
+func TestTeamScoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob", "carol")
+
+	// 存在しない参加者が含まれていればチームも追加しない
+	_, err := org.TeamsAdd(ctx, &client.TeamsAddParams{Name: "ghost", PlayerID: []string{ids[0], "not-found"}})
+	assertStatus(t, err, http.StatusBadRequest)
+	teams, err := org.Teams(ctx)
+	if err != nil {
+		t.Fatalf("error Teams: %s", err)
+	}
+	if len(teams.Teams) != 0 {
+		t.Fatalf("unexpected teams: %+v", teams.Teams)
+	}
+
+	added, err := org.TeamsAdd(ctx, &client.TeamsAddParams{Name: "red", PlayerID: ids[:2]})
+	if err != nil {
+		t.Fatalf("error TeamsAdd: %s", err)
+	}
+	teamID := added.Team.ID
+	competitionID := addTestCompetition(t, tenantName, "team match")
+	if _, err := org.CompetitionTeam(ctx, &client.CompetitionTeamParams{CompetitionID: competitionID, ScoreMode: TeamScoreModeSum}); err != nil {
+		t.Fatalf("error CompetitionTeam: %s", err)
+	}
+	uploadTestScores(t, tenantName, competitionID, ids[0]+",100")
+
+	// スコアを登録した後でメンバーを入れ替えても、順位・成績・課金は登録時点のメンバーで決まる
+	if _, err := org.TeamMembers(ctx, &client.TeamMembersParams{TeamID: teamID, PlayerID: ids[2:]}); err != nil {
+		t.Fatalf("error TeamMembers: %s", err)
+	}
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.TeamRanks) != 1 || ranking.TeamRanks[0].Score != 100 {
+		t.Fatalf("unexpected team ranks: %+v", ranking.TeamRanks)
+	}
+	for _, tc := range []struct {
+		playerID string
+		want     int
+	}{{ids[1], 1}, {ids[2], 0}} {
+		p, err := newPlayerClient(t, tenantName, tc.playerID).Player(ctx, &client.PlayerParams{PlayerID: tc.playerID})
+		if err != nil {
+			t.Fatalf("error Player: %s", err)
+		}
+		if len(p.TeamScores) != tc.want {
+			t.Fatalf("unexpected team scores: playerID=%s, %+v", tc.playerID, p.TeamScores)
+		}
+	}
+
+	if err := org.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	billing, err := org.Billing(ctx)
+	if err != nil {
+		t.Fatalf("error Billing: %s", err)
+	}
+	if len(billing.Reports) != 1 || billing.Reports[0].PlayerCount != 2 {
+		t.Fatalf("unexpected reports: %+v", billing.Reports)
+	}
+}
+
+func TestTeamScoreOverflow(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	ids := addTestPlayers(t, tenantName, "alice", "bob", "carol", "dave")
+	for _, tm := range []struct {
+		name      string
+		playerIDs []string
+	}{{"red", ids[:2]}, {"blue", ids[2:]}} {
+		if _, err := org.TeamsAdd(ctx, &client.TeamsAddParams{Name: tm.name, PlayerID: tm.playerIDs}); err != nil {
+			t.Fatalf("error TeamsAdd: %s", err)
+		}
+	}
+	competitionID := addTestCompetition(t, tenantName, "team match")
+	if _, err := org.CompetitionTeam(ctx, &client.CompetitionTeamParams{CompetitionID: competitionID, ScoreMode: TeamScoreModeSum}); err != nil {
+		t.Fatalf("error CompetitionTeam: %s", err)
+	}
+	maxScore, minScore := strconv.FormatInt(math.MaxInt64, 10), strconv.FormatInt(math.MinInt64, 10)
+	uploadTestScores(t, tenantName, competitionID, ids[0]+","+maxScore, ids[1]+",1", ids[2]+","+minScore, ids[3]+",-1")
+
+	// 合計がint64に収まらなくても上限・下限に張り付くだけで、順位は入れ替わらない
+	ranking, err := newPlayerClient(t, tenantName, ids[0]).CompetitionRanking(ctx, &client.CompetitionRankingParams{CompetitionID: competitionID})
+	if err != nil {
+		t.Fatalf("error CompetitionRanking: %s", err)
+	}
+	if len(ranking.TeamRanks) != 2 ||
+		ranking.TeamRanks[0].TeamName != "red" || ranking.TeamRanks[0].Score != math.MaxInt64 ||
+		ranking.TeamRanks[1].TeamName != "blue" || ranking.TeamRanks[1].Score != math.MinInt64 {
+		t.Fatalf("unexpected team ranks: %+v", ranking.TeamRanks)
+	}
+}
+
+func TestRetrieveUploadedTeamRanks(t *testing.T) {
+	ctx := context.Background()
+	db := openTestTenantDB(t)
+	for _, id := range []string{"t1", "t2", "t3"} {
+		if _, err := db.Exec(
+			"INSERT INTO team (id, tenant_id, name, created_at, updated_at) VALUES (?, 1, ?, 0, 0)",
+			id, "team "+id,
+		); err != nil {
+			t.Fatalf("error Insert team: %s", err)
+		}
+	}
+	// t1は後の行のスコアを採用する
+	for i, ts := range []struct {
+		teamID string
+		score  int64
+	}{
+		{"t1", 100}, {"t2", 80}, {"t1", 50}, {"t3", 80}, {"deleted", 200},
+	} {
+		if _, err := db.Exec(
+			"INSERT INTO team_score (id, tenant_id, team_id, competition_id, score, row_num, created_at, updated_at) VALUES (?, 1, ?, 'c1', ?, ?, 0, 0)",
+			ts.teamID+"-"+string(rune('a'+i)), ts.teamID, ts.score, i+1,
+		); err != nil {
+			t.Fatalf("error Insert team_score: %s", err)
+		}
+	}
+
+	ranks, err := retrieveTeamRanks(ctx, db, 1, &TeamCompetitionRow{TenantID: 1, CompetitionID: "c1", ScoreMode: TeamScoreModeUpload})
+	if err != nil {
+		t.Fatalf("error retrieveTeamRanks: %s", err)
+	}
+	// 同じスコアならCSV上で先に出現したほうが上位 存在しないチームは除く
+	want := []struct {
+		teamID string
+		rank   int64
+		score  int64
+	}{
+		{"t2", 1, 80}, {"t3", 2, 80}, {"t1", 3, 50},
+	}
+	if len(ranks) != len(want) {
+		t.Fatalf("unexpected ranks: %+v", ranks)
+	}
+	for i, w := range want {
+		if ranks[i].TeamID != w.teamID || ranks[i].Rank != w.rank || ranks[i].Score != w.score || ranks[i].TeamName != "team "+w.teamID {
+			t.Errorf("unexpected rank %d: %+v", i, ranks[i])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 存在しないテナント名・ドメインをキャッシュする数の上限
+// リクエストのたびに任意の名前を指定できるので、上限がないとメモリを使い切られる
+const tenantCacheMaxNegativeEntries = 10000
+
+// テナントの行をプロセス内にキャッシュする
+// テナントはほとんど変更されないのに全リクエストで参照されるので、毎回管理用DBに問い合わせない
+type tenantCache struct {
+	mu          sync.RWMutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	byName      map[string]tenantCacheEntry
+	byID        map[int64]tenantCacheEntry
+	byDomain    map[string]tenantCacheEntry
+	// 存在しないものとしてキャッシュしているbyName・byDomainの数
+	negatives int
+	// invalidate・purgeのたびに増やす
+	// 問い合わせている間に変更されたら、古い結果をキャッシュしない
+	generation uint64
+}
+
+type tenantCacheEntry struct {
+	tenant    TenantRow
+	found     bool // falseなら存在しないテナント名としてキャッシュしている
+	expiresAt time.Time
+}
+
+var tenants = newTenantCache(60*time.Second, 5*time.Second)
+
+func newTenantCache(ttl, negativeTTL time.Duration) *tenantCache {
+	return &tenantCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		byName:      map[string]tenantCacheEntry{},
+		byID:        map[int64]tenantCacheEntry{},
+		byDomain:    map[string]tenantCacheEntry{},
+	}
+}
+
+// テナント名からテナントを取得する
+// 存在しない場合は sql.ErrNoRows をラップしたエラーを返す
+func (tc *tenantCache) getByName(ctx context.Context, name string) (*TenantRow, error) {
+	now := time.Now()
+	tc.mu.RLock()
+	e, ok := tc.byName[name]
+	tc.mu.RUnlock()
+	if ok && now.Before(e.expiresAt) {
+		if !e.found {
+			return nil, fmt.Errorf("tenant not found (cached): name=%s, %w", name, sql.ErrNoRows)
+		}
+		t := e.tenant
+		return &t, nil
+	}
+
+	gen := tc.currentGeneration()
+	var t TenantRow
+	if err := adminDB.GetContext(ctx, &t, "SELECT * FROM tenant WHERE name = ?", name); err != nil {
+		// テナント名として正しくない名前は作られることがないので、キャッシュして覚えておく必要もない
+		if err == sql.ErrNoRows && tenantNameRegexp.MatchString(name) {
+			tc.setNegative(tc.byName, name, gen, now)
+		}
+		return nil, fmt.Errorf("failed to Select tenant: name=%s, %w", name, err)
+	}
+	tc.set(t, gen, now)
+	return &t, nil
+}
+
+// テナントIDからテナントを取得する
+func (tc *tenantCache) getByID(ctx context.Context, id int64) (*TenantRow, error) {
+	now := time.Now()
+	tc.mu.RLock()
+	e, ok := tc.byID[id]
+	tc.mu.RUnlock()
+	if ok && now.Before(e.expiresAt) {
+		t := e.tenant
+		return &t, nil
+	}
+
+	gen := tc.currentGeneration()
+	var t TenantRow
+	if err := adminDB.GetContext(ctx, &t, "SELECT * FROM tenant WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to Select tenant: id=%d, %w", id, err)
+	}
+	tc.set(t, gen, now)
+	return &t, nil
+}
+
+func (tc *tenantCache) currentGeneration() uint64 {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return tc.generation
+}
+
+func (tc *tenantCache) set(t TenantRow, gen uint64, now time.Time) {
+	e := tenantCacheEntry{tenant: t, found: true, expiresAt: now.Add(tc.ttl)}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if gen != tc.generation {
+		return
+	}
+	tc.put(tc.byName, t.Name, e)
+	tc.byID[t.ID] = e
+}
+
+// 存在しないものとしてキャッシュする
+// 上限に達していたら期限切れのものを捨て、それでも空きがなければキャッシュしない
+func (tc *tenantCache) setNegative(m map[string]tenantCacheEntry, key string, gen uint64, now time.Time) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	// 問い合わせている間にテナントが追加されていたら、存在しないとは限らない
+	if gen != tc.generation {
+		return
+	}
+	if tc.negatives >= tenantCacheMaxNegativeEntries {
+		tc.sweepNegatives(now)
+		if tc.negatives >= tenantCacheMaxNegativeEntries {
+			return
+		}
+	}
+	tc.put(m, key, tenantCacheEntry{found: false, expiresAt: now.Add(tc.negativeTTL)})
+}
+
+// negativesを数え直しながらエントリを置き換える tc.muを取得して呼ぶ
+func (tc *tenantCache) put(m map[string]tenantCacheEntry, key string, e tenantCacheEntry) {
+	tc.remove(m, key)
+	if !e.found {
+		tc.negatives++
+	}
+	m[key] = e
+}
+
+// tc.muを取得して呼ぶ
+func (tc *tenantCache) remove(m map[string]tenantCacheEntry, key string) {
+	if old, ok := m[key]; ok && !old.found {
+		tc.negatives--
+	}
+	delete(m, key)
+}
+
+// 期限切れの存在しないエントリを捨てる tc.muを取得して呼ぶ
+func (tc *tenantCache) sweepNegatives(now time.Time) {
+	for _, m := range []map[string]tenantCacheEntry{tc.byName, tc.byDomain} {
+		for k, e := range m {
+			if !e.found && !now.Before(e.expiresAt) {
+				tc.remove(m, k)
+			}
+		}
+	}
+}
+
+// テナントが追加・変更されたときに呼ぶ
+func (tc *tenantCache) invalidate(name string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if e, ok := tc.byName[name]; ok && e.found {
+		delete(tc.byID, e.tenant.ID)
+	}
+	tc.remove(tc.byName, name)
+	tc.generation++
+}
+
+// 管理用DBが初期化されたときなどに全て捨てる
+func (tc *tenantCache) purge() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.byName = map[string]tenantCacheEntry{}
+	tc.byID = map[int64]tenantCacheEntry{}
+	tc.byDomain = map[string]tenantCacheEntry{}
+	tc.negatives = 0
+	tc.generation++
+}
@@ -0,0 +1,89 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTenantCacheNegative(t *testing.T) {
+	ctx := context.Background()
+	tc := newTenantCache(time.Minute, time.Minute)
+
+	// テナント名として正しくない名前はキャッシュしない
+	if _, err := tc.getByName(ctx, "Not_A_Tenant"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := tc.getByName(ctx, "not-a-tenant"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, ok := tc.byName["Not_A_Tenant"]; ok {
+		t.Fatalf("invalid name must not be cached")
+	}
+	if _, ok := tc.byName["not-a-tenant"]; !ok || tc.negatives != 1 {
+		t.Fatalf("valid name must be cached: negatives=%d", tc.negatives)
+	}
+
+	// 問い合わせている間にinvalidateされたら、存在しないという結果はキャッシュしない
+	now := time.Now()
+	gen := tc.currentGeneration()
+	tc.invalidate("new-tenant")
+	tc.setNegative(tc.byName, "new-tenant", gen, now)
+	if _, ok := tc.byName["new-tenant"]; ok {
+		t.Fatalf("stale negative entry must not be cached")
+	}
+
+	// 上限を超えてキャッシュしない 期限切れのものは捨てて空きを作る
+	gen = tc.currentGeneration()
+	for i := 0; i < tenantCacheMaxNegativeEntries+10; i++ {
+		tc.setNegative(tc.byDomain, fmt.Sprintf("example-%d.com", i), gen, now)
+	}
+	if tc.negatives != tenantCacheMaxNegativeEntries {
+		t.Fatalf("unexpected negatives: %d", tc.negatives)
+	}
+	tc.setNegative(tc.byDomain, "example.org", gen, now.Add(2*time.Minute))
+	if _, ok := tc.byDomain["example.org"]; !ok || tc.negatives != 1 {
+		t.Fatalf("expired entries must be swept: negatives=%d", tc.negatives)
+	}
+}
+
+func TestTenantCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	tc := newTenantCache(time.Minute, time.Minute)
+	now := time.Now()
+
+	// キャッシュにあるうちは管理用DBに問い合わせない
+	tc.set(TenantRow{ID: 1, Name: "cached"}, tc.currentGeneration(), now)
+	if tenant, err := tc.getByName(ctx, "cached"); err != nil || tenant.ID != 1 {
+		t.Fatalf("unexpected getByName: %+v, %v", tenant, err)
+	}
+	if tenant, err := tc.getByID(ctx, 1); err != nil || tenant.Name != "cached" {
+		t.Fatalf("unexpected getByID: %+v, %v", tenant, err)
+	}
+	if e := tc.byName["cached"]; !e.expiresAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected expiresAt: %s", e.expiresAt)
+	}
+
+	// 存在しないテナント名のキャッシュは sql.ErrNoRows を返す
+	tc.byName["missing"] = tenantCacheEntry{found: false, expiresAt: now.Add(time.Minute)}
+	if _, err := tc.getByName(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows: %v", err)
+	}
+
+	// 変更されたテナントは名前からもIDからも消える
+	tc.invalidate("cached")
+	if _, ok := tc.byName["cached"]; ok {
+		t.Fatalf("byName must be invalidated")
+	}
+	if _, ok := tc.byID[1]; ok {
+		t.Fatalf("byID must be invalidated")
+	}
+
+	tc.purge()
+	if len(tc.byName) != 0 || len(tc.byID) != 0 {
+		t.Fatalf("cache must be purged: %d, %d", len(tc.byName), len(tc.byID))
+	}
+}
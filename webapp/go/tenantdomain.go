@@ -0,0 +1,298 @@
+package isuports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Hostヘッダでテナントを判別する
+	// {テナント名}.t.isucon.dev か、tenant_domainに登録された独自ドメイン
+	TenantRoutingHost = "host"
+	// /t/{テナント名}/api/... のようにパスでテナントを判別する
+	// ワイルドカードDNSを用意できない環境向け
+	TenantRoutingPath = "path"
+
+	// パスでテナントを判別したときにecho.Contextに保存するキー
+	contextKeyRoutedTenantName = "isuports.routed_tenant_name"
+)
+
+var (
+	tenantRoutingMode = TenantRoutingHost
+
+	// 独自ドメインとして登録できるホスト名の正規表現
+	tenantDomainRegexp = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+)
+
+// テナントのルーティング方式を設定する
+func initializeTenantRouting() error {
+	switch mode := appConfig.Routing.Mode; mode {
+	case TenantRoutingHost, TenantRoutingPath:
+		tenantRoutingMode = mode
+		return nil
+	default:
+		return fmt.Errorf("invalid ISUCON_TENANT_ROUTING: %s", mode)
+	}
+}
+
+// パスでテナントを判別するモードのとき、/t/{テナント名} を取り除いてからルーティングする
+// e.Pre で使う
+func RewriteTenantPath(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if !strings.HasPrefix(req.URL.Path, "/t/") {
+			return next(c)
+		}
+		name, path, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/t/"), "/")
+		if name == "" {
+			return next(c)
+		}
+		c.Set(contextKeyRoutedTenantName, name)
+		req.URL.Path = "/" + path
+		req.URL.RawPath = ""
+		return next(c)
+	}
+}
+
+// Hostヘッダからポート番号を取り除いて小文字にする
+func requestHostname(c echo.Context) string {
+	host := c.Request().Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// SaaS管理者用のホスト(パスでテナントを判別するモードでは /t/admin)へのリクエストかどうか
+func isAdminRequest(c echo.Context) bool {
+	if tenantRoutingMode == TenantRoutingPath {
+		name, _ := c.Get(contextKeyRoutedTenantName).(string)
+		return name == "admin"
+	}
+	return c.Request().Host == appConfig.Routing.AdminHostname
+}
+
+// リクエストからテナントを特定する
+// テナント名がわかる場合はnameに、独自ドメインの場合はdomainに値が入る
+func tenantNameOrDomainFromRequest(c echo.Context) (name string, domain string, err error) {
+	if tenantRoutingMode == TenantRoutingPath {
+		name, ok := c.Get(contextKeyRoutedTenantName).(string)
+		if !ok {
+			return "", "", echo.NewHTTPError(http.StatusNotFound, "tenant is not specified in path")
+		}
+		return name, "", nil
+	}
+
+	baseHost := appConfig.Routing.BaseHostname
+	host := c.Request().Host
+	if strings.HasSuffix(host, baseHost) {
+		return strings.TrimSuffix(host, baseHost), "", nil
+	}
+	return "", requestHostname(c), nil
+}
+
+// 独自ドメインからテナントを取得する
+// 存在しない場合は sql.ErrNoRows をラップしたエラーを返す
+func (tc *tenantCache) getByDomain(ctx context.Context, domain string) (*TenantRow, error) {
+	now := time.Now()
+	tc.mu.RLock()
+	e, ok := tc.byDomain[domain]
+	tc.mu.RUnlock()
+	if ok && now.Before(e.expiresAt) {
+		if !e.found {
+			return nil, fmt.Errorf("tenant domain not found (cached): domain=%s, %w", domain, sql.ErrNoRows)
+		}
+		t := e.tenant
+		return &t, nil
+	}
+
+	gen := tc.currentGeneration()
+	var t TenantRow
+	if err := adminDB.GetContext(
+		ctx,
+		&t,
+		"SELECT tenant.* FROM tenant_domain JOIN tenant ON tenant.id = tenant_domain.tenant_id WHERE tenant_domain.domain = ?",
+		domain,
+	); err != nil {
+		// 登録できない形式のドメインはキャッシュしない
+		if err == sql.ErrNoRows && validateTenantDomain(domain) == nil {
+			tc.setNegative(tc.byDomain, domain, gen, now)
+		}
+		return nil, fmt.Errorf("failed to Select tenant_domain: domain=%s, %w", domain, err)
+	}
+	tc.mu.Lock()
+	if gen == tc.generation {
+		tc.put(tc.byDomain, domain, tenantCacheEntry{tenant: t, found: true, expiresAt: now.Add(tc.ttl)})
+	}
+	tc.mu.Unlock()
+	return &t, nil
+}
+
+// 独自ドメインが追加・削除されたときに呼ぶ
+func (tc *tenantCache) invalidateDomain(domain string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.remove(tc.byDomain, domain)
+	tc.generation++
+}
+
+type TenantDomainRow struct {
+	Domain    string `db:"domain"`
+	TenantID  int64  `db:"tenant_id"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type TenantDomainDetail struct {
+	Domain     string `json:"domain"`
+	TenantName string `json:"tenant_name"`
+}
+
+type TenantDomainsHandlerResult struct {
+	Domains []TenantDomainDetail `json:"domains"`
+}
+
+// SaaS管理者用APIの共通のチェック
+func authorizeAdmin(c echo.Context) (*Viewer, error) {
+	v, err := parseViewer(c)
+	if err != nil {
+		return nil, fmt.Errorf("error parseViewer: %w", err)
+	}
+	if v.tenantName != "admin" {
+		// admin: SaaS管理者用の特別なテナント名
+		return nil, echo.NewHTTPError(
+			http.StatusNotFound,
+			fmt.Sprintf("%s has not this API", v.tenantName),
+		)
+	}
+	if v.role != RoleAdmin {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "admin role required")
+	}
+	return v, nil
+}
+
+// 独自ドメインとして登録できるかチェックする
+func validateTenantDomain(domain string) error {
+	if !tenantDomainRegexp.MatchString(domain) || len(domain) > 253 {
+		return fmt.Errorf("invalid domain: %s", domain)
+	}
+	// ISUCON_BASE_HOSTNAME 配下はテナント名で判別するので登録できない
+	baseHost := appConfig.Routing.BaseHostname
+	if strings.HasSuffix(domain, baseHost) || domain == strings.TrimPrefix(baseHost, ".") {
+		return fmt.Errorf("domain under %s cannot be registered: %s", baseHost, domain)
+	}
+	return nil
+}
+
+// SaaS管理者用API
+// テナントに独自ドメインを追加する
+// POST /api/admin/tenants/domains/add
+func tenantDomainsAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	domain := strings.ToLower(c.FormValue("domain"))
+	if err := validateTenantDomain(domain); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	tenantName := c.FormValue("tenant_name")
+	tenant, err := tenants.getByName(ctx, tenantName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "tenant not found")
+		}
+		return fmt.Errorf("error tenants.getByName: %w", err)
+	}
+
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"INSERT INTO tenant_domain (domain, tenant_id, created_at) VALUES (?, ?, ?)",
+		domain, tenant.ID, now,
+	); err != nil {
+		if isDuplicateEntryError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, "duplicate domain")
+		}
+		return fmt.Errorf("error Insert tenant_domain: domain=%s, tenantID=%d, createdAt=%d, %w", domain, tenant.ID, now, err)
+	}
+	tenants.invalidateDomain(domain)
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: TenantDomainsHandlerResult{
+			Domains: []TenantDomainDetail{{Domain: domain, TenantName: tenant.Name}},
+		},
+	})
+}
+
+// SaaS管理者用API
+// 独自ドメインを削除する
+// POST /api/admin/tenants/domains/delete
+func tenantDomainsDeleteHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	domain := strings.ToLower(c.FormValue("domain"))
+	res, err := adminDB.ExecContext(ctx, "DELETE FROM tenant_domain WHERE domain = ?", domain)
+	if err != nil {
+		return fmt.Errorf("error Delete tenant_domain: domain=%s, %w", domain, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error RowsAffected: %w", err)
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "domain not found")
+	}
+	tenants.invalidateDomain(domain)
+
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
+
+// SaaS管理者用API
+// 独自ドメインの一覧を取得する
+// GET /api/admin/tenants/domains
+// URL引数tenant_nameを指定した場合、そのテナントのドメインのみ返す
+func tenantDomainsHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	if _, err := authorizeAdmin(c); err != nil {
+		return err
+	}
+
+	type row struct {
+		TenantDomainRow
+		TenantName string `db:"tenant_name"`
+	}
+	rows := []row{}
+	query := "SELECT tenant_domain.*, tenant.name AS tenant_name FROM tenant_domain JOIN tenant ON tenant.id = tenant_domain.tenant_id"
+	args := []any{}
+	if tenantName := c.QueryParam("tenant_name"); tenantName != "" {
+		query += " WHERE tenant.name = ?"
+		args = append(args, tenantName)
+	}
+	query += " ORDER BY tenant_domain.domain"
+	if err := adminDB.SelectContext(ctx, &rows, query, args...); err != nil {
+		return fmt.Errorf("error Select tenant_domain: %w", err)
+	}
+	ds := make([]TenantDomainDetail, 0, len(rows))
+	for _, r := range rows {
+		ds = append(ds, TenantDomainDetail{
+			Domain:     r.Domain,
+			TenantName: r.TenantName,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   TenantDomainsHandlerResult{Domains: ds},
+	})
+}
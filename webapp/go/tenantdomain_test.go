@@ -0,0 +1,99 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTenantDomains(t *testing.T) {
+	ctx := context.Background()
+	admin := newAdminClient(t)
+	tenantName := newTestTenant(t)
+	domain := tenantName + ".example.com"
+
+	if _, err := admin.TenantDomainsAdd(ctx, &client.TenantDomainsAddParams{Domain: domain, TenantName: tenantName}); err != nil {
+		t.Fatalf("error TenantDomainsAdd: %s", err)
+	}
+	_, err := admin.TenantDomainsAdd(ctx, &client.TenantDomainsAddParams{Domain: domain, TenantName: tenantName})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = admin.TenantDomainsAdd(ctx, &client.TenantDomainsAddParams{Domain: "other.example.com", TenantName: "not-found"})
+	assertStatus(t, err, http.StatusNotFound)
+
+	domains, err := admin.TenantDomains(ctx, &client.TenantDomainsParams{TenantName: tenantName})
+	if err != nil {
+		t.Fatalf("error TenantDomains: %s", err)
+	}
+	if len(domains.Domains) != 1 || domains.Domains[0].Domain != domain {
+		t.Fatalf("unexpected domains: %+v", domains.Domains)
+	}
+
+	// 独自ドメインでもテナントにアクセスできる
+	custom := newTestClient(domain, newTestToken(t, "organizer", RoleOrganizer, tenantName))
+	if _, err := custom.PlayersList(ctx); err != nil {
+		t.Fatalf("error PlayersList on custom domain: %s", err)
+	}
+
+	if err := admin.TenantDomainsDelete(ctx, &client.TenantDomainsDeleteParams{Domain: domain}); err != nil {
+		t.Fatalf("error TenantDomainsDelete: %s", err)
+	}
+	_, err = custom.PlayersList(ctx)
+	assertStatus(t, err, http.StatusUnauthorized)
+}
+
+func TestRewriteTenantPath(t *testing.T) {
+	e := echo.New()
+	for _, tc := range []struct {
+		path     string
+		wantPath string
+		wantName string
+	}{
+		{"/t/tenant-1/api/player/competitions", "/api/player/competitions", "tenant-1"},
+		{"/t/admin/api/admin/tenants/billing", "/api/admin/tenants/billing", "admin"},
+		{"/t/tenant-1", "/", "tenant-1"},
+		// テナント名がなければ書き換えない
+		{"/t//api/me", "/t//api/me", ""},
+		{"/api/me", "/api/me", ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		var gotPath, gotName string
+		h := RewriteTenantPath(func(c echo.Context) error {
+			gotPath = c.Request().URL.Path
+			gotName, _ = c.Get(contextKeyRoutedTenantName).(string)
+			return nil
+		})
+		if err := h(c); err != nil {
+			t.Fatalf("error RewriteTenantPath: %s", err)
+		}
+		if gotPath != tc.wantPath || gotName != tc.wantName {
+			t.Errorf("RewriteTenantPath(%q) = %q, %q, want %q, %q", tc.path, gotPath, gotName, tc.wantPath, tc.wantName)
+		}
+	}
+}
+
+func TestValidateTenantDomain(t *testing.T) {
+	for _, tc := range []struct {
+		domain string
+		valid  bool
+	}{
+		{"scores.example.com", true},
+		{"example-1.co.jp", true},
+		{"example", false},
+		{"Example.com", false},
+		{"-example.com", false},
+		{"example.com.", false},
+		{"example.123", false},
+		// テナント名で判別するホストは独自ドメインにできない
+		{"t.isucon.dev", false},
+		{"tenant-1.t.isucon.dev", false},
+	} {
+		if err := validateTenantDomain(tc.domain); (err == nil) != tc.valid {
+			t.Errorf("validateTenantDomain(%q) = %v, want valid=%t", tc.domain, err, tc.valid)
+		}
+	}
+}
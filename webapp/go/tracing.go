@@ -0,0 +1,160 @@
+package isuports
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	proxy "github.com/shogo82148/go-sql-proxy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/isucon/isucon12-qualify/webapp/go")
+
+// OpenTelemetryのトレースを出力する設定を行う
+// otel.exporter (環境変数 ISUCON_OTEL_EXPORTER) に otlp を設定すると OTEL_EXPORTER_OTLP_ENDPOINT に送信する
+// file を設定すると otel.trace_file (ISUCON_OTEL_TRACE_FILE) にJSON形式で出力する
+// 未設定ならトレースは出力しない
+func initializeTracer(ctx context.Context, cfg OTelConfig) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch e := cfg.Exporter; e {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error otlptracehttp.New: %w", err)
+		}
+		exporter = exp
+	case "file":
+		f, err := os.OpenFile(cfg.TraceFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open otel.trace_file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error stdouttrace.New: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unknown otel.exporter: %s", e)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("isuports"),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// トレースが有効かどうか
+func tracingEnabled() bool {
+	return appConfig.OTel.Exporter != ""
+}
+
+// リクエストごとにspanを作成する
+func TraceRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(
+			ctx,
+			req.Method+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(req.Method),
+				semconv.HTTPRouteKey.String(c.Path()),
+				semconv.HTTPTargetKey.String(req.URL.RequestURI()),
+				semconv.HTTPHostKey.String(req.Host),
+			),
+		)
+		defer span.End()
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+		status := responseStatus(c, err)
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if tenantName, ok := c.Get(contextKeyTenantName).(string); ok {
+			span.SetAttributes(attribute.String("isuports.tenant", tenantName))
+		}
+		if err != nil {
+			span.RecordError(err)
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+		return err
+	}
+}
+
+// ハンドラ内で使うcontextを返す
+// クライアントの切断でCSVの書き込みなどが途中で止まらないよう、キャンセルは伝播させずにspanだけを引き継ぐ
+func requestContext(c echo.Context) context.Context {
+	ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(c.Request().Context()))
+	return withTraceLogTenant(ctx, c)
+}
+
+// キャンセルを伝播させるcontextを返す
+// 全テナントの課金計算のように、クライアントが切断したら途中でやめてよい読み取り専用の処理で使う
+func cancelableRequestContext(c echo.Context) context.Context {
+	return withTraceLogTenant(c.Request().Context(), c)
+}
+
+// SQLの実行ごとにspanを作成するhook
+// MySQLのドライバはプレースホルダがあるとErrSkipを返してPrepareし直すので、
+// 実行し終わってから開始時刻を指定してspanを作り、ErrSkipの分は作らない
+func newSQLTraceHooks(system attribute.KeyValue) *proxy.HooksContext {
+	pre := func(_ context.Context, _ *proxy.Stmt, _ []driver.NamedValue) (interface{}, error) {
+		return time.Now(), nil
+	}
+	post := func(c context.Context, ctx interface{}, stmt *proxy.Stmt, err error) {
+		if err == driver.ErrSkip {
+			return
+		}
+		_, span := tracer.Start(
+			c,
+			"sql",
+			trace.WithTimestamp(ctx.(time.Time)),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				system,
+				semconv.DBStatementKey.String(stmt.QueryString),
+			),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+	return &proxy.HooksContext{
+		PreExec: pre,
+		PostExec: func(c context.Context, ctx interface{}, stmt *proxy.Stmt, _ []driver.NamedValue, _ driver.Result, err error) error {
+			post(c, ctx, stmt, err)
+			return nil
+		},
+		PreQuery: pre,
+		PostQuery: func(c context.Context, ctx interface{}, stmt *proxy.Stmt, _ []driver.NamedValue, _ driver.Rows, err error) error {
+			post(c, ctx, stmt, err)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package isuports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(context.Background())
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	e := echo.New()
+	e.Use(TraceRequest)
+	var handlerCtx context.Context
+	e.GET("/api/trace-test/:id", func(c echo.Context) error {
+		c.Set(contextKeyTenantName, "trace-test")
+		handlerCtx = requestContext(c)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error")
+	})
+
+	// 呼び出し元のtraceparentを引き継ぐ
+	parentTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/trace-test/1", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("unexpected spans: %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "GET /api/trace-test/:id" || s.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("unexpected span: name=%s, kind=%s", s.Name(), s.SpanKind())
+	}
+	if s.SpanContext().TraceID().String() != parentTraceID {
+		t.Fatalf("trace id must be propagated: %s", s.SpanContext().TraceID())
+	}
+	if s.Status().Code != codes.Error {
+		t.Fatalf("5xx must be recorded as error: %+v", s.Status())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["http.status_code"].AsInt64() != http.StatusInternalServerError || attrs["isuports.tenant"].AsString() != "trace-test" {
+		t.Fatalf("unexpected attributes: %+v", s.Attributes())
+	}
+
+	// ハンドラのcontextはspanを引き継ぐが、リクエストのキャンセルは伝播させない
+	if trace.SpanContextFromContext(handlerCtx).SpanID() != s.SpanContext().SpanID() {
+		t.Fatalf("handler context must carry the request span")
+	}
+	if handlerCtx.Done() != nil {
+		t.Fatalf("handler context must not be cancelable")
+	}
+}
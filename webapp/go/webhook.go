@@ -0,0 +1,641 @@
+package isuports
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Webhookで通知するイベント
+const (
+	WebhookEventCompetitionCreated  = "competition.created"
+	WebhookEventCompetitionFinished = "competition.finished"
+	WebhookEventScoresUploaded      = "scores.uploaded"
+	WebhookEventPlayerDisqualified  = "player.disqualified"
+
+	WebhookStatusPending   = "pending"
+	WebhookStatusSucceeded = "succeeded"
+	WebhookStatusFailed    = "failed"
+
+	// 最大の試行回数 これを超えたら諦める
+	webhookMaxAttempts = 8
+	// 1回目の再送までの時間 以降は倍々にする
+	webhookBaseBackoff = 10 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// 配送中の行を他のプロセスが拾わないようにする時間
+	webhookLease = time.Minute
+)
+
+var allWebhookEvents = []string{
+	WebhookEventCompetitionCreated,
+	WebhookEventCompetitionFinished,
+	WebhookEventScoresUploaded,
+	WebhookEventPlayerDisqualified,
+}
+
+type WebhookSubscriptionRow struct {
+	ID        int64         `db:"id"`
+	TenantID  int64         `db:"tenant_id"`
+	URL       string        `db:"url"`
+	Secret    string        `db:"secret"`
+	Events    string        `db:"events"` // スペース区切り
+	CreatedAt int64         `db:"created_at"`
+	DeletedAt sql.NullInt64 `db:"deleted_at"`
+}
+
+// 配送待ちのイベント
+// ハンドラでINSERTし、ワーカーが配送する
+type WebhookOutboxRow struct {
+	ID             int64  `db:"id"`
+	SubscriptionID int64  `db:"subscription_id"`
+	TenantID       int64  `db:"tenant_id"`
+	Event          string `db:"event"`
+	Payload        string `db:"payload"`
+	Status         string `db:"status"`
+	Attempts       int64  `db:"attempts"`
+	NextAttemptAt  int64  `db:"next_attempt_at"`
+	CreatedAt      int64  `db:"created_at"`
+	UpdatedAt      int64  `db:"updated_at"`
+}
+
+// 配送を試みた結果のログ
+type WebhookDeliveryLogRow struct {
+	ID             int64  `db:"id"`
+	OutboxID       int64  `db:"outbox_id"`
+	SubscriptionID int64  `db:"subscription_id"`
+	Attempt        int64  `db:"attempt"`
+	StatusCode     int64  `db:"status_code"` // 接続できなかった場合は0
+	Error          string `db:"error"`
+	DurationMS     int64  `db:"duration_ms"`
+	CreatedAt      int64  `db:"created_at"`
+}
+
+// Webhookで送るJSON
+type WebhookPayload struct {
+	Event      string `json:"event"`
+	TenantName string `json:"tenant_name"`
+	CreatedAt  int64  `json:"created_at"`
+	Data       any    `json:"data"`
+}
+
+// Webhookのイベントを配送待ちに積む
+// 購読しているURLがなければ何もしない
+// 呼び出す時点で変更は確定しているので、失敗してもハンドラはエラーを返さずログに出すだけにする
+func emitWebhookEvent(ctx context.Context, v *Viewer, event string, data any) error {
+	subs := []WebhookSubscriptionRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&subs,
+		"SELECT * FROM webhook_subscription WHERE tenant_id = ? AND deleted_at IS NULL",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select webhook_subscription: tenantID=%d, %w", v.tenantID, err)
+	}
+
+	now := time.Now().Unix()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:      event,
+		TenantName: v.tenantName,
+		CreatedAt:  now,
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("error json.Marshal: %w", err)
+	}
+	for _, sub := range subs {
+		if !containsWord(sub.Events, event) {
+			continue
+		}
+		if _, err := adminDB.NamedExecContext(
+			ctx,
+			"INSERT INTO webhook_outbox (subscription_id, tenant_id, event, payload, status, attempts, next_attempt_at, created_at, updated_at) VALUES (:subscription_id, :tenant_id, :event, :payload, :status, :attempts, :next_attempt_at, :created_at, :updated_at)",
+			WebhookOutboxRow{
+				SubscriptionID: sub.ID,
+				TenantID:       v.tenantID,
+				Event:          event,
+				Payload:        string(payload),
+				Status:         WebhookStatusPending,
+				NextAttemptAt:  now,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			},
+		); err != nil {
+			return fmt.Errorf("error Insert webhook_outbox: subscriptionID=%d, event=%s, %w", sub.ID, event, err)
+		}
+	}
+	return nil
+}
+
+// スペース区切りの文字列に含まれているか
+func containsWord(words, word string) bool {
+	for _, w := range strings.Fields(words) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// 署名は "{timestamp}.{body}" のHMAC-SHA256
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// n回目の失敗の後、次に送るまでの時間
+func webhookBackoff(attempts int64) time.Duration {
+	d := webhookBaseBackoff
+	for i := int64(1); i < attempts; i++ {
+		d *= 2
+		if d >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return d
+}
+
+type webhookWorker struct {
+	client   *http.Client
+	interval time.Duration
+	batch    int
+	logger   echo.Logger
+}
+
+// 送信先にしてよいアドレスかを判定する関数
+// テストではhttptestのサーバー(ループバックアドレス)に送れるよう差し替える
+var webhookAddressAllowed = isPublicIP
+
+// 送信先にしてよいIPアドレスか
+// SaaSの内部のサーバーやクラウドのメタデータサーバーにリクエストを送らせないよう、グローバルなアドレスのみ許可する
+func isPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	// キャリアグレードNAT 100.64.0.0/10
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return false
+	}
+	return true
+}
+
+// Webhookの送信先のホストを名前解決し、全てのアドレスがグローバルか確かめる
+func validateWebhookHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !webhookAddressAllowed(ip) {
+			return fmt.Errorf("non-public address: %s", host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("error LookupIPAddr: host=%s, %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !webhookAddressAllowed(addr.IP) {
+			return fmt.Errorf("non-public address: host=%s, addr=%s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// Webhookの配送に使うHTTPクライアント
+// 登録後に名前解決の結果を変えられても(DNS rebinding)内部に送らないよう、接続する直前のアドレスでも確かめる
+// プロキシを経由すると接続先を確かめられないので使わない
+func newWebhookHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookAddressAllowed(net.ParseIP(host)) {
+				return fmt.Errorf("webhook destination is not a public address: %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+// 配送にclientを使うワーカーを作る
+func newWebhookWorker(client *http.Client, logger echo.Logger) *webhookWorker {
+	return &webhookWorker{
+		client:   client,
+		interval: time.Second,
+		batch:    20,
+		logger:   logger,
+	}
+}
+
+// Webhookの配送ワーカーを起動する
+// ctxがキャンセルされると止まる
+func startWebhookWorker(ctx context.Context, logger echo.Logger) <-chan struct{} {
+	w := newWebhookWorker(newWebhookHTTPClient(), logger)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					w.logger.Errorf("error webhook worker: %s", err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// 送信時刻になったイベントをまとめて配送する
+func (w *webhookWorker) run(ctx context.Context) error {
+	now := time.Now().Unix()
+	rows := []WebhookOutboxRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&rows,
+		"SELECT * FROM webhook_outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+		WebhookStatusPending, now, w.batch,
+	); err != nil {
+		return fmt.Errorf("error Select webhook_outbox: %w", err)
+	}
+	for _, row := range rows {
+		// 複数のプロセスで同じ行を配送しないよう、next_attempt_atを先に進めて確保する
+		res, err := adminDB.ExecContext(
+			ctx,
+			"UPDATE webhook_outbox SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?",
+			now+int64(webhookLease.Seconds()), row.ID, WebhookStatusPending, row.NextAttemptAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error Update webhook_outbox: id=%d, %w", row.ID, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("error RowsAffected: %w", err)
+		} else if n == 0 {
+			continue
+		}
+		if err := w.deliver(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 1件配送して結果を記録する
+func (w *webhookWorker) deliver(ctx context.Context, row WebhookOutboxRow) error {
+	var sub WebhookSubscriptionRow
+	if err := adminDB.GetContext(ctx, &sub, "SELECT * FROM webhook_subscription WHERE id = ?", row.SubscriptionID); err != nil {
+		return fmt.Errorf("error Select webhook_subscription: id=%d, %w", row.SubscriptionID, err)
+	}
+
+	attempt := row.Attempts + 1
+	start := time.Now()
+	statusCode, sendErr := w.send(ctx, sub, row)
+	if errors.Is(sendErr, context.Canceled) {
+		// 停止中なのでリースが切れたら再送される
+		return sendErr
+	}
+	log := WebhookDeliveryLogRow{
+		OutboxID:       row.ID,
+		SubscriptionID: sub.ID,
+		Attempt:        attempt,
+		StatusCode:     int64(statusCode),
+		DurationMS:     time.Since(start).Milliseconds(),
+		CreatedAt:      time.Now().Unix(),
+	}
+	if sendErr != nil {
+		log.Error = sendErr.Error()
+	}
+	if _, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO webhook_delivery_log (outbox_id, subscription_id, attempt, status_code, error, duration_ms, created_at) VALUES (:outbox_id, :subscription_id, :attempt, :status_code, :error, :duration_ms, :created_at)",
+		log,
+	); err != nil {
+		return fmt.Errorf("error Insert webhook_delivery_log: outboxID=%d, %w", row.ID, err)
+	}
+
+	now := time.Now()
+	status := WebhookStatusPending
+	nextAttemptAt := now.Add(webhookBackoff(attempt)).Unix()
+	switch {
+	case sendErr == nil:
+		status = WebhookStatusSucceeded
+	case sub.DeletedAt.Valid || attempt >= webhookMaxAttempts:
+		status = WebhookStatusFailed
+	}
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE webhook_outbox SET status = ?, attempts = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+		status, attempt, nextAttemptAt, now.Unix(), row.ID,
+	); err != nil {
+		return fmt.Errorf("error Update webhook_outbox: id=%d, status=%s, %w", row.ID, status, err)
+	}
+	return nil
+}
+
+// 2xx以外はエラーとする
+func (w *webhookWorker) send(ctx context.Context, sub WebhookSubscriptionRow, row WebhookOutboxRow) (int, error) {
+	if sub.DeletedAt.Valid {
+		return 0, errors.New("webhook subscription is deleted")
+	}
+	body := []byte(row.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error http.NewRequest: %w", err)
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "isuports-webhook")
+	req.Header.Set("X-Isuports-Event", row.Event)
+	req.Header.Set("X-Isuports-Delivery", strconv.FormatInt(row.ID, 10))
+	req.Header.Set("X-Isuports-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Isuports-Signature", signWebhookPayload(sub.Secret, timestamp, body))
+	res, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+type WebhookDetail struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+type WebhooksAddHandlerResult struct {
+	Webhook WebhookDetail `json:"webhook"`
+	Secret  string        `json:"secret"` // 作成時にのみ返す
+}
+
+type WebhooksHandlerResult struct {
+	Webhooks []WebhookDetail `json:"webhooks"`
+}
+
+type WebhookDeliveryDetail struct {
+	ID         string `json:"id"`
+	Event      string `json:"event"`
+	Status     string `json:"status"`
+	Attempts   int64  `json:"attempts"`
+	StatusCode int64  `json:"status_code"`
+	Error      string `json:"error"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+type WebhookDeliveriesHandlerResult struct {
+	Deliveries []WebhookDeliveryDetail `json:"deliveries"`
+}
+
+func webhookDetail(sub WebhookSubscriptionRow) WebhookDetail {
+	return WebhookDetail{
+		ID:        strconv.FormatInt(sub.ID, 10),
+		URL:       sub.URL,
+		Events:    strings.Fields(sub.Events),
+		CreatedAt: sub.CreatedAt,
+	}
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/webhooks/add
+// Webhookの送信先を追加する
+func webhooksAddHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeWebhooksWrite, PermissionManageWebhooks); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(c.FormValue("url"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid url: %s", c.FormValue("url")))
+	}
+	if err := validateWebhookHost(ctx, u.Hostname()); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid url: %s", err))
+	}
+	params, err := c.FormParams()
+	if err != nil {
+		return fmt.Errorf("error c.FormParams: %w", err)
+	}
+	eventSet := map[string]struct{}{}
+	for _, ev := range params["events[]"] {
+		if !containsWord(strings.Join(allWebhookEvents, " "), ev) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid event: %s", ev))
+		}
+		eventSet[ev] = struct{}{}
+	}
+	if len(eventSet) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "events[] required")
+	}
+	events := make([]string, 0, len(eventSet))
+	for ev := range eventSet {
+		events = append(events, ev)
+	}
+	sort.Strings(events)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("error rand.Read: %w", err)
+	}
+	sub := WebhookSubscriptionRow{
+		TenantID:  v.tenantID,
+		URL:       u.String(),
+		Secret:    hex.EncodeToString(b),
+		Events:    strings.Join(events, " "),
+		CreatedAt: time.Now().Unix(),
+	}
+	res, err := adminDB.NamedExecContext(
+		ctx,
+		"INSERT INTO webhook_subscription (tenant_id, url, secret, events, created_at, deleted_at) VALUES (:tenant_id, :url, :secret, :events, :created_at, :deleted_at)",
+		sub,
+	)
+	if err != nil {
+		return fmt.Errorf("error Insert webhook_subscription: tenantID=%d, url=%s, %w", v.tenantID, sub.URL, err)
+	}
+	if sub.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("error get LastInsertId: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data: WebhooksAddHandlerResult{
+			Webhook: webhookDetail(sub),
+			Secret:  sub.Secret,
+		},
+	})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/webhooks
+// Webhookの送信先の一覧を返す
+func webhooksHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeWebhooksWrite, PermissionManageWebhooks); err != nil {
+		return err
+	}
+
+	subs := []WebhookSubscriptionRow{}
+	if err := adminDB.SelectContext(
+		ctx,
+		&subs,
+		"SELECT * FROM webhook_subscription WHERE tenant_id = ? AND deleted_at IS NULL ORDER BY id",
+		v.tenantID,
+	); err != nil {
+		return fmt.Errorf("error Select webhook_subscription: tenantID=%d, %w", v.tenantID, err)
+	}
+	ds := make([]WebhookDetail, 0, len(subs))
+	for _, sub := range subs {
+		ds = append(ds, webhookDetail(sub))
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   WebhooksHandlerResult{Webhooks: ds},
+	})
+}
+
+// テナントのWebhookの送信先を取得する
+func retrieveWebhookSubscription(c echo.Context, v *Viewer) (*WebhookSubscriptionRow, error) {
+	id, err := strconv.ParseInt(c.Param("webhook_id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid webhook_id")
+	}
+	var sub WebhookSubscriptionRow
+	if err := adminDB.GetContext(
+		requestContext(c),
+		&sub,
+		"SELECT * FROM webhook_subscription WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL",
+		id, v.tenantID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "webhook not found")
+		}
+		return nil, fmt.Errorf("error Select webhook_subscription: id=%d, %w", id, err)
+	}
+	return &sub, nil
+}
+
+// テナント管理者向けAPI
+// POST /api/organizer/webhook/:webhook_id/delete
+// Webhookの送信先を削除する 配送待ちのイベントは送られない
+func webhookDeleteHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeWebhooksWrite, PermissionManageWebhooks); err != nil {
+		return err
+	}
+	sub, err := retrieveWebhookSubscription(c, v)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	if _, err := adminDB.ExecContext(
+		ctx,
+		"UPDATE webhook_subscription SET deleted_at = ? WHERE id = ?",
+		now, sub.ID,
+	); err != nil {
+		return fmt.Errorf("error Update webhook_subscription: id=%d, deletedAt=%d, %w", sub.ID, now, err)
+	}
+	return c.JSON(http.StatusOK, SuccessResult{Status: true})
+}
+
+// テナント管理者向けAPI
+// GET /api/organizer/webhook/:webhook_id/deliveries
+// Webhookの配送状況を新しい順に返す
+func webhookDeliveriesHandler(c echo.Context) error {
+	ctx := requestContext(c)
+	v, err := parseViewer(c)
+	if err != nil {
+		return fmt.Errorf("error parseViewer: %w", err)
+	}
+	if err := authorizeOrganizer(v, ScopeWebhooksWrite, PermissionManageWebhooks); err != nil {
+		return err
+	}
+	sub, err := retrieveWebhookSubscription(c, v)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		WebhookOutboxRow
+		StatusCode sql.NullInt64  `db:"status_code"`
+		Error      sql.NullString `db:"error"`
+	}
+	rows := []row{}
+	// 最後に試行した結果をあわせて返す
+	if err := adminDB.SelectContext(
+		ctx,
+		&rows,
+		`SELECT o.*, l.status_code, l.error FROM webhook_outbox o
+		LEFT JOIN webhook_delivery_log l ON l.outbox_id = o.id AND l.attempt = o.attempts
+		WHERE o.subscription_id = ? ORDER BY o.id DESC LIMIT 100`,
+		sub.ID,
+	); err != nil {
+		return fmt.Errorf("error Select webhook_outbox: subscriptionID=%d, %w", sub.ID, err)
+	}
+	ds := make([]WebhookDeliveryDetail, 0, len(rows))
+	for _, r := range rows {
+		ds = append(ds, WebhookDeliveryDetail{
+			ID:         strconv.FormatInt(r.ID, 10),
+			Event:      r.Event,
+			Status:     r.Status,
+			Attempts:   r.Attempts,
+			StatusCode: r.StatusCode.Int64,
+			Error:      r.Error.String,
+			CreatedAt:  r.CreatedAt,
+			UpdatedAt:  r.UpdatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, SuccessResult{
+		Status: true,
+		Data:   WebhookDeliveriesHandlerResult{Deliveries: ds},
+	})
+}
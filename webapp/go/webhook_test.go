@@ -0,0 +1,225 @@
+package isuports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucon12-qualify/webapp/go/client"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+
+	_, err := org.WebhooksAdd(ctx, &client.WebhooksAddParams{URL: "ftp://example.com/hook", Events: []string{WebhookEventCompetitionFinished}})
+	assertStatus(t, err, http.StatusBadRequest)
+
+	// 内部のアドレスには送らせない
+	for _, u := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://10.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		_, err := org.WebhooksAdd(ctx, &client.WebhooksAddParams{URL: u, Events: []string{WebhookEventCompetitionFinished}})
+		assertStatus(t, err, http.StatusBadRequest)
+	}
+
+	added, err := org.WebhooksAdd(ctx, &client.WebhooksAddParams{URL: "https://203.0.113.1/hook", Events: []string{WebhookEventCompetitionFinished}})
+	if err != nil {
+		t.Fatalf("error WebhooksAdd: %s", err)
+	}
+	if added.Secret == "" {
+		t.Fatalf("secret is empty")
+	}
+	webhooks, err := org.Webhooks(ctx)
+	if err != nil {
+		t.Fatalf("error Webhooks: %s", err)
+	}
+	if len(webhooks.Webhooks) != 1 || webhooks.Webhooks[0].ID != added.Webhook.ID {
+		t.Fatalf("unexpected webhooks: %+v", webhooks.Webhooks)
+	}
+
+	webhookID, err := strconv.ParseInt(added.Webhook.ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	// 配送は TestWebhookDelivery で確かめるので、ここでは一覧が取れることだけ確かめる
+	if _, err := org.WebhookDeliveries(ctx, &client.WebhookDeliveriesParams{WebhookID: webhookID}); err != nil {
+		t.Fatalf("error WebhookDeliveries: %s", err)
+	}
+	if err := org.WebhookDelete(ctx, &client.WebhookDeleteParams{WebhookID: webhookID}); err != nil {
+		t.Fatalf("error WebhookDelete: %s", err)
+	}
+	err = org.WebhookDelete(ctx, &client.WebhookDeleteParams{WebhookID: webhookID})
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+	// httptestのサーバーはループバックアドレスなので、送信先の制限を外す
+	webhookAddressAllowed = func(net.IP) bool { return true }
+	defer func() { webhookAddressAllowed = isPublicIP }()
+
+	type receivedRequest struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	received := []receivedRequest{}
+	var status int32 = http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error io.ReadAll: %s", err)
+		}
+		mu.Lock()
+		received = append(received, receivedRequest{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+	receivedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received)
+	}
+
+	tenantName := newTestTenant(t)
+	org := newOrganizerClient(t, tenantName)
+	added, err := org.WebhooksAdd(ctx, &client.WebhooksAddParams{URL: ts.URL + "/hook", Events: []string{WebhookEventCompetitionFinished}})
+	if err != nil {
+		t.Fatalf("error WebhooksAdd: %s", err)
+	}
+	webhookID, err := strconv.ParseInt(added.Webhook.ID, 10, 64)
+	if err != nil {
+		t.Fatalf("error strconv.ParseInt: %s", err)
+	}
+	competitionID := addTestCompetition(t, tenantName, "webhook")
+	if err := org.CompetitionFinish(ctx, &client.CompetitionFinishParams{CompetitionID: competitionID}); err != nil {
+		t.Fatalf("error CompetitionFinish: %s", err)
+	}
+	retrieveOutbox := func() WebhookOutboxRow {
+		t.Helper()
+		var row WebhookOutboxRow
+		if err := adminDB.GetContext(ctx, &row, "SELECT * FROM webhook_outbox WHERE subscription_id = ?", webhookID); err != nil {
+			t.Fatalf("error Select webhook_outbox: %s", err)
+		}
+		return row
+	}
+
+	// 5xxなら失敗として、間隔を空けて再送する
+	w := newWebhookWorker(newWebhookHTTPClient(), echo.New().Logger)
+	start := time.Now().Unix()
+	if err := w.run(ctx); err != nil {
+		t.Fatalf("error run: %s", err)
+	}
+	row := retrieveOutbox()
+	if row.Status != WebhookStatusPending || row.Attempts != 1 || row.NextAttemptAt < start+int64(webhookBackoff(1).Seconds()) {
+		t.Fatalf("unexpected outbox: %+v", row)
+	}
+	if n := receivedCount(); n != 1 {
+		t.Fatalf("unexpected requests: %d", n)
+	}
+
+	// 受信側はWebhookの作成時に受け取ったsecretで署名を検証できる
+	req := received[0]
+	mac := hmac.New(sha256.New, []byte(added.Secret))
+	mac.Write([]byte(req.header.Get("X-Isuports-Timestamp") + "."))
+	mac.Write(req.body)
+	if got, want := req.header.Get("X-Isuports-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signature mismatch: got=%s, want=%s", got, want)
+	}
+	if req.header.Get("X-Isuports-Event") != WebhookEventCompetitionFinished || !strings.Contains(string(req.body), competitionID) {
+		t.Fatalf("unexpected request: %v, %s", req.header, req.body)
+	}
+
+	// 再送の時刻まではもう一度実行しても送らない
+	if err := w.run(ctx); err != nil {
+		t.Fatalf("error run: %s", err)
+	}
+	if n := receivedCount(); n != 1 {
+		t.Fatalf("must not be sent before next_attempt_at: %d", n)
+	}
+
+	// 再送の時刻になったら送り、2xxなら配送済みにする
+	if _, err := adminDB.ExecContext(ctx, "UPDATE webhook_outbox SET next_attempt_at = ? WHERE id = ?", time.Now().Unix(), row.ID); err != nil {
+		t.Fatalf("error Update webhook_outbox: %s", err)
+	}
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	if err := w.run(ctx); err != nil {
+		t.Fatalf("error run: %s", err)
+	}
+	if row := retrieveOutbox(); row.Status != WebhookStatusSucceeded || row.Attempts != 2 {
+		t.Fatalf("unexpected outbox: %+v", row)
+	}
+	if n := receivedCount(); n != 2 {
+		t.Fatalf("unexpected requests: %d", n)
+	}
+	deliveries, err := org.WebhookDeliveries(ctx, &client.WebhookDeliveriesParams{WebhookID: webhookID})
+	if err != nil {
+		t.Fatalf("error WebhookDeliveries: %s", err)
+	}
+	if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].StatusCode != http.StatusNoContent || deliveries.Deliveries[0].Attempts != 2 {
+		t.Fatalf("unexpected deliveries: %+v", deliveries.Deliveries)
+	}
+}
+
+func TestWebhookHTTPClientRejectsPrivateAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request must not reach a loopback address")
+	}))
+	defer ts.Close()
+
+	// 登録後に名前解決の結果が内部のアドレスに変わった場合も、接続する時点で拒否する
+	res, err := newWebhookHTTPClient().Post(ts.URL, "application/json", nil)
+	if err == nil {
+		res.Body.Close()
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"event":"competition.finished"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1654041600." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := signWebhookPayload("secret", 1654041600, body); got != want {
+		t.Fatalf("signWebhookPayload = %s, want %s", got, want)
+	}
+	// タイムスタンプも署名の対象
+	if signWebhookPayload("secret", 1654041601, body) == want {
+		t.Fatalf("signature must depend on timestamp")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	if got := webhookBackoff(1); got != webhookBaseBackoff {
+		t.Fatalf("webhookBackoff(1) = %s", got)
+	}
+	if got := webhookBackoff(3); got != 4*webhookBaseBackoff {
+		t.Fatalf("webhookBackoff(3) = %s", got)
+	}
+	if got := webhookBackoff(1000); got != webhookMaxBackoff {
+		t.Fatalf("webhookBackoff(1000) = %s", got)
+	}
+	if !containsWord("player.added competition.finished", "competition.finished") || containsWord("player.added", "player") {
+		t.Fatalf("unexpected containsWord")
+	}
+}
@@ -3,6 +3,23 @@ USE `isuports`;
 DROP TABLE IF EXISTS `tenant`;
 DROP TABLE IF EXISTS `id_generator`;
 DROP TABLE IF EXISTS `visit_history`;
+DROP TABLE IF EXISTS `tenant_domain`;
+DROP TABLE IF EXISTS `tenant_rate_limit`;
+DROP TABLE IF EXISTS `tenant_quota`;
+DROP TABLE IF EXISTS `content_version`;
+DROP TABLE IF EXISTS `organizer_api_token`;
+DROP TABLE IF EXISTS `webhook_subscription`;
+DROP TABLE IF EXISTS `webhook_outbox`;
+DROP TABLE IF EXISTS `webhook_delivery_log`;
+DROP TABLE IF EXISTS `invoice`;
+DROP TABLE IF EXISTS `invoice_line`;
+DROP TABLE IF EXISTS `player_search_index`;
+DROP TABLE IF EXISTS `competition_search_index`;
+DROP TABLE IF EXISTS `impersonation_session`;
+DROP TABLE IF EXISTS `impersonation_audit_log`;
+DROP TABLE IF EXISTS `organizer_account`;
+DROP TABLE IF EXISTS `organizer_action_log`;
+DROP TABLE IF EXISTS `player_invite`;
 
 CREATE TABLE `tenant` (
   `id` BIGINT NOT NULL AUTO_INCREMENT,
@@ -29,3 +46,202 @@ CREATE TABLE `visit_history` (
   `updated_at` BIGINT NOT NULL,
   INDEX `tenant_id_idx` (`tenant_id`)
 ) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `tenant_domain` (
+  `domain` VARCHAR(255) NOT NULL,
+  `tenant_id` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`domain`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `tenant_rate_limit` (
+  `tenant_id` BIGINT NOT NULL,
+  `role` VARCHAR(255) NOT NULL,
+  `rate` DOUBLE NOT NULL,
+  `burst` INT NOT NULL,
+  `updated_at` BIGINT NOT NULL,
+  PRIMARY KEY (`tenant_id`, `role`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `tenant_quota` (
+  `tenant_id` BIGINT NOT NULL,
+  `max_players` BIGINT NOT NULL,
+  `max_competitions` BIGINT NOT NULL,
+  `max_csv_rows` BIGINT NOT NULL,
+  `updated_at` BIGINT NOT NULL,
+  PRIMARY KEY (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `content_version` (
+  `tenant_id` BIGINT NOT NULL,
+  `competition_id` VARCHAR(255) NOT NULL,
+  `version` BIGINT NOT NULL,
+  PRIMARY KEY (`tenant_id`, `competition_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `organizer_api_token` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `name` VARCHAR(255) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `revoked_at` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash_idx` (`token_hash`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `webhook_subscription` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(255) NOT NULL,
+  `events` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `deleted_at` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `webhook_outbox` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `subscription_id` BIGINT NOT NULL,
+  `tenant_id` BIGINT NOT NULL,
+  `event` VARCHAR(255) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(16) NOT NULL,
+  `attempts` BIGINT NOT NULL,
+  `next_attempt_at` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `updated_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `status_next_attempt_at_idx` (`status`, `next_attempt_at`),
+  INDEX `subscription_id_idx` (`subscription_id`, `id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `webhook_delivery_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `outbox_id` BIGINT NOT NULL,
+  `subscription_id` BIGINT NOT NULL,
+  `attempt` BIGINT NOT NULL,
+  `status_code` BIGINT NOT NULL,
+  `error` TEXT NOT NULL,
+  `duration_ms` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `outbox_id_attempt_idx` (`outbox_id`, `attempt`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `invoice` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `month` CHAR(7) NOT NULL,
+  `billing_player_yen` BIGINT NOT NULL,
+  `billing_visitor_yen` BIGINT NOT NULL,
+  `billing_yen` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `tenant_id_month` (`tenant_id`, `month`),
+  INDEX `month_idx` (`month`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `invoice_line` (
+  `invoice_id` BIGINT NOT NULL,
+  `line_no` BIGINT NOT NULL,
+  `competition_id` VARCHAR(255) NOT NULL,
+  `competition_title` TEXT NOT NULL,
+  `player_count` BIGINT NOT NULL,
+  `visitor_count` BIGINT NOT NULL,
+  `billing_player_yen` BIGINT NOT NULL,
+  `billing_visitor_yen` BIGINT NOT NULL,
+  `billing_yen` BIGINT NOT NULL,
+  PRIMARY KEY (`invoice_id`, `line_no`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `player_search_index` (
+  `player_id` VARCHAR(255) NOT NULL,
+  `tenant_id` BIGINT NOT NULL,
+  `display_name` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`player_id`),
+  INDEX `tenant_id_idx` (`tenant_id`),
+  INDEX `display_name_idx` (`display_name`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `competition_search_index` (
+  `competition_id` VARCHAR(255) NOT NULL,
+  `tenant_id` BIGINT NOT NULL,
+  `title` TEXT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`competition_id`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `impersonation_session` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `role` VARCHAR(255) NOT NULL,
+  `player_id` VARCHAR(255) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `writable` TINYINT NOT NULL,
+  `reason` TEXT NOT NULL,
+  `created_by` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `expires_at` BIGINT NOT NULL,
+  `revoked_at` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash_idx` (`token_hash`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `impersonation_audit_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `session_id` BIGINT NOT NULL,
+  `method` VARCHAR(16) NOT NULL,
+  `path` TEXT NOT NULL,
+  `allowed` TINYINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `session_id_idx` (`session_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `organizer_account` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `name` VARCHAR(255) NOT NULL,
+  `role` VARCHAR(16) NOT NULL,
+  `permissions` VARCHAR(255) NOT NULL,
+  `created_by` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `updated_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `tenant_id_name_idx` (`tenant_id`, `name`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `organizer_action_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `method` VARCHAR(16) NOT NULL,
+  `path` TEXT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `tenant_id_idx` (`tenant_id`, `id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
+
+CREATE TABLE `player_invite` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `tenant_id` BIGINT NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  `max_uses` BIGINT NOT NULL,
+  `used_count` BIGINT NOT NULL,
+  `expires_at` BIGINT NOT NULL,
+  `created_by` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `revoked_at` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `code_hash_idx` (`code_hash`),
+  INDEX `tenant_id_idx` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARACTER SET=utf8mb4;
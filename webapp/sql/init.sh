@@ -9,13 +9,53 @@ ISUCON_DB_USER=${ISUCON_DB_USER:-isucon}
 ISUCON_DB_PASSWORD=${ISUCON_DB_PASSWORD:-isucon}
 ISUCON_DB_NAME=${ISUCON_DB_NAME:-isuports}
 
-# MySQLを初期化
-mysql -u"$ISUCON_DB_USER" \
+isuports_mysql() {
+	mysql -u"$ISUCON_DB_USER" \
 		-p"$ISUCON_DB_PASSWORD" \
 		--host "$ISUCON_DB_HOST" \
 		--port "$ISUCON_DB_PORT" \
-		"$ISUCON_DB_NAME" < init.sql
+		"$@" "$ISUCON_DB_NAME"
+}
+
+# MySQLを初期化
+isuports_mysql < init.sql
+
+# 10_schema.sqlの後から追加したテーブルを初期データに作成する
+# 適用したマイグレーションの一覧を記録しておき、/initialize のたびには実行しない
+# マイグレーションはどれも IF NOT EXISTS なので、一覧が変わったときは全て適用し直す
+MIGRATIONS=$(ls tenant/[2-9]*.sql 2>/dev/null || true)
+MIGRATED=../../initial_data/.tenant_migrations
+if [ "$MIGRATIONS" != "$(cat "$MIGRATED" 2>/dev/null)" ]; then
+	for db in ../../initial_data/*.db; do
+		for f in $MIGRATIONS; do
+			sqlite3 "$db" < "$f"
+		done
+	done
+	echo "$MIGRATIONS" > "$MIGRATED"
+fi
 
 # SQLiteのデータベースを初期化
 rm -f ../tenant_db/*.db
 cp -r ../../initial_data/*.db ../tenant_db/
+
+# 検索用インデックスに初期データの分がなければ、初期データのテナントDBから作る
+# 一度作れば init.sql で残るので、/initialize のたびには作らない
+# 文字列はSQLiteのエスケープで出力されるので、バックスラッシュをエスケープ文字として扱わないようにする
+INDEXED=$(isuports_mysql -N -e "SELECT EXISTS(SELECT 1 FROM player_search_index WHERE tenant_id <= 100) AND EXISTS(SELECT 1 FROM competition_search_index WHERE tenant_id <= 100)")
+if [ "$INDEXED" != "1" ]; then
+	{
+		echo "SET SESSION sql_mode = CONCAT(@@sql_mode, ',NO_BACKSLASH_ESCAPES');"
+		echo "BEGIN;"
+		echo "DELETE FROM player_search_index WHERE tenant_id <= 100;"
+		echo "DELETE FROM competition_search_index WHERE tenant_id <= 100;"
+		for db in ../tenant_db/*.db; do
+			sqlite3 "$db" \
+				".headers on" \
+				".mode insert player_search_index" \
+				"SELECT id AS player_id, tenant_id, display_name, created_at FROM player;" \
+				".mode insert competition_search_index" \
+				"SELECT id AS competition_id, tenant_id, title, created_at FROM competition;"
+		done
+		echo "COMMIT;"
+	} | isuports_mysql
+fi
@@ -1,4 +1,22 @@
 DELETE FROM tenant WHERE id > 100;
 DELETE FROM visit_history WHERE created_at >= '1654041600';
+DELETE FROM tenant_domain;
+DELETE FROM tenant_rate_limit;
+DELETE FROM tenant_quota;
+DELETE FROM content_version;
+DELETE FROM organizer_api_token;
+DELETE FROM webhook_subscription;
+DELETE FROM webhook_outbox;
+DELETE FROM webhook_delivery_log;
+DELETE FROM invoice;
+DELETE FROM invoice_line;
+-- 検索用インデックスは初期データの分を残す 初期データの分がなければ init.sh で作る
+DELETE FROM player_search_index WHERE tenant_id > 100 OR created_at >= '1654041600';
+DELETE FROM competition_search_index WHERE tenant_id > 100 OR created_at >= '1654041600';
+DELETE FROM impersonation_session;
+DELETE FROM impersonation_audit_log;
+DELETE FROM organizer_account;
+DELETE FROM organizer_action_log;
+DELETE FROM player_invite;
 UPDATE id_generator SET id=2678400000 WHERE stub='a';
 ALTER TABLE id_generator AUTO_INCREMENT=2678400000;
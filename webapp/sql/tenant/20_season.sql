@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS season (
+  id VARCHAR(255) NOT NULL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  title TEXT NOT NULL,
+  mode TEXT NOT NULL,
+  points_table TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS season_competition (
+  season_id VARCHAR(255) NOT NULL,
+  competition_id VARCHAR(255) NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  PRIMARY KEY (season_id, competition_id)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS score_rule (
+  competition_id VARCHAR(255) NOT NULL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  score_order TEXT NOT NULL,
+  score_type TEXT NOT NULL,
+  min_score BIGINT NULL,
+  max_score BIGINT NULL,
+  tie_break TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
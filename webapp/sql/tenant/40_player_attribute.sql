@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS player_attribute_option (
+  tenant_id BIGINT NOT NULL,
+  name TEXT NOT NULL,
+  value TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  PRIMARY KEY (name, value)
+);
+
+CREATE TABLE IF NOT EXISTS player_attribute (
+  player_id VARCHAR(255) NOT NULL,
+  name TEXT NOT NULL,
+  value TEXT NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL,
+  PRIMARY KEY (player_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS player_attribute_name_value_idx ON player_attribute (tenant_id, name, value);
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS team (
+  id VARCHAR(255) NOT NULL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  name TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS team_member (
+  team_id VARCHAR(255) NOT NULL,
+  player_id VARCHAR(255) NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  PRIMARY KEY (team_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_member_player_id_idx ON team_member (player_id);
+
+CREATE TABLE IF NOT EXISTS team_competition (
+  competition_id VARCHAR(255) NOT NULL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  score_mode TEXT NOT NULL,
+  best_n BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS team_score (
+  id VARCHAR(255) NOT NULL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  team_id VARCHAR(255) NOT NULL,
+  competition_id VARCHAR(255) NOT NULL,
+  score BIGINT NOT NULL,
+  row_num BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS team_score_competition_id_idx ON team_score (tenant_id, competition_id, row_num);
+
+-- スコアを登録した時点のチームのメンバー
+-- 後からメンバーを入れ替えても、課金や参加者ごとの成績はこの時点のメンバーで計算する
+CREATE TABLE IF NOT EXISTS team_score_member (
+  competition_id VARCHAR(255) NOT NULL,
+  team_id VARCHAR(255) NOT NULL,
+  player_id VARCHAR(255) NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  created_at BIGINT NOT NULL,
+  PRIMARY KEY (competition_id, team_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_score_member_player_id_idx ON team_score_member (player_id);